@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/tmater/wacht/internal/checks"
+	"github.com/tmater/wacht/internal/config"
+	"github.com/tmater/wacht/internal/network"
+	"github.com/tmater/wacht/internal/proto"
+)
+
+// canaryMonitor is the probe's network self-test. It checks known-good
+// targets so a probe that lost its own uplink reports itself degraded instead
+// of reporting every assigned check down.
+type canaryMonitor struct {
+	canaries []config.ProbeCanary
+	probeID  string
+	run      func(canary config.ProbeCanary) proto.CheckResult
+
+	mu       sync.RWMutex
+	degraded string
+}
+
+func newCanaryMonitor(canaries []config.ProbeCanary, probeID string, policy network.Policy) *canaryMonitor {
+	return &canaryMonitor{
+		canaries: canaries,
+		probeID:  probeID,
+		run: func(canary config.ProbeCanary) proto.CheckResult {
+			return checkRunners[canary.Type]("", probeID, canary.Target, policy, checks.Options{})
+		},
+	}
+}
+
+// Check runs every canary concurrently and returns the new degraded reason.
+// The probe is degraded only when all canaries fail; one unreachable canary
+// says more about that canary than about the probe.
+func (m *canaryMonitor) Check() string {
+	if m == nil || len(m.canaries) == 0 {
+		return ""
+	}
+
+	results := make([]proto.CheckResult, len(m.canaries))
+	var wg sync.WaitGroup
+	for i, canary := range m.canaries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = m.run(canary)
+		}()
+	}
+	wg.Wait()
+
+	degraded := fmt.Sprintf("all %d canaries failed; %s %s: %s", len(m.canaries), m.canaries[0].Type, m.canaries[0].Target, results[0].Error)
+	for _, result := range results {
+		if result.Up {
+			degraded = ""
+			break
+		}
+	}
+
+	m.mu.Lock()
+	previous := m.degraded
+	m.degraded = degraded
+	m.mu.Unlock()
+
+	switch {
+	case degraded != "" && previous == "":
+		slog.Default().Warn("probe degraded", "component", "probe", "probe_id", m.probeID, "reason", degraded)
+	case degraded == "" && previous != "":
+		slog.Default().Info("probe recovered", "component", "probe", "probe_id", m.probeID)
+	}
+	return degraded
+}
+
+// Degraded reports the reason from the latest self-test, or "" while the
+// probe's network is healthy.
+func (m *canaryMonitor) Degraded() string {
+	if m == nil {
+		return ""
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.degraded
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tmater/wacht/internal/config"
+	"github.com/tmater/wacht/internal/network"
+	"github.com/tmater/wacht/internal/proto"
+)
+
+func TestCanaryMonitorDegradesOnlyWhenAllCanariesFail(t *testing.T) {
+	up := map[string]bool{}
+	monitor := &canaryMonitor{
+		canaries: []config.ProbeCanary{
+			{Type: "tcp", Target: "1.1.1.1:53"},
+			{Type: "tcp", Target: "8.8.8.8:53"},
+		},
+		probeID: "probe-1",
+		run: func(canary config.ProbeCanary) proto.CheckResult {
+			if up[canary.Target] {
+				return proto.CheckResult{Up: true}
+			}
+			return proto.CheckResult{Error: "network unreachable"}
+		},
+	}
+
+	up["8.8.8.8:53"] = true
+	if got := monitor.Check(); got != "" {
+		t.Fatalf("Check() = %q, want healthy while one canary is up", got)
+	}
+
+	up["8.8.8.8:53"] = false
+	got := monitor.Check()
+	if !strings.Contains(got, "all 2 canaries failed") || !strings.Contains(got, "network unreachable") {
+		t.Fatalf("Check() = %q, want degraded reason", got)
+	}
+	if monitor.Degraded() != got {
+		t.Fatalf("Degraded() = %q, want %q", monitor.Degraded(), got)
+	}
+
+	up["1.1.1.1:53"] = true
+	if got := monitor.Check(); got != "" || monitor.Degraded() != "" {
+		t.Fatalf("Check() = %q, want recovery once a canary is up", got)
+	}
+}
+
+func TestCanaryMonitorWithoutCanariesIsNeverDegraded(t *testing.T) {
+	var monitor *canaryMonitor
+	if got := monitor.Check(); got != "" {
+		t.Fatalf("nil Check() = %q, want empty", got)
+	}
+	if got := newCanaryMonitor(nil, "probe-1", network.Policy{}).Check(); got != "" {
+		t.Fatalf("Check() = %q, want empty without canaries", got)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/tmater/wacht/internal/proto"
+)
+
+const checkCacheFile = "checks.json"
+
+// cachedCheckSet is the on-disk form of the last check set fetched from the
+// server.
+type cachedCheckSet struct {
+	Revision string             `json:"revision"`
+	Checks   []proto.ProbeCheck `json:"checks"`
+}
+
+// checkCache keeps the last good check set under state_dir so a probe
+// restarted during a server outage can keep running checks. A nil cache, used
+// when no state_dir is configured, stores nothing.
+type checkCache struct {
+	path string
+}
+
+func newCheckCache(stateDir string) *checkCache {
+	if stateDir == "" {
+		return nil
+	}
+	return &checkCache{path: filepath.Join(stateDir, checkCacheFile)}
+}
+
+// Load returns the cached check set and its revision. ok is false when no set
+// has been cached yet.
+func (c *checkCache) Load() (checks []proto.ProbeCheck, revision string, ok bool, err error) {
+	if c == nil {
+		return nil, "", false, nil
+	}
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", false, nil
+	}
+	if err != nil {
+		return nil, "", false, fmt.Errorf("check cache: read: %w", err)
+	}
+	var cached cachedCheckSet
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, "", false, fmt.Errorf("check cache: decode: %w", err)
+	}
+	return cached.Checks, cached.Revision, true, nil
+}
+
+// Save replaces the cached check set atomically so a crash leaves either the
+// old or the new set, never a torn one.
+func (c *checkCache) Save(checks []proto.ProbeCheck, revision string) error {
+	if c == nil {
+		return nil
+	}
+	data, err := json.Marshal(cachedCheckSet{Revision: revision, Checks: checks})
+	if err != nil {
+		return fmt.Errorf("check cache: encode: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return fmt.Errorf("check cache: create dir: %w", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("check cache: write: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("check cache: write: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	probeapi "github.com/tmater/wacht/internal/api/probe"
+)
+
+const (
+	credentialFile = "credential.json"
+	// enrollmentIDFile holds the enrollment ID of an enrollment whose
+	// credential has not been stored yet, so retries reuse it.
+	enrollmentIDFile = "enrollment_id"
+)
+
+// enrollFunc exchanges a join token for a probe credential.
+type enrollFunc func(ctx context.Context, req probeapi.EnrollRequest) (probeapi.EnrollResponse, error)
+
+// credentialStore keeps the credential a probe received at enrollment under
+// state_dir, so it only spends a join token once.
+type credentialStore struct {
+	path             string
+	enrollmentIDPath string
+}
+
+func newCredentialStore(stateDir string) *credentialStore {
+	return &credentialStore{
+		path:             filepath.Join(stateDir, credentialFile),
+		enrollmentIDPath: filepath.Join(stateDir, enrollmentIDFile),
+	}
+}
+
+// Load returns the stored credential. ok is false when the probe has not
+// enrolled yet.
+func (s *credentialStore) Load() (credential probeapi.EnrollResponse, ok bool, err error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return probeapi.EnrollResponse{}, false, nil
+	}
+	if err != nil {
+		return probeapi.EnrollResponse{}, false, fmt.Errorf("credential: read: %w", err)
+	}
+	if err := json.Unmarshal(data, &credential); err != nil {
+		return probeapi.EnrollResponse{}, false, fmt.Errorf("credential: decode: %w", err)
+	}
+	if credential.ProbeID == "" || credential.Secret == "" {
+		return probeapi.EnrollResponse{}, false, fmt.Errorf("credential: %s is incomplete", s.path)
+	}
+	return credential, true, nil
+}
+
+// Save writes the credential atomically, readable only by the probe user.
+func (s *credentialStore) Save(credential probeapi.EnrollResponse) error {
+	data, err := json.Marshal(credential)
+	if err != nil {
+		return fmt.Errorf("credential: encode: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("credential: create dir: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("credential: write: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("credential: write: %w", err)
+	}
+	if err := os.Remove(s.enrollmentIDPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("credential: remove enrollment id: %w", err)
+	}
+	return nil
+}
+
+// EnrollmentID returns the ID of the pending enrollment, generating and
+// storing one first if there is none. The ID is written before the first
+// attempt so a retry, even after a restart, is recognised by the server as
+// the same enrollment. Save removes it.
+func (s *credentialStore) EnrollmentID() (string, error) {
+	data, err := os.ReadFile(s.enrollmentIDPath)
+	if err == nil {
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return id, nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("credential: read enrollment id: %w", err)
+	}
+
+	var raw [16]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		return "", fmt.Errorf("credential: generate enrollment id: %w", err)
+	}
+	id := hex.EncodeToString(raw[:])
+	if err := os.MkdirAll(filepath.Dir(s.enrollmentIDPath), 0o700); err != nil {
+		return "", fmt.Errorf("credential: create dir: %w", err)
+	}
+	tmp := s.enrollmentIDPath + ".tmp"
+	if err := os.WriteFile(tmp, []byte(id+"\n"), 0o600); err != nil {
+		return "", fmt.Errorf("credential: write enrollment id: %w", err)
+	}
+	if err := os.Rename(tmp, s.enrollmentIDPath); err != nil {
+		return "", fmt.Errorf("credential: write enrollment id: %w", err)
+	}
+	return id, nil
+}
+
+// enrollProbe returns the probe's stored credential, or enrolls with
+// joinToken and stores the result. Unreachable servers are retried with
+// backoff under one enrollment ID, so a retry after a lost response gets the
+// probe the first attempt created; a rejected token is returned as an error
+// because retrying cannot fix it.
+func enrollProbe(ctx context.Context, store *credentialStore, enroll enrollFunc, joinToken, probeID string, minDelay, maxDelay time.Duration) (probeapi.EnrollResponse, error) {
+	credential, ok, err := store.Load()
+	if err != nil {
+		return probeapi.EnrollResponse{}, err
+	}
+	if ok {
+		if probeID != "" && credential.ProbeID != probeID {
+			return probeapi.EnrollResponse{}, fmt.Errorf("credential: %s belongs to probe %q, config asks for %q", store.path, credential.ProbeID, probeID)
+		}
+		return credential, nil
+	}
+
+	enrollmentID, err := store.EnrollmentID()
+	if err != nil {
+		return probeapi.EnrollResponse{}, err
+	}
+	delay := minDelay
+	for {
+		credential, err = enroll(ctx, probeapi.EnrollRequest{Token: joinToken, ProbeID: probeID, EnrollmentID: enrollmentID})
+		if err == nil {
+			break
+		}
+		var responseErr *probeapi.ResponseError
+		if errors.As(err, &responseErr) && responseErr.StatusCode < http.StatusInternalServerError && responseErr.StatusCode != http.StatusTooManyRequests {
+			return probeapi.EnrollResponse{}, fmt.Errorf("enroll: %w", err)
+		}
+		slog.Default().Warn("enroll probe failed; retrying", "component", "probe", "probe_id", probeID, "retry_in", delay, "err", err)
+		select {
+		case <-ctx.Done():
+			return probeapi.EnrollResponse{}, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxDelay)
+	}
+
+	if err := store.Save(credential); err != nil {
+		return probeapi.EnrollResponse{}, err
+	}
+	slog.Default().Info("probe enrolled", "component", "probe", "probe_id", credential.ProbeID)
+	return credential, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	probeapi "github.com/tmater/wacht/internal/api/probe"
+)
+
+func TestEnrollProbeStoresCredentialAndReusesIt(t *testing.T) {
+	store := newCredentialStore(t.TempDir())
+	calls := 0
+	var enrollmentIDs []string
+	enroll := func(_ context.Context, req probeapi.EnrollRequest) (probeapi.EnrollResponse, error) {
+		calls++
+		if req.Token != "join-1" {
+			t.Fatalf("token = %q, want join-1", req.Token)
+		}
+		enrollmentIDs = append(enrollmentIDs, req.EnrollmentID)
+		if calls == 1 {
+			return probeapi.EnrollResponse{}, errServerDown
+		}
+		return probeapi.EnrollResponse{ProbeID: "probe-abc", Secret: "secret-1"}, nil
+	}
+
+	credential, err := enrollProbe(context.Background(), store, enroll, "join-1", "", time.Millisecond, time.Millisecond)
+	if err != nil {
+		t.Fatalf("enrollProbe() error = %v", err)
+	}
+	if credential.ProbeID != "probe-abc" || calls != 2 {
+		t.Fatalf("credential = %+v after %d calls, want probe-abc after a retry", credential, calls)
+	}
+	if enrollmentIDs[0] == "" || enrollmentIDs[1] != enrollmentIDs[0] {
+		t.Fatalf("enrollment ids = %q, want one non-empty id reused on retry", enrollmentIDs)
+	}
+	if _, err := os.Stat(store.enrollmentIDPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("enrollment id file stat error = %v, want removed once the credential is stored", err)
+	}
+
+	again, err := enrollProbe(context.Background(), store, enroll, "join-1", "", time.Millisecond, time.Millisecond)
+	if err != nil {
+		t.Fatalf("enrollProbe() again error = %v", err)
+	}
+	if again != credential || calls != 2 {
+		t.Fatalf("credential = %+v after %d calls, want stored credential without enrolling", again, calls)
+	}
+}
+
+func TestEnrollProbeReusesEnrollmentIDAcrossRestarts(t *testing.T) {
+	stateDir := t.TempDir()
+	var enrollmentIDs []string
+	enroll := func(_ context.Context, req probeapi.EnrollRequest) (probeapi.EnrollResponse, error) {
+		enrollmentIDs = append(enrollmentIDs, req.EnrollmentID)
+		if len(enrollmentIDs) == 1 {
+			return probeapi.EnrollResponse{}, &probeapi.ResponseError{StatusCode: http.StatusUnauthorized, Status: "401 Unauthorized"}
+		}
+		return probeapi.EnrollResponse{ProbeID: "probe-abc", Secret: "secret-1"}, nil
+	}
+
+	if _, err := enrollProbe(context.Background(), newCredentialStore(stateDir), enroll, "join-1", "", time.Millisecond, time.Millisecond); err == nil {
+		t.Fatal("enrollProbe() error = nil, want rejected token")
+	}
+	if _, err := enrollProbe(context.Background(), newCredentialStore(stateDir), enroll, "join-1", "", time.Millisecond, time.Millisecond); err != nil {
+		t.Fatalf("enrollProbe() after restart error = %v", err)
+	}
+	if len(enrollmentIDs) != 2 || enrollmentIDs[1] != enrollmentIDs[0] {
+		t.Fatalf("enrollment ids = %q, want the pending id reused after restart", enrollmentIDs)
+	}
+}
+
+func TestEnrollProbeStopsOnRejectedToken(t *testing.T) {
+	calls := 0
+	enroll := func(context.Context, probeapi.EnrollRequest) (probeapi.EnrollResponse, error) {
+		calls++
+		return probeapi.EnrollResponse{}, &probeapi.ResponseError{StatusCode: http.StatusUnauthorized, Status: "401 Unauthorized"}
+	}
+
+	if _, err := enrollProbe(context.Background(), newCredentialStore(t.TempDir()), enroll, "spent", "", time.Millisecond, time.Millisecond); err == nil {
+		t.Fatal("enrollProbe() error = nil, want rejected token")
+	}
+	if calls != 1 {
+		t.Fatalf("calls = %d, want no retry for a rejected token", calls)
+	}
+}
+
+func TestEnrollProbeRejectsCredentialForAnotherProbe(t *testing.T) {
+	store := newCredentialStore(t.TempDir())
+	if err := store.Save(probeapi.EnrollResponse{ProbeID: "probe-1", Secret: "secret-1"}); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	enroll := func(context.Context, probeapi.EnrollRequest) (probeapi.EnrollResponse, error) {
+		t.Fatal("unexpected enrollment")
+		return probeapi.EnrollResponse{}, nil
+	}
+
+	if _, err := enrollProbe(context.Background(), store, enroll, "join-1", "probe-2", time.Millisecond, time.Millisecond); err == nil {
+		t.Fatal("enrollProbe() error = nil, want probe id mismatch")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"flag"
 	"log/slog"
 	"os"
+	"path/filepath"
 	"time"
 
 	probeapi "github.com/tmater/wacht/internal/api/probe"
@@ -14,7 +15,18 @@ import (
 	"github.com/tmater/wacht/internal/proto"
 )
 
+// checkWatchWait is how long each check-sync long-poll waits for a change.
+const checkWatchWait = 30 * time.Second
+
+// version is the probe build version, set at build time with
+// -ldflags "-X main.version=v1.2.3".
+var version = "dev"
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		os.Exit(runCommand(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	logger := logx.Configure("wacht-probe")
 	configPath := flag.String("config", "probe.yaml", "path to probe config file")
 	serverOverride := flag.String("server", "", "override server URL from config")
@@ -34,61 +46,92 @@ func main() {
 		cfg.Server = *serverOverride
 	}
 
-	logger.Info("probe starting", "probe_id", cfg.ProbeID, "server", cfg.Server, "config_path", *configPath)
-
-	apiClient := probeapi.NewClient(cfg.Server, cfg.ProbeID, cfg.Secret, nil)
-
-	if err := apiClient.Register(context.Background(), "dev"); err != nil {
-		fatal("register probe failed", "probe_id", cfg.ProbeID, "err", err)
+	if cfg.Secret == "" {
+		// Exchange the join token once; later starts reuse the stored
+		// credential and authenticate like any provisioned probe.
+		enroll := func(ctx context.Context, req probeapi.EnrollRequest) (probeapi.EnrollResponse, error) {
+			return probeapi.Enroll(ctx, cfg.Server, nil, req)
+		}
+		credential, err := enrollProbe(context.Background(), newCredentialStore(cfg.StateDir), enroll, cfg.JoinToken, cfg.ProbeID, registerRetryMin, registerRetryMax)
+		if err != nil {
+			fatal("enroll probe failed", "server", cfg.Server, "state_dir", cfg.StateDir, "err", err)
+		}
+		cfg.ProbeID, cfg.Secret = credential.ProbeID, credential.Secret
 	}
-	logger.Info("probe registered", "probe_id", cfg.ProbeID)
 
-	checkList, err := apiClient.FetchChecks(context.Background())
-	if err != nil {
-		fatal("fetch checks failed", "probe_id", cfg.ProbeID, "err", err)
+	logger.Info("probe starting", "probe_id", cfg.ProbeID, "server", cfg.Server, "config_path", *configPath, "labels", cfg.Labels, "version", version)
+
+	apiClient := probeapi.NewClient(cfg.Server, cfg.ProbeID, cfg.Secret, nil)
+	if cfg.AuthScheme == config.ProbeAuthSigned {
+		apiClient.EnableSigning()
 	}
-	logger.Info("checks fetched", "probe_id", cfg.ProbeID, "count", len(checkList))
 
 	policy := network.Policy{AllowPrivateTargets: cfg.AllowPrivateTargets}
-	resultBatcher := newResultBatcher(apiClient, cfg.ResultFlushInterval, defaultResultBatchMaxSize)
+	var spool *resultSpool
+	if cfg.Spool.Enabled {
+		spool, err = openResultSpool(filepath.Join(cfg.StateDir, "spool"), cfg.Spool.MaxBytes, cfg.Spool.Fsync)
+		if err != nil {
+			fatal("open result spool failed", "state_dir", cfg.StateDir, "err", err)
+		}
+	}
+	resultBatcher := newResultBatcher(apiClient, cfg.ResultFlushInterval, defaultResultBatchMaxSize, spool, newResultSeqStore(cfg.StateDir))
 	defer resultBatcher.Close()
 
-	scheduler := newScheduler(cfg, policy, resultBatcher)
+	canaries := newCanaryMonitor(cfg.Canaries, cfg.ProbeID, policy)
+	scheduler := newScheduler(cfg, policy, resultBatcher, canaries, newPathTracer(cfg.Traceroute, policy))
 	defer scheduler.Close()
-	scheduler.Reconcile(checkList)
 
-	// TODO: Split heartbeat and check-sync into separate config intervals if the
-	// probe needs different liveness and config propagation cadences.
-	go heartbeatLoop(apiClient, cfg.ProbeID, cfg.HeartbeatInterval)
-	checkSyncLoop(apiClient, cfg.ProbeID, cfg.HeartbeatInterval, scheduler.Reconcile)
+	// Start from the cached check set if the server is unreachable, so a probe
+	// restarted during an outage keeps checking and spooling results.
+	cache := newCheckCache(cfg.StateDir)
+	register := probeapi.RegisterRequest{
+		Version:    version,
+		CheckTypes: supportedCheckTypes(),
+		Labels:     cfg.Labels,
+	}
+	revision := startProbe(context.Background(), apiClient, cfg.ProbeID, register, cache, scheduler.Reconcile)
+
+	go heartbeatLoop(apiClient, cfg.ProbeID, cfg.HeartbeatInterval, canaries)
+	go runNowLoop(apiClient, cfg.ProbeID, cfg.HeartbeatInterval, scheduler.RunNow)
+	checkSyncLoop(apiClient, cfg.ProbeID, revision, cfg.HeartbeatInterval, checkSetApplier(cache, cfg.ProbeID, scheduler.Reconcile))
 }
 
-// heartbeatLoop only reports probe liveness
-func heartbeatLoop(apiClient *probeapi.Client, probeID string, interval time.Duration) {
+// heartbeatLoop reports probe liveness along with the result of the network
+// self-test run just before each heartbeat.
+func heartbeatLoop(apiClient *probeapi.Client, probeID string, interval time.Duration, canaries *canaryMonitor) {
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for range ticker.C {
-		if err := apiClient.Heartbeat(context.Background()); err != nil {
+		req := probeapi.HeartbeatRequest{Degraded: canaries.Check()}
+		if err := apiClient.Heartbeat(context.Background(), req); err != nil {
 			slog.Default().Warn("probe heartbeat failed", "component", "probe", "probe_id", probeID, "err", err)
 			continue
 		}
 	}
 }
 
-// checkSyncLoop polls the server for the current check set and hands the
-// result to the scheduler
-func checkSyncLoop(apiClient *probeapi.Client, probeID string, interval time.Duration, onChecks func([]proto.ProbeCheck)) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		updated, err := apiClient.FetchChecks(context.Background())
+// checkSyncLoop long-polls the server for check-set revisions after revision
+// and hands each changed set to the scheduler. Failed polls are retried after
+// retryInterval.
+func checkSyncLoop(apiClient probeAPI, probeID, revision string, retryInterval time.Duration, onChecks func([]proto.ProbeCheck, string)) {
+	for {
+		updated, next, changed, err := apiClient.WatchChecks(context.Background(), revision, checkWatchWait)
 		if err != nil {
 			slog.Default().Warn("check sync failed", "component", "probe", "probe_id", probeID, "err", err)
+			time.Sleep(retryInterval)
 			continue
 		}
-		slog.Default().Debug("checks refreshed", "component", "probe", "probe_id", probeID, "count", len(updated))
-		onChecks(updated)
+		if !changed {
+			continue
+		}
+		revision = next
+		slog.Default().Debug("checks refreshed", "component", "probe", "probe_id", probeID, "count", len(updated), "revision", revision)
+		onChecks(updated, revision)
+		if revision == "" {
+			// Without a revision the server cannot hold the poll open, so fall
+			// back to polling at the retry interval.
+			time.Sleep(retryInterval)
+		}
 	}
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"log/slog"
+	"slices"
 	"sync"
 	"time"
 
@@ -20,23 +21,42 @@ type resultPoster interface {
 }
 
 // resultBatcher accumulates probe results and flushes them to the server on a
-// cadence or when the pending batch grows large enough.
+// cadence or when the pending batch grows large enough. With a spool, results
+// that would otherwise be dropped (memory overflow, failed uploads, shutdown)
+// go to disk instead and are drained oldest first before newer memory results.
 type resultBatcher struct {
 	client        resultPoster
 	flushInterval time.Duration
 	maxBatchSize  int
 	maxPending    int
+	spool         *resultSpool
+	seqs          *resultSeqStore
 
 	mu      sync.Mutex
 	pending []proto.CheckResult
 	closed  bool
+	// lastSeq starts above both the clock and the stored high-water mark so
+	// sequences keep increasing across restarts, including for results still
+	// waiting in the spool. reservedSeq is the mark last written to seqs;
+	// the next block is written in the background before it runs out.
+	lastSeq        int64
+	reservedSeq    int64
+	reserving      bool
+	reserveRetryAt time.Time
+	// inflight is the memory batch being uploaded. Overflow that reaches the
+	// spool during the upload spools inflight first so the spool stays in seq
+	// order; settledSeq then lets the drain skip the copy if the upload
+	// completed after all.
+	inflight        []proto.CheckResult
+	inflightSpooled bool
+	settledSeq      int64
 
 	wakeFlush chan struct{}
 	stop      chan struct{}
 	done      chan struct{}
 }
 
-func newResultBatcher(client resultPoster, flushInterval time.Duration, maxBatchSize int) *resultBatcher {
+func newResultBatcher(client resultPoster, flushInterval time.Duration, maxBatchSize int, spool *resultSpool, seqs *resultSeqStore) *resultBatcher {
 	if flushInterval <= 0 {
 		flushInterval = config.DefaultProbeResultFlushInterval
 	}
@@ -48,15 +68,30 @@ func newResultBatcher(client resultPoster, flushInterval time.Duration, maxBatch
 		maxPending = maxBatchSize
 	}
 
+	lastSeq := time.Now().UnixNano()
+	if stored, err := seqs.Load(); err != nil {
+		slog.Default().Warn("reading result sequence failed; seeding from the clock", "component", "probe", "err", err)
+	} else {
+		lastSeq = max(lastSeq, stored)
+	}
+
 	b := &resultBatcher{
 		client:        client,
 		flushInterval: flushInterval,
 		maxBatchSize:  maxBatchSize,
 		maxPending:    maxPending,
+		spool:         spool,
+		seqs:          seqs,
+		lastSeq:       lastSeq,
+		reservedSeq:   lastSeq,
 		wakeFlush:     make(chan struct{}, 1),
 		stop:          make(chan struct{}),
 		done:          make(chan struct{}),
 	}
+	if seqs != nil {
+		b.reserving = true
+		b.reserveSeqs()
+	}
 	go b.loop()
 	return b
 }
@@ -68,6 +103,7 @@ func (b *resultBatcher) Enqueue(result proto.CheckResult) {
 		return
 	}
 
+	result.Seq = b.nextSeqLocked()
 	b.pending = append(b.pending, result)
 	dropped := b.trimPendingLocked()
 	if len(b.pending) >= b.maxBatchSize {
@@ -80,6 +116,47 @@ func (b *resultBatcher) Enqueue(result proto.CheckResult) {
 	}
 }
 
+// nextSeqLocked hands out the next sequence number. With a seq store it only
+// hands out numbers covered by a saved reservation and starts reserving the
+// next block once half of the current one is used. When nothing is reserved,
+// because the store cannot be written, results go out unsequenced rather
+// than with numbers a restarted probe could repeat.
+func (b *resultBatcher) nextSeqLocked() int64 {
+	if b.seqs == nil {
+		b.lastSeq++
+		return b.lastSeq
+	}
+	if !b.reserving && b.reservedSeq-b.lastSeq < resultSeqReserve/2 && !time.Now().Before(b.reserveRetryAt) {
+		b.reserving = true
+		go b.reserveSeqs()
+	}
+	if b.lastSeq >= b.reservedSeq {
+		return 0
+	}
+	b.lastSeq++
+	return b.lastSeq
+}
+
+// reserveSeqs writes the next block of sequence numbers to the seq store
+// without holding b.mu, so a slow disk does not stall result submission.
+func (b *resultBatcher) reserveSeqs() {
+	b.mu.Lock()
+	target := max(b.lastSeq, b.reservedSeq) + resultSeqReserve
+	b.mu.Unlock()
+
+	err := b.seqs.Save(target)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reserving = false
+	if err != nil {
+		b.reserveRetryAt = time.Now().Add(resultSeqRetryDelay)
+		slog.Default().Warn("persisting result sequence failed; sending results unsequenced until it succeeds", "component", "probe", "err", err)
+		return
+	}
+	b.reservedSeq = max(b.reservedSeq, target)
+}
+
 func (b *resultBatcher) Close() {
 	b.mu.Lock()
 	if b.closed {
@@ -92,6 +169,11 @@ func (b *resultBatcher) Close() {
 	b.mu.Unlock()
 
 	<-b.done
+	if b.spool != nil {
+		if err := b.spool.Close(); err != nil {
+			slog.Default().Warn("closing result spool failed", "component", "probe", "err", err)
+		}
+	}
 }
 
 func (b *resultBatcher) loop() {
@@ -102,6 +184,7 @@ func (b *resultBatcher) loop() {
 	for {
 		select {
 		case <-ticker.C:
+			b.syncSpool()
 			b.flushOne()
 		case <-b.wakeFlush:
 			b.flushOne()
@@ -119,12 +202,31 @@ func (b *resultBatcher) flushPendingForShutdown() {
 			break
 		}
 	}
+	if b.spool != nil {
+		b.mu.Lock()
+		pending := b.pending
+		b.pending = nil
+		b.mu.Unlock()
+		if len(pending) == 0 {
+			return
+		}
+		if err := b.spool.Append(pending); err != nil {
+			slog.Default().Warn("dropping buffered results during shutdown", "component", "probe", "count", len(pending), "err", err)
+			return
+		}
+		slog.Default().Info("spooled buffered results for next start", "component", "probe", "count", len(pending))
+		return
+	}
 	if remaining := b.pendingCount(); remaining > 0 {
 		slog.Default().Warn("dropping buffered results during shutdown", "component", "probe", "count", remaining)
 	}
 }
 
 func (b *resultBatcher) flushOne() (hadBatch bool, flushed bool) {
+	if b.spool != nil && !b.spool.Empty() {
+		return b.flushSpooled()
+	}
+
 	batch := b.takeBatch()
 	if len(batch) == 0 {
 		return false, true
@@ -133,8 +235,17 @@ func (b *resultBatcher) flushOne() (hadBatch bool, flushed bool) {
 	ctx, cancel := context.WithTimeout(context.Background(), probeapi.DefaultRequestTimeout)
 	err := b.client.PostResults(ctx, batch)
 	cancel()
+	retryable := err != nil && probeapi.IsRetryablePostResultsError(err)
+	spooled := b.finishInflight(batch, !retryable)
 	if err != nil {
-		if probeapi.IsRetryablePostResultsError(err) {
+		if retryable {
+			if b.spool != nil {
+				if !spooled {
+					b.spill(batch)
+				}
+				slog.Default().Warn("result batch upload failed; spooled to disk", "component", "probe", "count", len(batch), "err", err)
+				return true, false
+			}
 			dropped := b.requeue(batch)
 			slog.Default().Warn("result batch upload failed", "component", "probe", "count", len(batch), "dropped", dropped, "err", err)
 			return true, false
@@ -156,6 +267,63 @@ func (b *resultBatcher) flushOne() (hadBatch bool, flushed bool) {
 	return true, true
 }
 
+// flushSpooled uploads the oldest spooled batch. The spool cursor only moves
+// after the server accepted it, so a failure or crash retries the same batch.
+func (b *resultBatcher) flushSpooled() (hadBatch bool, flushed bool) {
+	batch, pos, err := b.spool.Peek(b.maxBatchSize)
+	if err != nil {
+		slog.Default().Warn("reading result spool failed", "component", "probe", "err", err)
+		return true, false
+	}
+	b.mu.Lock()
+	settled := b.settledSeq
+	b.mu.Unlock()
+	batch = slices.DeleteFunc(batch, func(result proto.CheckResult) bool {
+		return result.Seq > 0 && result.Seq <= settled
+	})
+	if len(batch) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), probeapi.DefaultRequestTimeout)
+		err = b.client.PostResults(ctx, batch)
+		cancel()
+		if err != nil && probeapi.IsRetryablePostResultsError(err) {
+			slog.Default().Warn("spooled result batch upload failed", "component", "probe", "count", len(batch), "err", err)
+			return true, false
+		}
+		if err != nil {
+			slog.Default().Warn("dropping spooled result batch after non-retryable upload failure", "component", "probe", "count", len(batch), "err", err)
+		}
+	}
+	if err := b.spool.Commit(pos); err != nil {
+		slog.Default().Warn("advancing result spool failed", "component", "probe", "err", err)
+		return true, false
+	}
+
+	if !b.spool.Empty() || b.pendingCount() > 0 {
+		b.mu.Lock()
+		b.signalFlush()
+		b.mu.Unlock()
+	}
+	return true, true
+}
+
+// spill moves results to the spool, in order, ahead of anything still pending
+// in memory. If the disk write fails they go back to memory as before.
+func (b *resultBatcher) spill(batch []proto.CheckResult) {
+	if err := b.spool.Append(batch); err != nil {
+		dropped := b.requeue(batch)
+		slog.Default().Warn("spooling results failed", "component", "probe", "count", len(batch), "dropped", dropped, "err", err)
+	}
+}
+
+func (b *resultBatcher) syncSpool() {
+	if b.spool == nil || b.spool.fsync != config.SpoolFsyncInterval {
+		return
+	}
+	if err := b.spool.Sync(); err != nil {
+		slog.Default().Warn("syncing result spool failed", "component", "probe", "err", err)
+	}
+}
+
 func (b *resultBatcher) takeBatch() []proto.CheckResult {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -171,9 +339,27 @@ func (b *resultBatcher) takeBatch() []proto.CheckResult {
 
 	batch := append([]proto.CheckResult(nil), b.pending[:size]...)
 	b.pending = b.pending[size:]
+	b.inflight = batch
+	b.inflightSpooled = false
 	return batch
 }
 
+// finishInflight clears the in-flight batch once its upload returned and
+// reports whether overflow already spooled it. Settled batches, accepted or
+// dropped for good, mark their seqs so spooled copies are not sent again.
+func (b *resultBatcher) finishInflight(batch []proto.CheckResult, settled bool) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	spooled := b.inflightSpooled
+	b.inflight = nil
+	b.inflightSpooled = false
+	if settled && len(batch) > 0 {
+		b.settledSeq = max(b.settledSeq, batch[len(batch)-1].Seq)
+	}
+	return spooled
+}
+
 func (b *resultBatcher) requeue(batch []proto.CheckResult) int {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -198,12 +384,39 @@ func (b *resultBatcher) signalFlush() {
 	}
 }
 
+// trimPendingLocked enforces the memory cap. Overflow spills to the spool when
+// one is configured, behind the older in-flight batch; otherwise the oldest
+// results are dropped.
 func (b *resultBatcher) trimPendingLocked() int {
 	if b.maxPending <= 0 || len(b.pending) <= b.maxPending {
 		return 0
 	}
 
 	dropped := len(b.pending) - b.maxPending
+	overflow := b.pending[:dropped]
 	b.pending = append([]proto.CheckResult(nil), b.pending[dropped:]...)
+	if b.spool != nil {
+		err := b.spoolInflightLocked()
+		if err == nil {
+			err = b.spool.Append(overflow)
+		}
+		if err == nil {
+			return 0
+		}
+		slog.Default().Warn("spooling overflow results failed", "component", "probe", "count", len(overflow), "err", err)
+	}
 	return dropped
 }
+
+// spoolInflightLocked writes the in-flight batch to the spool once, so newer
+// overflow never lands ahead of it if the upload fails.
+func (b *resultBatcher) spoolInflightLocked() error {
+	if len(b.inflight) == 0 || b.inflightSpooled {
+		return nil
+	}
+	if err := b.spool.Append(b.inflight); err != nil {
+		return err
+	}
+	b.inflightSpooled = true
+	return nil
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"context"
 	"errors"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -38,7 +40,7 @@ func (f *fakeResultPoster) PostResults(_ context.Context, results []proto.CheckR
 
 func TestResultBatcherFlushesOnInterval(t *testing.T) {
 	poster := &fakeResultPoster{callCh: make(chan []proto.CheckResult, 1)}
-	batcher := newResultBatcher(poster, 10*time.Millisecond, 8)
+	batcher := newResultBatcher(poster, 10*time.Millisecond, 8, nil, nil)
 	defer batcher.Close()
 
 	batcher.Enqueue(proto.CheckResult{CheckID: "00000000-0000-0000-0000-000000000101", CheckName: "check-1", Up: true})
@@ -56,7 +58,7 @@ func TestResultBatcherFlushesOnInterval(t *testing.T) {
 
 func TestResultBatcherFlushesWhenBatchIsFull(t *testing.T) {
 	poster := &fakeResultPoster{callCh: make(chan []proto.CheckResult, 1)}
-	batcher := newResultBatcher(poster, time.Hour, 2)
+	batcher := newResultBatcher(poster, time.Hour, 2, nil, nil)
 	defer batcher.Close()
 
 	batcher.Enqueue(proto.CheckResult{CheckID: "00000000-0000-0000-0000-000000000101", CheckName: "check-1", Up: true})
@@ -83,7 +85,7 @@ func TestResultBatcherRetriesFailedBatchOnNextFlush(t *testing.T) {
 		return nil
 	}
 
-	batcher := newResultBatcher(poster, 10*time.Millisecond, 8)
+	batcher := newResultBatcher(poster, 10*time.Millisecond, 8, nil, nil)
 	defer batcher.Close()
 
 	batcher.Enqueue(proto.CheckResult{CheckID: "00000000-0000-0000-0000-000000000101", CheckName: "check-1", Up: true})
@@ -100,7 +102,7 @@ func TestResultBatcherRetriesFailedBatchOnNextFlush(t *testing.T) {
 
 func TestResultBatcherCloseFlushesPendingResults(t *testing.T) {
 	poster := &fakeResultPoster{callCh: make(chan []proto.CheckResult, 1)}
-	batcher := newResultBatcher(poster, time.Hour, 8)
+	batcher := newResultBatcher(poster, time.Hour, 8, nil, nil)
 
 	batcher.Enqueue(proto.CheckResult{CheckID: "00000000-0000-0000-0000-000000000101", CheckName: "check-1", Up: true})
 	batcher.Close()
@@ -127,7 +129,7 @@ func TestResultBatcherDropsBatchOnNonRetryableError(t *testing.T) {
 		}
 	}
 
-	batcher := newResultBatcher(poster, 10*time.Millisecond, 8)
+	batcher := newResultBatcher(poster, 10*time.Millisecond, 8, nil, nil)
 	defer batcher.Close()
 
 	batcher.Enqueue(proto.CheckResult{CheckID: "00000000-0000-0000-0000-000000000101", CheckName: "check-1", Up: true})
@@ -149,7 +151,7 @@ func TestResultBatcherDropsBatchOnNonRetryableError(t *testing.T) {
 
 func TestResultBatcherCapsPendingQueueByDroppingOldestResults(t *testing.T) {
 	poster := &fakeResultPoster{}
-	batcher := newResultBatcher(poster, time.Hour, 8)
+	batcher := newResultBatcher(poster, time.Hour, 8, nil, nil)
 	batcher.maxPending = 3
 	defer batcher.Close()
 
@@ -178,3 +180,112 @@ func TestResultBatcherCapsPendingQueueByDroppingOldestResults(t *testing.T) {
 		t.Fatalf("kept batch = %#v, want newest check-3/check-4/check-5", batch)
 	}
 }
+
+func TestResultBatcherStampsIncreasingSequenceNumbers(t *testing.T) {
+	poster := &fakeResultPoster{callCh: make(chan []proto.CheckResult, 2)}
+	attempts := 0
+	poster.postFn = func([]proto.CheckResult) error {
+		attempts++
+		if attempts == 1 {
+			return errors.New("temporary failure")
+		}
+		return nil
+	}
+
+	batcher := newResultBatcher(poster, 10*time.Millisecond, 8, nil, nil)
+	defer batcher.Close()
+
+	batcher.Enqueue(proto.CheckResult{CheckID: "00000000-0000-0000-0000-000000000101", CheckName: "check-1", Up: true})
+	batcher.Enqueue(proto.CheckResult{CheckID: "00000000-0000-0000-0000-000000000102", CheckName: "check-2", Up: true})
+
+	first := <-poster.callCh
+	retried := <-poster.callCh
+	if len(first) != 2 || first[0].Seq <= 0 || first[1].Seq != first[0].Seq+1 {
+		t.Fatalf("first upload seqs = %d/%d, want consecutive positive values", first[0].Seq, first[1].Seq)
+	}
+	if retried[0].Seq != first[0].Seq || retried[1].Seq != first[1].Seq {
+		t.Fatal("retried upload changed sequence numbers, want the same values so the server can dedupe")
+	}
+}
+
+func TestResultBatcherResumesSequenceAboveStoredMark(t *testing.T) {
+	seqs := newResultSeqStore(t.TempDir())
+	// A mark far ahead of the clock stands in for a clock that stepped back
+	// after the previous run.
+	mark := time.Now().UnixNano() + int64(365*24*time.Hour)
+	if err := seqs.Save(mark); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	poster := &fakeResultPoster{}
+	batcher := newResultBatcher(poster, time.Hour, 8, nil, seqs)
+	batcher.Enqueue(proto.CheckResult{CheckID: "00000000-0000-0000-0000-000000000101", CheckName: "check-1", Up: true})
+	first := batcher.takeBatch()
+	batcher.Close()
+	if len(first) != 1 || first[0].Seq <= mark {
+		t.Fatalf("first seq = %v, want above stored mark %d", first, mark)
+	}
+
+	stored, err := seqs.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if stored < first[0].Seq {
+		t.Fatalf("stored mark = %d, want at least the handed out seq %d", stored, first[0].Seq)
+	}
+
+	restarted := newResultBatcher(poster, time.Hour, 8, nil, seqs)
+	defer restarted.Close()
+	restarted.Enqueue(proto.CheckResult{CheckID: "00000000-0000-0000-0000-000000000101", CheckName: "check-1", Up: true})
+	if second := restarted.takeBatch(); len(second) != 1 || second[0].Seq <= first[0].Seq {
+		t.Fatalf("seq after restart = %v, want above %d", second, first[0].Seq)
+	}
+}
+
+func TestResultBatcherStopsSequencingWhenReservationCannotBeSaved(t *testing.T) {
+	// A regular file where state_dir should be makes every save fail.
+	stateDir := filepath.Join(t.TempDir(), "state")
+	if err := os.WriteFile(stateDir, nil, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	batcher := newResultBatcher(&fakeResultPoster{}, time.Hour, 8, nil, newResultSeqStore(stateDir))
+	defer batcher.Close()
+	batcher.Enqueue(proto.CheckResult{CheckID: "00000000-0000-0000-0000-000000000101", CheckName: "check-1", Up: true})
+	if batch := batcher.takeBatch(); len(batch) != 1 || batch[0].Seq != 0 {
+		t.Fatalf("batch = %+v, want one unsequenced result", batch)
+	}
+}
+
+func TestResultBatcherReservesNextBlockBeforeRunningOut(t *testing.T) {
+	seqs := newResultSeqStore(t.TempDir())
+	batcher := newResultBatcher(&fakeResultPoster{}, time.Hour, resultSeqReserve, nil, seqs)
+	defer batcher.Close()
+
+	batcher.mu.Lock()
+	first := batcher.reservedSeq
+	batcher.mu.Unlock()
+	for range resultSeqReserve/2 + 2 {
+		batcher.Enqueue(proto.CheckResult{CheckID: "00000000-0000-0000-0000-000000000101", CheckName: "check-1", Up: true})
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		stored, err := seqs.Load()
+		if err != nil {
+			t.Fatalf("Load: %v", err)
+		}
+		if stored > first {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stored mark = %d, want the next block reserved above %d", stored, first)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	for _, result := range batcher.takeBatch() {
+		if result.Seq == 0 || result.Seq > first {
+			t.Fatalf("seq = %d, want within the first reservation up to %d", result.Seq, first)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	resultSeqFile = "result_seq"
+	// resultSeqReserve is how many sequence numbers one write claims, so the
+	// file is rewritten once per block instead of for every result.
+	resultSeqReserve = 1 << 12
+	// resultSeqRetryDelay spaces out reservation attempts after a failed
+	// write.
+	resultSeqRetryDelay = 5 * time.Second
+)
+
+// resultSeqStore keeps a high-water mark for result sequence numbers under
+// state_dir, so a restarted probe never stamps a number the server may already
+// have accepted, even when the clock stepped backwards. A nil store, used when
+// no state_dir is configured, keeps nothing and sequences fall back to the
+// clock.
+type resultSeqStore struct {
+	path string
+}
+
+func newResultSeqStore(stateDir string) *resultSeqStore {
+	if stateDir == "" {
+		return nil
+	}
+	return &resultSeqStore{path: filepath.Join(stateDir, resultSeqFile)}
+}
+
+// Load returns the stored high-water mark, or zero when none was written yet.
+func (s *resultSeqStore) Load() (int64, error) {
+	if s == nil {
+		return 0, nil
+	}
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("result seq: read: %w", err)
+	}
+	seq, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("result seq: parse: %w", err)
+	}
+	return seq, nil
+}
+
+// Save durably replaces the high-water mark. It is synced before the rename so
+// a crash cannot leave a mark below numbers already handed out.
+func (s *resultSeqStore) Save(seq int64) error {
+	if s == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("result seq: create dir: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("result seq: write: %w", err)
+	}
+	_, err = f.WriteString(strconv.FormatInt(seq, 10) + "\n")
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("result seq: write: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("result seq: write: %w", err)
+	}
+	return nil
+}
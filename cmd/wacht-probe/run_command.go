@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tmater/wacht/internal/checks"
+	"github.com/tmater/wacht/internal/logx"
+	"github.com/tmater/wacht/internal/network"
+	"github.com/tmater/wacht/internal/proto"
+)
+
+// Exit codes for the run subcommand.
+const (
+	runExitUp    = 0
+	runExitDown  = 1
+	runExitUsage = 2
+)
+
+// headerFlags collects repeated -header "Name: value" flags.
+type headerFlags http.Header
+
+func (h headerFlags) String() string {
+	parts := make([]string, 0, len(h))
+	for name, values := range h {
+		for _, value := range values {
+			parts = append(parts, name+": "+value)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (h headerFlags) Set(raw string) error {
+	name, value, ok := strings.Cut(raw, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return fmt.Errorf("header must look like \"Name: value\"")
+	}
+	http.Header(h).Add(name, strings.TrimSpace(value))
+	return nil
+}
+
+// runCommand implements "wacht-probe run": it executes one check locally with
+// the probe's own checker code and network policy, prints the result, and
+// exits 0 when the check is up and 1 when it is down. No server or
+// credentials are needed.
+func runCommand(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("wacht-probe run", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	checkType := fs.String("type", "", "check type: "+strings.Join(supportedCheckTypes(), ", "))
+	target := fs.String("target", "", "check target, such as https://example.com or db.example.com:5432")
+	opts := checks.Options{Headers: http.Header{}}
+	fs.DurationVar(&opts.Timeout, "timeout", checks.DefaultTimeout, "timeout for one attempt")
+	fs.Var(headerFlags(opts.Headers), "header", "HTTP request header \"Name: value\" (repeatable)")
+	fs.IntVar(&opts.ExpectStatus, "expect-status", 0, "require this HTTP status instead of any 2xx or 3xx")
+	fs.StringVar(&opts.ExpectBody, "expect-body", "", "require this text in the HTTP response body")
+	fs.StringVar(&opts.ExpectAddr, "expect-addr", "", "require this address among the DNS answers")
+	fs.BoolVar(&opts.TCP.TLS, "tls", false, "tcp-expect: wrap the connection in TLS")
+	fs.StringVar(&opts.TCP.Send, "send", "", "tcp-expect: payload to send once connected; \\r, \\n, \\t, and \\xNN are unescaped")
+	fs.StringVar(&opts.TCP.Expect, "expect", "", "tcp-expect: require this in the response")
+	fs.StringVar(&opts.TCP.ExpectMode, "expect-mode", "", "tcp-expect: how -expect matches: contains (default), regex, or bytes (hex)")
+	fs.DurationVar(&opts.TCP.ReadTimeout, "read-timeout", 0, "tcp-expect: how long to wait for the response (default: -timeout)")
+	retries := fs.Int("retries", 0, fmt.Sprintf("re-run a failure up to this many times (0-%d)", checks.MaxRetries))
+	allowPrivate := fs.Bool("allow-private-targets", false, "allow private, loopback, and link-local targets")
+	trace := fs.Bool("trace", false, "trace the network path when an http or tcp check fails")
+	asJSON := fs.Bool("json", false, "print the result as JSON")
+	verbose := fs.Bool("v", false, "log checker diagnostics to stderr")
+	if err := fs.Parse(args); err != nil {
+		return runExitUsage
+	}
+
+	run, ok := checkRunners[*checkType]
+	switch {
+	case !ok:
+		fmt.Fprintf(stderr, "-type must be one of %s\n", strings.Join(supportedCheckTypes(), ", "))
+		return runExitUsage
+	case strings.TrimSpace(*target) == "":
+		fmt.Fprintln(stderr, "-target is required")
+		return runExitUsage
+	case *retries < 0 || *retries > checks.MaxRetries:
+		fmt.Fprintf(stderr, "-retries must be between 0 and %d\n", checks.MaxRetries)
+		return runExitUsage
+	case fs.NArg() > 0:
+		fmt.Fprintf(stderr, "unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		return runExitUsage
+	}
+	if opts.TCP.Send != "" {
+		send, err := unescapePayload(opts.TCP.Send)
+		if err != nil {
+			fmt.Fprintf(stderr, "-send: %v\n", err)
+			return runExitUsage
+		}
+		opts.TCP.Send = send
+	}
+	if checks.Type(*checkType) == checks.CheckTCPExpect {
+		if err := opts.TCP.Validate(); err != nil {
+			fmt.Fprintln(stderr, err)
+			return runExitUsage
+		}
+	}
+
+	level := "error"
+	if *verbose {
+		level = "debug"
+	}
+	slog.SetDefault(logx.New("wacht-probe", stderr, level))
+
+	policy := network.Policy{AllowPrivateTargets: *allowPrivate}
+	result := runWithRetries(func() proto.CheckResult {
+		return run("", "", *target, policy, opts)
+	}, *retries, checkRetryDelay)
+	if checkType := checks.Type(*checkType); *trace && !result.Up && checkType != checks.CheckDNS {
+		path := checks.Traceroute(checkType, *target, policy, checks.TraceOptions{})
+		result.Path = &path
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			fmt.Fprintf(stderr, "encode result: %v\n", err)
+			return runExitUsage
+		}
+	} else {
+		printRunResult(stdout, result)
+	}
+	if !result.Up {
+		return runExitDown
+	}
+	return runExitUp
+}
+
+// unescapePayload turns the \r, \n, \t, \\, and \xNN escapes a shell user
+// types into the bytes a -send payload stands for.
+func unescapePayload(raw string) (string, error) {
+	var out strings.Builder
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '\\' || i+1 == len(raw) {
+			out.WriteByte(raw[i])
+			continue
+		}
+		i++
+		switch raw[i] {
+		case 'r':
+			out.WriteByte('\r')
+		case 'n':
+			out.WriteByte('\n')
+		case 't':
+			out.WriteByte('\t')
+		case '\\':
+			out.WriteByte('\\')
+		case 'x':
+			if i+3 > len(raw) {
+				return "", fmt.Errorf("incomplete \\x escape")
+			}
+			b, err := strconv.ParseUint(raw[i+1:i+3], 16, 8)
+			if err != nil {
+				return "", fmt.Errorf("invalid \\x escape %q", raw[i-1:i+3])
+			}
+			out.WriteByte(byte(b))
+			i += 2
+		default:
+			return "", fmt.Errorf("unknown escape \\%c", raw[i])
+		}
+	}
+	return out.String(), nil
+}
+
+// printRunResult writes a short human-readable summary of result.
+func printRunResult(w io.Writer, result proto.CheckResult) {
+	status := "DOWN"
+	if result.Up {
+		status = "UP"
+	}
+	fmt.Fprintf(w, "%s %s %s in %dms\n", status, result.Type, result.Target, result.Latency.Milliseconds())
+	if result.Attempts > 1 {
+		fmt.Fprintf(w, "attempts: %d\n", result.Attempts)
+		for i, attemptErr := range result.AttemptErrors {
+			fmt.Fprintf(w, "  attempt %d: %s\n", i+1, attemptErr)
+		}
+	}
+	if timings := result.Timings; timings != nil {
+		fmt.Fprintf(w, "timings: dns %dms, connect %dms, tls %dms, ttfb %dms, transfer %dms\n",
+			timings.DNS.Milliseconds(), timings.Connect.Milliseconds(), timings.TLS.Milliseconds(), timings.TTFB.Milliseconds(), timings.Transfer.Milliseconds())
+	}
+	switch {
+	case result.Error != "" && result.ErrorKind != "":
+		fmt.Fprintf(w, "error (%s): %s\n", result.ErrorKind, result.Error)
+	case result.Error != "":
+		fmt.Fprintf(w, "error: %s\n", result.Error)
+	}
+	if path := result.Path; path != nil {
+		fmt.Fprintf(w, "path to %s:\n", path.Target)
+		for _, hop := range path.Hops {
+			if hop.Addr == "" {
+				fmt.Fprintf(w, "  %2d  *\n", hop.TTL)
+				continue
+			}
+			fmt.Fprintf(w, "  %2d  %s  %.1fms\n", hop.TTL, hop.Addr, float64(hop.RTT.Microseconds())/1000)
+		}
+		switch {
+		case path.Reached:
+			fmt.Fprintln(w, "  target reached")
+		case path.Error != "":
+			fmt.Fprintf(w, "  %s\n", path.Error)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/tmater/wacht/internal/proto"
+)
+
+func TestRunCommandRunsHTTPCheckWithHeadersAndAssertions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-1" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	code := runCommand([]string{
+		"-type", "http", "-target", server.URL, "-allow-private-targets", "-json",
+		"-header", "Authorization: Bearer token-1", "-expect-status", "200", "-expect-body", `"ok"`,
+	}, &stdout, &stderr)
+	if code != runExitUp {
+		t.Fatalf("exit = %d, want %d; stdout=%s stderr=%s", code, runExitUp, stdout.String(), stderr.String())
+	}
+	var result proto.CheckResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !result.Up || result.Type != "http" || result.Target != server.URL {
+		t.Fatalf("result = %+v, want up http result", result)
+	}
+
+	stdout.Reset()
+	code = runCommand([]string{"-type", "http", "-target", server.URL, "-allow-private-targets", "-expect-body", "missing"}, &stdout, &stderr)
+	if code != runExitDown {
+		t.Fatalf("exit = %d, want %d", code, runExitDown)
+	}
+	if out := stdout.String(); !strings.HasPrefix(out, "DOWN http ") || !strings.Contains(out, "error (assertion): ") {
+		t.Fatalf("stdout = %q, want DOWN summary with assertion error", out)
+	}
+}
+
+func TestRunCommandKeepsProbeNetworkPolicy(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := runCommand([]string{"-type", "tcp", "-target", "127.0.0.1:1"}, &stdout, &stderr)
+	if code != runExitDown {
+		t.Fatalf("exit = %d, want %d", code, runExitDown)
+	}
+	if !strings.Contains(stdout.String(), "error (blocked): ") || !strings.Contains(stdout.String(), "not allowed") {
+		t.Fatalf("stdout = %q, want private target rejection", stdout.String())
+	}
+}
+
+func TestRunCommandTracesFailedTCPCheck(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("traceroute needs linux")
+	}
+	var stdout, stderr bytes.Buffer
+	code := runCommand([]string{"-type", "tcp", "-target", "127.0.0.1:1", "-allow-private-targets", "-trace"}, &stdout, &stderr)
+	if code != runExitDown {
+		t.Fatalf("exit = %d, want %d", code, runExitDown)
+	}
+	out := stdout.String()
+	if !strings.Contains(out, "path to 127.0.0.1:1:\n") || !strings.Contains(out, "   1  127.0.0.1  ") || !strings.Contains(out, "target reached") {
+		t.Fatalf("stdout = %q, want one-hop path to the refusing target", out)
+	}
+}
+
+func TestRunCommandRunsTCPExpectCheck(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 64)
+		n, _ := conn.Read(buf)
+		if string(buf[:n]) == "PING\r\n" {
+			conn.Write([]byte("+PONG\r\n"))
+		}
+	}()
+
+	var stdout, stderr bytes.Buffer
+	code := runCommand([]string{"-type", "tcp-expect", "-target", ln.Addr().String(), "-allow-private-targets", "-send", `PING\r\n`, "-expect", "+PONG"}, &stdout, &stderr)
+	if code != runExitUp {
+		t.Fatalf("exit = %d, want %d; stdout=%s stderr=%s", code, runExitUp, stdout.String(), stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "UP tcp-expect ") {
+		t.Fatalf("stdout = %q, want UP tcp-expect summary", stdout.String())
+	}
+}
+
+func TestUnescapePayload(t *testing.T) {
+	got, err := unescapePayload(`stats\r\n\x00\\`)
+	if err != nil || got != "stats\r\n\x00\\" {
+		t.Fatalf("unescapePayload() = %q, %v", got, err)
+	}
+	for _, raw := range []string{`\x4`, `\xzz`, `\q`} {
+		if _, err := unescapePayload(raw); err == nil {
+			t.Errorf("unescapePayload(%q) error = nil, want error", raw)
+		}
+	}
+}
+
+func TestRunCommandRejectsInvalidUsage(t *testing.T) {
+	for _, args := range [][]string{
+		{"-target", "example.com"},
+		{"-type", "icmp", "-target", "example.com"},
+		{"-type", "dns"},
+		{"-type", "dns", "-target", "example.com", "-retries", "9"},
+		{"-type", "http", "-target", "https://example.com", "-header", "no-colon"},
+		{"-type", "tcp-expect", "-target", "example.com:6379"},
+		{"-type", "tcp-expect", "-target", "example.com:6379", "-send", `PING\q`},
+	} {
+		var stdout, stderr bytes.Buffer
+		if code := runCommand(args, &stdout, &stderr); code != runExitUsage {
+			t.Fatalf("runCommand(%q) = %d, want %d", args, code, runExitUsage)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	probeapi "github.com/tmater/wacht/internal/api/probe"
+	"github.com/tmater/wacht/internal/proto"
+)
+
+// runNowAPI is the probe API surface used to serve on-demand check runs.
+type runNowAPI interface {
+	WatchRuns(ctx context.Context, wait time.Duration) ([]probeapi.RunRequest, error)
+	PostRunResult(ctx context.Context, result probeapi.RunResult) error
+}
+
+// runNowLoop long-polls the server for on-demand runs and queues each one
+// outside the regular schedule, so results return while the caller is still
+// waiting. run starts a check and calls done with its result, or reports false
+// when the probe already has too many runs queued. Failed polls are retried
+// after retryInterval. The loop stops if the server does not offer on-demand
+// runs.
+func runNowLoop(apiClient runNowAPI, probeID string, retryInterval time.Duration, run func(check proto.ProbeCheck, done func(proto.CheckResult)) bool) {
+	for {
+		requests, err := apiClient.WatchRuns(context.Background(), checkWatchWait)
+		if err != nil {
+			var respErr *probeapi.ResponseError
+			if errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound {
+				slog.Default().Info("server does not support on-demand runs", "component", "probe", "probe_id", probeID)
+				return
+			}
+			slog.Default().Warn("run-now poll failed", "component", "probe", "probe_id", probeID, "err", err)
+			time.Sleep(retryInterval)
+			continue
+		}
+		for _, request := range requests {
+			serveRunRequest(apiClient, probeID, request, run)
+		}
+	}
+}
+
+// serveRunRequest queues one on-demand request and returns its result once it
+// has run. A probe that is too busy answers at once with a failed result so
+// the caller does not wait for the timeout.
+func serveRunRequest(apiClient runNowAPI, probeID string, request probeapi.RunRequest, run func(proto.ProbeCheck, func(proto.CheckResult)) bool) {
+	post := func(result proto.CheckResult) {
+		if err := apiClient.PostRunResult(context.Background(), probeapi.RunResult{RunID: request.RunID, Result: result}); err != nil {
+			// The caller may have stopped waiting; the result is ad hoc, so it
+			// is dropped rather than retried.
+			slog.Default().Debug("post run-now result failed", "component", "probe", "probe_id", probeID, "run_id", request.RunID, "err", err)
+		}
+	}
+	if !run(request.Check, post) {
+		slog.Default().Warn("too many on-demand runs queued; refusing run", "component", "probe", "probe_id", probeID, "run_id", request.RunID)
+		go post(failedRunResult(request.Check, "probe has too many on-demand runs queued"))
+	}
+}
+
+// failedRunResult reports an on-demand run the probe could not execute.
+func failedRunResult(check proto.ProbeCheck, message string) proto.CheckResult {
+	return proto.CheckResult{
+		CheckID:   check.ID,
+		CheckName: check.Name,
+		Type:      check.Type,
+		Target:    check.Target,
+		Error:     message,
+		ErrorKind: proto.ErrorKindOther,
+		Timestamp: time.Now().UTC(),
+	}
+}
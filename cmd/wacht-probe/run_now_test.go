@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	probeapi "github.com/tmater/wacht/internal/api/probe"
+	"github.com/tmater/wacht/internal/proto"
+)
+
+type fakeRunNowAPI struct {
+	mu       sync.Mutex
+	polls    int
+	requests []probeapi.RunRequest
+	posted   chan probeapi.RunResult
+}
+
+func (f *fakeRunNowAPI) WatchRuns(context.Context, time.Duration) ([]probeapi.RunRequest, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.polls++
+	if f.polls == 1 {
+		return f.requests, nil
+	}
+	return nil, &probeapi.ResponseError{StatusCode: http.StatusNotFound, Status: "404 Not Found"}
+}
+
+func (f *fakeRunNowAPI) PostRunResult(_ context.Context, result probeapi.RunResult) error {
+	f.posted <- result
+	return nil
+}
+
+func TestRunNowLoopRunsRequestsAndStopsOnOldServer(t *testing.T) {
+	api := &fakeRunNowAPI{
+		requests: []probeapi.RunRequest{{RunID: "run-1", Check: proto.ProbeCheck{Type: "tcp", Target: "db.example.com:5432"}}},
+		posted:   make(chan probeapi.RunResult, 1),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runNowLoop(api, "probe-1", time.Millisecond, func(check proto.ProbeCheck, done func(proto.CheckResult)) bool {
+			go done(proto.CheckResult{Up: true, Target: check.Target})
+			return true
+		})
+	}()
+
+	select {
+	case result := <-api.posted:
+		if result.RunID != "run-1" || !result.Result.Up || result.Result.Target != "db.example.com:5432" {
+			t.Fatalf("posted = %+v, want run-1 up", result)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("run result was not posted")
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("runNowLoop did not stop after a 404")
+	}
+}
+
+func TestServeRunRequestAnswersWhenProbeIsBusy(t *testing.T) {
+	api := &fakeRunNowAPI{posted: make(chan probeapi.RunResult, 1)}
+	request := probeapi.RunRequest{RunID: "run-1", Check: proto.ProbeCheck{Type: "tcp", Target: "db.example.com:5432"}}
+
+	serveRunRequest(api, "probe-1", request, func(proto.ProbeCheck, func(proto.CheckResult)) bool { return false })
+
+	select {
+	case result := <-api.posted:
+		if result.RunID != "run-1" || result.Result.Up || result.Result.Error == "" || result.Result.Target != "db.example.com:5432" {
+			t.Fatalf("posted = %+v, want a failed run-1 result", result)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("busy probe did not answer the run")
+	}
+}
+
+func TestSchedulerRunNowReportsUnsupportedCheckTypes(t *testing.T) {
+	s := &scheduler{}
+	done := make(chan proto.CheckResult, 1)
+
+	if !s.RunNow(proto.ProbeCheck{Type: "icmp", Target: "example.com"}, func(result proto.CheckResult) { done <- result }) {
+		t.Fatal("RunNow() = false, want unsupported types answered")
+	}
+	select {
+	case result := <-done:
+		if result.Up || result.Error == "" || result.Target != "example.com" {
+			t.Fatalf("result = %+v, want failed result for unsupported type", result)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("unsupported run was not answered")
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"container/heap"
+	"hash/fnv"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmater/wacht/internal/logx"
+	"github.com/tmater/wacht/internal/proto"
+)
+
+const (
+	runQueueReportInterval = time.Minute
+	runQueueLagWarnAfter   = 5 * time.Second
+	// maxFirstRunJitter bounds how long a newly added check waits for its
+	// first run, so a large check set does not start in one burst.
+	maxFirstRunJitter = 5 * time.Second
+	// maxQueuedRuns caps on-demand runs waiting for or holding a worker.
+	maxQueuedRuns = 8
+)
+
+// runEntry is one scheduled check. It sits in the heap while waiting for its
+// next start time, in a host's waiting list while that host is saturated, and
+// in neither while a worker is running it, so a check never overlaps itself.
+type runEntry struct {
+	check     proto.ProbeCheck
+	host      string
+	interval  time.Duration
+	offset    time.Duration
+	next      time.Time
+	index     int
+	aligned   bool
+	cancelled bool
+	// failed holds the errors of earlier attempts while a failed run is
+	// being confirmed, and slot the start of that run, so retries do not
+	// move the check off its cadence.
+	failed []string
+	slot   time.Time
+	// run replaces the queue's runner for an on-demand entry, which runs once
+	// and is not rescheduled.
+	run func(check proto.ProbeCheck, failed []string) []string
+}
+
+type runHeap []*runEntry
+
+func (h runHeap) Len() int           { return len(h) }
+func (h runHeap) Less(i, j int) bool { return h[i].next.Before(h[j].next) }
+func (h runHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *runHeap) Push(x any) {
+	entry := x.(*runEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *runHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	old[len(old)-1] = nil
+	entry.index = -1
+	*h = old[:len(old)-1]
+	return entry
+}
+
+type hostSlot struct {
+	active  int
+	waiting []*runEntry
+}
+
+// runQueueStats summarizes scheduling health since the previous report. Lag is
+// how late a run started compared with its slot; skipped counts whole
+// intervals dropped because the probe could not keep up.
+type runQueueStats struct {
+	Runs    uint64
+	Skipped uint64
+	MaxLag  time.Duration
+	Due     int
+}
+
+// runQueue is the probe's central scheduler. One dispatcher walks a min-heap
+// of next start times and hands due checks to a fixed worker pool, holding a
+// check back while its target host already has hostLimit runs in flight.
+// A confirmation retry goes back on the heap retryDelay later instead of
+// holding a worker while it waits.
+type runQueue struct {
+	// run executes one attempt of check. failed holds the errors of earlier
+	// attempts of the same run; run returns them with this attempt's error
+	// appended when the check should run again, or nil when the run is done.
+	run        func(check proto.ProbeCheck, failed []string) []string
+	now        func() time.Time
+	phaseSeed  string
+	hostLimit  int
+	retryDelay time.Duration
+
+	mu     sync.Mutex
+	queue  runHeap
+	hosts  map[string]*hostSlot
+	stats  runQueueStats
+	queued int
+
+	wake chan struct{}
+	jobs chan *runEntry
+	stop chan struct{}
+	wg   sync.WaitGroup
+	once sync.Once
+}
+
+func newRunQueue(workers, hostLimit int, phaseSeed string, run func(proto.ProbeCheck, []string) []string) *runQueue {
+	q := &runQueue{
+		run:        run,
+		now:        time.Now,
+		phaseSeed:  phaseSeed,
+		hostLimit:  max(hostLimit, 1),
+		retryDelay: checkRetryDelay,
+		hosts:      make(map[string]*hostSlot),
+		wake:       make(chan struct{}, 1),
+		jobs:       make(chan *runEntry),
+		stop:       make(chan struct{}),
+	}
+	workers = max(workers, 1)
+	q.wg.Add(workers + 2)
+	for range workers {
+		go q.worker()
+	}
+	go q.dispatch()
+	go q.report(workers)
+	return q
+}
+
+// Add runs check within a short jitter and then at its phase slot within the
+// interval. The slot is derived from the probe and check IDs, so a large check
+// set spreads evenly and keeps the same cadence across reconciles and restarts.
+func (q *runQueue) Add(check proto.ProbeCheck) *runEntry {
+	interval := time.Duration(max(check.Interval, 1)) * time.Second
+	entry := &runEntry{
+		check:    check,
+		host:     strings.ToLower(logx.TargetHost(check.Target)),
+		interval: interval,
+		offset:   phaseOffset(q.phaseSeed, check.ID, interval),
+		next:     q.now().Add(phaseOffset(q.phaseSeed, check.ID, min(interval, maxFirstRunJitter))),
+	}
+
+	q.mu.Lock()
+	heap.Push(&q.queue, entry)
+	q.mu.Unlock()
+	q.signal()
+	return entry
+}
+
+// RunOnce runs check now, outside any schedule, on the shared workers and
+// within its host's slots, using run instead of the queue's runner. It reports
+// false when maxQueuedRuns on-demand runs are already queued.
+func (q *runQueue) RunOnce(check proto.ProbeCheck, run func(check proto.ProbeCheck, failed []string) []string) bool {
+	entry := &runEntry{
+		check: check,
+		host:  strings.ToLower(logx.TargetHost(check.Target)),
+		run:   run,
+	}
+
+	q.mu.Lock()
+	if q.queued >= maxQueuedRuns {
+		q.mu.Unlock()
+		return false
+	}
+	q.queued++
+	entry.next = q.now()
+	heap.Push(&q.queue, entry)
+	q.mu.Unlock()
+	q.signal()
+	return true
+}
+
+// Remove stops future runs of entry. A run already in flight finishes but is
+// not rescheduled.
+func (q *runQueue) Remove(entry *runEntry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry.cancelled = true
+	if entry.index >= 0 && entry.index < len(q.queue) && q.queue[entry.index] == entry {
+		heap.Remove(&q.queue, entry.index)
+	}
+	if slot := q.hosts[entry.host]; slot != nil {
+		for i, waiting := range slot.waiting {
+			if waiting == entry {
+				slot.waiting = append(slot.waiting[:i], slot.waiting[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Close stops the dispatcher and waits for in-flight runs to finish.
+func (q *runQueue) Close() {
+	q.once.Do(func() { close(q.stop) })
+	q.wg.Wait()
+}
+
+// Stats returns the counters gathered since the last reset.
+func (q *runQueue) Stats(reset bool) runQueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := q.stats
+	now := q.now()
+	for _, entry := range q.queue {
+		if !entry.next.After(now) {
+			stats.Due++
+		}
+	}
+	for _, slot := range q.hosts {
+		stats.Due += len(slot.waiting)
+	}
+	if reset {
+		q.stats = runQueueStats{}
+	}
+	return stats
+}
+
+func (q *runQueue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *runQueue) dispatch() {
+	defer q.wg.Done()
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		entry, wait := q.nextDue()
+		if entry != nil {
+			select {
+			case q.jobs <- entry:
+			case <-q.stop:
+				return
+			}
+			continue
+		}
+
+		timer.Stop()
+		if wait > 0 {
+			timer.Reset(wait)
+		}
+		select {
+		case <-timer.C:
+		case <-q.wake:
+		case <-q.stop:
+			return
+		}
+	}
+}
+
+// nextDue pops the earliest due entry whose host has capacity. Due entries for
+// saturated hosts move to that host's waiting list. When nothing is due it
+// returns how long to sleep, or zero when the heap is empty.
+func (q *runQueue) nextDue() (*runEntry, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := q.now()
+	for len(q.queue) > 0 {
+		top := q.queue[0]
+		if top.next.After(now) {
+			return nil, top.next.Sub(now)
+		}
+		heap.Pop(&q.queue)
+
+		slot := q.hostLocked(top.host)
+		if slot.active >= q.hostLimit {
+			slot.waiting = append(slot.waiting, top)
+			continue
+		}
+		slot.active++
+		return top, 0
+	}
+	return nil, 0
+}
+
+func (q *runQueue) worker() {
+	defer q.wg.Done()
+
+	for {
+		select {
+		case entry := <-q.jobs:
+			run := q.run
+			if entry.run != nil {
+				run = entry.run
+			}
+			q.started(entry)
+			q.finished(entry, run(entry.check, entry.failed))
+		case <-q.stop:
+			return
+		}
+	}
+}
+
+func (q *runQueue) started(entry *runEntry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.stats.Runs++
+	if lag := q.now().Sub(entry.next); lag > q.stats.MaxLag {
+		q.stats.MaxLag = lag
+	}
+}
+
+// finished releases the host slot, lets the oldest waiter for that host go
+// next, and schedules entry's next run. A run that wants a retry goes back on
+// the heap retryDelay later. After the first run the check moves onto its
+// phase slot, at least half an interval later. Slots that are already a full
+// interval in the past are skipped rather than replayed in a burst.
+func (q *runQueue) finished(entry *runEntry, failed []string) {
+	q.mu.Lock()
+	defer q.signal()
+	defer q.mu.Unlock()
+
+	slot := q.hostLocked(entry.host)
+	slot.active--
+	if len(slot.waiting) > 0 {
+		waiter := slot.waiting[0]
+		slot.waiting = slot.waiting[1:]
+		heap.Push(&q.queue, waiter)
+	}
+	if slot.active == 0 && len(slot.waiting) == 0 {
+		delete(q.hosts, entry.host)
+	}
+
+	if entry.cancelled {
+		return
+	}
+	if failed != nil {
+		if entry.failed == nil {
+			entry.slot = entry.next
+		}
+		entry.failed = failed
+		entry.next = q.now().Add(q.retryDelay)
+		heap.Push(&q.queue, entry)
+		return
+	}
+	if entry.run != nil {
+		q.queued--
+		return
+	}
+	if entry.failed != nil {
+		entry.next, entry.failed = entry.slot, nil
+	}
+	prev := entry.next
+	if !entry.aligned {
+		entry.aligned = true
+		prev = firstRunAt(entry.next.Add(entry.interval/2), entry.offset, entry.interval).Add(-entry.interval)
+	}
+	next, skipped := nextRunAt(prev, entry.interval, q.now())
+	entry.next = next
+	q.stats.Skipped += skipped
+	heap.Push(&q.queue, entry)
+}
+
+func (q *runQueue) hostLocked(host string) *hostSlot {
+	slot, ok := q.hosts[host]
+	if !ok {
+		slot = &hostSlot{}
+		q.hosts[host] = slot
+	}
+	return slot
+}
+
+// report logs scheduling health once per interval and warns when runs start
+// noticeably late, which means the worker pool or host caps are too small for
+// the check set.
+func (q *runQueue) report(workers int) {
+	defer q.wg.Done()
+
+	ticker := time.NewTicker(runQueueReportInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			stats := q.Stats(true)
+			args := []any{"component", "probe_scheduler", "workers", workers, "runs", stats.Runs, "skipped", stats.Skipped, "max_lag_ms", stats.MaxLag.Milliseconds(), "due", stats.Due}
+			if stats.MaxLag >= runQueueLagWarnAfter || stats.Skipped > 0 {
+				slog.Default().Warn("check scheduler falling behind", args...)
+				continue
+			}
+			slog.Default().Debug("check scheduler healthy", args...)
+		case <-q.stop:
+			return
+		}
+	}
+}
+
+// phaseOffset deterministically places a check within its interval.
+func phaseOffset(seed, checkID string, interval time.Duration) time.Duration {
+	h := fnv.New64a()
+	h.Write([]byte(seed))
+	h.Write([]byte{0})
+	h.Write([]byte(checkID))
+	return time.Duration(h.Sum64() % uint64(interval))
+}
+
+// firstRunAt returns the first slot at or after now that matches offset.
+func firstRunAt(now time.Time, offset, interval time.Duration) time.Time {
+	next := now.Truncate(interval).Add(offset)
+	if next.Before(now) {
+		next = next.Add(interval)
+	}
+	return next
+}
+
+// nextRunAt advances prev by one interval, jumping over slots that already
+// passed, and reports how many were skipped.
+func nextRunAt(prev time.Time, interval time.Duration, now time.Time) (time.Time, uint64) {
+	next := prev.Add(interval)
+	if next.After(now) {
+		return next, 0
+	}
+	missed := now.Sub(next)/interval + 1
+	return next.Add(missed * interval), uint64(missed)
+}
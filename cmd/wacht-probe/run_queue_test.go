@@ -0,0 +1,339 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tmater/wacht/internal/proto"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func newTestRunQueue(t *testing.T, workers, hostLimit int, run func(proto.ProbeCheck, []string) []string) (*runQueue, *fakeClock) {
+	t.Helper()
+
+	clock := &fakeClock{now: time.Date(2026, time.April, 8, 12, 0, 0, 0, time.UTC)}
+	q := newRunQueue(workers, hostLimit, "probe-1", run)
+	q.mu.Lock()
+	q.now = clock.Now
+	q.mu.Unlock()
+	t.Cleanup(q.Close)
+	return q, clock
+}
+
+func TestPhaseOffsetIsStableAndSpreadsChecks(t *testing.T) {
+	interval := time.Minute
+	seen := make(map[time.Duration]bool)
+	for _, id := range []string{"check-a", "check-b", "check-c", "check-d"} {
+		offset := phaseOffset("probe-1", id, interval)
+		if offset < 0 || offset >= interval {
+			t.Fatalf("phaseOffset(%s) = %s, want within [0, %s)", id, offset, interval)
+		}
+		if again := phaseOffset("probe-1", id, interval); again != offset {
+			t.Fatalf("phaseOffset(%s) = %s then %s, want stable", id, offset, again)
+		}
+		seen[offset] = true
+	}
+	if len(seen) < 2 {
+		t.Fatalf("offsets = %v, want checks spread across the interval", seen)
+	}
+}
+
+func TestNextRunAtSkipsSlotsThatAlreadyPassed(t *testing.T) {
+	prev := time.Date(2026, time.April, 8, 12, 0, 0, 0, time.UTC)
+
+	next, skipped := nextRunAt(prev, 10*time.Second, prev.Add(3*time.Second))
+	if !next.Equal(prev.Add(10*time.Second)) || skipped != 0 {
+		t.Fatalf("on time: next = %s skipped = %d", next, skipped)
+	}
+
+	next, skipped = nextRunAt(prev, 10*time.Second, prev.Add(35*time.Second))
+	if !next.Equal(prev.Add(40*time.Second)) || skipped != 3 {
+		t.Fatalf("behind: next = %s skipped = %d, want +40s and 3", next, skipped)
+	}
+}
+
+func TestRunQueueRunsNewChecksSoonThenMovesToPhaseSlot(t *testing.T) {
+	ran := make(chan struct{}, 1)
+	q, clock := newTestRunQueue(t, 1, 1, func(proto.ProbeCheck, []string) []string { ran <- struct{}{}; return nil })
+	start := clock.Now()
+
+	check := proto.ProbeCheck{ID: "check-a", Type: "dns", Target: "example.com", Interval: 3600}
+	entry := q.Add(check)
+	if wait := entry.next.Sub(start); wait < 0 || wait >= maxFirstRunJitter {
+		t.Fatalf("first run in %s, want within %s", wait, maxFirstRunJitter)
+	}
+
+	clock.Advance(maxFirstRunJitter)
+	q.signal()
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("new check did not run within the first-run jitter")
+	}
+
+	interval := time.Hour
+	offset := phaseOffset("probe-1", check.ID, interval)
+	deadline := time.Now().Add(time.Second)
+	for {
+		q.mu.Lock()
+		next, aligned := entry.next, entry.aligned
+		q.mu.Unlock()
+		if aligned {
+			if got := next.Sub(next.Truncate(interval)); got != offset {
+				t.Fatalf("second run offset = %s, want phase slot %s", got, offset)
+			}
+			if gap := next.Sub(start); gap < interval/2 {
+				t.Fatalf("second run %s after the first, want at least half an interval", gap)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("check was not rescheduled")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRunQueueCapsConcurrentRunsPerHost(t *testing.T) {
+	started := make(chan string, 3)
+	release := make(chan struct{})
+	q, clock := newTestRunQueue(t, 4, 1, func(check proto.ProbeCheck, _ []string) []string {
+		started <- check.ID
+		if check.ID != "b-1" {
+			<-release
+		}
+		return nil
+	})
+	t.Cleanup(func() { close(release) })
+
+	q.Add(proto.ProbeCheck{ID: "a-1", Type: "http", Target: "https://a.example.com/one", Interval: 60})
+	q.Add(proto.ProbeCheck{ID: "a-2", Type: "http", Target: "https://A.example.com/two", Interval: 60})
+	q.Add(proto.ProbeCheck{ID: "b-1", Type: "tcp", Target: "b.example.com:443", Interval: 60})
+	clock.Advance(time.Minute)
+	q.signal()
+
+	first := map[string]bool{}
+	for range 2 {
+		select {
+		case id := <-started:
+			first[id] = true
+		case <-time.After(time.Second):
+			t.Fatalf("started = %v, want one run per host", first)
+		}
+	}
+	if !first["b-1"] || first["a-1"] == first["a-2"] {
+		t.Fatalf("started = %v, want b-1 plus exactly one a.example.com check", first)
+	}
+	select {
+	case id := <-started:
+		t.Fatalf("started %s while its host was saturated", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	release <- struct{}{}
+	select {
+	case id := <-started:
+		if first[id] {
+			t.Fatalf("started %s twice, want the waiting a.example.com check", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiting check did not start after its host freed up")
+	}
+}
+
+func TestRunQueueReportsLagAndSkippedSlots(t *testing.T) {
+	done := make(chan struct{}, 1)
+	q, clock := newTestRunQueue(t, 1, 1, func(proto.ProbeCheck, []string) []string { done <- struct{}{}; return nil })
+
+	q.Add(proto.ProbeCheck{ID: "check-a", Type: "dns", Target: "example.com", Interval: 10})
+	clock.Advance(35 * time.Second)
+	q.signal()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("check did not run")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		stats := q.Stats(false)
+		if stats.Skipped > 0 {
+			if stats.Runs != 1 || stats.MaxLag < 25*time.Second {
+				t.Fatalf("stats = %+v, want one run at least 25s late", stats)
+			}
+			if stats.Skipped < 2 {
+				t.Fatalf("skipped = %d, want late slots dropped", stats.Skipped)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("stats = %+v, want skipped slots recorded", stats)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if reset := q.Stats(true); reset.Runs != 1 {
+		t.Fatalf("Stats(true) runs = %d, want 1", reset.Runs)
+	}
+	if after := q.Stats(false); after.Runs != 0 || after.Skipped != 0 || after.MaxLag != 0 {
+		t.Fatalf("stats after reset = %+v, want zeroed counters", after)
+	}
+}
+
+func TestRunQueueRemoveStopsFutureRuns(t *testing.T) {
+	ran := make(chan struct{}, 1)
+	q, clock := newTestRunQueue(t, 1, 1, func(proto.ProbeCheck, []string) []string { ran <- struct{}{}; return nil })
+
+	entry := q.Add(proto.ProbeCheck{ID: "check-a", Type: "dns", Target: "example.com", Interval: 10})
+	q.Remove(entry)
+	clock.Advance(time.Minute)
+	q.signal()
+
+	select {
+	case <-ran:
+		t.Fatal("removed check ran")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRunQueueRequeuesRetriesWithoutHoldingAWorker(t *testing.T) {
+	type attempt struct {
+		id     string
+		failed []string
+	}
+	attempts := make(chan attempt, 4)
+	q, clock := newTestRunQueue(t, 1, 1, func(check proto.ProbeCheck, failed []string) []string {
+		attempts <- attempt{id: check.ID, failed: failed}
+		if check.ID == "flaky" && len(failed) == 0 {
+			return []string{"timeout"}
+		}
+		return nil
+	})
+	q.mu.Lock()
+	q.retryDelay = time.Minute
+	q.mu.Unlock()
+	next := func() attempt {
+		t.Helper()
+		select {
+		case got := <-attempts:
+			return got
+		case <-time.After(time.Second):
+			t.Fatal("check did not run")
+			return attempt{}
+		}
+	}
+
+	flaky := q.Add(proto.ProbeCheck{ID: "flaky", Type: "tcp", Target: "a.example.com:443", Interval: 60, Retries: 1})
+	clock.Advance(maxFirstRunJitter)
+	q.signal()
+	if got := next(); got.id != "flaky" || got.failed != nil {
+		t.Fatalf("first attempt = %+v, want flaky with no earlier failures", got)
+	}
+
+	// The retry waits on the heap, so the single worker is free for other
+	// checks in the meantime.
+	q.Add(proto.ProbeCheck{ID: "healthy", Type: "tcp", Target: "b.example.com:443", Interval: 3600})
+	clock.Advance(maxFirstRunJitter)
+	q.signal()
+	if got := next(); got.id != "healthy" {
+		t.Fatalf("attempt = %+v, want healthy while flaky waits to retry", got)
+	}
+
+	clock.Advance(time.Minute)
+	q.signal()
+	if got := next(); got.id != "flaky" || len(got.failed) != 1 || got.failed[0] != "timeout" {
+		t.Fatalf("retry = %+v, want flaky with the first failure", got)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		q.mu.Lock()
+		aligned, failed, next := flaky.aligned, flaky.failed, flaky.next
+		q.mu.Unlock()
+		if aligned {
+			if failed != nil {
+				t.Fatalf("failed = %v after the run finished, want cleared", failed)
+			}
+			offset := phaseOffset("probe-1", "flaky", time.Minute)
+			if got := next.Sub(next.Truncate(time.Minute)); got != offset {
+				t.Fatalf("next run offset = %s, want phase slot %s", got, offset)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("retried check was not rescheduled")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRunQueueRunOnceSharesHostSlotsAndCapsQueuedRuns(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan string, maxQueuedRuns+2)
+	q, clock := newTestRunQueue(t, 4, 1, func(check proto.ProbeCheck, _ []string) []string {
+		started <- check.ID
+		<-release
+		return nil
+	})
+
+	q.Add(proto.ProbeCheck{ID: "scheduled", Type: "tcp", Target: "a.example.com:443", Interval: 3600})
+	clock.Advance(maxFirstRunJitter)
+	q.signal()
+	if got := <-started; got != "scheduled" {
+		t.Fatalf("started %s, want the scheduled check", got)
+	}
+
+	ran := make(chan string, maxQueuedRuns)
+	once := func(check proto.ProbeCheck, _ []string) []string {
+		ran <- check.ID
+		return nil
+	}
+	for i := 0; i < maxQueuedRuns; i++ {
+		if !q.RunOnce(proto.ProbeCheck{ID: fmt.Sprintf("run-%d", i), Type: "tcp", Target: "a.example.com:443"}, once) {
+			t.Fatalf("RunOnce() #%d = false, want queued", i+1)
+		}
+	}
+	if q.RunOnce(proto.ProbeCheck{ID: "run-over", Type: "tcp", Target: "b.example.com:443"}, once) {
+		t.Fatal("RunOnce() over the cap = true, want refused")
+	}
+	select {
+	case id := <-ran:
+		t.Fatalf("on-demand %s ran while its host was saturated", id)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	for i := 0; i < maxQueuedRuns; i++ {
+		select {
+		case <-ran:
+		case <-time.After(time.Second):
+			t.Fatalf("%d on-demand runs finished, want %d", i, maxQueuedRuns)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for !q.RunOnce(proto.ProbeCheck{ID: "run-after", Type: "tcp", Target: "b.example.com:443"}, once) {
+		if time.Now().After(deadline) {
+			t.Fatal("RunOnce() still refused after queued runs finished")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -1,8 +1,9 @@
 package main
 
 import (
-	"context"
+	"fmt"
 	"log/slog"
+	"sort"
 	"sync"
 	"time"
 
@@ -12,34 +13,48 @@ import (
 	"github.com/tmater/wacht/internal/proto"
 )
 
-// runningCheck tracks one live worker so reconcile can stop or replace it by
-// stable check ID instead of rebuilding the whole scheduler.
+// checkRetryDelay is the pause before each confirmation retry of a failed
+// check.
+const checkRetryDelay = 2 * time.Second
+
+// runningCheck tracks one scheduled check so reconcile can stop or replace it
+// by stable check ID instead of rebuilding the whole scheduler.
 type runningCheck struct {
 	check  proto.ProbeCheck
-	cancel context.CancelFunc
+	cancel func()
 }
 
 type resultSink interface {
 	Enqueue(proto.CheckResult)
 }
 
-// scheduler owns the per-check workers that execute checks on their configured
-// intervals.
+// scheduler tracks the desired check set and feeds it into a shared run queue
+// that executes checks on their configured intervals.
 type scheduler struct {
 	mu          sync.Mutex
 	running     map[string]runningCheck
 	startWorker func(proto.ProbeCheck) runningCheck
+	attempt     func(proto.ProbeCheck) proto.CheckResult
+	queue       *runQueue
 }
 
-// TODO: This goroutine-per-check model is fine at small scale, but a central
-// scheduler plus bounded worker pool will scale better once probes need to run
-// large check sets with smoother execution spread.
-func newScheduler(cfg *config.ProbeConfig, policy network.Policy, sink resultSink) *scheduler {
+func newScheduler(cfg *config.ProbeConfig, policy network.Policy, sink resultSink, canaries *canaryMonitor, tracer *pathTracer) *scheduler {
 	s := &scheduler{
 		running: make(map[string]runningCheck),
 	}
+	s.queue = newRunQueue(cfg.Scheduler.Workers, cfg.Scheduler.HostConcurrency, cfg.ProbeID, func(check proto.ProbeCheck, failed []string) []string {
+		return runAndQueue(cfg, policy, sink, canaries, tracer, check, failed)
+	})
+	s.attempt = func(check proto.ProbeCheck) proto.CheckResult {
+		result, _ := runAttempt(cfg.ProbeID, policy, canaries, check)
+		return result
+	}
 	s.startWorker = func(check proto.ProbeCheck) runningCheck {
-		return s.startRuntimeWorker(cfg, policy, sink, check)
+		entry := s.queue.Add(check)
+		return runningCheck{
+			check:  check,
+			cancel: func() { s.queue.Remove(entry) },
+		}
 	}
 	return s
 }
@@ -74,61 +89,121 @@ func (s *scheduler) Reconcile(latest []proto.ProbeCheck) {
 	}
 }
 
-// Close stops every running worker during probe shutdown.
+// RunNow runs check once on the scheduler's workers, outside its schedule,
+// and hands the result to done on its own goroutine. Unsupported check types
+// are answered at once. It reports false when too many on-demand runs are
+// already queued.
+func (s *scheduler) RunNow(check proto.ProbeCheck, done func(proto.CheckResult)) bool {
+	if _, ok := checkRunners[check.Type]; !ok {
+		go done(failedRunResult(check, fmt.Sprintf("check type %q is not supported by this probe", check.Type)))
+		return true
+	}
+	return s.queue.RunOnce(check, func(check proto.ProbeCheck, failed []string) []string {
+		result := s.attempt(check)
+		if failed, retry := confirmAttempt(&result, failed, check.Retries); retry {
+			return failed
+		}
+		go done(result)
+		return nil
+	})
+}
+
+// Close stops every scheduled check during probe shutdown and waits for runs
+// already in flight.
 func (s *scheduler) Close() {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-
 	for id, job := range s.running {
 		job.cancel()
 		delete(s.running, id)
 	}
+	s.mu.Unlock()
+
+	if s.queue != nil {
+		s.queue.Close()
+	}
 }
 
-// startRuntimeWorker runs the check once immediately, then continues on the
-// configured interval until reconcile or shutdown cancels it.
-func (s *scheduler) startRuntimeWorker(cfg *config.ProbeConfig, policy network.Policy, sink resultSink, check proto.ProbeCheck) runningCheck {
-	ctx, cancel := context.WithCancel(context.Background())
-
-	go func() {
-		runAndQueue(cfg, policy, sink, check)
-		ticker := time.NewTicker(time.Duration(check.Interval) * time.Second)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				runAndQueue(cfg, policy, sink, check)
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
+// checkRunners maps each check type this build can execute to its runner. The
+// probe advertises these types at registration, so the server never assigns
+// a check the probe cannot run.
+var checkRunners = map[string]func(checkID, probeID, target string, policy network.Policy, opts checks.Options) proto.CheckResult{
+	string(checks.CheckHTTP):      checks.HTTPWith,
+	string(checks.CheckTCP):       checks.TCPWith,
+	string(checks.CheckDNS):       checks.DNSWith,
+	string(checks.CheckTCPExpect): checks.TCPExpectWith,
+}
 
-	return runningCheck{
-		check:  check,
-		cancel: cancel,
+// supportedCheckTypes returns the check types this build can execute in a
+// stable order.
+func supportedCheckTypes() []string {
+	types := make([]string, 0, len(checkRunners))
+	for checkType := range checkRunners {
+		types = append(types, checkType)
 	}
+	sort.Strings(types)
+	return types
 }
 
-func runAndQueue(cfg *config.ProbeConfig, policy network.Policy, sink resultSink, check proto.ProbeCheck) {
-	var result proto.CheckResult
-	switch check.Type {
-	case string(checks.CheckHTTP):
-		result = checks.HTTP(check.ID, cfg.ProbeID, check.Target, policy)
-	case string(checks.CheckTCP):
-		result = checks.TCP(check.ID, cfg.ProbeID, check.Target, policy)
-	case string(checks.CheckDNS):
-		result = checks.DNS(check.ID, cfg.ProbeID, check.Target, policy)
-	default:
+// runAndQueue runs one attempt of a scheduled check and queues the result
+// once the run is done. It returns the failed attempts so far when the check
+// should be retried first, or nil.
+func runAndQueue(cfg *config.ProbeConfig, policy network.Policy, sink resultSink, canaries *canaryMonitor, tracer *pathTracer, check proto.ProbeCheck, failed []string) []string {
+	result, ok := runAttempt(cfg.ProbeID, policy, canaries, check)
+	if !ok {
 		slog.Default().Warn("unknown check type; skipping", "component", "probe", "check_id", check.ID, "check_name", check.Name, "probe_id", cfg.ProbeID, "check_type", check.Type)
-		return
+		return nil
 	}
-	result.CheckID = check.ID
-	result.CheckName = check.Name
+	if failed, retry := confirmAttempt(&result, failed, check.Retries); retry {
+		return failed
+	}
+	tracer.Observe(check, &result)
 	if sink == nil {
 		slog.Default().Warn("result sink missing; dropping result", "component", "probe", "check_id", check.ID, "check_name", check.Name, "probe_id", cfg.ProbeID)
-		return
+		return nil
 	}
 	sink.Enqueue(result)
+	return nil
+}
+
+// runAttempt executes one attempt of check through its runner. It reports
+// false when this build cannot run the check type.
+func runAttempt(probeID string, policy network.Policy, canaries *canaryMonitor, check proto.ProbeCheck) (proto.CheckResult, bool) {
+	run, ok := checkRunners[check.Type]
+	if !ok {
+		return proto.CheckResult{}, false
+	}
+	result := run(check.ID, probeID, check.Target, policy, checks.ProbeOptions(check))
+	result.CheckID = check.ID
+	result.CheckName = check.Name
+	result.ProbeDegraded = canaries.Degraded() != ""
+	return result, true
+}
+
+// runWithRetries runs a check and, while it fails, re-runs it up to retries
+// more times after delay. It returns the last result with every attempt
+// recorded, so a single dropped packet is not reported as down.
+func runWithRetries(run func() proto.CheckResult, retries int, delay time.Duration) proto.CheckResult {
+	var failed []string
+	for {
+		result := run()
+		next, retry := confirmAttempt(&result, failed, retries)
+		if !retry {
+			return result
+		}
+		failed = next
+		time.Sleep(delay)
+	}
+}
+
+// confirmAttempt folds one attempt into a run with up to retries confirmation
+// retries. While the check fails and retries remain it returns failed with
+// this attempt's error appended and true; otherwise it records every attempt
+// on result.
+func confirmAttempt(result *proto.CheckResult, failed []string, retries int) ([]string, bool) {
+	if !result.Up && len(failed) < retries {
+		return append(failed, result.Error), true
+	}
+	result.Attempts = len(failed) + 1
+	result.AttemptErrors = failed
+	return nil, false
 }
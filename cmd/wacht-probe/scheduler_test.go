@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
 
@@ -96,3 +97,50 @@ func toSet(values []string) map[string]int {
 	}
 	return set
 }
+
+func TestSupportedCheckTypesMatchRunners(t *testing.T) {
+	got := supportedCheckTypes()
+	want := []string{"dns", "http", "tcp", "tcp-expect"}
+	if len(got) != len(want) {
+		t.Fatalf("supportedCheckTypes() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("supportedCheckTypes() = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestRunWithRetriesConfirmsFailureBeforeReporting(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		outcomes     []bool
+		retries      int
+		wantUp       bool
+		wantAttempts int
+	}{
+		{name: "up first time", outcomes: []bool{true}, retries: 2, wantUp: true, wantAttempts: 1},
+		{name: "recovers on retry", outcomes: []bool{false, true}, retries: 2, wantUp: true, wantAttempts: 2},
+		{name: "confirmed down", outcomes: []bool{false, false, false}, retries: 2, wantUp: false, wantAttempts: 3},
+		{name: "no retries", outcomes: []bool{false}, retries: 0, wantUp: false, wantAttempts: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			runs := 0
+			result := runWithRetries(func() proto.CheckResult {
+				up := tc.outcomes[runs]
+				runs++
+				if up {
+					return proto.CheckResult{Up: true}
+				}
+				return proto.CheckResult{Error: fmt.Sprintf("attempt %d failed", runs)}
+			}, tc.retries, 0)
+
+			if result.Up != tc.wantUp || result.Attempts != tc.wantAttempts || runs != tc.wantAttempts {
+				t.Fatalf("result = %+v after %d runs, want up=%t attempts=%d", result, runs, tc.wantUp, tc.wantAttempts)
+			}
+			if len(result.AttemptErrors) != tc.wantAttempts-1 {
+				t.Fatalf("AttemptErrors = %v, want %d earlier failures", result.AttemptErrors, tc.wantAttempts-1)
+			}
+		})
+	}
+}
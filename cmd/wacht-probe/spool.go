@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/tmater/wacht/internal/config"
+	"github.com/tmater/wacht/internal/proto"
+)
+
+const (
+	spoolSegmentSuffix    = ".seg"
+	spoolCursorFile       = "cursor"
+	maxSpoolSegmentBytes  = 4 << 20
+	minSpoolSegmentBytes  = 64 << 10
+	spoolSegmentsPerLimit = 4
+)
+
+// spoolPosition points at the next unread record: a segment number and a byte
+// offset inside it.
+type spoolPosition struct {
+	Segment uint64 `json:"segment"`
+	Offset  int64  `json:"offset"`
+}
+
+// resultSpool is an append-only, on-disk queue of check results that outlives
+// server outages and probe restarts. Records are JSON lines spread over
+// numbered segment files; a small cursor file remembers how far the server has
+// acknowledged. Delivery is at-least-once: a crash between upload and cursor
+// write replays the last batch.
+type resultSpool struct {
+	dir          string
+	maxBytes     int64
+	segmentBytes int64
+	fsync        string
+
+	mu       sync.Mutex
+	segments []uint64
+	sizes    map[uint64]int64
+	active   *os.File
+	cursor   spoolPosition
+	dirty    bool
+	closed   bool
+}
+
+func openResultSpool(dir string, maxBytes int64, fsync string) (*resultSpool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("spool: create dir: %w", err)
+	}
+	segmentBytes := min(max(maxBytes/spoolSegmentsPerLimit, minSpoolSegmentBytes), maxSpoolSegmentBytes)
+	s := &resultSpool{
+		dir:          dir,
+		maxBytes:     maxBytes,
+		segmentBytes: segmentBytes,
+		fsync:        fsync,
+		sizes:        make(map[uint64]int64),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *resultSpool) load() error {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return fmt.Errorf("spool: read dir: %w", err)
+	}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), spoolSegmentSuffix)
+		if !ok {
+			continue
+		}
+		id, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("spool: stat segment: %w", err)
+		}
+		s.segments = append(s.segments, id)
+		s.sizes[id] = info.Size()
+	}
+	slices.Sort(s.segments)
+
+	data, err := os.ReadFile(filepath.Join(s.dir, spoolCursorFile))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		if len(s.segments) > 0 {
+			s.cursor = spoolPosition{Segment: s.segments[0]}
+		}
+	case err != nil:
+		return fmt.Errorf("spool: read cursor: %w", err)
+	default:
+		if err := json.Unmarshal(data, &s.cursor); err != nil {
+			return fmt.Errorf("spool: parse cursor: %w", err)
+		}
+	}
+
+	// Segments before the cursor were fully delivered before a crash cut
+	// their cleanup short.
+	for len(s.segments) > 0 && s.segments[0] < s.cursor.Segment {
+		if err := s.removeSegmentLocked(s.segments[0]); err != nil {
+			return err
+		}
+	}
+	if len(s.segments) == 0 {
+		return s.openSegmentLocked(max(s.cursor.Segment, 1))
+	}
+	if s.cursor.Segment < s.segments[0] {
+		s.cursor = spoolPosition{Segment: s.segments[0]}
+	}
+
+	activeID := s.segments[len(s.segments)-1]
+	if err := s.repairTailLocked(activeID); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.segmentPath(activeID), os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("spool: open segment: %w", err)
+	}
+	s.active = f
+	return nil
+}
+
+// repairTailLocked drops a torn final record left by a crash mid-append so new
+// records start on a clean line.
+func (s *resultSpool) repairTailLocked(id uint64) error {
+	data, err := os.ReadFile(s.segmentPath(id))
+	if err != nil {
+		return fmt.Errorf("spool: read segment: %w", err)
+	}
+	if len(data) == 0 || data[len(data)-1] == '\n' {
+		return nil
+	}
+	size := int64(bytes.LastIndexByte(data, '\n') + 1)
+	if err := os.Truncate(s.segmentPath(id), size); err != nil {
+		return fmt.Errorf("spool: truncate torn segment: %w", err)
+	}
+	s.sizes[id] = size
+	return nil
+}
+
+// Append writes results to the end of the spool. When the spool outgrows its
+// cap, whole segments are dropped oldest first.
+func (s *resultSpool) Append(results []proto.CheckResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, result := range results {
+		if err := enc.Encode(result); err != nil {
+			return fmt.Errorf("spool: encode result: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("spool: closed")
+	}
+
+	activeID := s.activeIDLocked()
+	if _, err := s.active.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("spool: append: %w", err)
+	}
+	s.sizes[activeID] += int64(buf.Len())
+	s.dirty = true
+	if s.fsync == config.SpoolFsyncAlways {
+		if err := s.syncLocked(); err != nil {
+			return err
+		}
+	}
+
+	if s.sizes[activeID] >= s.segmentBytes {
+		if err := s.rotateLocked(); err != nil {
+			return err
+		}
+	}
+	return s.enforceLimitLocked()
+}
+
+// Peek returns up to n of the oldest undelivered results plus the position
+// just past them, for Commit once the server accepted the batch.
+func (s *resultSpool) Peek(n int) ([]proto.CheckResult, spoolPosition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pos := s.cursor
+	var results []proto.CheckResult
+	for _, id := range s.segments {
+		if id < pos.Segment {
+			continue
+		}
+		if len(results) >= n {
+			break
+		}
+		if id > pos.Segment {
+			pos = spoolPosition{Segment: id}
+		}
+
+		read, next, err := s.readSegmentLocked(id, pos.Offset, n-len(results))
+		if err != nil {
+			return nil, s.cursor, err
+		}
+		results = append(results, read...)
+		pos.Offset = next
+	}
+	return results, pos, nil
+}
+
+func (s *resultSpool) readSegmentLocked(id uint64, offset int64, n int) ([]proto.CheckResult, int64, error) {
+	f, err := os.Open(s.segmentPath(id))
+	if err != nil {
+		return nil, offset, fmt.Errorf("spool: open segment: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset, fmt.Errorf("spool: seek segment: %w", err)
+	}
+
+	reader := bufio.NewReader(f)
+	var results []proto.CheckResult
+	for len(results) < n {
+		line, err := reader.ReadBytes('\n')
+		if len(line) == 0 || line[len(line)-1] != '\n' {
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, offset, fmt.Errorf("spool: read segment: %w", err)
+			}
+			break
+		}
+		offset += int64(len(line))
+
+		var result proto.CheckResult
+		if err := json.Unmarshal(line, &result); err != nil {
+			slog.Default().Warn("skipping unreadable spooled result", "component", "probe_spool", "segment", id, "offset", offset, "err", err)
+			continue
+		}
+		results = append(results, result)
+	}
+	return results, offset, nil
+}
+
+// Commit marks everything before pos as delivered and deletes segments that
+// are no longer needed. A fully drained spool starts a fresh segment so disk
+// usage shrinks back to zero after an outage.
+func (s *resultSpool) Commit(pos spoolPosition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("spool: closed")
+	}
+
+	if pos.Segment < s.cursor.Segment || (pos.Segment == s.cursor.Segment && pos.Offset < s.cursor.Offset) {
+		// The segment was dropped by the size cap while the batch was in
+		// flight; the cursor already moved past it.
+		return nil
+	}
+	s.cursor = pos
+	activeID := s.activeIDLocked()
+	if pos.Segment == activeID && pos.Offset >= s.sizes[activeID] && pos.Offset > 0 {
+		if err := s.rotateLocked(); err != nil {
+			return err
+		}
+		s.cursor = spoolPosition{Segment: s.activeIDLocked()}
+	}
+	if err := s.writeCursorLocked(); err != nil {
+		return err
+	}
+	for len(s.segments) > 1 && s.segments[0] < s.cursor.Segment {
+		if err := s.removeSegmentLocked(s.segments[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Empty reports whether every spooled result has been delivered.
+func (s *resultSpool) Empty() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	activeID := s.activeIDLocked()
+	return s.cursor.Segment == activeID && s.cursor.Offset >= s.sizes[activeID]
+}
+
+// Sync flushes appended records to stable storage. The batcher calls it on
+// every flush tick when the fsync policy is "interval".
+func (s *resultSpool) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	return s.syncLocked()
+}
+
+func (s *resultSpool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+
+	var err error
+	if s.fsync != config.SpoolFsyncNever {
+		err = s.syncLocked()
+	}
+	return errors.Join(err, s.active.Close())
+}
+
+func (s *resultSpool) syncLocked() error {
+	if !s.dirty {
+		return nil
+	}
+	if err := s.active.Sync(); err != nil {
+		return fmt.Errorf("spool: sync: %w", err)
+	}
+	s.dirty = false
+	return nil
+}
+
+func (s *resultSpool) rotateLocked() error {
+	if s.fsync != config.SpoolFsyncNever {
+		if err := s.syncLocked(); err != nil {
+			return err
+		}
+	}
+	if err := s.active.Close(); err != nil {
+		return fmt.Errorf("spool: close segment: %w", err)
+	}
+	return s.openSegmentLocked(s.activeIDLocked() + 1)
+}
+
+func (s *resultSpool) openSegmentLocked(id uint64) error {
+	f, err := os.OpenFile(s.segmentPath(id), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("spool: create segment: %w", err)
+	}
+	s.active = f
+	s.segments = append(s.segments, id)
+	s.sizes[id] = 0
+	if len(s.segments) == 1 {
+		s.cursor = spoolPosition{Segment: id}
+	}
+	return nil
+}
+
+func (s *resultSpool) enforceLimitLocked() error {
+	total := int64(0)
+	for _, id := range s.segments {
+		total += s.sizes[id]
+	}
+	for total > s.maxBytes && len(s.segments) > 1 {
+		oldest := s.segments[0]
+		size := s.sizes[oldest]
+		if err := s.removeSegmentLocked(oldest); err != nil {
+			return err
+		}
+		total -= size
+		slog.Default().Warn("spool full; dropping oldest spooled results", "component", "probe_spool", "segment", oldest, "bytes", size)
+		if s.cursor.Segment <= oldest {
+			s.cursor = spoolPosition{Segment: s.segments[0]}
+			if err := s.writeCursorLocked(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *resultSpool) removeSegmentLocked(id uint64) error {
+	if err := os.Remove(s.segmentPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("spool: remove segment: %w", err)
+	}
+	s.segments = slices.DeleteFunc(s.segments, func(v uint64) bool { return v == id })
+	delete(s.sizes, id)
+	return nil
+}
+
+// writeCursorLocked replaces the cursor file atomically so a crash leaves
+// either the old or the new position, never a torn one.
+func (s *resultSpool) writeCursorLocked() error {
+	data, err := json.Marshal(s.cursor)
+	if err != nil {
+		return fmt.Errorf("spool: encode cursor: %w", err)
+	}
+	tmp := filepath.Join(s.dir, spoolCursorFile+".tmp")
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("spool: write cursor: %w", err)
+	}
+	_, err = f.Write(data)
+	if err == nil && s.fsync == config.SpoolFsyncAlways {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("spool: write cursor: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, spoolCursorFile)); err != nil {
+		return fmt.Errorf("spool: write cursor: %w", err)
+	}
+	return nil
+}
+
+func (s *resultSpool) activeIDLocked() uint64 {
+	return s.segments[len(s.segments)-1]
+}
+
+func (s *resultSpool) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, spoolSegmentSuffix))
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tmater/wacht/internal/config"
+	"github.com/tmater/wacht/internal/proto"
+)
+
+func spoolResults(names ...string) []proto.CheckResult {
+	results := make([]proto.CheckResult, 0, len(names))
+	for _, name := range names {
+		results = append(results, proto.CheckResult{CheckID: "00000000-0000-0000-0000-000000000101", CheckName: name, ProbeID: "probe-1"})
+	}
+	return results
+}
+
+func resultNames(results []proto.CheckResult) []string {
+	names := make([]string, 0, len(results))
+	for _, result := range results {
+		names = append(names, result.CheckName)
+	}
+	return names
+}
+
+func openTestSpool(t *testing.T, dir string) *resultSpool {
+	t.Helper()
+	spool, err := openResultSpool(dir, config.DefaultProbeSpoolMaxBytes, config.SpoolFsyncAlways)
+	if err != nil {
+		t.Fatalf("openResultSpool: %v", err)
+	}
+	return spool
+}
+
+func TestResultSpoolResumesFromCursorAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	spool := openTestSpool(t, dir)
+	if err := spool.Append(spoolResults("r1", "r2", "r3")); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	batch, pos, err := spool.Peek(2)
+	if err != nil {
+		t.Fatalf("Peek: %v", err)
+	}
+	if got := fmt.Sprint(resultNames(batch)); got != "[r1 r2]" {
+		t.Fatalf("Peek = %s, want [r1 r2]", got)
+	}
+	if err := spool.Commit(pos); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	if err := spool.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	reopened := openTestSpool(t, dir)
+	defer reopened.Close()
+	if err := reopened.Append(spoolResults("r4")); err != nil {
+		t.Fatalf("Append after reopen: %v", err)
+	}
+	batch, pos, err = reopened.Peek(10)
+	if err != nil {
+		t.Fatalf("Peek after reopen: %v", err)
+	}
+	if got := fmt.Sprint(resultNames(batch)); got != "[r3 r4]" {
+		t.Fatalf("Peek after reopen = %s, want [r3 r4]", got)
+	}
+	if err := reopened.Commit(pos); err != nil {
+		t.Fatalf("Commit after reopen: %v", err)
+	}
+	if !reopened.Empty() {
+		t.Fatal("Empty() = false after draining every result")
+	}
+	segments, _ := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentSuffix))
+	if len(segments) != 1 {
+		t.Fatalf("segments = %v, want only the fresh active segment", segments)
+	}
+}
+
+func TestResultSpoolDropsTornTailOnOpen(t *testing.T) {
+	dir := t.TempDir()
+	spool := openTestSpool(t, dir)
+	if err := spool.Append(spoolResults("r1")); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	path := spool.segmentPath(spool.activeIDLocked())
+	spool.Close()
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	f.WriteString(`{"check_id":"torn`)
+	f.Close()
+
+	reopened := openTestSpool(t, dir)
+	defer reopened.Close()
+	if err := reopened.Append(spoolResults("r2")); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	batch, _, err := reopened.Peek(10)
+	if err != nil {
+		t.Fatalf("Peek: %v", err)
+	}
+	if got := fmt.Sprint(resultNames(batch)); got != "[r1 r2]" {
+		t.Fatalf("Peek = %s, want [r1 r2]", got)
+	}
+}
+
+func TestResultSpoolCapDropsOldestSegments(t *testing.T) {
+	spool := openTestSpool(t, t.TempDir())
+	defer spool.Close()
+	spool.segmentBytes = 1
+	spool.maxBytes = 300
+
+	for i := range 10 {
+		if err := spool.Append(spoolResults(fmt.Sprintf("r%d", i))); err != nil {
+			t.Fatalf("Append %d: %v", i, err)
+		}
+	}
+
+	batch, _, err := spool.Peek(100)
+	if err != nil {
+		t.Fatalf("Peek: %v", err)
+	}
+	if len(batch) == 0 || len(batch) >= 10 {
+		t.Fatalf("kept %d results, want the cap to drop some but not all", len(batch))
+	}
+	if last := batch[len(batch)-1].CheckName; last != "r9" {
+		t.Fatalf("newest kept = %s, want r9", last)
+	}
+}
+
+func TestResultBatcherSpoolsFailedBatchesAndDrainsThemFirst(t *testing.T) {
+	spool := openTestSpool(t, t.TempDir())
+	poster := &fakeResultPoster{callCh: make(chan []proto.CheckResult, 8)}
+	var serverDown atomic.Bool
+	serverDown.Store(true)
+	poster.postFn = func([]proto.CheckResult) error {
+		if serverDown.Load() {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+
+	batcher := newResultBatcher(poster, time.Hour, 2, spool, nil)
+	defer batcher.Close()
+
+	batcher.Enqueue(spoolResults("old-1")[0])
+	batcher.Enqueue(spoolResults("old-2")[0])
+	<-poster.callCh
+	// The failed batch is spooled after the upload returns.
+	deadline := time.Now().Add(time.Second)
+	for spool.Empty() {
+		if time.Now().After(deadline) {
+			t.Fatal("spool empty after failed upload, want batch on disk")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	serverDown.Store(false)
+	batcher.Enqueue(spoolResults("new-1")[0])
+	batcher.Enqueue(spoolResults("new-2")[0])
+
+	var uploaded []string
+	timeout := time.After(time.Second)
+	for len(uploaded) < 4 {
+		select {
+		case batch := <-poster.callCh:
+			uploaded = append(uploaded, resultNames(batch)...)
+		case <-timeout:
+			t.Fatalf("uploaded = %v, want all four results", uploaded)
+		}
+	}
+	if got := fmt.Sprint(uploaded); got != "[old-1 old-2 new-1 new-2]" {
+		t.Fatalf("uploaded = %s, want spooled results first", got)
+	}
+}
+
+func TestResultBatcherCloseSpoolsUndeliveredResults(t *testing.T) {
+	dir := t.TempDir()
+	poster := &fakeResultPoster{postFn: func([]proto.CheckResult) error { return errors.New("connection refused") }}
+	batcher := newResultBatcher(poster, time.Hour, 8, openTestSpool(t, dir), nil)
+
+	batcher.Enqueue(spoolResults("r1")[0])
+	batcher.Close()
+
+	reopened := openTestSpool(t, dir)
+	defer reopened.Close()
+	batch, _, err := reopened.Peek(10)
+	if err != nil {
+		t.Fatalf("Peek: %v", err)
+	}
+	if got := fmt.Sprint(resultNames(batch)); got != "[r1]" {
+		t.Fatalf("spooled = %s, want [r1]", got)
+	}
+}
+
+func TestResultBatcherKeepsSpoolInSeqOrderWhenOverflowMeetsFailedUpload(t *testing.T) {
+	spool := openTestSpool(t, t.TempDir())
+	poster := &fakeResultPoster{callCh: make(chan []proto.CheckResult, 8)}
+	release := make(chan struct{})
+	var serverDown atomic.Bool
+	serverDown.Store(true)
+	poster.postFn = func([]proto.CheckResult) error {
+		if serverDown.Load() {
+			<-release
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+
+	batcher := newResultBatcher(poster, time.Hour, 2, spool, nil)
+	batcher.maxPending = 2
+	defer batcher.Close()
+
+	batcher.Enqueue(spoolResults("r1")[0])
+	batcher.Enqueue(spoolResults("r2")[0])
+	<-poster.callCh
+	// The upload of r1/r2 hangs while newer results overflow memory.
+	for _, name := range []string{"r3", "r4", "r5"} {
+		batcher.Enqueue(spoolResults(name)[0])
+	}
+	serverDown.Store(false)
+	close(release)
+
+	var uploaded []proto.CheckResult
+	timeout := time.After(time.Second)
+	for len(uploaded) < 5 {
+		batcher.signalFlush()
+		select {
+		case batch := <-poster.callCh:
+			uploaded = append(uploaded, batch...)
+		case <-timeout:
+			t.Fatalf("uploaded = %v, want all five results", resultNames(uploaded))
+		}
+	}
+	if got := fmt.Sprint(resultNames(uploaded)); got != "[r1 r2 r3 r4 r5]" {
+		t.Fatalf("uploaded = %s, want the failed batch ahead of the overflow", got)
+	}
+	for i := 1; i < len(uploaded); i++ {
+		if uploaded[i].Seq <= uploaded[i-1].Seq {
+			t.Fatalf("seq %d after %d, want strictly increasing uploads", uploaded[i].Seq, uploaded[i-1].Seq)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	probeapi "github.com/tmater/wacht/internal/api/probe"
+	"github.com/tmater/wacht/internal/proto"
+)
+
+const (
+	registerRetryMin = time.Second
+	registerRetryMax = 2 * time.Minute
+)
+
+// probeAPI is the part of the probe-server API used at startup and for check
+// sync.
+type probeAPI interface {
+	Register(ctx context.Context, req probeapi.RegisterRequest) error
+	WatchChecks(ctx context.Context, revision string, wait time.Duration) ([]proto.ProbeCheck, string, bool, error)
+}
+
+// checkSetApplier hands a check set fetched from the server to the scheduler
+// and caches it for the next cold start.
+func checkSetApplier(cache *checkCache, probeID string, reconcile func([]proto.ProbeCheck)) func([]proto.ProbeCheck, string) {
+	return func(checks []proto.ProbeCheck, revision string) {
+		reconcile(checks)
+		if err := cache.Save(checks, revision); err != nil {
+			slog.Default().Warn("cache check set failed", "component", "probe", "probe_id", probeID, "err", err)
+		}
+	}
+}
+
+// startProbe runs the probe cold start without requiring the server. It
+// registers, falling back to background retries with backoff, then starts the
+// scheduler from the server's check set or, when the server is unreachable,
+// from the cached one. It returns the revision check sync should resume from.
+func startProbe(ctx context.Context, api probeAPI, probeID string, reg probeapi.RegisterRequest, cache *checkCache, reconcile func([]proto.ProbeCheck)) string {
+	logger := slog.Default()
+	if err := api.Register(ctx, reg); err != nil {
+		logger.Warn("register probe failed; retrying in background", "component", "probe", "probe_id", probeID, "err", err)
+		go registerWithBackoff(ctx, api, probeID, reg, registerRetryMin, registerRetryMax)
+	} else {
+		logger.Info("probe registered", "component", "probe", "probe_id", probeID)
+	}
+
+	checks, revision, _, err := api.WatchChecks(ctx, "", 0)
+	if err == nil {
+		logger.Info("checks fetched", "component", "probe", "probe_id", probeID, "count", len(checks))
+		checkSetApplier(cache, probeID, reconcile)(checks, revision)
+		return revision
+	}
+	logger.Warn("fetch checks failed", "component", "probe", "probe_id", probeID, "err", err)
+
+	cached, revision, ok, err := cache.Load()
+	if err != nil {
+		logger.Warn("load cached check set failed", "component", "probe", "probe_id", probeID, "err", err)
+	}
+	if !ok {
+		logger.Warn("no cached check set; waiting for server", "component", "probe", "probe_id", probeID)
+		return ""
+	}
+	logger.Info("starting from cached check set", "component", "probe", "probe_id", probeID, "count", len(cached), "revision", revision)
+	reconcile(cached)
+	return revision
+}
+
+// registerWithBackoff retries registration until it succeeds or ctx ends,
+// doubling the delay between attempts up to maxDelay.
+func registerWithBackoff(ctx context.Context, api probeAPI, probeID string, reg probeapi.RegisterRequest, minDelay, maxDelay time.Duration) {
+	delay := minDelay
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		err := api.Register(ctx, reg)
+		if err == nil {
+			slog.Default().Info("probe registered", "component", "probe", "probe_id", probeID)
+			return
+		}
+		delay = min(delay*2, maxDelay)
+		slog.Default().Warn("register probe retry failed", "component", "probe", "probe_id", probeID, "retry_in", delay, "err", err)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	probeapi "github.com/tmater/wacht/internal/api/probe"
+	"github.com/tmater/wacht/internal/proto"
+)
+
+type fakeProbeAPI struct {
+	mu         sync.Mutex
+	events     []string
+	registerFn func() error
+	watchFn    func(revision string) ([]proto.ProbeCheck, string, bool, error)
+}
+
+func (f *fakeProbeAPI) record(event string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.events = append(f.events, event)
+}
+
+func (f *fakeProbeAPI) Events() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.events...)
+}
+
+func (f *fakeProbeAPI) Register(context.Context, probeapi.RegisterRequest) error {
+	f.record("register")
+	if f.registerFn != nil {
+		return f.registerFn()
+	}
+	return nil
+}
+
+func (f *fakeProbeAPI) WatchChecks(_ context.Context, revision string, _ time.Duration) ([]proto.ProbeCheck, string, bool, error) {
+	f.record("watch")
+	if f.watchFn != nil {
+		return f.watchFn(revision)
+	}
+	return nil, "", false, nil
+}
+
+var errServerDown = errors.New("connection refused")
+
+func TestStartProbeUsesServerCheckSetAndCachesIt(t *testing.T) {
+	cache := newCheckCache(t.TempDir())
+	fresh := []proto.ProbeCheck{{ID: "check-1", Name: "api", Type: "http", Target: "https://example.com", Interval: 30}}
+	api := &fakeProbeAPI{watchFn: func(string) ([]proto.ProbeCheck, string, bool, error) {
+		return fresh, `"rev-1"`, true, nil
+	}}
+
+	var reconciled [][]proto.ProbeCheck
+	revision := startProbe(context.Background(), api, "probe-1", probeapi.RegisterRequest{}, cache, func(checks []proto.ProbeCheck) {
+		reconciled = append(reconciled, checks)
+	})
+
+	if revision != `"rev-1"` {
+		t.Fatalf("revision = %s, want rev-1", revision)
+	}
+	if events := api.Events(); len(events) != 2 || events[0] != "register" || events[1] != "watch" {
+		t.Fatalf("events = %v, want register then watch", events)
+	}
+	if len(reconciled) != 1 || reconciled[0][0].ID != "check-1" {
+		t.Fatalf("reconciled = %v, want the server check set", reconciled)
+	}
+	cached, cachedRevision, ok, err := cache.Load()
+	if err != nil || !ok || cachedRevision != `"rev-1"` || len(cached) != 1 {
+		t.Fatalf("cache = %v, %s, %t, %v, want server set at rev-1", cached, cachedRevision, ok, err)
+	}
+}
+
+func TestStartProbeFallsBackToCachedCheckSetWhenServerIsDown(t *testing.T) {
+	cache := newCheckCache(t.TempDir())
+	if err := cache.Save([]proto.ProbeCheck{{ID: "cached", Name: "db", Type: "tcp", Target: "db:5432", Interval: 30}}, `"rev-7"`); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	api := &fakeProbeAPI{
+		registerFn: func() error { return errServerDown },
+		watchFn: func(string) ([]proto.ProbeCheck, string, bool, error) {
+			return nil, "", false, errServerDown
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var reconciled [][]proto.ProbeCheck
+	revision := startProbe(ctx, api, "probe-1", probeapi.RegisterRequest{}, cache, func(checks []proto.ProbeCheck) {
+		reconciled = append(reconciled, checks)
+	})
+
+	if revision != `"rev-7"` {
+		t.Fatalf("revision = %s, want cached rev-7", revision)
+	}
+	if len(reconciled) != 1 || len(reconciled[0]) != 1 || reconciled[0][0].ID != "cached" {
+		t.Fatalf("reconciled = %v, want the cached check set", reconciled)
+	}
+}
+
+func TestStartProbeWaitsWithoutCacheWhenServerIsDown(t *testing.T) {
+	api := &fakeProbeAPI{watchFn: func(string) ([]proto.ProbeCheck, string, bool, error) {
+		return nil, "", false, errServerDown
+	}}
+
+	called := false
+	revision := startProbe(context.Background(), api, "probe-1", probeapi.RegisterRequest{}, newCheckCache(t.TempDir()), func([]proto.ProbeCheck) {
+		called = true
+	})
+
+	if revision != "" || called {
+		t.Fatalf("revision = %q, reconciled = %t, want empty start", revision, called)
+	}
+}
+
+func TestRegisterWithBackoffRetriesUntilSuccess(t *testing.T) {
+	attempts := 0
+	api := &fakeProbeAPI{registerFn: func() error {
+		attempts++
+		if attempts < 3 {
+			return errServerDown
+		}
+		return nil
+	}}
+
+	done := make(chan struct{})
+	go func() {
+		registerWithBackoff(context.Background(), api, "probe-1", probeapi.RegisterRequest{}, time.Millisecond, 4*time.Millisecond)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("registerWithBackoff did not return after a successful attempt")
+	}
+	if attempts != 3 {
+		t.Fatalf("attempts = %d, want 3", attempts)
+	}
+}
+
+func TestCheckCacheNilStoresNothing(t *testing.T) {
+	var cache *checkCache
+	if err := cache.Save([]proto.ProbeCheck{{ID: "check-1"}}, `"rev"`); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if _, _, ok, err := cache.Load(); ok || err != nil {
+		t.Fatalf("Load = %t, %v, want nothing cached", ok, err)
+	}
+	if newCheckCache("") != nil {
+		t.Fatal("expected no cache without a state dir")
+	}
+}
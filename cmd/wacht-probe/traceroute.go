@@ -0,0 +1,116 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/tmater/wacht/internal/checks"
+	"github.com/tmater/wacht/internal/config"
+	"github.com/tmater/wacht/internal/network"
+	"github.com/tmater/wacht/internal/proto"
+)
+
+// maxConcurrentTraces bounds how many traceroutes run at once. A trace can
+// take max_hops hop timeouts, so traces run beside the scheduler workers
+// rather than on them.
+const maxConcurrentTraces = 2
+
+// pathTracer traces the network path to an HTTP or TCP check's target when
+// the check starts failing, so the incident shows whether packets stop in the
+// probe's network, in transit, or at the target. It traces once per failing
+// streak: a check that keeps failing is traced again only after it was up.
+// Traces run in the background and the path rides on the check's next failing
+// result.
+type pathTracer struct {
+	trace func(checkType, target string) proto.NetworkPath
+	slots chan struct{}
+
+	mu     sync.Mutex
+	streak uint64
+	// traced maps a check in a traced failing streak to that streak's number,
+	// so a trace that finishes after the streak ended is dropped.
+	traced map[string]uint64
+	// paths holds finished traces waiting for the check's next failing result.
+	paths   map[string]proto.NetworkPath
+	running sync.WaitGroup
+}
+
+// newPathTracer returns nil when traceroute is disabled; a nil tracer never
+// traces.
+func newPathTracer(cfg config.ProbeTraceroute, policy network.Policy) *pathTracer {
+	if !cfg.Enabled {
+		return nil
+	}
+	opts := checks.TraceOptions{MaxHops: cfg.MaxHops, HopTimeout: cfg.HopTimeout}
+	return newPathTracerFunc(func(checkType, target string) proto.NetworkPath {
+		return checks.Traceroute(checks.Type(checkType), target, policy, opts)
+	})
+}
+
+func newPathTracerFunc(trace func(checkType, target string) proto.NetworkPath) *pathTracer {
+	return &pathTracer{
+		trace:  trace,
+		slots:  make(chan struct{}, maxConcurrentTraces),
+		traced: make(map[string]uint64),
+		paths:  make(map[string]proto.NetworkPath),
+	}
+}
+
+// Observe attaches a finished trace to result when it is a failure, and
+// starts a trace in the background when result is the first failure of the
+// streak a path can explain. Failures where the target answered, the name did
+// not resolve, or the policy blocked the destination do not start a trace.
+func (t *pathTracer) Observe(check proto.ProbeCheck, result *proto.CheckResult) {
+	if t == nil {
+		return
+	}
+	switch checks.Type(check.Type) {
+	case checks.CheckHTTP, checks.CheckTCP, checks.CheckTCPExpect:
+	default:
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if result.Up {
+		delete(t.traced, check.ID)
+		delete(t.paths, check.ID)
+		return
+	}
+	if path, ok := t.paths[check.ID]; ok {
+		delete(t.paths, check.ID)
+		result.Path = &path
+	}
+	switch result.ErrorKind {
+	case proto.ErrorKindAssertion, proto.ErrorKindDNS, proto.ErrorKindBlocked:
+		return
+	}
+	if _, ok := t.traced[check.ID]; ok {
+		return
+	}
+	select {
+	case t.slots <- struct{}{}:
+	default:
+		// Every slot is busy; a later failure of the streak tries again.
+		return
+	}
+	t.streak++
+	streak := t.streak
+	t.traced[check.ID] = streak
+	t.running.Add(1)
+	go func() {
+		defer t.running.Done()
+		path := t.trace(check.Type, check.Target)
+		<-t.slots
+
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if t.traced[check.ID] == streak {
+			t.paths[check.ID] = path
+		}
+	}()
+}
+
+// wait blocks until traces in flight have finished.
+func (t *pathTracer) wait() {
+	t.running.Wait()
+}
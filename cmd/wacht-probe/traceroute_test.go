@@ -0,0 +1,97 @@
+package main
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/tmater/wacht/internal/proto"
+)
+
+func TestPathTracerTracesOncePerFailingStreak(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		traces int
+	)
+	tracer := newPathTracerFunc(func(checkType, target string) proto.NetworkPath {
+		mu.Lock()
+		defer mu.Unlock()
+		traces++
+		return proto.NetworkPath{Target: "203.0.113.7:443", Hops: []proto.PathHop{{TTL: 1, Addr: "192.0.2.1"}}}
+	})
+	check := proto.ProbeCheck{ID: "check-1", Type: "http", Target: "https://example.com"}
+	observe := func(result proto.CheckResult) proto.CheckResult {
+		tracer.Observe(check, &result)
+		tracer.wait()
+		return result
+	}
+
+	if got := observe(proto.CheckResult{Up: false, ErrorKind: proto.ErrorKindAssertion}); got.Path != nil {
+		t.Fatal("assertion failure was traced, want it skipped")
+	}
+	if got := observe(proto.CheckResult{Up: false, ErrorKind: proto.ErrorKindTimeout}); got.Path != nil {
+		t.Fatalf("first timeout path = %+v, want the trace to run in the background", got.Path)
+	}
+	if got := observe(proto.CheckResult{Up: false, ErrorKind: proto.ErrorKindTimeout}); got.Path == nil || got.Path.Target != "203.0.113.7:443" {
+		t.Fatalf("next failure path = %+v, want the finished trace", got.Path)
+	}
+	if got := observe(proto.CheckResult{Up: false, ErrorKind: proto.ErrorKindTimeout}); got.Path != nil {
+		t.Fatal("path attached twice, want it only on the next failure")
+	}
+	observe(proto.CheckResult{Up: true})
+	observe(proto.CheckResult{Up: false, ErrorKind: proto.ErrorKindConnectionRefused})
+	observe(proto.CheckResult{Up: true})
+	if got := observe(proto.CheckResult{Up: false, ErrorKind: proto.ErrorKindAssertion}); got.Path != nil {
+		t.Fatal("trace from an ended streak was attached to a later one")
+	}
+	if traces != 2 {
+		t.Fatalf("traces = %d, want 2", traces)
+	}
+}
+
+func TestPathTracerDoesNotBlockOnBusySlots(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan string, maxConcurrentTraces+1)
+	tracer := newPathTracerFunc(func(checkType, target string) proto.NetworkPath {
+		started <- target
+		<-release
+		return proto.NetworkPath{Target: target}
+	})
+
+	for i := 0; i < maxConcurrentTraces+1; i++ {
+		check := proto.ProbeCheck{ID: string(rune('a' + i)), Type: "tcp", Target: string(rune('a'+i)) + ".example.com:443"}
+		result := proto.CheckResult{Up: false, ErrorKind: proto.ErrorKindTimeout}
+		tracer.Observe(check, &result)
+	}
+	for i := 0; i < maxConcurrentTraces; i++ {
+		<-started
+	}
+	close(release)
+	tracer.wait()
+	if len(started) != 0 {
+		t.Fatalf("%d extra traces started, want at most %d at once", len(started), maxConcurrentTraces)
+	}
+
+	// The check that found every slot busy is traced on its next failure.
+	check := proto.ProbeCheck{ID: string(rune('a' + maxConcurrentTraces)), Type: "tcp", Target: "late.example.com:443"}
+	result := proto.CheckResult{Up: false, ErrorKind: proto.ErrorKindTimeout}
+	tracer.Observe(check, &result)
+	tracer.wait()
+	if got := <-started; got != "late.example.com:443" {
+		t.Fatalf("retried trace target = %q, want late.example.com:443", got)
+	}
+}
+
+func TestPathTracerSkipsDNSChecksAndNilTracer(t *testing.T) {
+	tracer := newPathTracerFunc(func(checkType, target string) proto.NetworkPath {
+		t.Fatalf("trace(%q, %q) called, want dns checks skipped", checkType, target)
+		return proto.NetworkPath{}
+	})
+	result := proto.CheckResult{Up: false, ErrorKind: proto.ErrorKindTimeout}
+	tracer.Observe(proto.ProbeCheck{ID: "check-1", Type: "dns", Target: "example.com"}, &result)
+
+	var disabled *pathTracer
+	disabled.Observe(proto.ProbeCheck{ID: "check-1", Type: "tcp", Target: "example.com:443"}, &result)
+	if result.Path != nil {
+		t.Fatalf("path = %+v, want none", result.Path)
+	}
+}
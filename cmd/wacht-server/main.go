@@ -92,6 +92,9 @@ func main() {
 		cancel()
 		seed[i] = check
 	}
+	if err := network.ValidateWebhookURL(cfg.AdminWebhook, policy); err != nil {
+		fatal("admin webhook is invalid", "err", err)
+	}
 	if err := db.SeedChecks(seed, seedUserID); err != nil {
 		fatal("seed checks failed", "err", err)
 	}
@@ -103,6 +106,12 @@ func main() {
 	if _, err := monitoring.SweepProbes(monitoringRuntime, db, time.Now().UTC(), cfg.ProbeOfflineAfter); err != nil {
 		fatal("initial probe sweep failed", "err", err)
 	}
+	// Enable notifications only after the boot sweep so probes that went stale
+	// while the server was down do not page admins on every restart.
+	monitoringRuntime.SetNotificationSettings(monitoring.NotificationSettings{
+		ServerURL:    cfg.BaseURL,
+		AdminWebhook: cfg.AdminWebhook,
+	})
 
 	h := server.New(db, monitoringRuntime, cfg)
 	defer h.Close()
@@ -0,0 +1,235 @@
+package alert
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tmater/wacht/internal/logx"
+)
+
+const (
+	defaultHostConcurrency     = 1
+	defaultHostRatePerMinute   = 60
+	defaultHostBurst           = 10
+	defaultBreakerFailures     = 5
+	defaultBreakerCooldown     = time.Minute
+	destinationBusyDelay       = time.Second
+	maxDestinationErrorLength  = 256
+	destinationIdleForgetAfter = time.Hour
+	// destinationSweepEvery is how many host lookups pass between sweeps for
+	// idle hosts, so the map stays bounded without scanning it on every job.
+	destinationSweepEvery = 256
+)
+
+// Breaker states reported by DestinationState.
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// DestinationState is a point-in-time view of one webhook host's delivery
+// guard, exposed to admins so an unhealthy receiver is easy to spot.
+type DestinationState struct {
+	Host                string
+	Breaker             string
+	ConsecutiveFailures int
+	InFlight            int
+	OpenUntil           *time.Time
+	LastError           string
+	LastFailureAt       *time.Time
+	LastSuccessAt       *time.Time
+}
+
+type destinationLimits struct {
+	concurrency     int
+	ratePerSecond   float64
+	burst           float64
+	breakerFailures int
+	breakerCooldown time.Duration
+}
+
+type destination struct {
+	inFlight      int
+	tokens        float64
+	refilledAt    time.Time
+	failures      int
+	openUntil     time.Time
+	trialInFlight bool
+	lastError     string
+	lastFailureAt time.Time
+	lastSuccessAt time.Time
+	lastUsedAt    time.Time
+}
+
+// destinationGuard keeps one misbehaving receiver from starving the shared
+// sender workers. Each webhook host gets its own concurrency cap, token bucket,
+// and circuit breaker; jobs that cannot go out now are parked until the guard
+// expects the host to accept them.
+type destinationGuard struct {
+	mu     sync.Mutex
+	limits destinationLimits
+	hosts  map[string]*destination
+	now    func() time.Time
+	// lookups counts hostLocked calls since the last idle sweep.
+	lookups int
+}
+
+func newDestinationGuard(limits destinationLimits) *destinationGuard {
+	return &destinationGuard{
+		limits: limits,
+		hosts:  make(map[string]*destination),
+		now:    time.Now,
+	}
+}
+
+// destinationKey groups webhook URLs by host so different paths on one
+// receiver share a budget.
+func destinationKey(webhookURL string) string {
+	return strings.ToLower(logx.URLHost(webhookURL))
+}
+
+// acquire reserves one delivery slot for host. When the host cannot take a
+// delivery now it returns ok=false plus the earliest time worth retrying and a
+// short reason for logs.
+func (g *destinationGuard) acquire(host string) (ok bool, retryAt time.Time, reason string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	d := g.hostLocked(host, now)
+
+	halfOpen := false
+	if !d.openUntil.IsZero() {
+		if now.Before(d.openUntil) {
+			return false, d.openUntil, "circuit open"
+		}
+		if d.trialInFlight {
+			return false, now.Add(destinationBusyDelay), "circuit half-open"
+		}
+		halfOpen = true
+	}
+	if d.inFlight >= g.limits.concurrency {
+		return false, now.Add(destinationBusyDelay), "concurrency limit"
+	}
+
+	g.refillLocked(d, now)
+	if d.tokens < 1 {
+		wait := time.Duration((1 - d.tokens) / g.limits.ratePerSecond * float64(time.Second))
+		return false, now.Add(max(wait, time.Millisecond)), "rate limit"
+	}
+
+	d.tokens--
+	d.inFlight++
+	d.lastUsedAt = now
+	if halfOpen {
+		d.trialInFlight = true
+	}
+	return true, time.Time{}, ""
+}
+
+// release returns the slot taken by acquire and feeds the outcome into the
+// host's circuit breaker.
+func (g *destinationGuard) release(host string, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	d := g.hostLocked(host, now)
+	if d.inFlight > 0 {
+		d.inFlight--
+	}
+	trial := d.trialInFlight
+	d.trialInFlight = false
+
+	if err == nil {
+		d.failures = 0
+		d.openUntil = time.Time{}
+		d.lastSuccessAt = now
+		return
+	}
+
+	d.failures++
+	d.lastFailureAt = now
+	d.lastError = err.Error()
+	if len(d.lastError) > maxDestinationErrorLength {
+		d.lastError = d.lastError[:maxDestinationErrorLength]
+	}
+	if trial || d.failures >= g.limits.breakerFailures {
+		d.openUntil = now.Add(g.limits.breakerCooldown)
+	}
+}
+
+// snapshots returns the state of every host seen recently, sorted by host.
+func (g *destinationGuard) snapshots() []DestinationState {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	g.forgetIdleLocked(now)
+	states := make([]DestinationState, 0, len(g.hosts))
+	for host, d := range g.hosts {
+		state := DestinationState{
+			Host:                host,
+			Breaker:             BreakerClosed,
+			ConsecutiveFailures: d.failures,
+			InFlight:            d.inFlight,
+			LastError:           d.lastError,
+			LastFailureAt:       optionalTime(d.lastFailureAt),
+			LastSuccessAt:       optionalTime(d.lastSuccessAt),
+		}
+		if !d.openUntil.IsZero() {
+			state.Breaker = BreakerHalfOpen
+			if now.Before(d.openUntil) {
+				state.Breaker = BreakerOpen
+			}
+			state.OpenUntil = optionalTime(d.openUntil)
+		}
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Host < states[j].Host })
+	return states
+}
+
+func (g *destinationGuard) hostLocked(host string, now time.Time) *destination {
+	g.lookups++
+	if g.lookups >= destinationSweepEvery {
+		g.forgetIdleLocked(now)
+	}
+	d, ok := g.hosts[host]
+	if !ok {
+		d = &destination{tokens: g.limits.burst, refilledAt: now, lastUsedAt: now}
+		g.hosts[host] = d
+	}
+	return d
+}
+
+// forgetIdleLocked drops hosts with nothing in flight, no breaker cooldown
+// pending, and no delivery for destinationIdleForgetAfter.
+func (g *destinationGuard) forgetIdleLocked(now time.Time) {
+	g.lookups = 0
+	for host, d := range g.hosts {
+		if d.inFlight == 0 && !now.Before(d.openUntil) && now.Sub(d.lastUsedAt) > destinationIdleForgetAfter {
+			delete(g.hosts, host)
+		}
+	}
+}
+
+func (g *destinationGuard) refillLocked(d *destination, now time.Time) {
+	elapsed := now.Sub(d.refilledAt).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	d.tokens = min(g.limits.burst, d.tokens+elapsed*g.limits.ratePerSecond)
+	d.refilledAt = now
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
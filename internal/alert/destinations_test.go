@@ -0,0 +1,141 @@
+package alert
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestDestinationGuard(limits destinationLimits) (*destinationGuard, *time.Time) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	guard := newDestinationGuard(limits)
+	guard.now = func() time.Time { return now }
+	return guard, &now
+}
+
+func TestDestinationGuardBreakerOpensAndRecoversThroughHalfOpenTrial(t *testing.T) {
+	guard, now := newTestDestinationGuard(destinationLimits{
+		concurrency:     2,
+		ratePerSecond:   100,
+		burst:           100,
+		breakerFailures: 2,
+		breakerCooldown: time.Minute,
+	})
+
+	for i := 0; i < 2; i++ {
+		if ok, _, reason := guard.acquire("hooks.example.com"); !ok {
+			t.Fatalf("acquire %d denied: %s", i, reason)
+		}
+		guard.release("hooks.example.com", errors.New("boom"))
+	}
+
+	ok, retryAt, reason := guard.acquire("hooks.example.com")
+	if ok || reason != "circuit open" {
+		t.Fatalf("acquire after failures = %v (%s), want circuit open", ok, reason)
+	}
+	if want := now.Add(time.Minute); !retryAt.Equal(want) {
+		t.Fatalf("retryAt = %s, want %s", retryAt, want)
+	}
+	if ok, _, _ := guard.acquire("other.example.com"); !ok {
+		t.Fatal("other host denied while first host breaker is open")
+	}
+
+	*now = now.Add(time.Minute)
+	if ok, _, reason := guard.acquire("hooks.example.com"); !ok {
+		t.Fatalf("half-open trial denied: %s", reason)
+	}
+	if ok, _, reason := guard.acquire("hooks.example.com"); ok || reason != "circuit half-open" {
+		t.Fatalf("second acquire during trial = %v (%s), want half-open denial", ok, reason)
+	}
+	guard.release("hooks.example.com", nil)
+
+	states := guard.snapshots()
+	if len(states) != 2 || states[0].Breaker != BreakerClosed || states[0].ConsecutiveFailures != 0 {
+		t.Fatalf("states = %+v, want hooks.example.com closed after successful trial", states)
+	}
+}
+
+func TestDestinationGuardFailedTrialReopensBreaker(t *testing.T) {
+	guard, now := newTestDestinationGuard(destinationLimits{
+		concurrency:     1,
+		ratePerSecond:   100,
+		burst:           100,
+		breakerFailures: 1,
+		breakerCooldown: time.Minute,
+	})
+
+	guard.acquire("hooks.example.com")
+	guard.release("hooks.example.com", errors.New("boom"))
+	*now = now.Add(time.Minute)
+	if ok, _, _ := guard.acquire("hooks.example.com"); !ok {
+		t.Fatal("half-open trial denied")
+	}
+	guard.release("hooks.example.com", errors.New("still broken"))
+
+	states := guard.snapshots()
+	if states[0].Breaker != BreakerOpen || states[0].LastError != "still broken" {
+		t.Fatalf("state = %+v, want reopened breaker with last error", states[0])
+	}
+}
+
+func TestDestinationGuardEnforcesConcurrencyAndRate(t *testing.T) {
+	guard, now := newTestDestinationGuard(destinationLimits{
+		concurrency:     1,
+		ratePerSecond:   1,
+		burst:           1,
+		breakerFailures: 5,
+		breakerCooldown: time.Minute,
+	})
+
+	if ok, _, _ := guard.acquire("hooks.example.com"); !ok {
+		t.Fatal("first acquire denied")
+	}
+	if ok, _, reason := guard.acquire("hooks.example.com"); ok || reason != "concurrency limit" {
+		t.Fatalf("second acquire = %v (%s), want concurrency limit", ok, reason)
+	}
+	guard.release("hooks.example.com", nil)
+
+	ok, retryAt, reason := guard.acquire("hooks.example.com")
+	if ok || reason != "rate limit" {
+		t.Fatalf("acquire with empty bucket = %v (%s), want rate limit", ok, reason)
+	}
+	if want := now.Add(time.Second); !retryAt.Equal(want) {
+		t.Fatalf("retryAt = %s, want %s", retryAt, want)
+	}
+
+	*now = now.Add(time.Second)
+	if ok, _, reason := guard.acquire("hooks.example.com"); !ok {
+		t.Fatalf("acquire after refill denied: %s", reason)
+	}
+}
+
+func TestDestinationGuardForgetsIdleHostsWithoutSnapshots(t *testing.T) {
+	guard, now := newTestDestinationGuard(destinationLimits{
+		concurrency:     1,
+		ratePerSecond:   1000,
+		burst:           1000,
+		breakerFailures: 5,
+		breakerCooldown: time.Minute,
+	})
+
+	if ok, _, reason := guard.acquire("old.example.com"); !ok {
+		t.Fatalf("acquire denied: %s", reason)
+	}
+	guard.release("old.example.com", nil)
+
+	*now = now.Add(destinationIdleForgetAfter + time.Second)
+	for i := 0; i < destinationSweepEvery; i++ {
+		if ok, _, reason := guard.acquire("busy.example.com"); !ok {
+			t.Fatalf("acquire %d denied: %s", i, reason)
+		}
+		guard.release("busy.example.com", nil)
+	}
+
+	guard.mu.Lock()
+	_, kept := guard.hosts["old.example.com"]
+	hosts := len(guard.hosts)
+	guard.mu.Unlock()
+	if kept || hosts != 1 {
+		t.Fatalf("hosts = %d, old host kept = %v, want only the busy host", hosts, kept)
+	}
+}
@@ -1,8 +1,11 @@
 package alert
 
 import (
+	"context"
+	"encoding/json"
 	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/tmater/wacht/internal/logx"
@@ -16,12 +19,72 @@ const (
 	defaultWebhookPollInterval = time.Second
 	defaultWebhookStaleAfter   = 20 * time.Second
 	maxWebhookRetryDelay       = 5 * time.Minute
+	maxWebhookDigestSize       = 100
+
+	// listenerPollInterval is the relaxed poll cadence while LISTEN/NOTIFY is
+	// connected and no retries, parked jobs, or stale claims are expected
+	// soon. NOTIFY only announces new work, so those still need the regular
+	// poll interval.
+	listenerPollInterval   = 5 * time.Second
+	listenerReconnectDelay = time.Second
+	maxListenerRetryDelay  = 30 * time.Second
 )
 
+// Options tunes webhook delivery. The zero value delivers every notification
+// on its own as soon as it is due.
+type Options struct {
+	// GroupWindow holds the first notification for a destination this long so
+	// transitions arriving in the meantime are delivered as one digest.
+	GroupWindow time.Duration
+	// HostConcurrency caps simultaneous deliveries to one webhook host.
+	HostConcurrency int
+	// HostRatePerMinute and HostBurst size the per-host token bucket.
+	HostRatePerMinute int
+	HostBurst         int
+	// BreakerFailures consecutive failures open a host's circuit breaker for
+	// BreakerCooldown; jobs for that host are parked until it closes again.
+	BreakerFailures int
+	BreakerCooldown time.Duration
+}
+
+func (o Options) destinationLimits() destinationLimits {
+	limits := destinationLimits{
+		concurrency:     o.HostConcurrency,
+		ratePerSecond:   float64(o.HostRatePerMinute) / 60,
+		burst:           float64(o.HostBurst),
+		breakerFailures: o.BreakerFailures,
+		breakerCooldown: o.BreakerCooldown,
+	}
+	if limits.concurrency <= 0 {
+		limits.concurrency = defaultHostConcurrency
+	}
+	if limits.ratePerSecond <= 0 {
+		limits.ratePerSecond = float64(defaultHostRatePerMinute) / 60
+	}
+	if limits.burst < 1 {
+		limits.burst = defaultHostBurst
+	}
+	if limits.breakerFailures <= 0 {
+		limits.breakerFailures = defaultBreakerFailures
+	}
+	if limits.breakerCooldown <= 0 {
+		limits.breakerCooldown = defaultBreakerCooldown
+	}
+	return limits
+}
+
 type notificationStore interface {
 	ClaimDueIncidentNotifications(now, staleBefore time.Time, limit int) ([]store.NotificationJob, error)
+	ClaimDueIncidentNotificationGroup(now, staleBefore, groupBefore time.Time, limit int) ([]store.NotificationJob, error)
 	MarkIncidentNotificationDelivered(id int64, deliveredAt time.Time) error
 	MarkIncidentNotificationRetry(id int64, attemptedAt, nextAttemptAt time.Time, lastError string) error
+	ReleaseIncidentNotification(id int64, releasedAt, nextAttemptAt time.Time) error
+}
+
+// notificationListener is implemented by stores that can push a wake-up when
+// new webhook work is queued.
+type notificationListener interface {
+	ListenIncidentNotifications(ctx context.Context, wake func()) error
 }
 
 type sendFunc func(url string, payload []byte) error
@@ -42,17 +105,26 @@ type Sender struct {
 	pollInterval time.Duration
 	staleAfter   time.Duration
 	claimBatch   int
+	groupWindow  time.Duration
+	guard        *destinationGuard
+	wake         chan struct{}
 	stop         chan struct{}
 	wg           sync.WaitGroup
 	once         sync.Once
+
+	// listenInterval replaces pollInterval while listening is set and no
+	// deferred work is due before pollFastUntil.
+	listenInterval time.Duration
+	listening      atomic.Bool
+	pollFastUntil  atomic.Int64
 }
 
 // NewSender creates a durable webhook sender backed by the store.
-func NewSender(st notificationStore, policy network.Policy) *Sender {
-	return newSender(st, policy, defaultWebhookWorkers, defaultWebhookClaimBatch, defaultWebhookPollInterval, defaultWebhookStaleAfter, nil)
+func NewSender(st notificationStore, policy network.Policy, opts Options) *Sender {
+	return newSender(st, policy, opts, defaultWebhookWorkers, defaultWebhookClaimBatch, defaultWebhookPollInterval, defaultWebhookStaleAfter, nil)
 }
 
-func newSender(st notificationStore, policy network.Policy, workers, claimBatch int, pollInterval, staleAfter time.Duration, send sendFunc) *Sender {
+func newSender(st notificationStore, policy network.Policy, opts Options, workers, claimBatch int, pollInterval, staleAfter time.Duration, send sendFunc) *Sender {
 	if workers < 0 {
 		workers = 1
 	}
@@ -65,6 +137,9 @@ func newSender(st notificationStore, policy network.Policy, workers, claimBatch
 	if staleAfter <= 0 {
 		staleAfter = 4 * webhookTimeout
 	}
+	if opts.GroupWindow < 0 {
+		opts.GroupWindow = 0
+	}
 	if send == nil {
 		client := policy.NewHTTPClient(webhookTimeout, 3*time.Second, false)
 		send = func(url string, payload []byte) error {
@@ -73,16 +148,28 @@ func newSender(st notificationStore, policy network.Policy, workers, claimBatch
 	}
 
 	s := &Sender{
-		store:        st,
-		send:         send,
-		pollInterval: pollInterval,
-		staleAfter:   staleAfter,
-		claimBatch:   claimBatch,
-		stop:         make(chan struct{}),
+		store:          st,
+		send:           send,
+		pollInterval:   pollInterval,
+		listenInterval: max(listenerPollInterval, pollInterval),
+		staleAfter:     staleAfter,
+		claimBatch:     claimBatch,
+		groupWindow:    opts.GroupWindow,
+		guard:          newDestinationGuard(opts.destinationLimits()),
+		wake:           make(chan struct{}, max(workers, 1)),
+		stop:           make(chan struct{}),
 	}
 	if st == nil {
 		return s
 	}
+	// Retries and claims left behind by a previous run are not announced by
+	// NOTIFY, so keep the regular cadence until they must have come due.
+	s.deferUntil(time.Now().Add(max(maxWebhookRetryDelay, staleAfter)))
+
+	if listener, ok := st.(notificationListener); ok && workers > 0 {
+		s.wg.Add(1)
+		go s.listen(listener)
+	}
 
 	for i := 0; i < workers; i++ {
 		s.wg.Add(1)
@@ -106,7 +193,83 @@ func (s *Sender) worker() {
 		select {
 		case <-s.stop:
 			return
-		case <-time.After(s.pollInterval):
+		case <-s.wake:
+		case <-time.After(s.idleWait()):
+		}
+	}
+}
+
+// listen keeps a LISTEN connection open so idle workers pick up new work as
+// soon as it is committed instead of on the next poll.
+func (s *Sender) listen(listener notificationListener) {
+	defer s.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-s.stop
+		cancel()
+	}()
+
+	delay := listenerReconnectDelay
+	for {
+		startedAt := time.Now()
+		err := listener.ListenIncidentNotifications(ctx, func() {
+			s.listening.Store(true)
+			// Grouped work announced now is only claimable once its window
+			// has passed, so keep the regular poll interval until then.
+			if s.groupWindow > 0 {
+				s.deferUntil(time.Now().Add(s.groupWindow))
+			}
+			s.wakeWorkers()
+		})
+		s.listening.Store(false)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(startedAt) > maxListenerRetryDelay {
+			delay = listenerReconnectDelay
+		}
+		slog.Default().Warn("webhook listener disconnected; falling back to polling", "component", "alert", "retry_in", delay, "err", err)
+
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxListenerRetryDelay)
+	}
+}
+
+// idleWait is how long an idle worker sleeps before claiming again. The relaxed
+// listener cadence only applies while LISTEN is connected and no deferred work
+// is known to come due soon.
+func (s *Sender) idleWait() time.Duration {
+	if !s.listening.Load() || time.Now().UnixNano() < s.pollFastUntil.Load() {
+		return s.pollInterval
+	}
+	return s.listenInterval
+}
+
+// deferUntil records that work was pushed back to at, keeping workers on the
+// regular poll interval until then.
+func (s *Sender) deferUntil(at time.Time) {
+	next := at.Add(s.pollInterval).UnixNano()
+	for {
+		current := s.pollFastUntil.Load()
+		if current >= next || s.pollFastUntil.CompareAndSwap(current, next) {
+			return
+		}
+	}
+}
+
+// wakeWorkers nudges every idle worker without blocking the listener.
+func (s *Sender) wakeWorkers() {
+	for i := 0; i < cap(s.wake); i++ {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+			return
 		}
 	}
 }
@@ -116,6 +279,10 @@ func (s *Sender) runBatch() batchResult {
 		return batchIdle
 	}
 
+	if s.groupWindow > 0 {
+		return s.runGroup()
+	}
+
 	now := time.Now().UTC()
 	jobs, err := s.store.ClaimDueIncidentNotifications(now, now.Add(-s.staleAfter), s.claimBatch)
 	if err != nil {
@@ -137,10 +304,120 @@ func (s *Sender) runBatch() batchResult {
 	return batchProcessed
 }
 
+// Destinations reports per-host delivery guard state for admin inspection.
+func (s *Sender) Destinations() []DestinationState {
+	if s == nil {
+		return nil
+	}
+	return s.guard.snapshots()
+}
+
+// admit reserves a delivery slot for the jobs' destination host. When the host
+// is unhealthy or over budget the jobs are handed back to the store without
+// counting an attempt, so healthy destinations keep flowing.
+func (s *Sender) admit(jobs []store.NotificationJob) (string, bool) {
+	webhookURL := jobs[0].WebhookURL
+	host := destinationKey(webhookURL)
+	ok, retryAt, reason := s.guard.acquire(host)
+	if ok {
+		return host, true
+	}
+
+	releasedAt := time.Now().UTC()
+	for _, job := range jobs {
+		if err := s.store.ReleaseIncidentNotification(job.ID, releasedAt, retryAt.UTC()); err != nil {
+			slog.Default().Error("park webhook job failed", "component", "alert", "check_id", job.CheckID, "event", job.Event, "job_id", job.ID, "webhook_host", host, "err", err)
+		}
+	}
+	s.deferUntil(retryAt)
+	slog.Default().Debug("webhook delivery parked", "component", "alert", "jobs", len(jobs), "webhook_host", host, "reason", reason, "next_attempt_at", retryAt.UTC())
+	return host, false
+}
+
+func (s *Sender) runGroup() batchResult {
+	now := time.Now().UTC()
+	jobs, err := s.store.ClaimDueIncidentNotificationGroup(now, now.Add(-s.staleAfter), now.Add(-s.groupWindow), maxWebhookDigestSize)
+	if err != nil {
+		slog.Default().Error("claim webhook group failed", "component", "alert", "err", err)
+		return batchIdle
+	}
+	if len(jobs) == 0 {
+		return batchIdle
+	}
+
+	select {
+	case <-s.stop:
+		return batchStopped
+	default:
+	}
+	if len(jobs) == 1 {
+		s.dispatch(jobs[0])
+	} else {
+		s.dispatchDigest(jobs)
+	}
+	return batchProcessed
+}
+
+// dispatchDigest delivers several jobs for one destination in a single
+// request. Every row keeps its own durable state, so a failed digest is
+// retried as a whole and nothing is acknowledged until the receiver accepts it.
+func (s *Sender) dispatchDigest(jobs []store.NotificationJob) {
+	host, ok := s.admit(jobs)
+	if !ok {
+		return
+	}
+
+	webhookURL := jobs[0].WebhookURL
+	digest := DigestPayload{
+		Status: DigestStatus,
+		Count:  len(jobs),
+		Alerts: make([]json.RawMessage, 0, len(jobs)),
+	}
+	attempts := 0
+	for _, job := range jobs {
+		digest.Alerts = append(digest.Alerts, json.RawMessage(job.Payload))
+		attempts = max(attempts, job.Attempts)
+	}
+
+	payload, err := json.Marshal(digest)
+	if err == nil {
+		err = s.send(webhookURL, payload)
+	}
+	s.guard.release(host, err)
+	if err != nil {
+		attemptedAt := time.Now().UTC()
+		nextAttemptAt := attemptedAt.Add(nextRetryDelayWithBackoff(attempts))
+		s.deferUntil(nextAttemptAt)
+		for _, job := range jobs {
+			if markErr := s.store.MarkIncidentNotificationRetry(job.ID, attemptedAt, nextAttemptAt, err.Error()); markErr != nil {
+				slog.Default().Error("record webhook retry failed", "component", "alert", "check_id", job.CheckID, "event", job.Event, "job_id", job.ID, "webhook_host", logx.URLHost(webhookURL), "err", markErr)
+			}
+		}
+		slog.Default().Warn("webhook digest delivery failed", "component", "alert", "alerts", len(jobs), "attempt", attempts, "webhook_host", logx.URLHost(webhookURL), "next_attempt_at", nextAttemptAt, "err", err)
+		return
+	}
+
+	deliveredAt := time.Now().UTC()
+	for _, job := range jobs {
+		if err := s.store.MarkIncidentNotificationDelivered(job.ID, deliveredAt); err != nil {
+			slog.Default().Error("record webhook delivery failed", "component", "alert", "check_id", job.CheckID, "event", job.Event, "job_id", job.ID, "webhook_host", logx.URLHost(webhookURL), "err", err)
+		}
+	}
+	slog.Default().Info("webhook digest delivered", "component", "alert", "alerts", len(jobs), "attempt", attempts, "webhook_host", logx.URLHost(webhookURL))
+}
+
 func (s *Sender) dispatch(job store.NotificationJob) {
-	if err := s.send(job.WebhookURL, job.Payload); err != nil {
+	host, ok := s.admit([]store.NotificationJob{job})
+	if !ok {
+		return
+	}
+
+	err := s.send(job.WebhookURL, job.Payload)
+	s.guard.release(host, err)
+	if err != nil {
 		attemptedAt := time.Now().UTC()
 		nextAttemptAt := attemptedAt.Add(nextRetryDelayWithBackoff(job.Attempts))
+		s.deferUntil(nextAttemptAt)
 		if markErr := s.store.MarkIncidentNotificationRetry(job.ID, attemptedAt, nextAttemptAt, err.Error()); markErr != nil {
 			slog.Default().Error("record webhook retry failed", "component", "alert", "check_id", job.CheckID, "event", job.Event, "job_id", job.ID, "webhook_host", logx.URLHost(job.WebhookURL), "err", markErr)
 			return
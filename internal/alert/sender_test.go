@@ -1,7 +1,9 @@
 package alert
 
 import (
+	"context"
 	"errors"
+	"slices"
 	"sync"
 	"testing"
 	"time"
@@ -11,13 +13,18 @@ import (
 )
 
 type fakeNotificationStore struct {
-	mu          sync.Mutex
-	jobs        []store.NotificationJob
-	claim       func() []store.NotificationJob
-	deliveredID int64
-	retriedID   int64
-	retryAt     time.Time
-	retryErr    string
+	mu           sync.Mutex
+	jobs         []store.NotificationJob
+	claim        func() []store.NotificationJob
+	deliveredID  int64
+	deliveredIDs []int64
+	retriedID    int64
+	retriedIDs   []int64
+	retryAt      time.Time
+	retryErr     string
+	groupBefore  time.Time
+	releasedIDs  []int64
+	releaseAt    time.Time
 }
 
 func (f *fakeNotificationStore) ClaimDueIncidentNotifications(now, staleBefore time.Time, limit int) ([]store.NotificationJob, error) {
@@ -35,10 +42,18 @@ func (f *fakeNotificationStore) ClaimDueIncidentNotifications(now, staleBefore t
 	return jobs, nil
 }
 
+func (f *fakeNotificationStore) ClaimDueIncidentNotificationGroup(now, staleBefore, groupBefore time.Time, limit int) ([]store.NotificationJob, error) {
+	f.mu.Lock()
+	f.groupBefore = groupBefore
+	f.mu.Unlock()
+	return f.ClaimDueIncidentNotifications(now, staleBefore, limit)
+}
+
 func (f *fakeNotificationStore) MarkIncidentNotificationDelivered(id int64, deliveredAt time.Time) error {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	f.deliveredID = id
+	f.deliveredIDs = append(f.deliveredIDs, id)
 	return nil
 }
 
@@ -46,11 +61,20 @@ func (f *fakeNotificationStore) MarkIncidentNotificationRetry(id int64, attempte
 	f.mu.Lock()
 	defer f.mu.Unlock()
 	f.retriedID = id
+	f.retriedIDs = append(f.retriedIDs, id)
 	f.retryAt = nextAttemptAt
 	f.retryErr = lastError
 	return nil
 }
 
+func (f *fakeNotificationStore) ReleaseIncidentNotification(id int64, releasedAt, nextAttemptAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.releasedIDs = append(f.releasedIDs, id)
+	f.releaseAt = nextAttemptAt
+	return nil
+}
+
 func testJob(id int64, checkID, event, status string, attempts int) store.NotificationJob {
 	return store.NotificationJob{
 		ID:         id,
@@ -109,7 +133,7 @@ func TestSenderRunBatchRecordsDeliveryOutcome(t *testing.T) {
 				sender       *Sender
 				sentPayloads [][]byte
 			)
-			sender = newSender(st, network.Policy{}, 0, len(tt.jobs), time.Hour, time.Hour, func(url string, payload []byte) error {
+			sender = newSender(st, network.Policy{}, Options{}, 0, len(tt.jobs), time.Hour, time.Hour, func(url string, payload []byte) error {
 				sentPayloads = append(sentPayloads, append([]byte(nil), payload...))
 				if tt.stopAfterFirst && len(sentPayloads) == 1 {
 					sender.once.Do(func() {
@@ -152,6 +176,293 @@ func TestSenderRunBatchRecordsDeliveryOutcome(t *testing.T) {
 	}
 }
 
+func TestSenderRunBatchDeliversGroupAsDigest(t *testing.T) {
+	tests := []struct {
+		name          string
+		sendErr       error
+		wantDelivered []int64
+		wantRetried   []int64
+		wantRetryErr  string
+	}{
+		{
+			name:          "delivered",
+			wantDelivered: []int64{3, 4},
+		},
+		{
+			name:         "retry whole digest on failure",
+			sendErr:      errors.New("boom"),
+			wantRetried:  []int64{3, 4},
+			wantRetryErr: "boom",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &fakeNotificationStore{jobs: []store.NotificationJob{
+				testJob(3, "check-1", "down", "down", 1),
+				testJob(4, "check-2", "down", "down", 2),
+			}}
+
+			var sent [][]byte
+			sender := newSender(st, network.Policy{}, Options{GroupWindow: 30 * time.Second}, 0, 1, time.Hour, time.Hour, func(url string, payload []byte) error {
+				sent = append(sent, append([]byte(nil), payload...))
+				return tt.sendErr
+			})
+			defer sender.Close()
+
+			startedAt := time.Now().UTC()
+			if got := sender.runBatch(); got != batchProcessed {
+				t.Fatalf("runBatch = %v, want %v", got, batchProcessed)
+			}
+			if len(sent) != 1 {
+				t.Fatalf("sent %d payloads, want 1 digest", len(sent))
+			}
+			const wantPayload = `{"status":"digest","count":2,"alerts":[{"status":"down"},{"status":"down"}]}`
+			if string(sent[0]) != wantPayload {
+				t.Fatalf("payload = %s, want %s", sent[0], wantPayload)
+			}
+			if got := startedAt.Sub(st.groupBefore); got < 29*time.Second || got > 31*time.Second {
+				t.Fatalf("groupBefore = %s, want about 30s before %s", st.groupBefore, startedAt)
+			}
+			if !slices.Equal(st.deliveredIDs, tt.wantDelivered) {
+				t.Fatalf("delivered = %v, want %v", st.deliveredIDs, tt.wantDelivered)
+			}
+			if !slices.Equal(st.retriedIDs, tt.wantRetried) {
+				t.Fatalf("retried = %v, want %v", st.retriedIDs, tt.wantRetried)
+			}
+			if st.retryErr != tt.wantRetryErr {
+				t.Fatalf("retryErr = %q, want %q", st.retryErr, tt.wantRetryErr)
+			}
+		})
+	}
+}
+
+func TestSenderRunBatchSendsSingleGroupedJobUnwrapped(t *testing.T) {
+	st := &fakeNotificationStore{jobs: []store.NotificationJob{testJob(5, "check-1", "up", "up", 1)}}
+
+	var sent [][]byte
+	sender := newSender(st, network.Policy{}, Options{GroupWindow: time.Minute}, 0, 1, time.Hour, time.Hour, func(url string, payload []byte) error {
+		sent = append(sent, append([]byte(nil), payload...))
+		return nil
+	})
+	defer sender.Close()
+
+	if got := sender.runBatch(); got != batchProcessed {
+		t.Fatalf("runBatch = %v, want %v", got, batchProcessed)
+	}
+	if len(sent) != 1 || string(sent[0]) != `{"status":"up"}` {
+		t.Fatalf("sent = %q, want original payload", sent)
+	}
+	if st.deliveredID != 5 {
+		t.Fatalf("deliveredID = %d, want 5", st.deliveredID)
+	}
+}
+
+func TestSenderParksJobsForOpenBreakerWhileOtherHostsFlow(t *testing.T) {
+	unhealthy := testJob(1, "check-1", "down", "down", 1)
+	unhealthy.WebhookURL = "https://broken.example.com/hook"
+	healthy := testJob(2, "check-2", "down", "down", 1)
+	healthy.WebhookURL = "https://fine.example.com/hook"
+
+	st := &fakeNotificationStore{}
+	var sentTo []string
+	sender := newSender(st, network.Policy{}, Options{BreakerFailures: 1, BreakerCooldown: time.Minute}, 0, 2, time.Hour, time.Hour, func(url string, payload []byte) error {
+		sentTo = append(sentTo, url)
+		if url == unhealthy.WebhookURL {
+			return errors.New("503")
+		}
+		return nil
+	})
+	defer sender.Close()
+
+	st.jobs = []store.NotificationJob{unhealthy}
+	sender.runBatch()
+	if st.retriedID != 1 {
+		t.Fatalf("retriedID = %d, want first failure recorded as retry", st.retriedID)
+	}
+
+	startedAt := time.Now()
+	st.jobs = []store.NotificationJob{unhealthy, healthy}
+	sender.runBatch()
+
+	if !slices.Equal(sentTo, []string{unhealthy.WebhookURL, healthy.WebhookURL}) {
+		t.Fatalf("sent to %v, want broken host skipped after breaker opened", sentTo)
+	}
+	if !slices.Equal(st.releasedIDs, []int64{1}) {
+		t.Fatalf("released = %v, want parked job 1", st.releasedIDs)
+	}
+	if !st.releaseAt.After(startedAt.Add(50 * time.Second)) {
+		t.Fatalf("releaseAt = %s, want parked until breaker cooldown ends", st.releaseAt)
+	}
+	if st.deliveredID != 2 {
+		t.Fatalf("deliveredID = %d, want healthy job delivered", st.deliveredID)
+	}
+
+	states := sender.Destinations()
+	if len(states) != 2 || states[0].Host != "broken.example.com" || states[0].Breaker != BreakerOpen {
+		t.Fatalf("destinations = %+v, want broken host open", states)
+	}
+}
+
+type fakeListeningStore struct {
+	*fakeNotificationStore
+	listen func(ctx context.Context, wake func()) error
+}
+
+func (f *fakeListeningStore) ListenIncidentNotifications(ctx context.Context, wake func()) error {
+	return f.listen(ctx, wake)
+}
+
+func TestSenderWakesOnNotificationInsteadOfWaitingForPoll(t *testing.T) {
+	notify := make(chan struct{})
+	delivered := make(chan struct{}, 1)
+	base := &fakeNotificationStore{}
+	st := &fakeListeningStore{
+		fakeNotificationStore: base,
+		listen: func(ctx context.Context, wake func()) error {
+			for {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-notify:
+					wake()
+				}
+			}
+		},
+	}
+
+	sender := newSender(st, network.Policy{}, Options{}, 1, 1, time.Hour, time.Hour, func(url string, payload []byte) error {
+		delivered <- struct{}{}
+		return nil
+	})
+	defer sender.Close()
+
+	// Let the worker finish its initial empty claim and park on the poll timer.
+	time.Sleep(20 * time.Millisecond)
+	base.mu.Lock()
+	base.jobs = []store.NotificationJob{testJob(11, "check-1", "down", "down", 1)}
+	base.mu.Unlock()
+	notify <- struct{}{}
+
+	select {
+	case <-delivered:
+	case <-time.After(time.Second):
+		t.Fatal("worker did not wake on notification")
+	}
+}
+
+func TestSenderDeliversGroupSoonAfterWindowWhileListening(t *testing.T) {
+	const (
+		pollInterval = 50 * time.Millisecond
+		groupWindow  = 300 * time.Millisecond
+	)
+	notify := make(chan struct{})
+	delivered := make(chan time.Time, 1)
+	var queuedAt time.Time
+	base := &fakeNotificationStore{}
+	base.claim = func() []store.NotificationJob {
+		if len(base.jobs) == 0 || time.Now().Before(queuedAt.Add(groupWindow)) {
+			return nil
+		}
+		jobs := base.jobs
+		base.jobs = nil
+		return jobs
+	}
+	st := &fakeListeningStore{
+		fakeNotificationStore: base,
+		listen: func(ctx context.Context, wake func()) error {
+			for {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-notify:
+					wake()
+				}
+			}
+		},
+	}
+
+	sender := newSender(st, network.Policy{}, Options{GroupWindow: groupWindow}, 1, 1, pollInterval, time.Hour, func(url string, payload []byte) error {
+		delivered <- time.Now()
+		return nil
+	})
+	defer sender.Close()
+	// Nothing was left behind by a previous run; only the new job matters.
+	sender.pollFastUntil.Store(0)
+	time.Sleep(2 * pollInterval)
+
+	base.mu.Lock()
+	queuedAt = time.Now()
+	base.jobs = []store.NotificationJob{testJob(12, "check-1", "down", "down", 1)}
+	base.mu.Unlock()
+	notify <- struct{}{}
+
+	select {
+	case at := <-delivered:
+		if late := at.Sub(queuedAt) - groupWindow; late > pollInterval+50*time.Millisecond {
+			t.Fatalf("grouped job delivered %s after its window, want within the poll interval", late)
+		}
+	case <-time.After(listenerPollInterval):
+		t.Fatal("grouped job was not delivered")
+	}
+}
+
+func TestSenderReconnectsListenerAfterFailure(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+	reconnected := make(chan struct{})
+	st := &fakeListeningStore{
+		fakeNotificationStore: &fakeNotificationStore{},
+		listen: func(ctx context.Context, wake func()) error {
+			mu.Lock()
+			calls++
+			n := calls
+			mu.Unlock()
+			if n == 1 {
+				return errors.New("connection reset")
+			}
+			close(reconnected)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}
+
+	sender := newSender(st, network.Policy{}, Options{}, 1, 1, time.Hour, time.Hour, func(url string, payload []byte) error { return nil })
+	defer sender.Close()
+
+	select {
+	case <-reconnected:
+	case <-time.After(3 * listenerReconnectDelay):
+		t.Fatal("listener was not restarted after failure")
+	}
+}
+
+func TestSenderIdleWaitRelaxesOnlyWhileListeningWithNothingDeferred(t *testing.T) {
+	sender := &Sender{pollInterval: time.Second, listenInterval: listenerPollInterval}
+
+	if got := sender.idleWait(); got != time.Second {
+		t.Fatalf("idleWait without listener = %s, want poll interval", got)
+	}
+
+	sender.listening.Store(true)
+	if got := sender.idleWait(); got != listenerPollInterval {
+		t.Fatalf("idleWait while listening = %s, want listener interval", got)
+	}
+
+	sender.deferUntil(time.Now().Add(time.Minute))
+	if got := sender.idleWait(); got != time.Second {
+		t.Fatalf("idleWait with deferred work = %s, want poll interval", got)
+	}
+
+	sender.pollFastUntil.Store(time.Now().Add(-time.Second).UnixNano())
+	sender.listening.Store(false)
+	if got := sender.idleWait(); got != time.Second {
+		t.Fatalf("idleWait after listener dropped = %s, want poll interval", got)
+	}
+}
+
 func TestSenderCloseReturnsUnderSustainedLoad(t *testing.T) {
 	started := make(chan struct{})
 	var (
@@ -165,7 +476,7 @@ func TestSenderCloseReturnsUnderSustainedLoad(t *testing.T) {
 		},
 	}
 
-	sender := newSender(st, network.Policy{}, 1, 1, time.Hour, time.Hour, func(url string, payload []byte) error {
+	sender := newSender(st, network.Policy{}, Options{}, 1, 1, time.Hour, time.Hour, func(url string, payload []byte) error {
 		once.Do(func() { close(started) })
 		return nil
 	})
@@ -2,9 +2,12 @@ package alert
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
+
+	"github.com/tmater/wacht/internal/store"
 )
 
 // AlertPayload is the JSON body sent to a webhook URL on a state transition.
@@ -15,6 +18,79 @@ type AlertPayload struct {
 	Status      string `json:"status"` // "down" or "up"
 	ProbesDown  int    `json:"probes_down"`
 	ProbesTotal int    `json:"probes_total"`
+	// ProbableCause is the error kind most down probes reported, such as
+	// "dns" or "timeout". Omitted when no probe classified its failure.
+	ProbableCause string `json:"probable_cause,omitempty"`
+}
+
+// PayloadSchemaV2 is the schema_version carried by AlertPayloadV2.
+const PayloadSchemaV2 = 2
+
+// AlertPayloadV2 is the versioned webhook body for destinations that opt in.
+// It lets receivers correlate down and up events for one incident and explain
+// which probes saw the failure.
+type AlertPayloadV2 struct {
+	SchemaVersion int            `json:"schema_version"`
+	Status        string         `json:"status"` // "down" or "up"
+	ServerURL     string         `json:"server_url,omitempty"`
+	Check         AlertCheck     `json:"check"`
+	ProbesDown    int            `json:"probes_down"`
+	ProbesTotal   int            `json:"probes_total"`
+	Probes        []AlertProbe   `json:"probes"`
+	Incident      *AlertIncident `json:"incident,omitempty"`
+	// ProbableCause is the error kind most down probes reported. Omitted
+	// when no probe classified its failure.
+	ProbableCause string `json:"probable_cause,omitempty"`
+}
+
+// AlertCheck identifies the check an AlertPayloadV2 is about.
+type AlertCheck struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Target string `json:"target"`
+}
+
+// AlertProbe is one probe's view of the check when the alert was raised.
+type AlertProbe struct {
+	ProbeID      string  `json:"probe_id"`
+	State        string  `json:"state"`
+	LastResultAt *string `json:"last_result_at,omitempty"`
+	LastError    string  `json:"last_error,omitempty"`
+	ErrorKind    string  `json:"error_kind,omitempty"`
+	// Attempts is how many runs the probe needed for its last result,
+	// including confirmation retries. Omitted for probes that do not
+	// report attempts.
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// AlertIncident is filled in by the store once the incident row exists, so
+// monitoring leaves it unset when rendering the payload.
+type AlertIncident = store.NotificationIncident
+
+// FleetPayload is the admin-facing JSON body sent when probe fleet health
+// changes enough to threaten monitoring itself.
+type FleetPayload struct {
+	Status            string   `json:"status"` // probe_offline, probe_online, quorum_at_risk, quorum_restored
+	ProbeID           string   `json:"probe_id,omitempty"`
+	ProbesOnline      int      `json:"probes_online"`
+	ProbesTotal       int      `json:"probes_total"`
+	ChecksAtRiskCount int      `json:"checks_at_risk_count"`
+	ChecksAtRisk      []string `json:"checks_at_risk,omitempty"` // check IDs, truncated for large fleets
+	ServerURL         string   `json:"server_url,omitempty"`
+	OccurredAt        string   `json:"occurred_at"`
+}
+
+// DigestStatus marks a payload that bundles several alerts for one destination.
+const DigestStatus = "digest"
+
+// DigestPayload is the JSON body sent when several transitions for the same
+// webhook URL fall into one grouping window. Alerts holds the individual
+// payloads unchanged, in the order they were queued.
+type DigestPayload struct {
+	Status string            `json:"status"` // always "digest"
+	Count  int               `json:"count"`
+	Alerts []json.RawMessage `json:"alerts"`
 }
 
 const webhookTimeout = 5 * time.Second
@@ -3,15 +3,21 @@ package probe
 import (
 	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/tmater/wacht/internal/probeauth"
 	"github.com/tmater/wacht/internal/proto"
 )
 
@@ -35,6 +41,7 @@ type Client struct {
 	baseURL    string
 	probeID    string
 	secret     string
+	signingKey ed25519.PrivateKey
 	httpClient *http.Client
 }
 
@@ -51,12 +58,55 @@ func NewClient(baseURL, probeID, secret string, httpClient *http.Client) *Client
 	}
 }
 
-// Register announces a probe startup and records its version on the server.
-func (c *Client) Register(ctx context.Context, version string) error {
-	reqBody := RegisterRequest{
-		ProbeID: c.probeID,
-		Version: version,
+// Enroll exchanges a join token for a probe credential. It runs before the
+// probe has a credential, so the request is unauthenticated.
+func Enroll(ctx context.Context, baseURL string, httpClient *http.Client, reqBody EnrollRequest) (EnrollResponse, error) {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultRequestTimeout}
+	}
+	payload, err := json.Marshal(reqBody)
+	if err != nil {
+		return EnrollResponse{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(baseURL, "/")+PathEnroll, bytes.NewReader(payload))
+	if err != nil {
+		return EnrollResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return EnrollResponse{}, fmt.Errorf("%s %s: %w", req.Method, req.URL.Path, err)
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return EnrollResponse{}, &ResponseError{
+			Method:     req.Method,
+			Path:       req.URL.Path,
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Expected:   http.StatusCreated,
+		}
+	}
+	var credential EnrollResponse
+	if err := json.NewDecoder(resp.Body).Decode(&credential); err != nil {
+		return EnrollResponse{}, err
+	}
+	return credential, nil
+}
+
+// EnableSigning switches the client from sending the secret in
+// HeaderProbeSecret to signed requests, so the secret never crosses the
+// wire.
+func (c *Client) EnableSigning() {
+	c.signingKey = probeauth.SigningKey(c.secret)
+}
+
+// Register announces a probe startup and records its version, capabilities,
+// and declared labels on the server. The probe ID and protocol version are
+// filled in by the client.
+func (c *Client) Register(ctx context.Context, reqBody RegisterRequest) error {
+	reqBody.ProbeID = c.probeID
+	reqBody.ProtocolVersion = ProtocolVersion
 	req, err := c.newRequest(ctx, http.MethodPost, PathRegister, reqBody)
 	if err != nil {
 		return err
@@ -107,9 +157,10 @@ func IsRetryablePostResultsError(err error) bool {
 	return true
 }
 
-// Heartbeat refreshes the probe's liveness state on the server.
-func (c *Client) Heartbeat(ctx context.Context) error {
-	reqBody := HeartbeatRequest{ProbeID: c.probeID}
+// Heartbeat refreshes the probe's liveness state on the server, reporting
+// reqBody.Degraded while the probe's network self-test is failing.
+func (c *Client) Heartbeat(ctx context.Context, reqBody HeartbeatRequest) error {
+	reqBody.ProbeID = c.probeID
 	req, err := c.newRequest(ctx, http.MethodPost, PathHeartbeat, reqBody)
 	if err != nil {
 		return err
@@ -127,24 +178,114 @@ func (c *Client) Heartbeat(ctx context.Context) error {
 
 // FetchChecks reads the current check set assigned to the authenticated probe.
 func (c *Client) FetchChecks(ctx context.Context) ([]proto.ProbeCheck, error) {
-	req, err := c.newRequest(ctx, http.MethodGet, PathChecks, nil)
+	checks, _, _, err := c.WatchChecks(ctx, "", 0)
+	return checks, err
+}
+
+// WatchChecks long-polls the check set assigned to the authenticated probe.
+// When revision still matches after waiting up to wait, it returns changed
+// false and no checks. Otherwise it returns the current set and its revision.
+// An empty revision or zero wait fetches the set immediately.
+func (c *Client) WatchChecks(ctx context.Context, revision string, wait time.Duration) ([]proto.ProbeCheck, string, bool, error) {
+	path := PathChecks
+	httpClient := c.httpClient
+	if wait > 0 {
+		path += "?" + url.Values{QueryWait: {wait.String()}}.Encode()
+		if httpClient.Timeout > 0 {
+			// The request timeout covers the whole exchange, so extend it by
+			// the time the server may hold the request open.
+			extended := *httpClient
+			extended.Timeout += wait
+			httpClient = &extended
+		}
+	}
+	req, err := c.newConditionalRequest(ctx, http.MethodGet, path, revision, nil)
 	if err != nil {
-		return nil, err
+		return nil, "", false, err
 	}
-	resp, err := c.httpClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL.Path, err)
+		return nil, "", false, fmt.Errorf("%s %s: %w", req.Method, req.URL.Path, err)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && revision != "" {
+		return nil, revision, false, nil
+	}
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("%s %s: expected status %d, got %s", req.Method, req.URL.Path, http.StatusOK, resp.Status)
+		return nil, "", false, fmt.Errorf("%s %s: expected status %d, got %s", req.Method, req.URL.Path, http.StatusOK, resp.Status)
 	}
 
 	var payload []proto.ProbeCheck
 	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, "", false, err
+	}
+	return payload, resp.Header.Get("ETag"), true, nil
+}
+
+// WatchRuns long-polls for on-demand check runs queued for the probe, waiting
+// up to wait. It returns no requests when nothing was queued in time.
+func (c *Client) WatchRuns(ctx context.Context, wait time.Duration) ([]RunRequest, error) {
+	path := PathRuns
+	httpClient := c.httpClient
+	if wait > 0 {
+		path += "?" + url.Values{QueryWait: {wait.String()}}.Encode()
+		if httpClient.Timeout > 0 {
+			extended := *httpClient
+			extended.Timeout += wait
+			httpClient = &extended
+		}
+	}
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: %w", req.Method, req.URL.Path, err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNoContent:
+		return nil, nil
+	case http.StatusOK:
+	default:
+		return nil, &ResponseError{
+			Method:     req.Method,
+			Path:       req.URL.Path,
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Expected:   http.StatusOK,
+		}
+	}
+
+	var runs []RunRequest
+	if err := json.NewDecoder(resp.Body).Decode(&runs); err != nil {
 		return nil, err
 	}
-	return payload, nil
+	return runs, nil
+}
+
+// PostRunResult returns the result of one on-demand run to the server.
+func (c *Client) PostRunResult(ctx context.Context, result RunResult) error {
+	req, err := c.newRequest(ctx, http.MethodPost, PathRunResults, result)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", req.Method, req.URL.Path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		return &ResponseError{
+			Method:     req.Method,
+			Path:       req.URL.Path,
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Expected:   http.StatusNoContent,
+		}
+	}
+	return nil
 }
 
 // PostResult submits one executed check result back to the server.
@@ -177,9 +318,19 @@ func (c *Client) PostResults(ctx context.Context, results []proto.CheckResult) e
 }
 
 func (c *Client) newRequest(ctx context.Context, method, path string, body any) (*http.Request, error) {
-	var reader io.Reader
+	return c.newConditionalRequest(ctx, method, path, "", body)
+}
+
+// newConditionalRequest is newRequest with an optional If-None-Match revision,
+// set before signing so the signature covers it.
+func (c *Client) newConditionalRequest(ctx context.Context, method, path, revision string, body any) (*http.Request, error) {
+	var (
+		reader  io.Reader
+		payload []byte
+	)
 	if body != nil {
-		payload, err := json.Marshal(body)
+		var err error
+		payload, err = json.Marshal(body)
 		if err != nil {
 			return nil, err
 		}
@@ -191,7 +342,28 @@ func (c *Client) newRequest(ctx context.Context, method, path string, body any)
 		return nil, err
 	}
 	req.Header.Set(HeaderProbeID, c.probeID)
-	req.Header.Set(HeaderProbeSecret, c.secret)
+	if revision != "" {
+		req.Header.Set("If-None-Match", revision)
+	}
+	if c.signingKey != nil {
+		var nonce [16]byte
+		if _, err := rand.Read(nonce[:]); err != nil {
+			return nil, err
+		}
+		signed := probeauth.SignedRequest{
+			Method:      method,
+			RequestURI:  req.URL.RequestURI(),
+			Timestamp:   strconv.FormatInt(time.Now().Unix(), 10),
+			Nonce:       hex.EncodeToString(nonce[:]),
+			IfNoneMatch: revision,
+			Body:        payload,
+		}
+		req.Header.Set(HeaderTimestamp, signed.Timestamp)
+		req.Header.Set(HeaderNonce, signed.Nonce)
+		req.Header.Set(HeaderSignature, probeauth.Sign(c.signingKey, signed))
+	} else {
+		req.Header.Set(HeaderProbeSecret, c.secret)
+	}
 	if body != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
@@ -11,6 +12,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/tmater/wacht/internal/probeauth"
 	"github.com/tmater/wacht/internal/proto"
 )
 
@@ -43,6 +45,175 @@ func TestFetchChecksIncludesHeadersAndDecodesPayload(t *testing.T) {
 	}
 }
 
+func TestWatchChecksSendsRevisionAndHandlesNotModified(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get(QueryWait); got != "30s" {
+			t.Fatalf("%s = %q, want 30s", QueryWait, got)
+		}
+		if r.Header.Get("If-None-Match") == `"rev-1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"rev-2"`)
+		_, _ = w.Write([]byte(`[{"id":"00000000-0000-0000-0000-000000000101","name":"check-1","type":"http","target":"https://example.com","interval":45}]`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "probe-1", "secret-1", nil)
+	got, revision, changed, err := client.WatchChecks(context.Background(), `"rev-1"`, 30*time.Second)
+	if err != nil {
+		t.Fatalf("WatchChecks(rev-1) error = %v", err)
+	}
+	if changed || got != nil || revision != `"rev-1"` {
+		t.Fatalf("WatchChecks(rev-1) = %v, %q, %t, want unchanged rev-1", got, revision, changed)
+	}
+
+	got, revision, changed, err = client.WatchChecks(context.Background(), `"rev-0"`, 30*time.Second)
+	if err != nil {
+		t.Fatalf("WatchChecks(rev-0) error = %v", err)
+	}
+	if !changed || len(got) != 1 || revision != `"rev-2"` {
+		t.Fatalf("WatchChecks(rev-0) = %v, %q, %t, want one check at rev-2", got, revision, changed)
+	}
+}
+
+func TestWatchRunsHandlesIdleAndQueuedRuns(t *testing.T) {
+	queued := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != PathRuns {
+			t.Fatalf("path = %q, want %q", r.URL.Path, PathRuns)
+		}
+		if !queued {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		_, _ = w.Write([]byte(`[{"run_id":"run-1","check":{"id":"","name":"","type":"tcp","target":"db.example.com:5432","interval":30}}]`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "probe-1", "secret-1", nil)
+	runs, err := client.WatchRuns(context.Background(), 30*time.Second)
+	if err != nil || runs != nil {
+		t.Fatalf("WatchRuns() = %v, %v, want no runs", runs, err)
+	}
+
+	queued = true
+	runs, err = client.WatchRuns(context.Background(), 30*time.Second)
+	if err != nil {
+		t.Fatalf("WatchRuns() error = %v", err)
+	}
+	if len(runs) != 1 || runs[0].RunID != "run-1" || runs[0].Check.Target != "db.example.com:5432" {
+		t.Fatalf("WatchRuns() = %+v, want run-1", runs)
+	}
+}
+
+func TestSignedClientSignsRequestsWithoutSendingSecret(t *testing.T) {
+	nonces := make(map[string]bool)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get(HeaderProbeSecret); got != "" {
+			t.Fatalf("%s = %q, want no secret on signed requests", HeaderProbeSecret, got)
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatalf("read body: %v", err)
+		}
+		signed := probeauth.SignedRequest{
+			Method:      r.Method,
+			RequestURI:  r.URL.RequestURI(),
+			Timestamp:   r.Header.Get(HeaderTimestamp),
+			Nonce:       r.Header.Get(HeaderNonce),
+			IfNoneMatch: r.Header.Get("If-None-Match"),
+			Body:        body,
+		}
+		if !probeauth.VerifySignature(probeauth.VerifyKey("secret-1"), signed, r.Header.Get(HeaderSignature)) {
+			t.Fatalf("signature %q does not verify", r.Header.Get(HeaderSignature))
+		}
+		if nonces[signed.Nonce] {
+			t.Fatalf("nonce %q reused", signed.Nonce)
+		}
+		nonces[signed.Nonce] = true
+		signed.Body = append(body, ' ')
+		if probeauth.VerifySignature(probeauth.VerifyKey("secret-1"), signed, r.Header.Get(HeaderSignature)) {
+			t.Fatal("signature verified for a modified body")
+		}
+		if r.URL.Path == PathChecks {
+			if signed.IfNoneMatch != `"rev-1"` {
+				t.Fatalf("If-None-Match = %q, want \"rev-1\"", signed.IfNoneMatch)
+			}
+			signed.Body, signed.IfNoneMatch = body, `"rev-2"`
+			if probeauth.VerifySignature(probeauth.VerifyKey("secret-1"), signed, r.Header.Get(HeaderSignature)) {
+				t.Fatal("signature verified for a different If-None-Match")
+			}
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "probe-1", "secret-1", nil)
+	client.EnableSigning()
+	for range 2 {
+		if err := client.Register(context.Background(), RegisterRequest{Version: "v1.2.0"}); err != nil {
+			t.Fatalf("Register() error = %v", err)
+		}
+	}
+	if _, _, changed, err := client.WatchChecks(context.Background(), `"rev-1"`, 0); err != nil || changed {
+		t.Fatalf("WatchChecks() = changed %v, %v, want unchanged", changed, err)
+	}
+}
+
+func TestEnrollExchangesJoinTokenWithoutCredentials(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != PathEnroll {
+			t.Fatalf("path = %s, want %s", r.URL.Path, PathEnroll)
+		}
+		if r.Header.Get(HeaderProbeSecret) != "" || r.Header.Get(HeaderSignature) != "" {
+			t.Fatal("expected enrollment without probe credentials")
+		}
+		var req EnrollRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		if req.Token != "join-1" || req.ProbeID != "edge-1" {
+			t.Fatalf("request = %+v, want join-1 for edge-1", req)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"probe_id":"edge-1","secret":"secret-1"}`))
+	}))
+	defer server.Close()
+
+	got, err := Enroll(context.Background(), server.URL, nil, EnrollRequest{Token: "join-1", ProbeID: "edge-1"})
+	if err != nil {
+		t.Fatalf("Enroll() error = %v", err)
+	}
+	if got != (EnrollResponse{ProbeID: "edge-1", Secret: "secret-1"}) {
+		t.Fatalf("Enroll() = %+v, want edge-1 credential", got)
+	}
+}
+
+func TestRegisterSendsCapabilities(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req RegisterRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode register body: %v", err)
+		}
+		if req.ProbeID != "probe-1" || req.Version != "v1.2.0" || req.ProtocolVersion != ProtocolVersion {
+			t.Fatalf("register request = %#v, want probe-1 v1.2.0 protocol %d", req, ProtocolVersion)
+		}
+		if len(req.CheckTypes) != 2 || req.CheckTypes[0] != "http" || req.CheckTypes[1] != "tcp" {
+			t.Fatalf("CheckTypes = %v, want [http tcp]", req.CheckTypes)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "probe-1", "secret-1", nil)
+	if err := client.Register(context.Background(), RegisterRequest{Version: "v1.2.0", CheckTypes: []string{"http", "tcp"}}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+}
+
 func TestProbeServerAPIRequestsFailOnUnexpectedStatus(t *testing.T) {
 	tests := []struct {
 		name string
@@ -53,14 +224,14 @@ func TestProbeServerAPIRequestsFailOnUnexpectedStatus(t *testing.T) {
 			name: "register",
 			path: PathRegister,
 			run: func(client *Client) error {
-				return client.Register(context.Background(), "dev")
+				return client.Register(context.Background(), RegisterRequest{Version: "dev"})
 			},
 		},
 		{
 			name: "heartbeat",
 			path: PathHeartbeat,
 			run: func(client *Client) error {
-				return client.Heartbeat(context.Background())
+				return client.Heartbeat(context.Background(), HeartbeatRequest{})
 			},
 		},
 		{
@@ -120,13 +291,13 @@ func TestProbeServerAPIRequestsTimeout(t *testing.T) {
 		{
 			name: "register",
 			run: func(client *Client) error {
-				return client.Register(context.Background(), "dev")
+				return client.Register(context.Background(), RegisterRequest{Version: "dev"})
 			},
 		},
 		{
 			name: "heartbeat",
 			run: func(client *Client) error {
-				return client.Heartbeat(context.Background())
+				return client.Heartbeat(context.Background(), HeartbeatRequest{})
 			},
 		},
 		{
@@ -1,15 +1,45 @@
 package probe
 
+// ProtocolVersion is the probe API protocol spoken by this build. Probes send
+// it at registration so the server can flag probes running an older protocol.
+const ProtocolVersion = 2
+
+// ProtocolVersionRuns is the first protocol whose probes poll PathRuns for
+// on-demand check runs.
+const ProtocolVersionRuns = 2
+
 const (
 	// HeaderProbeID identifies the authenticated probe making the request.
 	HeaderProbeID = "X-Wacht-Probe-ID"
 	// HeaderProbeSecret carries the shared secret for probe authentication.
 	HeaderProbeSecret = "X-Wacht-Probe-Secret"
+	// HeaderTimestamp carries the Unix time a signed request was made.
+	HeaderTimestamp = "X-Wacht-Timestamp"
+	// HeaderNonce carries a random value unique to one signed request. The
+	// server accepts each nonce once.
+	HeaderNonce = "X-Wacht-Nonce"
+	// HeaderSignature carries the signature of a request; see Sign. Signed
+	// requests omit HeaderProbeSecret.
+	HeaderSignature = "X-Wacht-Signature"
 
+	// PathEnroll exchanges a join token for a probe credential. It is the
+	// only probe path that does not require probe authentication.
+	PathEnroll = "/api/probes/enroll"
 	// PathRegister records probe startup against the server.
 	PathRegister = "/api/probes/register"
-	// PathChecks returns the current probe-visible check set.
+	// PathChecks returns the current probe-visible check set. Responses carry
+	// an ETag revision; a request with If-None-Match and a wait query
+	// parameter long-polls until the set changes or the wait elapses.
 	PathChecks = "/api/probes/checks"
+	// QueryWait is the long-poll duration on PathChecks and PathRuns, such
+	// as "30s".
+	QueryWait = "wait"
+	// PathRuns long-polls, with QueryWait, for on-demand check runs queued
+	// for the probe. It answers 200 with a JSON array of RunRequest, or 204
+	// when nothing was queued before the wait elapsed.
+	PathRuns = "/api/probes/runs"
+	// PathRunResults accepts the RunResult of one on-demand run.
+	PathRunResults = "/api/probes/runs/results"
 	// PathHeartbeat refreshes the probe's last-seen timestamp.
 	PathHeartbeat = "/api/probes/heartbeat"
 	// PathResults accepts executed check results from probes.
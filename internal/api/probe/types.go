@@ -2,15 +2,56 @@ package probe
 
 import "github.com/tmater/wacht/internal/proto"
 
-// HeartbeatRequest is the optional JSON body for probe heartbeats.
+// HeartbeatRequest is the optional JSON body for probe heartbeats. A
+// non-empty Degraded reports that the probe's network self-test is failing
+// and carries the reason; the server then treats the probe's failures as
+// probe errors rather than target outages.
 type HeartbeatRequest struct {
+	ProbeID  string `json:"probe_id"`
+	Degraded string `json:"degraded,omitempty"`
+}
+
+// RunRequest asks a probe to run one check immediately, outside its regular
+// schedule. The check may not be saved yet, so it is sent in full.
+type RunRequest struct {
+	RunID string           `json:"run_id"`
+	Check proto.ProbeCheck `json:"check"`
+}
+
+// RunResult is a probe's answer to one RunRequest. The server returns it to
+// the caller that requested the run; it never feeds check quorum.
+type RunResult struct {
+	RunID  string            `json:"run_id"`
+	Result proto.CheckResult `json:"result"`
+}
+
+// EnrollRequest is the JSON body a new probe sends to exchange a join token
+// for its credential. A blank ProbeID asks the server to generate one.
+// EnrollmentID is a random value the probe keeps until it stores the
+// credential; retrying with the same value returns the probe the first
+// attempt created instead of spending another use.
+type EnrollRequest struct {
+	Token        string `json:"token"`
+	ProbeID      string `json:"probe_id,omitempty"`
+	EnrollmentID string `json:"enrollment_id,omitempty"`
+}
+
+// EnrollResponse carries the long-lived credential issued at enrollment.
+type EnrollResponse struct {
 	ProbeID string `json:"probe_id"`
+	Secret  string `json:"secret"`
 }
 
 // RegisterRequest is the JSON body sent when a probe registers on startup.
+// Labels describe where the probe runs, such as region, provider, or network,
+// and are matched against check probe selectors. CheckTypes lists the check
+// types the probe can execute; the server only assigns checks of those types.
 type RegisterRequest struct {
-	ProbeID string `json:"probe_id"`
-	Version string `json:"version"`
+	ProbeID         string            `json:"probe_id"`
+	Version         string            `json:"version"`
+	ProtocolVersion int               `json:"protocol_version,omitempty"`
+	CheckTypes      []string          `json:"check_types,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
 }
 
 // ResultBatchRequest is the JSON body sent when a probe flushes one or more
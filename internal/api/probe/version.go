@@ -0,0 +1,58 @@
+package probe
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed probe build version of the form vMAJOR.MINOR.PATCH.
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// ParseVersion parses a release version such as "v1.4.2" or "1.4". A leading
+// "v" is optional, missing minor or patch numbers default to zero, and any
+// pre-release or build suffix after "-" or "+" is ignored. Development builds
+// reporting "dev" do not parse.
+func ParseVersion(raw string) (Version, error) {
+	s := strings.TrimPrefix(strings.TrimSpace(raw), "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if s == "" || len(parts) > 3 {
+		return Version{}, fmt.Errorf("invalid version %q", raw)
+	}
+	var nums [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return Version{}, fmt.Errorf("invalid version %q", raw)
+		}
+		nums[i] = n
+	}
+	return Version{Major: nums[0], Minor: nums[1], Patch: nums[2]}, nil
+}
+
+// IsZero reports whether v is the zero version, used for "no minimum".
+func (v Version) IsZero() bool {
+	return v == Version{}
+}
+
+// Less reports whether v is an older release than other.
+func (v Version) Less(other Version) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Patch < other.Patch
+}
+
+func (v Version) String() string {
+	return fmt.Sprintf("v%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
@@ -0,0 +1,53 @@
+package probe
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    Version
+		wantErr bool
+	}{
+		{raw: "v1.4.2", want: Version{Major: 1, Minor: 4, Patch: 2}},
+		{raw: "1.4", want: Version{Major: 1, Minor: 4}},
+		{raw: "v2.0.0-rc.1", want: Version{Major: 2}},
+		{raw: "v1.2.3+build.7", want: Version{Major: 1, Minor: 2, Patch: 3}},
+		{raw: "dev", wantErr: true},
+		{raw: "", wantErr: true},
+		{raw: "v1.2.3.4", wantErr: true},
+		{raw: "v1.-2", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseVersion(tt.raw)
+		if tt.wantErr {
+			if err == nil {
+				t.Fatalf("ParseVersion(%q) error = nil, want error", tt.raw)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("ParseVersion(%q) error = %v", tt.raw, err)
+		}
+		if got != tt.want {
+			t.Fatalf("ParseVersion(%q) = %#v, want %#v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestVersionLess(t *testing.T) {
+	tests := []struct {
+		a, b Version
+		want bool
+	}{
+		{a: Version{Major: 1, Minor: 2, Patch: 3}, b: Version{Major: 1, Minor: 3}, want: true},
+		{a: Version{Major: 1, Minor: 3}, b: Version{Major: 1, Minor: 2, Patch: 9}, want: false},
+		{a: Version{Major: 1}, b: Version{Major: 2}, want: true},
+		{a: Version{Major: 1, Patch: 1}, b: Version{Major: 1, Patch: 1}, want: false},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Less(tt.b); got != tt.want {
+			t.Fatalf("%s.Less(%s) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
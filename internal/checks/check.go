@@ -3,14 +3,25 @@ package checks
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
 
+	"github.com/tmater/wacht/internal/labels"
 	"github.com/tmater/wacht/internal/network"
 )
 
 const (
 	DefaultInterval = 30
 	MaxInterval     = 86400
+	// MaxRetries bounds confirmation retries so a failing check still
+	// reports within a few seconds.
+	MaxRetries = 5
+)
+
+// Webhook payload schema versions a check can opt into per destination.
+const (
+	WebhookPayloadV1 = 1
+	WebhookPayloadV2 = 2
 )
 
 // Type identifies what kind of check should be executed.
@@ -20,8 +31,36 @@ const (
 	CheckHTTP Type = "http"
 	CheckTCP  Type = "tcp"
 	CheckDNS  Type = "dns"
+	// CheckTCPExpect connects like CheckTCP, then talks to the service; see
+	// network.TCPExchange.
+	CheckTCPExpect Type = "tcp-expect"
 )
 
+// MaxProbeCheckTypes bounds the capability list a probe may advertise.
+const MaxProbeCheckTypes = 16
+
+// Types lists every check type this build understands.
+var Types = []Type{CheckHTTP, CheckTCP, CheckDNS, CheckTCPExpect}
+
+// NormalizeTypes validates the check types a probe advertises and returns
+// them without duplicates, in their original order. Unknown types are
+// rejected so a probe cannot claim capabilities the server cannot schedule.
+func NormalizeTypes(raw []string) ([]string, error) {
+	if len(raw) > MaxProbeCheckTypes {
+		return nil, fmt.Errorf("check_types must list at most %d types", MaxProbeCheckTypes)
+	}
+	out := make([]string, 0, len(raw))
+	for _, checkType := range raw {
+		if !slices.Contains(Types, Type(checkType)) {
+			return nil, fmt.Errorf("check_types: unknown type %q", checkType)
+		}
+		if !slices.Contains(out, checkType) {
+			out = append(out, checkType)
+		}
+	}
+	return out, nil
+}
+
 // Check is the canonical definition of a monitored check after normalization.
 type Check struct {
 	ID       string `json:"id,omitempty" yaml:"-"`
@@ -30,6 +69,44 @@ type Check struct {
 	Target   string `json:"target" yaml:"target"`
 	Webhook  string `json:"webhook" yaml:"webhook"`
 	Interval int    `json:"interval" yaml:"interval"`
+	// Retries is how many times a probe immediately re-runs a failed check
+	// before reporting it down, so one dropped packet does not count toward
+	// quorum streaks.
+	Retries int `json:"retries" yaml:"retries"`
+	// WebhookVersion selects the alert payload schema sent to Webhook.
+	WebhookVersion int `json:"webhook_version" yaml:"webhook_version"`
+	// ProbeSelector limits which probes run the check and count towards its
+	// quorum, e.g. "region in (eu-west,eu-central)". Empty means all probes.
+	ProbeSelector string `json:"probe_selector" yaml:"probe_selector"`
+	// Private checks run only on probes owned by the check's owner and may
+	// target private networks. Shared probes never receive them.
+	Private bool `json:"private" yaml:"private"`
+	// TLS, Send, Expect, ExpectMode, and ReadTimeoutMS describe what a
+	// tcp-expect check does once connected. They are empty for other types.
+	TLS           bool   `json:"tls,omitempty" yaml:"tls,omitempty"`
+	Send          string `json:"send,omitempty" yaml:"send,omitempty"`
+	Expect        string `json:"expect,omitempty" yaml:"expect,omitempty"`
+	ExpectMode    string `json:"expect_mode,omitempty" yaml:"expect_mode,omitempty"`
+	ReadTimeoutMS int    `json:"read_timeout_ms,omitempty" yaml:"read_timeout_ms,omitempty"`
+	// OwnerID is the owning user, or zero for config-seeded checks. It is
+	// filled from the store and never accepted from clients.
+	OwnerID int64 `json:"-" yaml:"-"`
+}
+
+// TCPExchange returns the exchange a tcp-expect check runs once connected.
+func (c Check) TCPExchange() network.TCPExchange {
+	return tcpExchange(c.TLS, c.Send, c.Expect, c.ExpectMode, c.ReadTimeoutMS)
+}
+
+// SelectsProbe reports whether a probe with the given labels should run c.
+// A selector that fails to parse selects nothing; validation rejects those
+// before they are stored.
+func (c Check) SelectsProbe(probeLabels map[string]string) bool {
+	sel, err := labels.Parse(c.ProbeSelector)
+	if err != nil {
+		return false
+	}
+	return sel.Matches(probeLabels)
 }
 
 func NewCheck(name, checkType, target, webhook string, interval int) Check {
@@ -51,11 +128,23 @@ func (c Check) Normalize() Check {
 	if c.Interval == 0 {
 		c.Interval = DefaultInterval
 	}
+	if c.WebhookVersion == 0 {
+		c.WebhookVersion = WebhookPayloadV1
+	}
+	if sel, err := labels.Parse(c.ProbeSelector); err == nil {
+		c.ProbeSelector = sel.String()
+	}
+	c.ExpectMode = strings.ToLower(strings.TrimSpace(c.ExpectMode))
+	if c.Expect != "" && c.ExpectMode == "" {
+		c.ExpectMode = network.ExpectContains
+	}
 	return c
 }
 
 // NormalizeAndValidate returns the canonical form of the check or an error when
-// the definition is invalid under the given outbound target policy.
+// the definition is invalid under the given outbound target policy. Private
+// checks may target private networks because only their owner's probes run
+// them; the webhook is sent by the server and always follows policy.
 func (c Check) NormalizeAndValidate(ctx context.Context, policy network.Policy, requireName bool) (Check, error) {
 	c = c.Normalize()
 
@@ -68,10 +157,23 @@ func (c Check) NormalizeAndValidate(ctx context.Context, policy network.Policy,
 	if c.Interval < 1 || c.Interval > MaxInterval {
 		return Check{}, fmt.Errorf("interval must be between 0 and 86400 seconds")
 	}
+	if c.Retries < 0 || c.Retries > MaxRetries {
+		return Check{}, fmt.Errorf("retries must be between 0 and %d", MaxRetries)
+	}
+	if c.WebhookVersion != WebhookPayloadV1 && c.WebhookVersion != WebhookPayloadV2 {
+		return Check{}, fmt.Errorf("webhook_version must be 1 or 2")
+	}
+	if _, err := labels.Parse(c.ProbeSelector); err != nil {
+		return Check{}, fmt.Errorf("probe_selector: %w", err)
+	}
 	if err := network.ValidateWebhookURL(c.Webhook, policy); err != nil {
 		return Check{}, err
 	}
-	if err := network.ValidateCheckTarget(ctx, string(c.Type), c.Target, policy); err != nil {
+	targetPolicy := policy
+	if c.Private {
+		targetPolicy.AllowPrivateTargets = true
+	}
+	if err := network.ValidateCheckTarget(ctx, string(c.Type), c.Target, c.TCPExchange(), targetPolicy); err != nil {
 		return Check{}, err
 	}
 	return c, nil
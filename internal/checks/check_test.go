@@ -2,14 +2,24 @@ package checks
 
 import (
 	"context"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"runtime"
 	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/tmater/wacht/internal/network"
+	"github.com/tmater/wacht/internal/proto"
 	"gopkg.in/yaml.v3"
 )
 
@@ -28,6 +38,40 @@ func TestHTTP_Up(t *testing.T) {
 	if result.Type != string(CheckHTTP) {
 		t.Errorf("expected type %q, got %q", CheckHTTP, result.Type)
 	}
+	if result.Evidence != nil {
+		t.Errorf("expected no evidence for an up result, got %+v", result.Evidence)
+	}
+}
+
+func TestHTTP_ReportsPhaseTimings(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		time.Sleep(20 * time.Millisecond)
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	result := HTTP("check-1", "probe-1", srv.URL, network.Policy{AllowPrivateTargets: true})
+	if !result.Up {
+		t.Fatalf("expected Up=true, got false (error: %s)", result.Error)
+	}
+	if result.Timings == nil {
+		t.Fatal("expected phase timings")
+	}
+	if result.Timings.Connect <= 0 {
+		t.Errorf("Connect = %v, want > 0", result.Timings.Connect)
+	}
+	if result.Timings.TTFB < 20*time.Millisecond {
+		t.Errorf("TTFB = %v, want >= 20ms", result.Timings.TTFB)
+	}
+	if result.Timings.Transfer < 20*time.Millisecond {
+		t.Errorf("Transfer = %v, want >= 20ms", result.Timings.Transfer)
+	}
+	if result.Timings.DNS != 0 || result.Timings.TLS != 0 {
+		t.Errorf("DNS = %v, TLS = %v, want zero for a plain-HTTP IP target", result.Timings.DNS, result.Timings.TLS)
+	}
 }
 
 func TestHTTP_Down_Non2xx(t *testing.T) {
@@ -43,6 +87,73 @@ func TestHTTP_Down_Non2xx(t *testing.T) {
 	if result.Error == "" {
 		t.Error("expected non-empty Error for 500 response")
 	}
+	if result.ErrorKind != proto.ErrorKindAssertion {
+		t.Errorf("ErrorKind = %q, want %q", result.ErrorKind, proto.ErrorKindAssertion)
+	}
+}
+
+func TestHTTP_CapturesEvidenceOnFailedStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx")
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("<h1>maintenance</h1>"))
+	}))
+	defer srv.Close()
+
+	result := HTTP("check-1", "probe-1", srv.URL, network.Policy{AllowPrivateTargets: true})
+	if result.Up {
+		t.Fatal("expected Up=false for 503 response")
+	}
+	evidence := result.Evidence
+	if evidence == nil {
+		t.Fatal("expected evidence for failed status")
+	}
+	if evidence.Status != "HTTP/1.1 503 Service Unavailable" {
+		t.Errorf("Status = %q, want HTTP/1.1 503 Service Unavailable", evidence.Status)
+	}
+	if evidence.Body != "<h1>maintenance</h1>" || evidence.BodyTruncated {
+		t.Errorf("Body = %q truncated=%v, want full page", evidence.Body, evidence.BodyTruncated)
+	}
+	if evidence.Headers["Server"] != "nginx" {
+		t.Errorf("Headers = %v, want Server: nginx", evidence.Headers)
+	}
+	if _, ok := evidence.Headers["Set-Cookie"]; ok {
+		t.Errorf("Headers = %v, want Set-Cookie left out", evidence.Headers)
+	}
+	if evidence.RemoteAddr != srv.Listener.Addr().String() {
+		t.Errorf("RemoteAddr = %q, want %q", evidence.RemoteAddr, srv.Listener.Addr().String())
+	}
+}
+
+func TestHTTP_ReadsOnlyTheBodyItNeeds(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		chunk := []byte(strings.Repeat("x", 1<<10))
+		for i := 0; i < 512; i++ {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		}
+		w.Write([]byte("needle"))
+	}))
+	defer srv.Close()
+	policy := network.Policy{AllowPrivateTargets: true}
+
+	if result := HTTP("check-1", "probe-1", srv.URL, policy); !result.Up {
+		t.Fatalf("expected Up=true, got false (error: %s)", result.Error)
+	}
+	result := HTTPWith("check-1", "probe-1", srv.URL, policy, Options{ExpectBody: "needle"})
+	if !result.Up {
+		t.Fatalf("expected Up=true with the body read to the end, got false (error: %s)", result.Error)
+	}
+	result = HTTP("check-1", "probe-1", srv.URL+"/down", policy)
+	if result.Up || result.Evidence == nil || !result.Evidence.BodyTruncated || len(result.Evidence.Body) != proto.MaxEvidenceBodyBytes {
+		t.Fatalf("result = %+v, want down with truncated evidence body", result)
+	}
 }
 
 func TestHTTP_Down_Unreachable(t *testing.T) {
@@ -53,6 +164,9 @@ func TestHTTP_Down_Unreachable(t *testing.T) {
 	if result.Error == "" {
 		t.Error("expected non-empty Error for unreachable target")
 	}
+	if result.ErrorKind != proto.ErrorKindConnectionRefused {
+		t.Errorf("ErrorKind = %q, want %q", result.ErrorKind, proto.ErrorKindConnectionRefused)
+	}
 }
 
 func TestHTTP_RejectsBlockedTarget(t *testing.T) {
@@ -63,6 +177,31 @@ func TestHTTP_RejectsBlockedTarget(t *testing.T) {
 	if result.Error == "" {
 		t.Error("expected non-empty Error for blocked target")
 	}
+	if result.ErrorKind != proto.ErrorKindBlocked {
+		t.Errorf("ErrorKind = %q, want %q", result.ErrorKind, proto.ErrorKindBlocked)
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want proto.ErrorKind
+	}{
+		{"nil", nil, ""},
+		{"policy", fmt.Errorf("dial: %w", &network.PolicyError{Reason: "destination 10.0.0.1 is not allowed"}), proto.ErrorKindBlocked},
+		{"dns", fmt.Errorf("resolve host: %w", &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}), proto.ErrorKindDNS},
+		{"dns timeout", &net.DNSError{Err: "i/o timeout", Name: "example.com", IsTimeout: true}, proto.ErrorKindDNS},
+		{"refused", &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}, proto.ErrorKindConnectionRefused},
+		{"tls", &url.Error{Op: "Get", URL: "https://example.com", Err: x509.UnknownAuthorityError{}}, proto.ErrorKindTLS},
+		{"deadline", fmt.Errorf("get: %w", context.DeadlineExceeded), proto.ErrorKindTimeout},
+		{"other", errors.New("connection reset by peer"), proto.ErrorKindOther},
+	}
+	for _, tc := range cases {
+		if got := classifyError(tc.err); got != tc.want {
+			t.Errorf("%s: classifyError() = %q, want %q", tc.name, got, tc.want)
+		}
+	}
 }
 
 // TCP tests
@@ -103,22 +242,231 @@ func TestTCP_RejectsBlockedTarget(t *testing.T) {
 	}
 }
 
+// serveTCPOnce accepts one connection on loopback and hands it to handle.
+func serveTCPOnce(t *testing.T, handle func(conn net.Conn)) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handle(conn)
+	}()
+	return ln.Addr().String()
+}
+
+func TestTCPExpect_SendsPayloadAndMatchesResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		exchange network.TCPExchange
+		reply    string
+	}{
+		{"contains", network.TCPExchange{Send: "PING\r\n", Expect: "+PONG"}, "+PONG\r\n"},
+		{"regex", network.TCPExchange{Send: "PING\r\n", Expect: `^\+PONG\r\n$`, ExpectMode: network.ExpectRegex}, "+PONG\r\n"},
+		{"bytes", network.TCPExchange{Send: "PING\r\n", Expect: "2b 50 4f 4e 47", ExpectMode: network.ExpectBytes}, "+PONG\r\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := make(chan string, 1)
+			addr := serveTCPOnce(t, func(conn net.Conn) {
+				buf := make([]byte, 64)
+				n, _ := conn.Read(buf)
+				received <- string(buf[:n])
+				// Split the reply so the check has to keep reading.
+				io.WriteString(conn, tt.reply[:2])
+				time.Sleep(10 * time.Millisecond)
+				io.WriteString(conn, tt.reply[2:])
+			})
+
+			result := TCPExpect("check-1", "probe-1", addr, network.Policy{AllowPrivateTargets: true}, tt.exchange)
+			if !result.Up {
+				t.Fatalf("expected Up=true, got false (error: %s)", result.Error)
+			}
+			if result.Type != string(CheckTCPExpect) {
+				t.Errorf("expected type %q, got %q", CheckTCPExpect, result.Type)
+			}
+			if got := <-received; got != "PING\r\n" {
+				t.Errorf("server received %q, want PING", got)
+			}
+		})
+	}
+}
+
+func TestTCPExpect_MatchesBannerWithoutSending(t *testing.T) {
+	addr := serveTCPOnce(t, func(conn net.Conn) {
+		io.WriteString(conn, "220 mail.example.com ESMTP ready\r\n")
+	})
+
+	result := TCPExpect("check-1", "probe-1", addr, network.Policy{AllowPrivateTargets: true}, network.TCPExchange{Expect: `^220 `, ExpectMode: network.ExpectRegex})
+	if !result.Up {
+		t.Fatalf("expected Up=true, got false (error: %s)", result.Error)
+	}
+}
+
+func TestTCPExpect_ReportsMismatchAsAssertion(t *testing.T) {
+	addr := serveTCPOnce(t, func(conn net.Conn) {
+		io.WriteString(conn, "-NOAUTH Authentication required.\r\n")
+	})
+
+	result := TCPExpect("check-1", "probe-1", addr, network.Policy{AllowPrivateTargets: true}, network.TCPExchange{Send: "PING\r\n", Expect: "+PONG"})
+	if result.Up {
+		t.Fatal("expected Up=false for mismatched response")
+	}
+	if result.ErrorKind != proto.ErrorKindAssertion || !strings.Contains(result.Error, `"-NOAUTH`) {
+		t.Fatalf("error = %q (%s), want assertion quoting the response", result.Error, result.ErrorKind)
+	}
+}
+
+func TestTCPExpect_TimesOutWaitingForResponse(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	addr := serveTCPOnce(t, func(conn net.Conn) {
+		<-done
+	})
+
+	result := TCPExpect("check-1", "probe-1", addr, network.Policy{AllowPrivateTargets: true}, network.TCPExchange{Expect: "+PONG", ReadTimeout: 50 * time.Millisecond})
+	if result.Up {
+		t.Fatal("expected Up=false for silent server")
+	}
+	if result.ErrorKind != proto.ErrorKindTimeout {
+		t.Fatalf("error kind = %q, want timeout (error: %s)", result.ErrorKind, result.Error)
+	}
+}
+
+func TestTCPExpect_VerifiesTLSCertificate(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	result := TCPExpect("check-1", "probe-1", srv.Listener.Addr().String(), network.Policy{AllowPrivateTargets: true}, network.TCPExchange{TLS: true})
+	if result.Up {
+		t.Fatal("expected Up=false for untrusted certificate")
+	}
+	if result.ErrorKind != proto.ErrorKindTLS {
+		t.Fatalf("error kind = %q, want tls (error: %s)", result.ErrorKind, result.Error)
+	}
+}
+
+func TestProbeOptionsMatchesCheckTCPExchange(t *testing.T) {
+	check := Check{Type: CheckTCPExpect, TLS: true, Send: "PING\r\n", Expect: "+PONG", ExpectMode: network.ExpectContains, ReadTimeoutMS: 250}
+	probeCheck := proto.ProbeCheck{Type: string(check.Type), TLS: check.TLS, Send: check.Send, Expect: check.Expect, ExpectMode: check.ExpectMode, ReadTimeoutMS: check.ReadTimeoutMS}
+
+	if got, want := ProbeOptions(probeCheck).TCP, check.TCPExchange(); got != want {
+		t.Fatalf("ProbeOptions().TCP = %+v, want %+v", got, want)
+	}
+	if got := ProbeOptions(probeCheck).TCP.ReadTimeout; got != 250*time.Millisecond {
+		t.Fatalf("ReadTimeout = %s, want 250ms", got)
+	}
+}
+
+func TestCheckNormalizeAndValidateTCPExpect(t *testing.T) {
+	policy := network.Policy{AllowPrivateTargets: true}
+	check := Check{Name: "redis", Type: "TCP-Expect", Target: "127.0.0.1:6379", Send: "PING\r\n", Expect: "+PONG", ReadTimeoutMS: 500}
+	got, err := check.NormalizeAndValidate(context.Background(), policy, true)
+	if err != nil {
+		t.Fatalf("NormalizeAndValidate() error = %v", err)
+	}
+	if got.Type != CheckTCPExpect || got.ExpectMode != network.ExpectContains {
+		t.Fatalf("check = %+v, want tcp-expect with contains mode", got)
+	}
+	if exchange := got.TCPExchange(); exchange.ReadTimeout != 500*time.Millisecond || exchange.Send != "PING\r\n" {
+		t.Fatalf("exchange = %+v", exchange)
+	}
+
+	plain := Check{Name: "redis", Type: "tcp", Target: "127.0.0.1:6379", Expect: "+PONG"}
+	if _, err := plain.NormalizeAndValidate(context.Background(), policy, true); err == nil {
+		t.Fatal("expected expect on a plain tcp check to be rejected")
+	}
+	empty := Check{Name: "redis", Type: "tcp-expect", Target: "127.0.0.1:6379"}
+	if _, err := empty.NormalizeAndValidate(context.Background(), policy, true); err == nil {
+		t.Fatal("expected tcp-expect without tls, send, or expect to be rejected")
+	}
+}
+
+// Traceroute tests
+
+func TestTraceroute_ReachesLoopbackListener(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("traceroute needs linux")
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to start listener: %v", err)
+	}
+	defer ln.Close()
+
+	path := Traceroute(CheckTCP, ln.Addr().String(), network.Policy{AllowPrivateTargets: true}, TraceOptions{})
+	if !path.Reached || path.Error != "" {
+		t.Fatalf("path = %+v, want reached without error", path)
+	}
+	if path.Target != ln.Addr().String() {
+		t.Errorf("target = %q, want %q", path.Target, ln.Addr().String())
+	}
+	if len(path.Hops) != 1 || path.Hops[0].TTL != 1 || path.Hops[0].Addr != "127.0.0.1" {
+		t.Errorf("hops = %+v, want one hop at 127.0.0.1", path.Hops)
+	}
+}
+
+func TestTraceroute_ClosedPortCountsAsReached(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("traceroute needs linux")
+	}
+	path := Traceroute(CheckHTTP, "http://127.0.0.1:1/health", network.Policy{AllowPrivateTargets: true}, TraceOptions{})
+	if !path.Reached || path.Target != "127.0.0.1:1" {
+		t.Fatalf("path = %+v, want the refusing target reached", path)
+	}
+}
+
+func TestTraceroute_RejectsBlockedTarget(t *testing.T) {
+	path := Traceroute(CheckTCP, "127.0.0.1:1", network.Policy{}, TraceOptions{})
+	if path.Reached || path.Error == "" || len(path.Hops) != 0 {
+		t.Fatalf("path = %+v, want an error and no hops", path)
+	}
+}
+
+func TestTraceAddress(t *testing.T) {
+	tests := []struct {
+		checkType  Type
+		target     string
+		host, port string
+	}{
+		{CheckHTTP, "https://example.com/health", "example.com", "443"},
+		{CheckHTTP, "http://example.com", "example.com", "80"},
+		{CheckHTTP, "http://example.com:8080/", "example.com", "8080"},
+		{CheckTCP, "db.example.com:5432", "db.example.com", "5432"},
+	}
+	for _, tt := range tests {
+		host, port, err := traceAddress(tt.checkType, tt.target)
+		if err != nil || host != tt.host || port != tt.port {
+			t.Errorf("traceAddress(%q, %q) = %q, %q, %v; want %q, %q", tt.checkType, tt.target, host, port, err, tt.host, tt.port)
+		}
+	}
+	if _, _, err := traceAddress(CheckDNS, "example.com"); err == nil {
+		t.Error("traceAddress(dns) error = nil, want unsupported")
+	}
+}
+
 func TestValidateTarget_RejectsPrivateHTTPDestination(t *testing.T) {
-	err := network.ValidateCheckTarget(context.Background(), "http", "http://127.0.0.1:8080", network.Policy{})
+	err := network.ValidateCheckTarget(context.Background(), "http", "http://127.0.0.1:8080", network.TCPExchange{}, network.Policy{})
 	if err == nil {
 		t.Fatal("expected private HTTP target to be rejected")
 	}
 }
 
 func TestValidateTarget_AllowsPrivateHTTPDestinationWhenConfigured(t *testing.T) {
-	err := network.ValidateCheckTarget(context.Background(), "http", "http://127.0.0.1:8080", network.Policy{AllowPrivateTargets: true})
+	err := network.ValidateCheckTarget(context.Background(), "http", "http://127.0.0.1:8080", network.TCPExchange{}, network.Policy{AllowPrivateTargets: true})
 	if err != nil {
 		t.Fatalf("expected private HTTP target to be allowed, got %v", err)
 	}
 }
 
 func TestValidateTarget_RejectsIPForDNS(t *testing.T) {
-	err := network.ValidateCheckTarget(context.Background(), "dns", "127.0.0.1", network.Policy{AllowPrivateTargets: true})
+	err := network.ValidateCheckTarget(context.Background(), "dns", "127.0.0.1", network.TCPExchange{}, network.Policy{AllowPrivateTargets: true})
 	if err == nil {
 		t.Fatal("expected DNS IP literal to be rejected")
 	}
@@ -180,6 +528,16 @@ func TestCheckNormalizeAndValidateRejectsNegativeInterval(t *testing.T) {
 	}
 }
 
+func TestCheckNormalizeAndValidateRejectsOutOfRangeRetries(t *testing.T) {
+	for _, retries := range []int{-1, MaxRetries + 1} {
+		check := NewCheck("api-check", "http", "https://1.1.1.1", "", 30)
+		check.Retries = retries
+		if _, err := check.NormalizeAndValidate(context.Background(), network.Policy{}, true); err == nil {
+			t.Fatalf("NormalizeAndValidate() retries %d error = nil, want retries error", retries)
+		}
+	}
+}
+
 func TestCheckNormalizeAndValidateRejectsInvalidWebhook(t *testing.T) {
 	_, err := NewCheck("api-check", "http", "https://1.1.1.1", "http://127.0.0.1/webhook", 30).
 		NormalizeAndValidate(context.Background(), network.Policy{}, true)
@@ -191,6 +549,43 @@ func TestCheckNormalizeAndValidateRejectsInvalidWebhook(t *testing.T) {
 	}
 }
 
+func TestCheckNormalizeAndValidateCanonicalizesProbeSelector(t *testing.T) {
+	check := NewCheck("api-check", "http", "https://1.1.1.1", "", 30)
+	check.ProbeSelector = " region == eu-west , !gpu "
+	check, err := check.NormalizeAndValidate(context.Background(), network.Policy{}, true)
+	if err != nil {
+		t.Fatalf("NormalizeAndValidate() error = %v", err)
+	}
+	if check.ProbeSelector != "region=eu-west,!gpu" {
+		t.Fatalf("ProbeSelector = %q, want canonical selector", check.ProbeSelector)
+	}
+	if !check.SelectsProbe(map[string]string{"region": "eu-west"}) || check.SelectsProbe(map[string]string{"region": "us-east"}) {
+		t.Fatal("SelectsProbe did not follow the selector")
+	}
+
+	check.ProbeSelector = "region like eu"
+	if _, err := check.NormalizeAndValidate(context.Background(), network.Policy{}, true); err == nil || !strings.Contains(err.Error(), "probe_selector:") {
+		t.Fatalf("error = %v, want probe_selector validation error", err)
+	}
+}
+
+func TestCheckNormalizeAndValidatePrivateCheckAllowsPrivateTargetOnly(t *testing.T) {
+	check := NewCheck("intranet", "http", "http://10.0.0.5", "", 30)
+	if _, err := check.NormalizeAndValidate(context.Background(), network.Policy{}, true); err == nil {
+		t.Fatal("NormalizeAndValidate() error = nil, want private target rejected for shared check")
+	}
+
+	check.Private = true
+	if _, err := check.NormalizeAndValidate(context.Background(), network.Policy{}, true); err != nil {
+		t.Fatalf("NormalizeAndValidate() error = %v, want private target allowed", err)
+	}
+
+	check.Webhook = "http://10.0.0.6/hook"
+	if _, err := check.NormalizeAndValidate(context.Background(), network.Policy{}, true); err == nil || !strings.Contains(err.Error(), "webhook:") {
+		t.Fatalf("error = %v, want webhook to keep the server policy", err)
+	}
+}
+
 func TestCheckJSONUsesLowercaseFieldNames(t *testing.T) {
 	check := NewCheck("api-check", "http", "https://example.com", "https://hooks.example.com", 45)
 
@@ -233,3 +628,24 @@ func TestCheckYAMLUsesConfigFieldNames(t *testing.T) {
 		t.Fatalf("Interval = %d, want 45", check.Interval)
 	}
 }
+
+func TestNormalizeTypesDeduplicatesAndRejectsUnknown(t *testing.T) {
+	got, err := NormalizeTypes([]string{"tcp", "http", "tcp"})
+	if err != nil {
+		t.Fatalf("NormalizeTypes: %v", err)
+	}
+	if fmt.Sprint(got) != "[tcp http]" {
+		t.Fatalf("NormalizeTypes = %v, want [tcp http]", got)
+	}
+
+	if _, err := NormalizeTypes([]string{"http", "icmp"}); err == nil {
+		t.Fatal("NormalizeTypes accepted an unknown type")
+	}
+	tooMany := make([]string, MaxProbeCheckTypes+1)
+	for i := range tooMany {
+		tooMany[i] = "http"
+	}
+	if _, err := NormalizeTypes(tooMany); err == nil {
+		t.Fatal("NormalizeTypes accepted more than MaxProbeCheckTypes entries")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 	"net"
+	"slices"
 	"strings"
 	"time"
 
@@ -16,6 +17,11 @@ import (
 // DNS resolves target as a hostname and returns a CheckResult.
 // target should be a bare hostname, e.g. "example.com".
 func DNS(checkID, probeID, target string, policy network.Policy) proto.CheckResult {
+	return DNSWith(checkID, probeID, target, policy, Options{})
+}
+
+// DNSWith runs a DNS check with explicit options.
+func DNSWith(checkID, probeID, target string, policy network.Policy, opts Options) proto.CheckResult {
 	slog.Default().Debug("dns check started", "component", "check_dns", "check_id", checkID, "probe_id", probeID, "target_host", logx.TargetHost(target))
 
 	result := proto.CheckResult{
@@ -30,11 +36,12 @@ func DNS(checkID, probeID, target string, policy network.Policy) proto.CheckResu
 	if err != nil {
 		result.Up = false
 		result.Error = err.Error()
+		result.ErrorKind = proto.ErrorKindOther
 		slog.Default().Warn("dns check failed", "component", "check_dns", "check_id", checkID, "probe_id", probeID, "target_host", logx.TargetHost(target), "err", err)
 		return result
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
 	defer cancel()
 
 	start := time.Now()
@@ -44,6 +51,7 @@ func DNS(checkID, probeID, target string, policy network.Policy) proto.CheckResu
 	if err != nil {
 		result.Up = false
 		result.Error = err.Error()
+		result.ErrorKind = classifyError(err)
 		slog.Default().Warn("dns check failed", "component", "check_dns", "check_id", checkID, "probe_id", probeID, "target_host", logx.TargetHost(target), "err", err)
 		return result
 	}
@@ -51,10 +59,19 @@ func DNS(checkID, probeID, target string, policy network.Policy) proto.CheckResu
 	if len(addrs) == 0 {
 		result.Up = false
 		result.Error = "no addresses resolved"
+		result.ErrorKind = proto.ErrorKindDNS
 		slog.Default().Warn("dns check failed", "component", "check_dns", "check_id", checkID, "probe_id", probeID, "target_host", logx.TargetHost(target), "err", "no addresses resolved")
 		return result
 	}
 
+	if opts.ExpectAddr != "" && !slices.Contains(addrs, opts.ExpectAddr) {
+		result.Up = false
+		result.Error = fmt.Sprintf("expected address %s not found in DNS response", opts.ExpectAddr)
+		result.ErrorKind = proto.ErrorKindAssertion
+		slog.Default().Warn("dns expectation failed", "component", "check_dns", "check_id", checkID, "probe_id", probeID, "target_host", logx.TargetHost(target), "err", result.Error)
+		return result
+	}
+
 	result.Up = true
 	slog.Default().Debug("dns check finished", "component", "check_dns", "check_id", checkID, "probe_id", probeID, "target_host", logx.TargetHost(target), "up", true, "addrs", len(addrs), "latency_ms", result.Latency.Milliseconds())
 	return result
@@ -62,37 +79,7 @@ func DNS(checkID, probeID, target string, policy network.Policy) proto.CheckResu
 
 // DNSExpect resolves target and checks that expectedAddr appears in the results.
 func DNSExpect(checkID, probeID, target, expectedAddr string, policy network.Policy) proto.CheckResult {
-	result := DNS(checkID, probeID, target, policy)
-	if !result.Up {
-		return result
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	host, err := network.ParseDNSHostnameTarget(target)
-	if err != nil {
-		result.Up = false
-		result.Error = err.Error()
-		return result
-	}
-
-	addrs, err := lookupDNSHost(ctx, host, policy)
-	if err != nil {
-		result.Up = false
-		result.Error = err.Error()
-		return result
-	}
-	for _, a := range addrs {
-		if a == expectedAddr {
-			return result
-		}
-	}
-
-	result.Up = false
-	result.Error = fmt.Sprintf("expected address %s not found in DNS response", expectedAddr)
-	slog.Default().Warn("dns expectation failed", "component", "check_dns", "check_id", checkID, "probe_id", probeID, "target_host", logx.TargetHost(target), "err", result.Error)
-	return result
+	return DNSWith(checkID, probeID, target, policy, Options{ExpectAddr: expectedAddr})
 }
 
 func lookupDNSHost(ctx context.Context, host string, policy network.Policy) ([]string, error) {
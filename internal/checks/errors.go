@@ -0,0 +1,48 @@
+package checks
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"syscall"
+
+	"github.com/tmater/wacht/internal/network"
+	"github.com/tmater/wacht/internal/proto"
+)
+
+// classifyError maps a checker error to the kind reported in
+// CheckResult.ErrorKind. Policy rejections come first because they wrap no
+// network error at all; DNS comes before timeout so a resolver timeout still
+// points at DNS.
+func classifyError(err error) proto.ErrorKind {
+	var (
+		policyErr    *network.PolicyError
+		dnsErr       *net.DNSError
+		verifyErr    *tls.CertificateVerificationError
+		recordErr    tls.RecordHeaderError
+		alertErr     tls.AlertError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+		netErr       net.Error
+	)
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &policyErr):
+		return proto.ErrorKindBlocked
+	case errors.As(err, &dnsErr):
+		return proto.ErrorKindDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return proto.ErrorKindConnectionRefused
+	case errors.As(err, &verifyErr), errors.As(err, &recordErr), errors.As(err, &alertErr),
+		errors.As(err, &authorityErr), errors.As(err, &hostnameErr), errors.As(err, &invalidErr):
+		return proto.ErrorKindTLS
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return proto.ErrorKindTimeout
+	default:
+		return proto.ErrorKindOther
+	}
+}
@@ -2,9 +2,14 @@ package checks
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/tmater/wacht/internal/logx"
@@ -14,9 +19,14 @@ import (
 
 // HTTP runs an HTTP check against the given target URL and returns a CheckResult.
 func HTTP(checkID, probeID, target string, policy network.Policy) proto.CheckResult {
+	return HTTPWith(checkID, probeID, target, policy, Options{})
+}
+
+// HTTPWith runs an HTTP check with explicit options.
+func HTTPWith(checkID, probeID, target string, policy network.Policy, opts Options) proto.CheckResult {
 	slog.Default().Debug("http check started", "component", "check_http", "check_id", checkID, "probe_id", probeID, "target_host", logx.TargetHost(target))
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
 	defer cancel()
 
 	result := proto.CheckResult{
@@ -30,18 +40,31 @@ func HTTP(checkID, probeID, target string, policy network.Policy) proto.CheckRes
 	if _, err := network.ParseHTTPURLTarget(target); err != nil {
 		result.Up = false
 		result.Error = err.Error()
+		result.ErrorKind = proto.ErrorKindOther
 		slog.Default().Warn("http check failed", "component", "check_http", "check_id", checkID, "probe_id", probeID, "target_host", logx.TargetHost(target), "err", err)
 		return result
 	}
 
-	client := policy.NewHTTPClient(10*time.Second, 10*time.Second, true)
+	client := policy.NewHTTPClient(opts.timeout(), opts.timeout(), true)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
 	if err != nil {
 		result.Up = false
 		result.Error = err.Error()
+		result.ErrorKind = proto.ErrorKindOther
 		slog.Default().Warn("http check failed", "component", "check_http", "check_id", checkID, "probe_id", probeID, "target_host", logx.TargetHost(target), "err", err)
 		return result
 	}
+	for name, values := range opts.Headers {
+		for _, value := range values {
+			req.Header.Add(name, value)
+		}
+	}
+	if host := opts.Headers.Get("Host"); host != "" {
+		req.Host = host
+	}
+
+	phases := &httpPhaseTrace{}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), phases.clientTrace()))
 
 	start := time.Now()
 	resp, err := client.Do(req)
@@ -50,16 +73,173 @@ func HTTP(checkID, probeID, target string, policy network.Policy) proto.CheckRes
 	if err != nil {
 		result.Up = false
 		result.Error = err.Error()
+		result.ErrorKind = classifyError(err)
+		result.Timings = phases.snapshot()
 		slog.Default().Warn("http check failed", "component", "check_http", "check_id", checkID, "probe_id", probeID, "target_host", logx.TargetHost(target), "err", err)
 		return result
 	}
 	defer resp.Body.Close()
 
-	result.Up = resp.StatusCode >= 200 && resp.StatusCode < 400
+	if opts.ExpectStatus != 0 {
+		result.Up = resp.StatusCode == opts.ExpectStatus
+	} else {
+		result.Up = resp.StatusCode >= 200 && resp.StatusCode < 400
+	}
+
+	// Only read as much of the body as the result needs: up to maxBodyBytes
+	// to search for ExpectBody, enough for evidence when the status failed,
+	// and otherwise a short drain so the transfer phase is still measured.
+	bodyLimit := int64(maxDrainBodyBytes)
+	switch {
+	case result.Up && opts.ExpectBody != "":
+		bodyLimit = maxBodyBytes
+	case !result.Up:
+		bodyLimit = proto.MaxEvidenceBodyBytes + 1
+	}
+	body, bodyErr := io.ReadAll(io.LimitReader(resp.Body, bodyLimit))
+	phases.finishTransfer()
+	result.Timings = phases.snapshot()
+
 	if !result.Up {
 		result.Error = fmt.Sprintf("unexpected status code: %d", resp.StatusCode)
+		result.ErrorKind = proto.ErrorKindAssertion
+	} else if opts.ExpectBody != "" {
+		switch {
+		case bodyErr != nil:
+			result.Up = false
+			result.Error = fmt.Sprintf("read body: %v", bodyErr)
+			result.ErrorKind = classifyError(bodyErr)
+		case !strings.Contains(string(body), opts.ExpectBody):
+			result.Up = false
+			result.Error = fmt.Sprintf("expected body text %q not found", opts.ExpectBody)
+			result.ErrorKind = proto.ErrorKindAssertion
+		}
+	}
+	if result.ErrorKind == proto.ErrorKindAssertion {
+		result.Evidence = responseEvidence(resp, body, phases.remoteAddr())
 	}
 
 	slog.Default().Debug("http check finished", "component", "check_http", "check_id", checkID, "probe_id", probeID, "target_host", logx.TargetHost(target), "status_code", resp.StatusCode, "up", result.Up, "latency_ms", result.Latency.Milliseconds())
 	return result
 }
+
+// httpPhaseTrace collects HTTP request phase durations from httptrace hooks.
+// Hooks can fire from transport goroutines, so fields are guarded by mu.
+type httpPhaseTrace struct {
+	mu        sync.Mutex
+	timings   proto.HTTPTimings
+	dns       time.Time
+	connect   time.Time
+	tls       time.Time
+	wrote     time.Time
+	firstByte time.Time
+	remote    string
+}
+
+func (t *httpPhaseTrace) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { t.begin(&t.dns) },
+		DNSDone:           func(httptrace.DNSDoneInfo) { t.end(&t.dns, &t.timings.DNS) },
+		ConnectStart:      func(string, string) { t.begin(&t.connect) },
+		ConnectDone:       func(string, string, error) { t.end(&t.connect, &t.timings.Connect) },
+		TLSHandshakeStart: func() { t.begin(&t.tls) },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { t.end(&t.tls, &t.timings.TLS) },
+		WroteRequest:      func(httptrace.WroteRequestInfo) { t.begin(&t.wrote) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.remote = info.Conn.RemoteAddr().String()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.firstByte = time.Now()
+			if !t.wrote.IsZero() {
+				t.timings.TTFB += t.firstByte.Sub(t.wrote)
+				t.wrote = time.Time{}
+			}
+		},
+	}
+}
+
+func (t *httpPhaseTrace) begin(start *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	*start = time.Now()
+}
+
+// end adds the time since *start to *phase. Each phase adds up across
+// redirect hops.
+func (t *httpPhaseTrace) end(start *time.Time, phase *time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if start.IsZero() {
+		return
+	}
+	*phase += time.Since(*start)
+	*start = time.Time{}
+}
+
+// finishTransfer records the time from the final response's first byte to
+// the end of its body.
+func (t *httpPhaseTrace) finishTransfer() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.firstByte.IsZero() {
+		t.timings.Transfer = time.Since(t.firstByte)
+	}
+}
+
+// remoteAddr returns the address of the connection the final request used.
+func (t *httpPhaseTrace) remoteAddr() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.remote
+}
+
+// snapshot returns the phases measured so far, or nil when none were.
+func (t *httpPhaseTrace) snapshot() *proto.HTTPTimings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.timings.IsZero() {
+		return nil
+	}
+	timings := t.timings
+	return &timings
+}
+
+// evidenceHeaders are the response headers kept as failure evidence. They
+// describe the response and the path it took; cookies and other headers that
+// may carry secrets are left out.
+var evidenceHeaders = []string{
+	"Cache-Control",
+	"Cf-Ray",
+	"Content-Length",
+	"Content-Type",
+	"Location",
+	"Retry-After",
+	"Server",
+	"Via",
+	"X-Cache",
+	"X-Request-Id",
+}
+
+// responseEvidence snapshots a response that failed the check's expectations.
+func responseEvidence(resp *http.Response, body []byte, remoteAddr string) *proto.HTTPEvidence {
+	evidence := proto.HTTPEvidence{
+		Status:     resp.Proto + " " + resp.Status,
+		Body:       string(body),
+		RemoteAddr: remoteAddr,
+	}
+	for _, name := range evidenceHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			if evidence.Headers == nil {
+				evidence.Headers = make(map[string]string)
+			}
+			evidence.Headers[name] = value
+		}
+	}
+	// Bounded cuts the body to the evidence limit and marks it truncated.
+	evidence = evidence.Bounded()
+	return &evidence
+}
@@ -0,0 +1,66 @@
+package checks
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/tmater/wacht/internal/network"
+	"github.com/tmater/wacht/internal/proto"
+)
+
+const (
+	// DefaultTimeout bounds one check execution when Options.Timeout is zero.
+	DefaultTimeout = 10 * time.Second
+	// maxBodyBytes caps how much of an HTTP response body is searched for
+	// Options.ExpectBody.
+	maxBodyBytes = 1 << 20
+	// maxDrainBodyBytes caps how much of an HTTP response body is read when
+	// nothing is expected of it, only to time the transfer phase.
+	maxDrainBodyBytes = 4 << 10
+	// maxTCPResponseBytes caps how much a tcp-expect check reads while
+	// waiting for its expected response.
+	maxTCPResponseBytes = 64 << 10
+)
+
+// Options tunes one check execution. ProbeOptions returns what scheduled
+// probe runs use.
+type Options struct {
+	Timeout time.Duration
+	// Headers are added to HTTP requests.
+	Headers http.Header
+	// ExpectStatus requires this exact HTTP status instead of any 2xx or 3xx.
+	ExpectStatus int
+	// ExpectBody requires this substring in the HTTP response body.
+	ExpectBody string
+	// ExpectAddr requires this address among the DNS answers.
+	ExpectAddr string
+	// TCP is what a tcp-expect check does once connected.
+	TCP network.TCPExchange
+}
+
+// ProbeOptions returns the options a probe runs check with. The tcp-expect
+// exchange is built the same way as Check.TCPExchange on the server.
+func ProbeOptions(check proto.ProbeCheck) Options {
+	return Options{
+		TCP: tcpExchange(check.TLS, check.Send, check.Expect, check.ExpectMode, check.ReadTimeoutMS),
+	}
+}
+
+// tcpExchange builds the exchange a tcp-expect check runs from its stored
+// fields.
+func tcpExchange(tls bool, send, expect, expectMode string, readTimeoutMS int) network.TCPExchange {
+	return network.TCPExchange{
+		TLS:         tls,
+		Send:        send,
+		Expect:      expect,
+		ExpectMode:  expectMode,
+		ReadTimeout: time.Duration(readTimeoutMS) * time.Millisecond,
+	}
+}
+
+func (o Options) timeout() time.Duration {
+	if o.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return o.Timeout
+}
@@ -2,6 +2,10 @@ package checks
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"time"
 
@@ -12,6 +16,11 @@ import (
 
 // TCP attempts to open a TCP connection to target (host:port) and returns a CheckResult.
 func TCP(checkID, probeID, target string, policy network.Policy) proto.CheckResult {
+	return TCPWith(checkID, probeID, target, policy, Options{})
+}
+
+// TCPWith runs a TCP check with explicit options.
+func TCPWith(checkID, probeID, target string, policy network.Policy, opts Options) proto.CheckResult {
 	slog.Default().Debug("tcp check started", "component", "check_tcp", "check_id", checkID, "probe_id", probeID, "target_host", logx.TargetHost(target))
 
 	result := proto.CheckResult{
@@ -25,20 +34,22 @@ func TCP(checkID, probeID, target string, policy network.Policy) proto.CheckResu
 	if _, _, err := network.ParseTCPAddressTarget(target); err != nil {
 		result.Up = false
 		result.Error = err.Error()
+		result.ErrorKind = proto.ErrorKindOther
 		slog.Default().Warn("tcp check failed", "component", "check_tcp", "check_id", checkID, "probe_id", probeID, "target_host", logx.TargetHost(target), "err", err)
 		return result
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
 	defer cancel()
 
 	start := time.Now()
-	conn, err := policy.DialContext(ctx, "tcp", target, 10*time.Second)
+	conn, err := policy.DialContext(ctx, "tcp", target, opts.timeout())
 	result.Latency = time.Since(start)
 
 	if err != nil {
 		result.Up = false
 		result.Error = err.Error()
+		result.ErrorKind = classifyError(err)
 		slog.Default().Warn("tcp check failed", "component", "check_tcp", "check_id", checkID, "probe_id", probeID, "target_host", logx.TargetHost(target), "err", err)
 		return result
 	}
@@ -48,3 +59,122 @@ func TCP(checkID, probeID, target string, policy network.Policy) proto.CheckResu
 	slog.Default().Debug("tcp check finished", "component", "check_tcp", "check_id", checkID, "probe_id", probeID, "target_host", logx.TargetHost(target), "up", true, "latency_ms", result.Latency.Milliseconds())
 	return result
 }
+
+// TCPExpect connects to target (host:port) and runs exchange: an optional TLS
+// handshake, an optional payload, and an optional wait for a matching
+// response. It returns a CheckResult.
+func TCPExpect(checkID, probeID, target string, policy network.Policy, exchange network.TCPExchange) proto.CheckResult {
+	return TCPExpectWith(checkID, probeID, target, policy, Options{TCP: exchange})
+}
+
+// TCPExpectWith runs a tcp-expect check with explicit options. Options.Timeout
+// bounds the connect, handshake, and send; Options.TCP.ReadTimeout, when set,
+// bounds the wait for the response instead.
+func TCPExpectWith(checkID, probeID, target string, policy network.Policy, opts Options) proto.CheckResult {
+	slog.Default().Debug("tcp-expect check started", "component", "check_tcp", "check_id", checkID, "probe_id", probeID, "target_host", logx.TargetHost(target))
+
+	result := proto.CheckResult{
+		CheckID:   checkID,
+		ProbeID:   probeID,
+		Type:      string(CheckTCPExpect),
+		Target:    target,
+		Timestamp: time.Now().UTC(),
+	}
+	fail := func(err error, kind proto.ErrorKind) proto.CheckResult {
+		result.Up = false
+		result.Error = err.Error()
+		result.ErrorKind = kind
+		slog.Default().Warn("tcp-expect check failed", "component", "check_tcp", "check_id", checkID, "probe_id", probeID, "target_host", logx.TargetHost(target), "err", err)
+		return result
+	}
+
+	host, _, err := network.ParseTCPAddressTarget(target)
+	if err != nil {
+		return fail(err, proto.ErrorKindOther)
+	}
+	match, err := opts.TCP.Matcher()
+	if err != nil {
+		return fail(err, proto.ErrorKindOther)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout())
+	defer cancel()
+
+	start := time.Now()
+	conn, err := policy.DialContext(ctx, "tcp", target, opts.timeout())
+	if err != nil {
+		result.Latency = time.Since(start)
+		return fail(err, classifyError(err))
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if opts.TCP.TLS {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			result.Latency = time.Since(start)
+			return fail(fmt.Errorf("tls handshake: %w", err), classifyError(err))
+		}
+		conn = tlsConn
+	}
+	if opts.TCP.Send != "" {
+		if _, err := io.WriteString(conn, opts.TCP.Send); err != nil {
+			result.Latency = time.Since(start)
+			return fail(fmt.Errorf("send: %w", err), classifyError(err))
+		}
+	}
+	if match != nil {
+		if opts.TCP.ReadTimeout > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(opts.TCP.ReadTimeout))
+		}
+		got, matched, err := readUntilMatch(conn, match)
+		result.Latency = time.Since(start)
+		switch {
+		case matched:
+		case len(got) == 0 && err != nil:
+			return fail(fmt.Errorf("read: %w", err), classifyError(err))
+		default:
+			return fail(fmt.Errorf("response did not match expect: got %s", responsePreview(got)), proto.ErrorKindAssertion)
+		}
+	}
+	result.Latency = time.Since(start)
+
+	result.Up = true
+	slog.Default().Debug("tcp-expect check finished", "component", "check_tcp", "check_id", checkID, "probe_id", probeID, "target_host", logx.TargetHost(target), "up", true, "latency_ms", result.Latency.Milliseconds())
+	return result
+}
+
+// readUntilMatch reads from r until match accepts everything read so far, the
+// peer stops sending, or maxTCPResponseBytes were read. The error is nil when
+// the peer closed the connection.
+func readUntilMatch(r io.Reader, match func([]byte) bool) (got []byte, matched bool, err error) {
+	chunk := make([]byte, 4096)
+	for len(got) < maxTCPResponseBytes {
+		n, err := r.Read(chunk[:min(len(chunk), maxTCPResponseBytes-len(got))])
+		got = append(got, chunk[:n]...)
+		if match(got) {
+			return got, true, nil
+		}
+		if errors.Is(err, io.EOF) {
+			return got, false, nil
+		}
+		if err != nil {
+			return got, false, err
+		}
+	}
+	return got, false, nil
+}
+
+// responsePreview quotes the start of a response for an error message.
+func responsePreview(got []byte) string {
+	const limit = 64
+	if len(got) == 0 {
+		return "nothing"
+	}
+	if len(got) > limit {
+		return fmt.Sprintf("%q...", got[:limit])
+	}
+	return fmt.Sprintf("%q", got)
+}
@@ -0,0 +1,138 @@
+package checks
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/tmater/wacht/internal/logx"
+	"github.com/tmater/wacht/internal/network"
+	"github.com/tmater/wacht/internal/proto"
+)
+
+const (
+	// DefaultTraceMaxHops is how far a traceroute walks when
+	// TraceOptions.MaxHops is zero.
+	DefaultTraceMaxHops = 16
+	// DefaultTraceHopTimeout is how long each hop may take to answer when
+	// TraceOptions.HopTimeout is zero.
+	DefaultTraceHopTimeout = time.Second
+	// maxSilentHops ends a trace after this many hops in a row did not
+	// answer; the path beyond a filtering hop rarely answers either.
+	maxSilentHops = 5
+)
+
+// TraceOptions bounds one traceroute.
+type TraceOptions struct {
+	MaxHops    int
+	HopTimeout time.Duration
+}
+
+func (o TraceOptions) maxHops() int {
+	if o.MaxHops <= 0 {
+		return DefaultTraceMaxHops
+	}
+	return min(o.MaxHops, proto.MaxPathHops)
+}
+
+func (o TraceOptions) hopTimeout() time.Duration {
+	if o.HopTimeout <= 0 {
+		return DefaultTraceHopTimeout
+	}
+	return o.HopTimeout
+}
+
+// hopOutcome is what one TTL step of a traceroute ran into.
+type hopOutcome int
+
+const (
+	hopSilent      hopOutcome = iota // nothing answered in time
+	hopTransit                       // a router reported the TTL expired
+	hopReached                       // the target accepted or refused the connection
+	hopUnreachable                   // a router reported the target unreachable
+)
+
+// Traceroute walks the TCP path from this host toward the target of an HTTP
+// or TCP check by sending connection attempts with increasing TTLs, the way
+// tcptraceroute does, so the packets look like the check's own traffic to
+// firewalls on the way. The target must pass policy; the routers in between
+// are only listened to, never contacted. Traceroute never fails: problems end
+// the trace early and are reported in NetworkPath.Error.
+func Traceroute(checkType Type, target string, policy network.Policy, opts TraceOptions) proto.NetworkPath {
+	var path proto.NetworkPath
+	host, port, err := traceAddress(checkType, target)
+	if err != nil {
+		path.Error = err.Error()
+		return path
+	}
+
+	hopTimeout := opts.hopTimeout()
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout+time.Duration(opts.maxHops())*hopTimeout)
+	defer cancel()
+
+	ips, err := policy.ResolveHost(ctx, host)
+	if err != nil {
+		path.Error = err.Error()
+		return path
+	}
+	ip := ips[0].IP
+	path.Target = net.JoinHostPort(ip.String(), port)
+
+	silent := 0
+	for ttl := 1; ttl <= opts.maxHops(); ttl++ {
+		hop, outcome, err := traceHop(ctx, ip, port, ttl, hopTimeout)
+		if err != nil {
+			path.Error = err.Error()
+			break
+		}
+		path.Hops = append(path.Hops, hop)
+
+		switch outcome {
+		case hopReached:
+			path.Reached = true
+		case hopUnreachable:
+			path.Error = fmt.Sprintf("%s reported the target unreachable", hop.Addr)
+		case hopSilent:
+			silent++
+			if silent == maxSilentHops {
+				path.Error = fmt.Sprintf("no answer from the last %d hops", maxSilentHops)
+			}
+		default:
+			silent = 0
+		}
+		if path.Reached || path.Error != "" {
+			break
+		}
+	}
+	if !path.Reached && path.Error == "" {
+		path.Error = fmt.Sprintf("target not reached within %d hops", opts.maxHops())
+	}
+
+	slog.Default().Debug("traceroute finished", "component", "check_traceroute", "target_host", logx.TargetHost(path.Target), "hops", len(path.Hops), "reached", path.Reached, "err", path.Error)
+	return path
+}
+
+// traceAddress returns the host and port an HTTP or TCP check connects to.
+func traceAddress(checkType Type, target string) (host, port string, err error) {
+	switch checkType {
+	case CheckHTTP:
+		u, err := network.ParseHTTPURLTarget(target)
+		if err != nil {
+			return "", "", err
+		}
+		port := u.Port()
+		if port == "" {
+			port = "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+		}
+		return u.Hostname(), port, nil
+	case CheckTCP, CheckTCPExpect:
+		return network.ParseTCPAddressTarget(target)
+	default:
+		return "", "", fmt.Errorf("traceroute is not supported for %q checks", checkType)
+	}
+}
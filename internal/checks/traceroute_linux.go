@@ -0,0 +1,136 @@
+package checks
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/tmater/wacht/internal/proto"
+)
+
+// Fields of struct sock_extended_err, which the kernel queues on a socket
+// with IP_RECVERR set when an ICMP error answers one of its packets.
+const (
+	soEEOriginICMP    = 2
+	soEEOriginICMP6   = 3
+	icmpTimeExceeded  = 11
+	icmp6TimeExceeded = 3
+	sockExtendedErrSz = 16
+)
+
+// traceHop sends one connection attempt to ip:port that expires after ttl
+// hops. A router that drops it answers with ICMP, which Linux fails the
+// connect with and, because IP_RECVERR is set, keeps on the socket's error
+// queue together with the router's address. That works without raw sockets,
+// so the probe needs no extra privileges.
+func traceHop(ctx context.Context, ip net.IP, port string, ttl int, timeout time.Duration) (proto.PathHop, hopOutcome, error) {
+	hop := proto.PathHop{TTL: ttl}
+	networkName, level, ttlOpt, recvErrOpt := "tcp4", syscall.IPPROTO_IP, syscall.IP_TTL, syscall.IP_RECVERR
+	if ip.To4() == nil {
+		networkName, level, ttlOpt, recvErrOpt = "tcp6", syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, syscall.IPV6_RECVERR
+	}
+
+	errFD := -1
+	defer func() {
+		if errFD >= 0 {
+			syscall.Close(errFD)
+		}
+	}()
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(_, _ string, c syscall.RawConn) error {
+			var sockErr error
+			err := c.Control(func(fd uintptr) {
+				if sockErr = syscall.SetsockoptInt(int(fd), level, ttlOpt, ttl); sockErr != nil {
+					return
+				}
+				if sockErr = syscall.SetsockoptInt(int(fd), level, recvErrOpt, 1); sockErr != nil {
+					return
+				}
+				// The dialer closes its descriptor when the connect fails, so
+				// keep a duplicate to read the error queue afterwards.
+				errFD, sockErr = dupCloseOnExec(int(fd))
+			})
+			if err != nil {
+				return err
+			}
+			return sockErr
+		},
+	}
+
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, networkName, net.JoinHostPort(ip.String(), port))
+	rtt := time.Since(start)
+	switch {
+	case err == nil:
+		conn.Close()
+		hop.Addr, hop.RTT = ip.String(), rtt
+		return hop, hopReached, nil
+	case errors.Is(err, syscall.ECONNREFUSED):
+		hop.Addr, hop.RTT = ip.String(), rtt
+		return hop, hopReached, nil
+	}
+
+	if addr, timeExceeded, ok := readICMPError(errFD); ok {
+		hop.Addr, hop.RTT = addr, rtt
+		if timeExceeded {
+			return hop, hopTransit, nil
+		}
+		return hop, hopUnreachable, nil
+	}
+	if ctx.Err() != nil {
+		return hop, hopSilent, ctx.Err()
+	}
+	return hop, hopSilent, nil
+}
+
+// readICMPError pops the ICMP error queued on fd and returns the address of
+// the host that sent it, and whether it reported an expired TTL.
+func readICMPError(fd int) (addr string, timeExceeded, ok bool) {
+	if fd < 0 {
+		return "", false, false
+	}
+	buf := make([]byte, 512)
+	oob := make([]byte, 512)
+	_, oobn, _, _, err := syscall.Recvmsg(fd, buf, oob, syscall.MSG_ERRQUEUE|syscall.MSG_DONTWAIT)
+	if err != nil {
+		return "", false, false
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return "", false, false
+	}
+
+	for _, msg := range msgs {
+		data := msg.Data
+		if len(data) < sockExtendedErrSz+2 {
+			continue
+		}
+		origin, icmpType := data[4], data[5]
+		// The offending host's sockaddr follows sock_extended_err.
+		family := binary.NativeEndian.Uint16(data[sockExtendedErrSz:])
+		switch {
+		case msg.Header.Level == syscall.SOL_IP && msg.Header.Type == syscall.IP_RECVERR &&
+			family == syscall.AF_INET && len(data) >= sockExtendedErrSz+8:
+			return net.IP(data[sockExtendedErrSz+4 : sockExtendedErrSz+8]).String(), origin == soEEOriginICMP && icmpType == icmpTimeExceeded, true
+		case msg.Header.Level == syscall.SOL_IPV6 && msg.Header.Type == syscall.IPV6_RECVERR &&
+			family == syscall.AF_INET6 && len(data) >= sockExtendedErrSz+24:
+			return net.IP(data[sockExtendedErrSz+8 : sockExtendedErrSz+24]).String(), origin == soEEOriginICMP6 && icmpType == icmp6TimeExceeded, true
+		}
+	}
+	return "", false, false
+}
+
+func dupCloseOnExec(fd int) (int, error) {
+	syscall.ForkLock.RLock()
+	defer syscall.ForkLock.RUnlock()
+	dup, err := syscall.Dup(fd)
+	if err != nil {
+		return -1, err
+	}
+	syscall.CloseOnExec(dup)
+	return dup, nil
+}
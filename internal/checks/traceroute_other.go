@@ -0,0 +1,18 @@
+//go:build !linux
+
+package checks
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/tmater/wacht/internal/proto"
+)
+
+// traceHop needs the Linux socket error queue to learn which router dropped
+// a probe packet without raw-socket privileges.
+func traceHop(ctx context.Context, ip net.IP, port string, ttl int, timeout time.Duration) (proto.PathHop, hopOutcome, error) {
+	return proto.PathHop{}, hopSilent, errors.New("traceroute is only supported on linux")
+}
@@ -3,10 +3,15 @@ package config
 import (
 	"fmt"
 	"net/netip"
+	"net/url"
 	"os"
+	"strings"
 	"time"
 
+	probeapi "github.com/tmater/wacht/internal/api/probe"
 	"github.com/tmater/wacht/internal/checks"
+	"github.com/tmater/wacht/internal/labels"
+	"github.com/tmater/wacht/internal/proto"
 	"gopkg.in/yaml.v3"
 )
 
@@ -16,6 +21,24 @@ const (
 	DefaultProbeOfflineAfter        = 90 * time.Second
 	DefaultProbeHeartbeatInterval   = 30 * time.Second
 	DefaultProbeResultFlushInterval = 10 * time.Second
+	DefaultProbeSchedulerWorkers    = 16
+	DefaultProbeHostConcurrency     = 4
+	DefaultProbeSpoolMaxBytes       = 64 << 20
+)
+
+// Spool fsync policies.
+const (
+	SpoolFsyncAlways   = "always"
+	SpoolFsyncInterval = "interval"
+	SpoolFsyncNever    = "never"
+)
+
+// Probe authentication schemes. Servers accept ProbeAuthAny or
+// ProbeAuthSigned; probes send ProbeAuthSigned or ProbeAuthHeader.
+const (
+	ProbeAuthAny    = "any"
+	ProbeAuthSigned = "signed"
+	ProbeAuthHeader = "header"
 )
 
 var DefaultTrustedProxies = []string{
@@ -31,7 +54,18 @@ type ServerConfig struct {
 	AuthRateLimit       RateLimit      `yaml:"auth_rate_limit"`
 	TrustedProxies      []string       `yaml:"trusted_proxies"`
 	ProbeOfflineAfter   time.Duration  `yaml:"probe_offline_after"`
-	TrustedProxyCIDRs   []netip.Prefix `yaml:"-"`
+	Webhooks            WebhookConfig  `yaml:"webhooks"`
+	BaseURL             string         `yaml:"base_url"`      // public dashboard URL, used in v2 webhook payloads
+	AdminWebhook        string         `yaml:"admin_webhook"` // probe fleet health alerts; empty disables them
+	// MinProbeVersion refuses registration from probes built before this
+	// release, such as "v1.4.0". Empty accepts any version.
+	MinProbeVersion string `yaml:"min_probe_version"`
+	// ProbeAuth selects accepted probe authentication: "any" (default) takes
+	// both the secret header and signed requests during migration; "signed"
+	// requires signed requests.
+	ProbeAuth             string           `yaml:"probe_auth"`
+	TrustedProxyCIDRs     []netip.Prefix   `yaml:"-"`
+	MinProbeVersionParsed probeapi.Version `yaml:"-"`
 }
 
 type SeedUser struct {
@@ -49,13 +83,72 @@ type RateLimit struct {
 	Window   time.Duration `yaml:"window"`
 }
 
+// WebhookConfig tunes outbound alert delivery.
+type WebhookConfig struct {
+	// GroupWindow batches transitions for the same webhook URL that occur
+	// within this window into one digest. Zero sends every alert on its own.
+	GroupWindow time.Duration `yaml:"group_window"`
+	// Per-host delivery guard. Zero values fall back to the sender defaults.
+	HostConcurrency   int           `yaml:"host_concurrency"`
+	HostRatePerMinute int           `yaml:"host_rate_per_minute"`
+	HostBurst         int           `yaml:"host_burst"`
+	BreakerFailures   int           `yaml:"breaker_failures"`
+	BreakerCooldown   time.Duration `yaml:"breaker_cooldown"`
+}
+
 type ProbeConfig struct {
-	Secret              string        `yaml:"secret"`
-	Server              string        `yaml:"server"`
-	ProbeID             string        `yaml:"probe_id"`
-	HeartbeatInterval   time.Duration `yaml:"heartbeat_interval"`
-	ResultFlushInterval time.Duration `yaml:"result_flush_interval"`
-	AllowPrivateTargets bool          `yaml:"allow_private_targets"` // false by default
+	Secret              string         `yaml:"secret"`
+	JoinToken           string         `yaml:"join_token"` // enrolls the probe when secret is empty
+	Server              string         `yaml:"server"`
+	ProbeID             string         `yaml:"probe_id"`
+	HeartbeatInterval   time.Duration  `yaml:"heartbeat_interval"`
+	ResultFlushInterval time.Duration  `yaml:"result_flush_interval"`
+	AllowPrivateTargets bool           `yaml:"allow_private_targets"` // false by default
+	Scheduler           ProbeScheduler `yaml:"scheduler"`
+	StateDir            string         `yaml:"state_dir"` // local data that survives restarts
+	Spool               ProbeSpool     `yaml:"spool"`
+	// Labels describe where the probe runs (region, provider, network) and
+	// are matched against check probe selectors.
+	Labels map[string]string `yaml:"labels"`
+	// AuthScheme is "signed" (default) to sign requests, or "header" to
+	// send the secret for servers that predate signed requests.
+	AuthScheme string `yaml:"auth_scheme"`
+	// Canaries are known-good targets checked every heartbeat interval. When
+	// all of them fail the probe reports itself degraded, and the server
+	// counts its failing checks as probe errors instead of down votes.
+	Canaries []ProbeCanary `yaml:"canaries"`
+	// Traceroute traces the path to an HTTP or TCP check's target when the
+	// check starts failing on this probe, and reports it with the failure.
+	Traceroute ProbeTraceroute `yaml:"traceroute"`
+}
+
+// ProbeCanary is one network self-test target.
+type ProbeCanary struct {
+	Type   string `yaml:"type"` // http, tcp, or dns
+	Target string `yaml:"target"`
+}
+
+// ProbeTraceroute bounds the traceroutes a probe runs for failing checks.
+type ProbeTraceroute struct {
+	Enabled    bool          `yaml:"enabled"`
+	MaxHops    int           `yaml:"max_hops"`    // default 16, at most 32
+	HopTimeout time.Duration `yaml:"hop_timeout"` // default 1s
+}
+
+// ProbeScheduler sizes the probe's check executor.
+type ProbeScheduler struct {
+	// Workers caps how many checks run at once across all targets.
+	Workers int `yaml:"workers"`
+	// HostConcurrency caps concurrent runs against a single target host.
+	HostConcurrency int `yaml:"host_concurrency"`
+}
+
+// ProbeSpool keeps results on disk under state_dir/spool while the server is
+// unreachable, instead of dropping them once the memory buffer is full.
+type ProbeSpool struct {
+	Enabled  bool   `yaml:"enabled"`
+	MaxBytes int64  `yaml:"max_bytes"`
+	Fsync    string `yaml:"fsync"` // always, interval (default), or never
 }
 
 // LoadServer reads and parses a server.yaml config file.
@@ -86,6 +179,34 @@ func LoadServer(path string) (*ServerConfig, error) {
 	if cfg.ProbeOfflineAfter <= 0 {
 		cfg.ProbeOfflineAfter = DefaultProbeOfflineAfter
 	}
+	if cfg.BaseURL != "" {
+		u, err := url.Parse(cfg.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("config: base_url must be an absolute http(s) URL")
+		}
+		cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+	}
+	switch cfg.ProbeAuth {
+	case "":
+		cfg.ProbeAuth = ProbeAuthAny
+	case ProbeAuthAny, ProbeAuthSigned:
+	default:
+		return nil, fmt.Errorf("config: probe_auth must be %q or %q", ProbeAuthAny, ProbeAuthSigned)
+	}
+	if cfg.MinProbeVersion != "" {
+		v, err := probeapi.ParseVersion(cfg.MinProbeVersion)
+		if err != nil {
+			return nil, fmt.Errorf("config: min_probe_version: %w", err)
+		}
+		cfg.MinProbeVersionParsed = v
+	}
+	if cfg.Webhooks.GroupWindow < 0 {
+		return nil, fmt.Errorf("config: webhooks.group_window must not be negative")
+	}
+	if cfg.Webhooks.HostConcurrency < 0 || cfg.Webhooks.HostRatePerMinute < 0 || cfg.Webhooks.HostBurst < 0 ||
+		cfg.Webhooks.BreakerFailures < 0 || cfg.Webhooks.BreakerCooldown < 0 {
+		return nil, fmt.Errorf("config: webhooks limits must not be negative")
+	}
 	if cfg.AuthRateLimit.Requests <= 0 {
 		cfg.AuthRateLimit.Requests = DefaultAuthRateLimitRequests
 	}
@@ -118,21 +239,77 @@ func LoadProbe(path string) (*ProbeConfig, error) {
 		return nil, fmt.Errorf("parse config: %w", err)
 	}
 
-	if cfg.Secret == "" {
-		return nil, fmt.Errorf("config: secret is required")
+	if cfg.Secret == "" && cfg.JoinToken == "" {
+		return nil, fmt.Errorf("config: secret or join_token is required")
 	}
 	if cfg.Server == "" {
 		return nil, fmt.Errorf("config: server is required")
 	}
-	if cfg.ProbeID == "" {
+	if cfg.Secret != "" && cfg.ProbeID == "" {
 		return nil, fmt.Errorf("config: probe_id is required")
 	}
+	if cfg.Secret == "" && cfg.StateDir == "" {
+		// The enrolled credential is only returned once, so it must be kept.
+		return nil, fmt.Errorf("config: join_token requires state_dir")
+	}
 	if cfg.HeartbeatInterval == 0 {
 		cfg.HeartbeatInterval = DefaultProbeHeartbeatInterval
 	}
 	if cfg.ResultFlushInterval <= 0 {
 		cfg.ResultFlushInterval = DefaultProbeResultFlushInterval
 	}
+	if cfg.Scheduler.Workers <= 0 {
+		cfg.Scheduler.Workers = DefaultProbeSchedulerWorkers
+	}
+	if cfg.Scheduler.HostConcurrency <= 0 {
+		cfg.Scheduler.HostConcurrency = DefaultProbeHostConcurrency
+	}
+	if err := labels.Validate(cfg.Labels); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	if cfg.Spool.Enabled {
+		if cfg.StateDir == "" {
+			return nil, fmt.Errorf("config: spool requires state_dir")
+		}
+		if cfg.Spool.MaxBytes <= 0 {
+			cfg.Spool.MaxBytes = DefaultProbeSpoolMaxBytes
+		}
+		switch cfg.Spool.Fsync {
+		case "":
+			cfg.Spool.Fsync = SpoolFsyncInterval
+		case SpoolFsyncAlways, SpoolFsyncInterval, SpoolFsyncNever:
+		default:
+			return nil, fmt.Errorf("config: spool.fsync must be %q, %q, or %q", SpoolFsyncAlways, SpoolFsyncInterval, SpoolFsyncNever)
+		}
+	}
+	for i, canary := range cfg.Canaries {
+		switch checks.Type(canary.Type) {
+		case checks.CheckHTTP, checks.CheckTCP, checks.CheckDNS:
+		default:
+			return nil, fmt.Errorf("config: canaries[%d].type must be %q, %q, or %q", i, checks.CheckHTTP, checks.CheckTCP, checks.CheckDNS)
+		}
+		if strings.TrimSpace(canary.Target) == "" {
+			return nil, fmt.Errorf("config: canaries[%d].target is required", i)
+		}
+	}
+	if cfg.Traceroute.Enabled {
+		if cfg.Traceroute.MaxHops <= 0 {
+			cfg.Traceroute.MaxHops = checks.DefaultTraceMaxHops
+		}
+		if cfg.Traceroute.MaxHops > proto.MaxPathHops {
+			return nil, fmt.Errorf("config: traceroute.max_hops must be at most %d", proto.MaxPathHops)
+		}
+		if cfg.Traceroute.HopTimeout <= 0 {
+			cfg.Traceroute.HopTimeout = checks.DefaultTraceHopTimeout
+		}
+	}
+	switch cfg.AuthScheme {
+	case "":
+		cfg.AuthScheme = ProbeAuthSigned
+	case ProbeAuthSigned, ProbeAuthHeader:
+	default:
+		return nil, fmt.Errorf("config: auth_scheme must be %q or %q", ProbeAuthSigned, ProbeAuthHeader)
+	}
 
 	return &cfg, nil
 }
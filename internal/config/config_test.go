@@ -6,6 +6,9 @@ import (
 	"path/filepath"
 	"testing"
 	"time"
+
+	probeapi "github.com/tmater/wacht/internal/api/probe"
+	"github.com/tmater/wacht/internal/checks"
 )
 
 func TestResolveDatabaseDSN_PrefersEnvironmentOverFile(t *testing.T) {
@@ -115,6 +118,184 @@ func TestLoadProbe_ParsesResultFlushInterval(t *testing.T) {
 	}
 }
 
+func TestLoadProbe_SchedulerDefaultsAndOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "probe.yaml")
+	data := []byte("secret: s3cr3t\nserver: http://server:8080\nprobe_id: probe-1\nscheduler:\n  workers: 64\n")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	cfg, err := LoadProbe(path)
+	if err != nil {
+		t.Fatalf("LoadProbe: %v", err)
+	}
+	if cfg.Scheduler.Workers != 64 {
+		t.Fatalf("Scheduler.Workers = %d, want 64", cfg.Scheduler.Workers)
+	}
+	if cfg.Scheduler.HostConcurrency != DefaultProbeHostConcurrency {
+		t.Fatalf("Scheduler.HostConcurrency = %d, want %d", cfg.Scheduler.HostConcurrency, DefaultProbeHostConcurrency)
+	}
+}
+
+func TestLoadProbe_SpoolRequiresStateDirAndValidFsync(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		yaml    string
+		wantErr bool
+	}{
+		{name: "missing state dir", yaml: "spool:\n  enabled: true\n", wantErr: true},
+		{name: "bad fsync", yaml: "state_dir: /var/lib/wacht\nspool:\n  enabled: true\n  fsync: sometimes\n", wantErr: true},
+		{name: "defaults", yaml: "state_dir: /var/lib/wacht\nspool:\n  enabled: true\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "probe.yaml")
+			data := []byte("secret: s3cr3t\nserver: http://server:8080\nprobe_id: probe-1\n" + tc.yaml)
+			if err := os.WriteFile(path, data, 0o600); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+
+			cfg, err := LoadProbe(path)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("LoadProbe: expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadProbe: %v", err)
+			}
+			if cfg.Spool.MaxBytes != DefaultProbeSpoolMaxBytes || cfg.Spool.Fsync != SpoolFsyncInterval {
+				t.Fatalf("Spool = %+v, want default size and interval fsync", cfg.Spool)
+			}
+		})
+	}
+}
+
+func TestLoadProbe_JoinTokenReplacesSecretAndProbeID(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		yaml    string
+		wantErr bool
+	}{
+		{name: "no credential", yaml: "probe_id: probe-1\n", wantErr: true},
+		{name: "join token without state dir", yaml: "join_token: join-1\n", wantErr: true},
+		{name: "secret without probe id", yaml: "secret: s3cr3t\n", wantErr: true},
+		{name: "join token", yaml: "join_token: join-1\nstate_dir: /var/lib/wacht\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "probe.yaml")
+			if err := os.WriteFile(path, []byte("server: http://server:8080\n"+tc.yaml), 0o600); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+
+			cfg, err := LoadProbe(path)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("LoadProbe: expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadProbe: %v", err)
+			}
+			if cfg.JoinToken != "join-1" || cfg.ProbeID != "" {
+				t.Fatalf("cfg = %+v, want join token without probe id", cfg)
+			}
+		})
+	}
+}
+
+func TestLoadProbe_ValidatesCanaries(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		yaml    string
+		wantErr bool
+	}{
+		{name: "valid", yaml: "canaries:\n  - type: tcp\n    target: 1.1.1.1:53\n  - type: dns\n    target: example.com\n"},
+		{name: "unknown type", yaml: "canaries:\n  - type: icmp\n    target: 1.1.1.1\n", wantErr: true},
+		{name: "missing target", yaml: "canaries:\n  - type: http\n", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "probe.yaml")
+			data := "secret: s3cr3t\nserver: http://server:8080\nprobe_id: probe-1\n" + tc.yaml
+			if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+
+			cfg, err := LoadProbe(path)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("LoadProbe: expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadProbe: %v", err)
+			}
+			if len(cfg.Canaries) != 2 || cfg.Canaries[0].Type != "tcp" || cfg.Canaries[1].Target != "example.com" {
+				t.Fatalf("Canaries = %+v, want tcp and dns canaries", cfg.Canaries)
+			}
+		})
+	}
+}
+
+func TestLoadProbe_TracerouteDefaultsAndLimits(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		yaml    string
+		wantErr bool
+	}{
+		{name: "defaults", yaml: "traceroute:\n  enabled: true\n"},
+		{name: "too many hops", yaml: "traceroute:\n  enabled: true\n  max_hops: 64\n", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "probe.yaml")
+			data := "secret: s3cr3t\nserver: http://server:8080\nprobe_id: probe-1\n" + tc.yaml
+			if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+
+			cfg, err := LoadProbe(path)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("LoadProbe: expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadProbe: %v", err)
+			}
+			if cfg.Traceroute.MaxHops != checks.DefaultTraceMaxHops || cfg.Traceroute.HopTimeout != checks.DefaultTraceHopTimeout {
+				t.Fatalf("Traceroute = %+v, want default hops and hop timeout", cfg.Traceroute)
+			}
+		})
+	}
+}
+
+func TestLoadProbe_ValidatesLabels(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, labels string) string {
+		path := filepath.Join(dir, name)
+		data := []byte("secret: s3cr3t\nserver: http://server:8080\nprobe_id: probe-1\nlabels:\n" + labels)
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		return path
+	}
+
+	cfg, err := LoadProbe(write("ok.yaml", "  region: eu-west\n  network: private\n"))
+	if err != nil {
+		t.Fatalf("LoadProbe: %v", err)
+	}
+	if cfg.Labels["region"] != "eu-west" || cfg.Labels["network"] != "private" {
+		t.Fatalf("Labels = %v, want region and network", cfg.Labels)
+	}
+
+	if _, err := LoadProbe(write("bad.yaml", "  Region: eu west\n")); err == nil {
+		t.Fatal("LoadProbe: expected invalid label error")
+	}
+}
+
 func TestLoadServer_ParsesAuthRateLimit(t *testing.T) {
 	path := filepath.Join(t.TempDir(), "server.yaml")
 	data := []byte("auth_rate_limit:\n  requests: 42\n  window: 2m\nprobes:\n  - id: probe-1\n    secret: s3cr3t\n")
@@ -262,3 +443,88 @@ func TestLoadServer_ParsesProbeOfflineAfter(t *testing.T) {
 		t.Fatalf("ProbeOfflineAfter = %s, want 8s", cfg.ProbeOfflineAfter)
 	}
 }
+
+func TestLoadServer_ParsesMinProbeVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.yaml")
+	if err := os.WriteFile(path, []byte("min_probe_version: v1.4\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	cfg, err := LoadServer(path)
+	if err != nil {
+		t.Fatalf("LoadServer: %v", err)
+	}
+	if cfg.MinProbeVersionParsed != (probeapi.Version{Major: 1, Minor: 4}) {
+		t.Fatalf("MinProbeVersionParsed = %#v, want v1.4.0", cfg.MinProbeVersionParsed)
+	}
+}
+
+func TestLoadServer_RejectsInvalidMinProbeVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.yaml")
+	if err := os.WriteFile(path, []byte("min_probe_version: latest\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if _, err := LoadServer(path); err == nil {
+		t.Fatal("LoadServer() error = nil, want invalid min_probe_version")
+	}
+}
+
+func TestLoadProbeAndServer_AuthSchemes(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatalf("WriteFile: %v", err)
+		}
+		return path
+	}
+
+	probe, err := LoadProbe(write("probe.yaml", "probe_id: probe-1\nsecret: s\nserver: http://localhost:8080\n"))
+	if err != nil {
+		t.Fatalf("LoadProbe: %v", err)
+	}
+	if probe.AuthScheme != ProbeAuthSigned {
+		t.Fatalf("AuthScheme = %q, want %q", probe.AuthScheme, ProbeAuthSigned)
+	}
+	if _, err := LoadProbe(write("bad-probe.yaml", "probe_id: probe-1\nsecret: s\nserver: http://localhost:8080\nauth_scheme: any\n")); err == nil {
+		t.Fatal("LoadProbe() error = nil, want invalid auth_scheme")
+	}
+
+	server, err := LoadServer(write("server.yaml", ""))
+	if err != nil {
+		t.Fatalf("LoadServer: %v", err)
+	}
+	if server.ProbeAuth != ProbeAuthAny {
+		t.Fatalf("ProbeAuth = %q, want %q", server.ProbeAuth, ProbeAuthAny)
+	}
+	if _, err := LoadServer(write("bad-server.yaml", "probe_auth: header\n")); err == nil {
+		t.Fatal("LoadServer() error = nil, want invalid probe_auth")
+	}
+}
+
+func TestLoadServer_NormalizesBaseURL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.yaml")
+	if err := os.WriteFile(path, []byte("base_url: https://wacht.example.com/\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	cfg, err := LoadServer(path)
+	if err != nil {
+		t.Fatalf("LoadServer: %v", err)
+	}
+	if cfg.BaseURL != "https://wacht.example.com" {
+		t.Fatalf("BaseURL = %q, want trailing slash trimmed", cfg.BaseURL)
+	}
+}
+
+func TestLoadServer_RejectsRelativeBaseURL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.yaml")
+	if err := os.WriteFile(path, []byte("base_url: /wacht\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	if _, err := LoadServer(path); err == nil {
+		t.Fatal("LoadServer() error = nil, want invalid base_url error")
+	}
+}
@@ -0,0 +1,238 @@
+// Package labels validates probe labels and matches them against check probe
+// selectors.
+//
+// Selectors use a small subset of the Kubernetes label selector syntax:
+// comma-separated requirements that must all hold, each one of
+//
+//	key=value   key==value   key!=value
+//	key in (a,b)             key notin (a,b)
+//	key                      !key
+//
+// An empty selector matches every probe.
+package labels
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const maxLabels = 32
+
+var (
+	// ErrInvalidLabel reports a label key or value outside the allowed syntax.
+	ErrInvalidLabel = errors.New("labels: invalid label")
+	// ErrInvalidSelector reports a selector that cannot be parsed.
+	ErrInvalidSelector = errors.New("labels: invalid selector")
+
+	keyPattern   = regexp.MustCompile(`^[a-z0-9]([a-z0-9._/-]{0,62})$`)
+	valuePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]{0,62})$`)
+)
+
+// Validate checks that every key and value in set is well formed.
+func Validate(set map[string]string) error {
+	if len(set) > maxLabels {
+		return fmt.Errorf("%w: at most %d labels are allowed", ErrInvalidLabel, maxLabels)
+	}
+	for key, value := range set {
+		if !keyPattern.MatchString(key) {
+			return fmt.Errorf("%w: key %q", ErrInvalidLabel, key)
+		}
+		if !valuePattern.MatchString(value) {
+			return fmt.Errorf("%w: value %q for key %q", ErrInvalidLabel, value, key)
+		}
+	}
+	return nil
+}
+
+// Merge returns base overlaid with override. Neither input is modified.
+func Merge(base, override map[string]string) map[string]string {
+	out := make(map[string]string, len(base)+len(override))
+	maps.Copy(out, base)
+	maps.Copy(out, override)
+	return out
+}
+
+type operator int
+
+const (
+	opEquals operator = iota
+	opNotEquals
+	opIn
+	opNotIn
+	opExists
+	opNotExists
+)
+
+type requirement struct {
+	key    string
+	op     operator
+	values []string
+}
+
+func (r requirement) matches(set map[string]string) bool {
+	value, ok := set[r.key]
+	switch r.op {
+	case opEquals:
+		return ok && value == r.values[0]
+	case opNotEquals:
+		return !ok || value != r.values[0]
+	case opIn:
+		return ok && slices.Contains(r.values, value)
+	case opNotIn:
+		return !ok || !slices.Contains(r.values, value)
+	case opExists:
+		return ok
+	case opNotExists:
+		return !ok
+	}
+	return false
+}
+
+func (r requirement) String() string {
+	switch r.op {
+	case opEquals:
+		return r.key + "=" + r.values[0]
+	case opNotEquals:
+		return r.key + "!=" + r.values[0]
+	case opIn:
+		return r.key + " in (" + strings.Join(r.values, ",") + ")"
+	case opNotIn:
+		return r.key + " notin (" + strings.Join(r.values, ",") + ")"
+	case opNotExists:
+		return "!" + r.key
+	}
+	return r.key
+}
+
+// Selector is a parsed probe selector.
+type Selector struct {
+	requirements []requirement
+}
+
+// Parse parses a selector expression. Whitespace around tokens is ignored.
+func Parse(raw string) (Selector, error) {
+	var sel Selector
+	for _, part := range splitRequirements(raw) {
+		req, err := parseRequirement(strings.TrimSpace(part))
+		if err != nil {
+			return Selector{}, err
+		}
+		sel.requirements = append(sel.requirements, req)
+	}
+	return sel, nil
+}
+
+// Empty reports whether the selector matches every label set.
+func (s Selector) Empty() bool {
+	return len(s.requirements) == 0
+}
+
+// Matches reports whether set satisfies every requirement.
+func (s Selector) Matches(set map[string]string) bool {
+	for _, req := range s.requirements {
+		if !req.matches(set) {
+			return false
+		}
+	}
+	return true
+}
+
+// String renders the selector in canonical form.
+func (s Selector) String() string {
+	parts := make([]string, 0, len(s.requirements))
+	for _, req := range s.requirements {
+		parts = append(parts, req.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// splitRequirements splits on commas that are not inside a value list.
+func splitRequirements(raw string) []string {
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	var (
+		parts []string
+		depth int
+		start int
+	)
+	for i, r := range raw {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, raw[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, raw[start:])
+}
+
+func parseRequirement(part string) (requirement, error) {
+	if part == "" {
+		return requirement{}, fmt.Errorf("%w: empty requirement", ErrInvalidSelector)
+	}
+
+	if key, ok := strings.CutPrefix(part, "!"); ok {
+		return newRequirement(strings.TrimSpace(key), opNotExists, nil)
+	}
+	if key, value, ok := strings.Cut(part, "!="); ok {
+		return newRequirement(strings.TrimSpace(key), opNotEquals, []string{strings.TrimSpace(value)})
+	}
+	if key, value, ok := strings.Cut(part, "=="); ok {
+		return newRequirement(strings.TrimSpace(key), opEquals, []string{strings.TrimSpace(value)})
+	}
+	if key, value, ok := strings.Cut(part, "="); ok {
+		return newRequirement(strings.TrimSpace(key), opEquals, []string{strings.TrimSpace(value)})
+	}
+
+	fields := strings.Fields(part)
+	if len(fields) == 1 {
+		return newRequirement(fields[0], opExists, nil)
+	}
+	if len(fields) < 2 {
+		return requirement{}, fmt.Errorf("%w: %q", ErrInvalidSelector, part)
+	}
+	var op operator
+	switch fields[1] {
+	case "in":
+		op = opIn
+	case "notin":
+		op = opNotIn
+	default:
+		return requirement{}, fmt.Errorf("%w: unknown operator in %q", ErrInvalidSelector, part)
+	}
+
+	list := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(part[len(fields[0]):]), fields[1]))
+	if !strings.HasPrefix(list, "(") || !strings.HasSuffix(list, ")") {
+		return requirement{}, fmt.Errorf("%w: %q needs a parenthesized value list", ErrInvalidSelector, part)
+	}
+	var values []string
+	for _, value := range strings.Split(list[1:len(list)-1], ",") {
+		values = append(values, strings.TrimSpace(value))
+	}
+	return newRequirement(fields[0], op, values)
+}
+
+func newRequirement(key string, op operator, values []string) (requirement, error) {
+	if !keyPattern.MatchString(key) {
+		return requirement{}, fmt.Errorf("%w: key %q", ErrInvalidSelector, key)
+	}
+	if (op == opIn || op == opNotIn) && len(values) == 0 {
+		return requirement{}, fmt.Errorf("%w: %q needs at least one value", ErrInvalidSelector, key)
+	}
+	for _, value := range values {
+		if !valuePattern.MatchString(value) {
+			return requirement{}, fmt.Errorf("%w: value %q for key %q", ErrInvalidSelector, value, key)
+		}
+	}
+	return requirement{key: key, op: op, values: values}, nil
+}
@@ -0,0 +1,74 @@
+package labels
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseMatchesRequirements(t *testing.T) {
+	probe := map[string]string{"region": "eu-west", "provider": "hetzner", "network": "private"}
+
+	for _, tc := range []struct {
+		selector string
+		want     bool
+	}{
+		{selector: "", want: true},
+		{selector: "region=eu-west", want: true},
+		{selector: "region==eu-west, provider=hetzner", want: true},
+		{selector: "region!=eu-west", want: false},
+		{selector: "region in (us-east, eu-west)", want: true},
+		{selector: "provider notin (aws,gcp),network=private", want: true},
+		{selector: "network", want: true},
+		{selector: "!gpu", want: true},
+		{selector: "!network", want: false},
+		{selector: "zone=a", want: false},
+		{selector: "zone!=a", want: true},
+	} {
+		sel, err := Parse(tc.selector)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", tc.selector, err)
+		}
+		if got := sel.Matches(probe); got != tc.want {
+			t.Fatalf("Parse(%q).Matches = %t, want %t", tc.selector, got, tc.want)
+		}
+	}
+}
+
+func TestParseRejectsMalformedSelectors(t *testing.T) {
+	for _, raw := range []string{
+		"region=",
+		"Region=eu",
+		"region in eu-west",
+		"region in ()",
+		"region like eu",
+		"region=eu,,provider=aws",
+	} {
+		if _, err := Parse(raw); !errors.Is(err, ErrInvalidSelector) {
+			t.Fatalf("Parse(%q) error = %v, want %v", raw, err, ErrInvalidSelector)
+		}
+	}
+}
+
+func TestSelectorStringIsCanonical(t *testing.T) {
+	sel, err := Parse(" region == eu-west ,provider in ( aws , gcp ), !gpu")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if got, want := sel.String(), "region=eu-west,provider in (aws,gcp),!gpu"; got != want {
+		t.Fatalf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestValidateAndMerge(t *testing.T) {
+	if err := Validate(map[string]string{"region": "eu-west", "example.com/tier": "edge"}); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if err := Validate(map[string]string{"region": "eu west"}); !errors.Is(err, ErrInvalidLabel) {
+		t.Fatalf("Validate(space) error = %v, want %v", err, ErrInvalidLabel)
+	}
+
+	merged := Merge(map[string]string{"region": "eu", "provider": "aws"}, map[string]string{"region": "us"})
+	if merged["region"] != "us" || merged["provider"] != "aws" {
+		t.Fatalf("Merge() = %v, want override to win", merged)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"time"
 
 	"github.com/qmuntal/stateless"
+
+	"github.com/tmater/wacht/internal/proto"
 )
 
 const consecutiveEvidenceThreshold = 2
@@ -52,6 +54,13 @@ func (m *CheckMachine) LoseEvidence() (CheckTransition, error) {
 	m.state.LastOutcome = ""
 	m.state.StreakLen = 0
 	m.state.LastError = ""
+	m.state.LastErrorKind = ""
+	m.state.LastAttempts = 0
+	m.state.LastTimings = proto.HTTPTimings{}
+	m.state.LastPath = nil
+	m.state.LastPathAt = time.Time{}
+	m.state.LastEvidence = nil
+	m.state.LastEvidenceAt = time.Time{}
 	return transition, nil
 }
 
@@ -0,0 +1,131 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"maps"
+	"sort"
+	"time"
+
+	"github.com/tmater/wacht/internal/alert"
+	"github.com/tmater/wacht/internal/store"
+)
+
+// maxFleetPayloadCheckIDs bounds the check list in one fleet alert.
+const maxFleetPayloadCheckIDs = 50
+
+// fleetState remembers which fleet health alerts were already queued so a
+// recovery is only announced after the matching outage alert. Transitions seen
+// while no admin webhook is configured, such as the silent boot sweep, are not
+// recorded and therefore never produce an unmatched recovery.
+type fleetState struct {
+	offlineNotified map[string]bool
+	quorumAtRisk    bool
+}
+
+func (s fleetState) clone() fleetState {
+	s.offlineNotified = maps.Clone(s.offlineNotified)
+	return s
+}
+
+// fleetNotificationsLocked returns the admin notifications caused by probeID
+// becoming offline or online, updating the remembered fleet state. Callers
+// restore the returned previous state if persisting the notifications fails.
+// Private probes only serve their owner, so they never raise fleet alerts.
+func (r *Runtime) fleetNotificationsLocked(probeID string, online bool, now time.Time) ([]store.FleetNotification, fleetState, error) {
+	previous := r.fleet.clone()
+	webhook := r.notifications.AdminWebhook
+	if webhook == "" || r.privateProbeLocked(probeID) {
+		return nil, previous, nil
+	}
+	if r.fleet.offlineNotified == nil {
+		r.fleet.offlineNotified = make(map[string]bool)
+	}
+
+	atRisk := r.checksWithoutQuorumLocked()
+	var events []string
+	switch {
+	case !online:
+		events = append(events, store.FleetEventProbeOffline)
+		r.fleet.offlineNotified[probeID] = true
+	case r.fleet.offlineNotified[probeID]:
+		events = append(events, store.FleetEventProbeOnline)
+		delete(r.fleet.offlineNotified, probeID)
+	}
+	switch {
+	case len(atRisk) > 0 && !r.fleet.quorumAtRisk:
+		events = append(events, store.FleetEventQuorumAtRisk)
+		r.fleet.quorumAtRisk = true
+	case len(atRisk) == 0 && r.fleet.quorumAtRisk:
+		events = append(events, store.FleetEventQuorumRestored)
+		r.fleet.quorumAtRisk = false
+	}
+
+	probesOnline, probesTotal := 0, 0
+	for _, probe := range r.probes {
+		if probe.state.OwnerUserID != 0 {
+			continue
+		}
+		probesTotal++
+		if probe.state.State == ProbeStateOnline {
+			probesOnline++
+		}
+	}
+
+	notifications := make([]store.FleetNotification, 0, len(events))
+	for _, event := range events {
+		payload := alert.FleetPayload{
+			Status:            event,
+			ProbesOnline:      probesOnline,
+			ProbesTotal:       probesTotal,
+			ChecksAtRiskCount: len(atRisk),
+			ChecksAtRisk:      atRisk[:min(len(atRisk), maxFleetPayloadCheckIDs)],
+			ServerURL:         r.notifications.ServerURL,
+			OccurredAt:        now.UTC().Format(time.RFC3339),
+		}
+		notification := store.FleetNotification{Event: event, WebhookURL: webhook}
+		if event == store.FleetEventProbeOffline || event == store.FleetEventProbeOnline {
+			payload.ProbeID = probeID
+			notification.ProbeID = probeID
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			r.fleet = previous
+			return nil, previous, err
+		}
+		notification.Payload = body
+		notifications = append(notifications, notification)
+	}
+	return notifications, previous, nil
+}
+
+// checksWithoutQuorumLocked returns checks whose assigned shared probes that
+// are still online can no longer form a strict majority. Checks served only by
+// private probes are their owners' concern and are skipped.
+func (r *Runtime) checksWithoutQuorumLocked() []string {
+	var checkIDs []string
+	for checkID, quorum := range r.quorums {
+		assigned, online := 0, 0
+		for probeID := range quorum.checks {
+			if r.privateProbeLocked(probeID) {
+				continue
+			}
+			assigned++
+			if probe, ok := r.probes[probeID]; ok && probe.state.State == ProbeStateOnline {
+				online++
+			}
+		}
+		if assigned == 0 {
+			continue
+		}
+		if online < quorumThreshold(assigned) {
+			checkIDs = append(checkIDs, checkID)
+		}
+	}
+	sort.Strings(checkIDs)
+	return checkIDs
+}
+
+func (r *Runtime) privateProbeLocked(probeID string) bool {
+	probe, ok := r.probes[probeID]
+	return ok && probe.state.OwnerUserID != 0
+}
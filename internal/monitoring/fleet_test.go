@@ -0,0 +1,229 @@
+package monitoring
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tmater/wacht/internal/alert"
+	"github.com/tmater/wacht/internal/store"
+)
+
+func newFleetTestRuntime(t *testing.T, at time.Time) *Runtime {
+	t.Helper()
+
+	runtime := NewRuntime([]string{"check-a"}, []string{"probe-a", "probe-b", "probe-c"})
+	runtime.SetNotificationSettings(NotificationSettings{
+		ServerURL:    "https://wacht.example.com",
+		AdminWebhook: "https://hooks.example.com/admin",
+	})
+	expiresAt := at.Add(time.Minute)
+	for _, probeID := range []string{"probe-a", "probe-b", "probe-c"} {
+		if _, err := runtime.ObserveCheckUp("check-a", probeID, at, &expiresAt); err != nil {
+			t.Fatalf("ObserveCheckUp %s: %v", probeID, err)
+		}
+	}
+	if _, err := runtime.ReceiveHeartbeat("probe-a", at); err != nil {
+		t.Fatalf("ReceiveHeartbeat probe-a: %v", err)
+	}
+	if _, err := runtime.ReceiveHeartbeat("probe-b", at); err != nil {
+		t.Fatalf("ReceiveHeartbeat probe-b: %v", err)
+	}
+	if _, err := runtime.ReceiveHeartbeat("probe-c", at.Add(80*time.Second)); err != nil {
+		t.Fatalf("ReceiveHeartbeat probe-c: %v", err)
+	}
+	return runtime
+}
+
+func fleetEvents(writes []store.MonitoringWrite) []string {
+	var events []string
+	for _, write := range writes {
+		for _, notification := range write.FleetNotifications {
+			events = append(events, notification.Event)
+		}
+	}
+	return events
+}
+
+func TestSweepProbesQueuesFleetAlertsWhenQuorumIsLost(t *testing.T) {
+	at := time.Date(2026, time.April, 8, 12, 0, 0, 0, time.UTC)
+	runtime := newFleetTestRuntime(t, at)
+	st := &fakeSweeperStore{}
+
+	if _, err := SweepProbes(runtime, st, at.Add(100*time.Second), 90*time.Second); err != nil {
+		t.Fatalf("SweepProbes() error = %v", err)
+	}
+
+	got := fleetEvents(st.persistedWrites)
+	want := []string{store.FleetEventProbeOffline, store.FleetEventProbeOffline, store.FleetEventQuorumAtRisk}
+	if len(got) != len(want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("events = %v, want %v", got, want)
+		}
+	}
+
+	last := st.persistedWrites[len(st.persistedWrites)-1].FleetNotifications
+	risk := last[len(last)-1]
+	if risk.WebhookURL != "https://hooks.example.com/admin" || risk.ProbeID != "" {
+		t.Fatalf("risk notification = %+v, want admin webhook without probe", risk)
+	}
+	var payload alert.FleetPayload
+	if err := json.Unmarshal(risk.Payload, &payload); err != nil {
+		t.Fatalf("Unmarshal payload: %v", err)
+	}
+	if payload.ProbesOnline != 1 || payload.ProbesTotal != 3 || payload.ChecksAtRiskCount != 1 || payload.ChecksAtRisk[0] != "check-a" {
+		t.Fatalf("payload = %+v, want one online probe and check-a at risk", payload)
+	}
+}
+
+func TestApplyHeartbeatAnnouncesRecoveryOnlyAfterOutageAlert(t *testing.T) {
+	at := time.Date(2026, time.April, 8, 12, 0, 0, 0, time.UTC)
+	runtime := newFleetTestRuntime(t, at)
+	if _, err := SweepProbes(runtime, &fakeSweeperStore{}, at.Add(100*time.Second), 90*time.Second); err != nil {
+		t.Fatalf("SweepProbes() error = %v", err)
+	}
+
+	st := &fakeHeartbeatStore{}
+	if err := ApplyHeartbeat(runtime, st, "probe-a", at.Add(110*time.Second), ""); err != nil {
+		t.Fatalf("ApplyHeartbeat() error = %v", err)
+	}
+	got := fleetEvents(st.persistedWrites)
+	if len(got) != 2 || got[0] != store.FleetEventProbeOnline || got[1] != store.FleetEventQuorumRestored {
+		t.Fatalf("events = %v, want probe_online then quorum_restored", got)
+	}
+
+	st = &fakeHeartbeatStore{}
+	if err := ApplyHeartbeat(runtime, st, "probe-b", at.Add(111*time.Second), ""); err != nil {
+		t.Fatalf("ApplyHeartbeat() error = %v", err)
+	}
+	if got := fleetEvents(st.persistedWrites); len(got) != 1 || got[0] != store.FleetEventProbeOnline {
+		t.Fatalf("events = %v, want only probe_online", got)
+	}
+}
+
+func TestApplyHeartbeatSkipsFleetAlertsWhileStateIsUnchanged(t *testing.T) {
+	at := time.Date(2026, time.April, 8, 12, 0, 0, 0, time.UTC)
+	runtime := newFleetTestRuntime(t, at)
+	if _, err := SweepProbes(runtime, &fakeSweeperStore{}, at.Add(100*time.Second), 90*time.Second); err != nil {
+		t.Fatalf("SweepProbes() error = %v", err)
+	}
+
+	st := &fakeHeartbeatStore{}
+	if err := ApplyHeartbeat(runtime, st, "probe-a", at.Add(110*time.Second), "canaries unreachable"); err != nil {
+		t.Fatalf("first ApplyHeartbeat() error = %v", err)
+	}
+	if got := fleetEvents(st.persistedWrites); len(got) != 1 || got[0] != store.FleetEventProbeOnline {
+		t.Fatalf("events = %v, want only probe_online while quorum stays at risk", got)
+	}
+
+	runtime.mu.Lock()
+	fleetBefore := runtime.fleet.clone()
+	runtime.mu.Unlock()
+	st = &fakeHeartbeatStore{}
+	if err := ApplyHeartbeat(runtime, st, "probe-a", at.Add(115*time.Second), "canaries unreachable"); err != nil {
+		t.Fatalf("second ApplyHeartbeat() error = %v", err)
+	}
+	if got := fleetEvents(st.persistedWrites); len(got) != 0 {
+		t.Fatalf("events = %v, want none while probe-a stays degraded", got)
+	}
+	if len(st.persistedWrites) != 1 || st.persistedWrites[0].ProbeHeartbeatID != "probe-a" {
+		t.Fatalf("writes = %+v, want only the heartbeat", st.persistedWrites)
+	}
+	runtime.mu.Lock()
+	defer runtime.mu.Unlock()
+	if !reflect.DeepEqual(runtime.fleet, fleetBefore) {
+		t.Fatalf("fleet = %+v, want unchanged %+v", runtime.fleet, fleetBefore)
+	}
+}
+
+func TestFleetAlertsStaySilentWithoutAdminWebhook(t *testing.T) {
+	at := time.Date(2026, time.April, 8, 12, 0, 0, 0, time.UTC)
+	runtime := newFleetTestRuntime(t, at)
+	runtime.SetNotificationSettings(NotificationSettings{})
+
+	sweeper := &fakeSweeperStore{}
+	if _, err := SweepProbes(runtime, sweeper, at.Add(100*time.Second), 90*time.Second); err != nil {
+		t.Fatalf("SweepProbes() error = %v", err)
+	}
+	if len(sweeper.persistedWrites) != 0 {
+		t.Fatalf("persisted writes = %d, want 0", len(sweeper.persistedWrites))
+	}
+
+	// Enabling alerts later must not announce a recovery nobody was told about.
+	runtime.SetNotificationSettings(NotificationSettings{AdminWebhook: "https://hooks.example.com/admin"})
+	st := &fakeHeartbeatStore{}
+	if err := ApplyHeartbeat(runtime, st, "probe-a", at.Add(110*time.Second), ""); err != nil {
+		t.Fatalf("ApplyHeartbeat() error = %v", err)
+	}
+	if got := fleetEvents(st.persistedWrites); len(got) != 0 {
+		t.Fatalf("events = %v, want none", got)
+	}
+}
+
+func TestSweepProbesRestoresFleetStateWhenPersistFails(t *testing.T) {
+	at := time.Date(2026, time.April, 8, 12, 0, 0, 0, time.UTC)
+	runtime := newFleetTestRuntime(t, at)
+	st := &fakeSweeperStore{
+		persistMonitoringWriteFn: func(write store.MonitoringWrite) (store.MonitoringWrite, error) {
+			return store.MonitoringWrite{}, errors.New("db down")
+		},
+	}
+
+	if _, err := SweepProbes(runtime, st, at.Add(100*time.Second), 90*time.Second); err == nil {
+		t.Fatal("SweepProbes() error = nil, want persist failure")
+	}
+	probe, err := runtime.ProbeSnapshot("probe-a")
+	if err != nil {
+		t.Fatalf("ProbeSnapshot() error = %v", err)
+	}
+	if probe.State != ProbeStateOnline {
+		t.Fatalf("probe state = %q, want rollback to online", probe.State)
+	}
+	if runtime.fleet.offlineNotified["probe-a"] || runtime.fleet.quorumAtRisk {
+		t.Fatalf("fleet state = %+v, want rollback", runtime.fleet)
+	}
+}
+
+func TestFleetAlertsIgnorePrivateProbes(t *testing.T) {
+	at := time.Date(2026, time.April, 8, 12, 0, 0, 0, time.UTC)
+	runtime := newFleetTestRuntime(t, at)
+	runtime.AddOwnedProbe("home-1", 7)
+	runtime.EnsureCheck("check-private")
+	expiresAt := at.Add(time.Minute)
+	if _, err := runtime.ObserveCheckUp("check-private", "home-1", at, &expiresAt); err != nil {
+		t.Fatalf("ObserveCheckUp home-1: %v", err)
+	}
+	if _, err := runtime.ReceiveHeartbeat("home-1", at); err != nil {
+		t.Fatalf("ReceiveHeartbeat home-1: %v", err)
+	}
+
+	st := &fakeSweeperStore{}
+	if _, err := SweepProbes(runtime, st, at.Add(100*time.Second), 90*time.Second); err != nil {
+		t.Fatalf("SweepProbes() error = %v", err)
+	}
+
+	var last store.FleetNotification
+	for _, write := range st.persistedWrites {
+		for _, notification := range write.FleetNotifications {
+			if notification.ProbeID == "home-1" {
+				t.Fatalf("notification %+v, want none for a private probe", notification)
+			}
+			last = notification
+		}
+	}
+	if got := fleetEvents(st.persistedWrites); len(got) != 3 {
+		t.Fatalf("events = %v, want two shared probe_offline and quorum_at_risk", got)
+	}
+	var payload alert.FleetPayload
+	if err := json.Unmarshal(last.Payload, &payload); err != nil {
+		t.Fatalf("Unmarshal payload: %v", err)
+	}
+	if payload.ProbesTotal != 3 || payload.ChecksAtRiskCount != 1 || payload.ChecksAtRisk[0] != "check-a" {
+		t.Fatalf("payload = %+v, want three shared probes and only check-a at risk", payload)
+	}
+}
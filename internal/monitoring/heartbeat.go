@@ -14,8 +14,10 @@ type heartbeatStore interface {
 }
 
 // ApplyHeartbeat updates runtime-owned probe liveness and refreshes the
-// persisted probe heartbeat timestamp used by recovery and metadata reads.
-func ApplyHeartbeat(runtime *Runtime, st heartbeatStore, probeID string, at time.Time) error {
+// persisted probe heartbeat timestamp used by recovery and metadata reads. A
+// non-empty degraded reason keeps the probe alive but moves it into the error
+// state, so its failing votes stop counting as target outages.
+func ApplyHeartbeat(runtime *Runtime, st heartbeatStore, probeID string, at time.Time, degraded string) error {
 	if runtime == nil {
 		return fmt.Errorf("monitoring: runtime is required")
 	}
@@ -23,12 +25,12 @@ func ApplyHeartbeat(runtime *Runtime, st heartbeatStore, probeID string, at time
 		return fmt.Errorf("monitoring: store is required")
 	}
 
-	return runtime.applyHeartbeat(st, probeID, at)
+	return runtime.applyHeartbeat(st, probeID, at, degraded)
 }
 
 // applyHeartbeat advances one probe's runtime state and persists the matching
 // compact probe liveness snapshot as one unit.
-func (r *Runtime) applyHeartbeat(st heartbeatStore, probeID string, at time.Time) error {
+func (r *Runtime) applyHeartbeat(st heartbeatStore, probeID string, at time.Time, degraded string) error {
 	heartbeatAt := at.UTC()
 
 	r.mu.Lock()
@@ -39,18 +41,48 @@ func (r *Runtime) applyHeartbeat(st heartbeatStore, probeID string, at time.Time
 		return ErrUnknownProbe
 	}
 
-	previous := probe.state.clone()
+	rollback := r.captureProbeSweepRollbackLocked(probeID)
+	previous := rollback.probe
 	if _, err := probe.ReceiveHeartbeat(heartbeatAt); err != nil {
 		return err
 	}
+	if degraded != "" {
+		if _, err := probe.MarkError(degraded); err != nil {
+			r.restoreProbeSweepRollbackLocked(probeID, rollback)
+			return err
+		}
+		// Only degrade existing votes on entry; up results that arrive while
+		// the probe stays degraded still count.
+		if previous.State != ProbeStateError {
+			if err := r.applyProbeDegradationLocked(probeID, ProbeStateError, degraded); err != nil {
+				r.restoreProbeSweepRollbackLocked(probeID, rollback)
+				return err
+			}
+		}
+	}
 
 	write := store.MonitoringWrite{
 		ProbeHeartbeatID: probeID,
 		ProbeHeartbeatAt: heartbeatAt,
 	}
 
+	// Fleet alerts follow which probes are online, so only a state change can
+	// move them; a probe that keeps heartbeating in the same state, degraded or
+	// not, leaves them alone.
+	previousFleet := r.fleet
+	if probe.state.State != previous.State {
+		notifications, fleetBefore, err := r.fleetNotificationsLocked(probeID, true, heartbeatAt)
+		if err != nil {
+			r.restoreProbeSweepRollbackLocked(probeID, rollback)
+			return err
+		}
+		previousFleet = fleetBefore
+		write.FleetNotifications = notifications
+	}
+
 	if _, err := st.PersistMonitoringWrite(write); err != nil {
-		probe.state = previous
+		r.restoreProbeSweepRollbackLocked(probeID, rollback)
+		r.fleet = previousFleet
 		return err
 	}
 
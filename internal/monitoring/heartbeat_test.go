@@ -29,7 +29,7 @@ func TestApplyHeartbeatPersistsProbeRuntimeTransition(t *testing.T) {
 	runtime := NewRuntime([]string{"check-a"}, []string{"probe-a"})
 	at := time.Date(2026, time.April, 8, 14, 0, 0, 0, time.UTC)
 
-	if err := ApplyHeartbeat(runtime, st, "probe-a", at); err != nil {
+	if err := ApplyHeartbeat(runtime, st, "probe-a", at, ""); err != nil {
 		t.Fatalf("ApplyHeartbeat() error = %v", err)
 	}
 
@@ -68,7 +68,7 @@ func TestApplyHeartbeatRollsBackRuntimeWhenPersistFails(t *testing.T) {
 	runtime := NewRuntime([]string{"check-a"}, []string{"probe-a"})
 	at := time.Date(2026, time.April, 8, 14, 0, 0, 0, time.UTC)
 
-	err := ApplyHeartbeat(runtime, st, "probe-a", at)
+	err := ApplyHeartbeat(runtime, st, "probe-a", at, "")
 	if !errors.Is(err, persistErr) {
 		t.Fatalf("ApplyHeartbeat() error = %v, want %v", err, persistErr)
 	}
@@ -84,3 +84,52 @@ func TestApplyHeartbeatRollsBackRuntimeWhenPersistFails(t *testing.T) {
 		t.Fatalf("LastHeartbeatAt = %v, want nil", probe.LastHeartbeatAt)
 	}
 }
+
+// TestApplyHeartbeatMarksDegradedProbeError verifies that a degraded heartbeat
+// keeps the probe alive but moves it and its votes into the error state, and
+// that a healthy heartbeat brings it back online.
+func TestApplyHeartbeatMarksDegradedProbeError(t *testing.T) {
+	st := &fakeHeartbeatStore{}
+	runtime := NewRuntime([]string{"check-a"}, []string{"probe-a"})
+	at := time.Date(2026, time.April, 8, 14, 0, 0, 0, time.UTC)
+	expiresAt := at.Add(time.Minute)
+	if _, err := runtime.ObserveCheckDown("check-a", "probe-a", at, &expiresAt, "timeout"); err != nil {
+		t.Fatalf("ObserveCheckDown() error = %v", err)
+	}
+
+	if err := ApplyHeartbeat(runtime, st, "probe-a", at, "all 2 canaries failed"); err != nil {
+		t.Fatalf("ApplyHeartbeat() error = %v", err)
+	}
+
+	probe, err := runtime.ProbeSnapshot("probe-a")
+	if err != nil {
+		t.Fatalf("ProbeSnapshot() error = %v", err)
+	}
+	if probe.State != ProbeStateError {
+		t.Fatalf("probe state = %q, want %q", probe.State, ProbeStateError)
+	}
+	if probe.LastError != "all 2 canaries failed" {
+		t.Fatalf("LastError = %q, want canary reason", probe.LastError)
+	}
+	if probe.LastHeartbeatAt == nil || !probe.LastHeartbeatAt.Equal(at) {
+		t.Fatalf("LastHeartbeatAt = %v, want %v", probe.LastHeartbeatAt, at)
+	}
+	check, err := runtime.CheckSnapshot("check-a", "probe-a")
+	if err != nil {
+		t.Fatalf("CheckSnapshot() error = %v", err)
+	}
+	if check.State != CheckStateError {
+		t.Fatalf("check state = %q, want %q", check.State, CheckStateError)
+	}
+
+	if err := ApplyHeartbeat(runtime, st, "probe-a", at.Add(30*time.Second), ""); err != nil {
+		t.Fatalf("ApplyHeartbeat() error = %v", err)
+	}
+	probe, err = runtime.ProbeSnapshot("probe-a")
+	if err != nil {
+		t.Fatalf("ProbeSnapshot() error = %v", err)
+	}
+	if probe.State != ProbeStateOnline || probe.LastError != "" {
+		t.Fatalf("probe = %+v, want online without error", probe)
+	}
+}
@@ -0,0 +1,121 @@
+package monitoring
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/tmater/wacht/internal/checks"
+	"github.com/tmater/wacht/internal/store"
+)
+
+// placementStore is the persistence surface needed to drop probes from a
+// check's quorum.
+type placementStore interface {
+	PersistMonitoringWrite(write store.MonitoringWrite) (store.MonitoringWrite, error)
+}
+
+// ApplyCheckPlacement removes probes that check no longer selects from its
+// quorum, so only selected probes vote. It is called after a check's probe
+// selector or a probe's labels change. The removed assignments are deleted
+// from the store together with any incident transition the smaller quorum
+// causes. It returns how many probes were removed.
+func ApplyCheckPlacement(runtime *Runtime, st placementStore, check checks.Check, selected func(probeID string) bool) (int, error) {
+	if runtime == nil {
+		return 0, fmt.Errorf("monitoring: runtime is required")
+	}
+	if st == nil {
+		return 0, fmt.Errorf("monitoring: store is required")
+	}
+	if selected == nil {
+		return 0, fmt.Errorf("monitoring: selected is required")
+	}
+
+	runtime.mu.Lock()
+	defer runtime.mu.Unlock()
+
+	quorum, ok := runtime.quorums[check.ID]
+	if !ok {
+		return 0, nil
+	}
+
+	var removedIDs []string
+	for probeID := range quorum.checks {
+		if !selected(probeID) {
+			removedIDs = append(removedIDs, probeID)
+		}
+	}
+	if len(removedIDs) == 0 {
+		return 0, nil
+	}
+	sort.Strings(removedIDs)
+
+	if err := removeFromQuorumLocked(runtime, st, check, quorum, removedIDs); err != nil {
+		return 0, err
+	}
+	return len(removedIDs), nil
+}
+
+// RemoveProbe drops a revoked probe from the runtime: it leaves the quorum of
+// every check in all that it votes in, and its liveness state is forgotten so
+// it no longer counts toward fleet health. Each check's quorum change is
+// persisted like a placement change. On error the probe stays known to the
+// runtime, so the removal can be retried.
+func RemoveProbe(runtime *Runtime, st placementStore, probeID string, all []checks.Check) error {
+	if runtime == nil {
+		return fmt.Errorf("monitoring: runtime is required")
+	}
+	if st == nil {
+		return fmt.Errorf("monitoring: store is required")
+	}
+
+	runtime.mu.Lock()
+	defer runtime.mu.Unlock()
+
+	for _, check := range all {
+		quorum, ok := runtime.quorums[check.ID]
+		if !ok {
+			continue
+		}
+		if _, ok := quorum.checks[probeID]; !ok {
+			continue
+		}
+		if err := removeFromQuorumLocked(runtime, st, check, quorum, []string{probeID}); err != nil {
+			return err
+		}
+	}
+	delete(runtime.probes, probeID)
+	delete(runtime.fleet.offlineNotified, probeID)
+	return nil
+}
+
+// removeFromQuorumLocked removes probeIDs from quorum, recomputes it, and
+// persists the removed assignments with any incident transition. The quorum is
+// restored if persisting fails.
+func removeFromQuorumLocked(runtime *Runtime, st placementStore, check checks.Check, quorum *QuorumMachine, removedIDs []string) error {
+	previousQuorum := quorum.Snapshot()
+	removed := make(map[string]*CheckMachine, len(removedIDs))
+	write := store.MonitoringWrite{RemovedAssignments: make([]store.CheckAssignment, 0, len(removedIDs))}
+	for _, probeID := range removedIDs {
+		removed[probeID] = quorum.checks[probeID]
+		delete(quorum.checks, probeID)
+		write.RemovedAssignments = append(write.RemovedAssignments, store.CheckAssignment{CheckID: check.ID, ProbeID: probeID})
+	}
+	rollback := func() {
+		for probeID, machine := range removed {
+			quorum.checks[probeID] = machine
+		}
+		quorum.state = previousQuorum
+	}
+
+	quorum.Recompute()
+	write, err := monitoringWriteForCheckEvent(check, quorum, previousQuorum, quorum.Snapshot(), runtime.notifications, write)
+	if err != nil {
+		rollback()
+		return err
+	}
+	if _, err := st.PersistMonitoringWrite(write); err != nil {
+		rollback()
+		return err
+	}
+	return nil
+}
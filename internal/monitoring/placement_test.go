@@ -0,0 +1,123 @@
+package monitoring
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tmater/wacht/internal/checks"
+	"github.com/tmater/wacht/internal/store"
+)
+
+func newPlacementTestRuntime(t *testing.T) *Runtime {
+	t.Helper()
+	runtime := NewRuntime([]string{"check-a"}, []string{"probe-a", "probe-b", "probe-c"})
+	at := time.Date(2026, time.October, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := at.Add(time.Minute)
+	for _, observedAt := range []time.Time{at, at.Add(time.Second)} {
+		for _, probeID := range []string{"probe-a", "probe-b", "probe-c"} {
+			if _, err := runtime.ObserveCheckUp("check-a", probeID, observedAt, &expiresAt); err != nil {
+				t.Fatalf("ObserveCheckUp %s: %v", probeID, err)
+			}
+		}
+	}
+	return runtime
+}
+
+func TestApplyCheckPlacementRemovesUnselectedProbes(t *testing.T) {
+	st := &fakeSweeperStore{}
+	runtime := newPlacementTestRuntime(t)
+	check := checks.Check{ID: "check-a", ProbeSelector: "region=eu"}
+
+	removed, err := ApplyCheckPlacement(runtime, st, check, func(probeID string) bool { return probeID != "probe-c" })
+	if err != nil {
+		t.Fatalf("ApplyCheckPlacement() error = %v", err)
+	}
+	if removed != 1 {
+		t.Fatalf("removed = %d, want 1", removed)
+	}
+	if _, err := runtime.CheckSnapshot("check-a", "probe-c"); !errors.Is(err, ErrUnknownCheckAssignment) {
+		t.Fatalf("CheckSnapshot(probe-c) error = %v, want %v", err, ErrUnknownCheckAssignment)
+	}
+	quorum, err := runtime.QuorumSnapshot("check-a")
+	if err != nil {
+		t.Fatalf("QuorumSnapshot() error = %v", err)
+	}
+	if quorum.State != QuorumStateUp {
+		t.Fatalf("quorum state = %q, want %q", quorum.State, QuorumStateUp)
+	}
+
+	if len(st.persistedWrites) != 1 {
+		t.Fatalf("persisted writes = %d, want 1", len(st.persistedWrites))
+	}
+	got := st.persistedWrites[0].RemovedAssignments
+	if len(got) != 1 || got[0] != (store.CheckAssignment{CheckID: "check-a", ProbeID: "probe-c"}) {
+		t.Fatalf("RemovedAssignments = %+v, want probe-c", got)
+	}
+
+	// A second pass with nothing left to remove is a no-op.
+	removed, err = ApplyCheckPlacement(runtime, st, check, func(probeID string) bool { return probeID != "probe-c" })
+	if err != nil || removed != 0 {
+		t.Fatalf("ApplyCheckPlacement() again = %d, %v, want 0, nil", removed, err)
+	}
+	if len(st.persistedWrites) != 1 {
+		t.Fatalf("persisted writes = %d, want no new write", len(st.persistedWrites))
+	}
+}
+
+func TestApplyCheckPlacementRollsBackWhenPersistFails(t *testing.T) {
+	st := &fakeSweeperStore{
+		persistMonitoringWriteFn: func(store.MonitoringWrite) (store.MonitoringWrite, error) {
+			return store.MonitoringWrite{}, errors.New("boom")
+		},
+	}
+	runtime := newPlacementTestRuntime(t)
+	before, err := runtime.QuorumSnapshot("check-a")
+	if err != nil {
+		t.Fatalf("QuorumSnapshot() error = %v", err)
+	}
+
+	if _, err := ApplyCheckPlacement(runtime, st, checks.Check{ID: "check-a"}, func(string) bool { return false }); err == nil {
+		t.Fatal("ApplyCheckPlacement() error = nil, want persist error")
+	}
+
+	for _, probeID := range []string{"probe-a", "probe-b", "probe-c"} {
+		if _, err := runtime.CheckSnapshot("check-a", probeID); err != nil {
+			t.Fatalf("CheckSnapshot(%s) error = %v, want restored assignment", probeID, err)
+		}
+	}
+	after, err := runtime.QuorumSnapshot("check-a")
+	if err != nil {
+		t.Fatalf("QuorumSnapshot() error = %v", err)
+	}
+	if after != before {
+		t.Fatalf("quorum = %+v, want %+v", after, before)
+	}
+}
+
+func TestRemoveProbeDropsProbeFromQuorumsAndFleet(t *testing.T) {
+	st := &fakeSweeperStore{}
+	runtime := newPlacementTestRuntime(t)
+
+	if err := RemoveProbe(runtime, st, "probe-c", []checks.Check{{ID: "check-a"}}); err != nil {
+		t.Fatalf("RemoveProbe() error = %v", err)
+	}
+	if _, err := runtime.CheckSnapshot("check-a", "probe-c"); !errors.Is(err, ErrUnknownCheckAssignment) {
+		t.Fatalf("CheckSnapshot(probe-c) error = %v, want %v", err, ErrUnknownCheckAssignment)
+	}
+	if _, err := runtime.ProbeSnapshot("probe-c"); err == nil {
+		t.Fatal("ProbeSnapshot(probe-c) error = nil, want unknown probe")
+	}
+	for _, probe := range runtime.ProbeSnapshots() {
+		if probe.ProbeID == "probe-c" {
+			t.Fatal("ProbeSnapshots() still lists probe-c")
+		}
+	}
+	if len(st.persistedWrites) != 1 {
+		t.Fatalf("persisted writes = %d, want 1", len(st.persistedWrites))
+	}
+	got := st.persistedWrites[0].RemovedAssignments
+	if len(got) != 1 || got[0] != (store.CheckAssignment{CheckID: "check-a", ProbeID: "probe-c"}) {
+		t.Fatalf("RemovedAssignments = %+v, want probe-c", got)
+	}
+}
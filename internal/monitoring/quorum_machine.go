@@ -1,6 +1,10 @@
 package monitoring
 
-import "time"
+import (
+	"time"
+
+	"github.com/tmater/wacht/internal/proto"
+)
 
 // QuorumMachine owns one check's aggregate state.
 type QuorumMachine struct {
@@ -139,14 +143,20 @@ func (m *QuorumMachine) Recompute() QuorumTransition {
 	next := current
 
 	var upVotes, downVotes int
+	causes := make(map[proto.ErrorKind]int)
 	for _, check := range m.checks {
-		switch quorumContribution(check.Snapshot(), current) {
+		state := check.Snapshot()
+		switch quorumContribution(state, current) {
 		case CheckStateUp:
 			upVotes++
 		case CheckStateDown:
 			downVotes++
+			if state.LastErrorKind != "" {
+				causes[state.LastErrorKind]++
+			}
 		}
 	}
+	next.ProbableCause = probableCause(causes)
 
 	required := quorumThreshold(len(m.checks))
 
@@ -183,6 +193,22 @@ func (m *QuorumMachine) Recompute() QuorumTransition {
 	}
 }
 
+// probableCause returns the error kind reported by the most down-voting
+// probes. Ties go to the kind that sorts first so the cause does not flip
+// between recomputes.
+func probableCause(causes map[proto.ErrorKind]int) proto.ErrorKind {
+	var (
+		best  proto.ErrorKind
+		count int
+	)
+	for kind, n := range causes {
+		if n > count || (n == count && kind < best) {
+			best, count = kind, n
+		}
+	}
+	return best
+}
+
 func isStableQuorumState(state QuorumState) bool {
 	return state == QuorumStateUp || state == QuorumStateDown
 }
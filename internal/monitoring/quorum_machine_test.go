@@ -3,6 +3,8 @@ package monitoring
 import (
 	"testing"
 	"time"
+
+	"github.com/tmater/wacht/internal/proto"
 )
 
 func TestQuorumMachineRecompute(t *testing.T) {
@@ -91,3 +93,15 @@ func TestQuorumMachineDoesNotOpenIncidentForStaggeredFlap(t *testing.T) {
 		t.Fatalf("last stable state = %q, want not down", quorum.Snapshot().LastStableState)
 	}
 }
+
+func TestProbableCausePrefersMostCommonKind(t *testing.T) {
+	if got := probableCause(map[proto.ErrorKind]int{proto.ErrorKindTimeout: 1, proto.ErrorKindDNS: 2}); got != proto.ErrorKindDNS {
+		t.Fatalf("probableCause() = %q, want dns", got)
+	}
+	if got := probableCause(map[proto.ErrorKind]int{proto.ErrorKindTimeout: 1, proto.ErrorKindTLS: 1}); got != proto.ErrorKindTimeout {
+		t.Fatalf("probableCause() tie = %q, want timeout", got)
+	}
+	if got := probableCause(nil); got != "" {
+		t.Fatalf("probableCause(nil) = %q, want empty", got)
+	}
+}
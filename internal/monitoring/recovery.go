@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/tmater/wacht/internal/checks"
+	"github.com/tmater/wacht/internal/proto"
 	"github.com/tmater/wacht/internal/store"
 )
 
@@ -73,7 +74,12 @@ func LoadRuntime(src recoveryStore) (*Runtime, error) {
 
 	for _, probe := range probes {
 		runtimeProbe, ok := runtime.probes[probe.ProbeID]
-		if !ok || probe.LastSeenAt == nil {
+		if !ok {
+			continue
+		}
+		runtimeProbe.state.LastResultSeq = probe.LastResultSeq
+		runtimeProbe.state.OwnerUserID = probe.OwnerUserID
+		if probe.LastSeenAt == nil {
 			continue
 		}
 		lastSeenAt := probe.LastSeenAt.UTC()
@@ -108,13 +114,16 @@ func LoadRuntime(src recoveryStore) (*Runtime, error) {
 
 func persistedCheckExecState(state store.PersistedCheckState) CheckExecState {
 	return CheckExecState{
-		CheckID:      state.CheckID,
-		ProbeID:      state.ProbeID,
-		LastResultAt: state.LastResultAt,
-		LastOutcome:  CheckState(state.LastOutcome),
-		StreakLen:    state.StreakLen,
-		ExpiresAt:    state.ExpiresAt,
-		State:        CheckState(state.State),
-		LastError:    state.LastError,
+		CheckID:       state.CheckID,
+		ProbeID:       state.ProbeID,
+		LastResultAt:  state.LastResultAt,
+		LastOutcome:   CheckState(state.LastOutcome),
+		StreakLen:     state.StreakLen,
+		ExpiresAt:     state.ExpiresAt,
+		State:         CheckState(state.State),
+		LastError:     state.LastError,
+		LastErrorKind: proto.ErrorKind(state.LastErrorKind),
+		LastAttempts:  state.LastAttempts,
+		LastTimings:   state.LastTimings,
 	}
 }
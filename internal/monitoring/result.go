@@ -3,6 +3,7 @@ package monitoring
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
@@ -24,44 +25,76 @@ type ObservedResult struct {
 
 // ApplyResultBatch updates runtime-owned monitoring state for one accepted
 // result batch and durably records all resulting current-state rows and
-// incident side effects in one DB transaction.
-func ApplyResultBatch(runtime *Runtime, st resultBatchStore, observed []ObservedResult) error {
+// incident side effects in one DB transaction. Sequenced results at or below
+// the probe's last accepted sequence are duplicates of an earlier upload or
+// arrived out of order; they are skipped and counted in stale.
+func ApplyResultBatch(runtime *Runtime, st resultBatchStore, observed []ObservedResult) (stale int, err error) {
 	if runtime == nil {
-		return fmt.Errorf("monitoring: runtime is required")
+		return 0, fmt.Errorf("monitoring: runtime is required")
 	}
 	if st == nil {
-		return fmt.Errorf("monitoring: store is required")
+		return 0, fmt.Errorf("monitoring: store is required")
 	}
 	if len(observed) == 0 {
-		return nil
+		return 0, nil
 	}
 
 	return runtime.applyObservedResultBatch(st, observed)
 }
 
-func (r *Runtime) applyObservedResultBatch(st resultBatchStore, observed []ObservedResult) error {
+func (r *Runtime) applyObservedResultBatch(st resultBatchStore, observed []ObservedResult) (int, error) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	writes := make([]store.MonitoringWrite, 0, len(observed))
+	writes := make([]store.MonitoringWrite, 0, len(observed)+1)
 	rollbacks := make([]observedResultRollback, 0, len(observed))
+	previousSeqs := make(map[string]int64)
+	rollback := func() {
+		r.rollbackObservedResultsLocked(rollbacks)
+		for probeID, seq := range previousSeqs {
+			if probe, ok := r.probes[probeID]; ok {
+				probe.state.LastResultSeq = seq
+			}
+		}
+	}
 
+	stale := 0
 	for _, item := range observed {
-		write, rollback, err := r.applyObservedResultLocked(item.Check, item.Result)
+		if probe, ok := r.probes[item.Result.ProbeID]; ok && item.Result.Seq > 0 {
+			if item.Result.Seq <= probe.state.LastResultSeq {
+				stale++
+				continue
+			}
+			if _, saved := previousSeqs[item.Result.ProbeID]; !saved {
+				previousSeqs[item.Result.ProbeID] = probe.state.LastResultSeq
+			}
+			probe.state.LastResultSeq = item.Result.Seq
+		}
+
+		write, itemRollback, err := r.applyObservedResultLocked(item.Check, item.Result)
 		if err != nil {
-			r.rollbackObservedResultsLocked(rollbacks)
-			return err
+			rollback()
+			return 0, err
 		}
 		writes = append(writes, write)
-		rollbacks = append(rollbacks, rollback)
+		rollbacks = append(rollbacks, itemRollback)
+	}
+	for probeID := range previousSeqs {
+		writes = append(writes, store.MonitoringWrite{
+			ResultSeqProbeID: probeID,
+			ResultSeq:        r.probes[probeID].state.LastResultSeq,
+		})
 	}
 
+	if len(writes) == 0 {
+		return stale, nil
+	}
 	if _, err := st.PersistMonitoringBatch(writes); err != nil {
-		r.rollbackObservedResultsLocked(rollbacks)
-		return err
+		rollback()
+		return 0, err
 	}
 
-	return nil
+	return stale, nil
 }
 
 type observedResultRollback struct {
@@ -77,7 +110,8 @@ func (r *Runtime) applyObservedResultLocked(check checks.Check, result proto.Che
 	expiresAt := evidenceExpiresAt(check, result.Timestamp)
 	checkID := check.ID
 
-	if _, ok := r.probes[result.ProbeID]; !ok {
+	probe, ok := r.probes[result.ProbeID]
+	if !ok {
 		return store.MonitoringWrite{}, observedResultRollback{}, ErrUnknownProbe
 	}
 
@@ -99,42 +133,147 @@ func (r *Runtime) applyObservedResultLocked(check checks.Check, result proto.Che
 		PreviousQuorum:    previousQuorum,
 	}
 
+	// The kind is set before the observation so the quorum recompute it
+	// triggers sees this probe's cause; a failed observation rolls it back.
+	child.state.LastErrorKind = ""
+	if !result.Up {
+		child.state.LastErrorKind = result.ErrorKind
+	}
+
 	var (
 		update CheckUpdate
 		err    error
 	)
-	if result.Up {
+	switch {
+	case result.Up:
 		update, err = quorum.ObserveUp(result.ProbeID, result.Timestamp, &expiresAt)
-	} else {
+	case result.ProbeDegraded || probe.state.State == ProbeStateError:
+		// A probe whose own canaries fail cannot tell a dead target from its
+		// own lost uplink, so the failure is a probe error, not a down vote.
+		update, err = quorum.MarkCheckError(result.ProbeID, strings.TrimSpace(result.Error))
+		if err == nil {
+			child.state.LastResultAt = result.Timestamp.UTC()
+			child.state.ExpiresAt = expiresAt
+		}
+	default:
 		update, err = quorum.ObserveDown(result.ProbeID, result.Timestamp, &expiresAt, strings.TrimSpace(result.Error))
 	}
 	if err != nil {
 		r.rollbackObservedResultsLocked([]observedResultRollback{rollback})
 		return store.MonitoringWrite{}, observedResultRollback{}, err
 	}
+	child.state.LastAttempts = result.Attempts
+	child.state.LastTimings = proto.HTTPTimings{}
+	if result.Timings != nil {
+		child.state.LastTimings = *result.Timings
+	}
+	if result.Up {
+		child.state.LastPath, child.state.LastPathAt = nil, time.Time{}
+		child.state.LastEvidence, child.state.LastEvidenceAt = nil, time.Time{}
+	} else {
+		if result.Path != nil {
+			child.state.LastPath, child.state.LastPathAt = result.Path, result.Timestamp
+		}
+		if result.Evidence != nil {
+			child.state.LastEvidence, child.state.LastEvidenceAt = result.Evidence, result.Timestamp
+		}
+	}
 
 	write := store.MonitoringWrite{
 		CheckStateWrites: []store.CheckStateWrite{
 			{
-				CheckID:      checkID,
-				ProbeID:      result.ProbeID,
-				LastResultAt: child.state.LastResultAt,
-				LastOutcome:  string(child.state.LastOutcome),
-				StreakLen:    child.state.StreakLen,
-				ExpiresAt:    child.state.ExpiresAt,
-				State:        string(child.state.State),
-				LastError:    child.state.LastError,
+				CheckID:       checkID,
+				ProbeID:       result.ProbeID,
+				LastResultAt:  child.state.LastResultAt,
+				LastOutcome:   string(child.state.LastOutcome),
+				StreakLen:     child.state.StreakLen,
+				ExpiresAt:     child.state.ExpiresAt,
+				State:         string(child.state.State),
+				LastError:     child.state.LastError,
+				LastErrorKind: string(child.state.LastErrorKind),
+				LastAttempts:  child.state.LastAttempts,
+				LastTimings:   child.state.LastTimings,
 			},
 		},
 	}
-	write, err = monitoringWriteForCheckEvent(check, quorum, rollback.PreviousQuorum, update.Quorum, write)
+	if !result.Up && (result.Evidence != nil || result.Path != nil) {
+		evidence := store.IncidentEvidenceWrite{
+			CheckID:    checkID,
+			ProbeID:    result.ProbeID,
+			CapturedAt: result.Timestamp,
+			Path:       result.Path,
+		}
+		if result.Evidence != nil {
+			evidence.Evidence = *result.Evidence
+		}
+		write.EvidenceWrites = []store.IncidentEvidenceWrite{evidence}
+	}
+	write, err = monitoringWriteForCheckEvent(check, quorum, rollback.PreviousQuorum, update.Quorum, r.notifications, write)
 	if err != nil {
 		return store.MonitoringWrite{}, observedResultRollback{}, err
 	}
+	if write.IncidentCheckID != "" && !write.ResolveIncident {
+		// Anything captured with this result is already in the write.
+		write.EvidenceWrites = append(write.EvidenceWrites, pendingEvidence(quorum, result.ProbeID, result.Timestamp)...)
+	}
 
 	return write, rollback, nil
 }
 
+// pendingEvidence returns the responses and paths probes captured earlier in
+// their failing streaks, except what skipProbeID captured at skipAt. Those
+// results arrived before quorum opened the incident, so they are attached when
+// it opens.
+func pendingEvidence(quorum *QuorumMachine, skipProbeID string, skipAt time.Time) []store.IncidentEvidenceWrite {
+	probeIDs := make([]string, 0, len(quorum.checks))
+	for probeID, child := range quorum.checks {
+		if child.state.LastPath != nil || child.state.LastEvidence != nil {
+			probeIDs = append(probeIDs, probeID)
+		}
+	}
+	sort.Strings(probeIDs)
+
+	writes := make([]store.IncidentEvidenceWrite, 0, len(probeIDs))
+	for _, probeID := range probeIDs {
+		state := quorum.checks[probeID].state
+		skip := func(at time.Time) bool { return probeID == skipProbeID && at.Equal(skipAt) }
+		var evidence, path *store.IncidentEvidenceWrite
+		if state.LastEvidence != nil && !skip(state.LastEvidenceAt) {
+			evidence = &store.IncidentEvidenceWrite{
+				CheckID:    quorum.state.CheckID,
+				ProbeID:    probeID,
+				CapturedAt: state.LastEvidenceAt,
+				Evidence:   *state.LastEvidence,
+			}
+		}
+		if state.LastPath != nil && !skip(state.LastPathAt) {
+			path = &store.IncidentEvidenceWrite{
+				CheckID:    quorum.state.CheckID,
+				ProbeID:    probeID,
+				CapturedAt: state.LastPathAt,
+				Path:       state.LastPath,
+			}
+		}
+		switch {
+		case evidence != nil && path != nil && evidence.CapturedAt.Equal(path.CapturedAt):
+			// Both came with the same result, which is one evidence row.
+			evidence.Path = path.Path
+			writes = append(writes, *evidence)
+		default:
+			first, second := path, evidence
+			if first == nil || (second != nil && second.CapturedAt.Before(first.CapturedAt)) {
+				first, second = second, first
+			}
+			for _, w := range []*store.IncidentEvidenceWrite{first, second} {
+				if w != nil {
+					writes = append(writes, *w)
+				}
+			}
+		}
+	}
+	return writes
+}
+
 func (r *Runtime) rollbackObservedResultsLocked(rollbacks []observedResultRollback) {
 	for i := len(rollbacks) - 1; i >= 0; i-- {
 		rollback := rollbacks[i]
@@ -186,11 +325,12 @@ func monitoringWriteForCheckEvent(
 	quorum *QuorumMachine,
 	previousQuorum CheckQuorumState,
 	currentQuorum CheckQuorumState,
+	settings NotificationSettings,
 	write store.MonitoringWrite,
 ) (store.MonitoringWrite, error) {
 	switch {
 	case previousQuorum.LastStableState == QuorumStateUp && currentQuorum.LastStableState == QuorumStateDown:
-		request, err := notificationRequest(check, "down", quorum)
+		request, err := notificationRequest(check, "down", quorum, settings)
 		if err != nil {
 			return store.MonitoringWrite{}, err
 		}
@@ -199,7 +339,7 @@ func monitoringWriteForCheckEvent(
 	case previousQuorum.IncidentOpen &&
 		previousQuorum.LastStableState == QuorumStateDown &&
 		currentQuorum.LastStableState == QuorumStateUp:
-		request, err := notificationRequest(check, "up", quorum)
+		request, err := notificationRequest(check, "up", quorum, settings)
 		if err != nil {
 			return store.MonitoringWrite{}, err
 		}
@@ -208,24 +348,46 @@ func monitoringWriteForCheckEvent(
 		write.IncidentNotification = request
 	}
 
+	// Record the probable cause when the incident opens and whenever it
+	// changes while open. An empty cause keeps the last one known.
+	opening := write.IncidentCheckID != "" && !write.ResolveIncident
+	if cause := currentQuorum.ProbableCause; cause != "" && currentQuorum.IncidentOpen && !write.ResolveIncident &&
+		(opening || cause != previousQuorum.ProbableCause) {
+		write.ProbableCauseCheckID = check.ID
+		write.ProbableCause = string(cause)
+	}
+
 	return write, nil
 }
 
 // notificationRequest builds the durable webhook work item for one stable
-// quorum transition.
-func notificationRequest(check checks.Check, status string, quorum *QuorumMachine) (*store.NotificationRequest, error) {
+// quorum transition in the payload schema the check opted into.
+func notificationRequest(check checks.Check, status string, quorum *QuorumMachine, settings NotificationSettings) (*store.NotificationRequest, error) {
 	if check.Webhook == "" {
 		return nil, nil
 	}
 
+	if check.WebhookVersion == checks.WebhookPayloadV2 {
+		body, err := json.Marshal(alertPayloadV2(check, status, quorum, settings))
+		if err != nil {
+			return nil, err
+		}
+		return &store.NotificationRequest{
+			WebhookURL:      check.Webhook,
+			Payload:         body,
+			IncludeIncident: true,
+		}, nil
+	}
+
 	probesDown, probesTotal := quorumCounts(quorum)
 	body, err := json.Marshal(alert.AlertPayload{
-		CheckID:     check.ID,
-		CheckName:   check.Name,
-		Target:      check.Target,
-		Status:      status,
-		ProbesDown:  probesDown,
-		ProbesTotal: probesTotal,
+		CheckID:       check.ID,
+		CheckName:     check.Name,
+		Target:        check.Target,
+		Status:        status,
+		ProbesDown:    probesDown,
+		ProbesTotal:   probesTotal,
+		ProbableCause: string(quorum.state.ProbableCause),
 	})
 	if err != nil {
 		return nil, err
@@ -237,6 +399,49 @@ func notificationRequest(check checks.Check, status string, quorum *QuorumMachin
 	}, nil
 }
 
+// alertPayloadV2 renders the versioned payload from the quorum's child
+// machines. The incident block is added by the store once the row exists.
+func alertPayloadV2(check checks.Check, status string, quorum *QuorumMachine, settings NotificationSettings) alert.AlertPayloadV2 {
+	probesDown, probesTotal := quorumCounts(quorum)
+	payload := alert.AlertPayloadV2{
+		SchemaVersion: alert.PayloadSchemaV2,
+		Status:        status,
+		ServerURL:     settings.ServerURL,
+		Check: alert.AlertCheck{
+			ID:     check.ID,
+			Name:   check.Name,
+			Type:   string(check.Type),
+			Target: check.Target,
+		},
+		ProbesDown:    probesDown,
+		ProbesTotal:   probesTotal,
+		Probes:        make([]alert.AlertProbe, 0, len(quorum.checks)),
+		ProbableCause: string(quorum.state.ProbableCause),
+	}
+
+	probeIDs := make([]string, 0, len(quorum.checks))
+	for probeID := range quorum.checks {
+		probeIDs = append(probeIDs, probeID)
+	}
+	sort.Strings(probeIDs)
+	for _, probeID := range probeIDs {
+		state := quorum.checks[probeID].state
+		probe := alert.AlertProbe{
+			ProbeID:   probeID,
+			State:     string(state.State),
+			LastError: state.LastError,
+			ErrorKind: string(state.LastErrorKind),
+			Attempts:  state.LastAttempts,
+		}
+		if !state.LastResultAt.IsZero() {
+			lastResultAt := state.LastResultAt.UTC().Format(time.RFC3339)
+			probe.LastResultAt = &lastResultAt
+		}
+		payload.Probes = append(payload.Probes, probe)
+	}
+	return payload
+}
+
 // quorumCounts summarizes the current child-check distribution for incident
 // notifications.
 func quorumCounts(quorum *QuorumMachine) (down int, total int) {
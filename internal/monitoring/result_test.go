@@ -1,10 +1,12 @@
 package monitoring
 
 import (
+	"encoding/json"
 	"errors"
 	"testing"
 	"time"
 
+	"github.com/tmater/wacht/internal/alert"
 	"github.com/tmater/wacht/internal/checks"
 	"github.com/tmater/wacht/internal/proto"
 	"github.com/tmater/wacht/internal/store"
@@ -33,12 +35,13 @@ func testObservedCheck(checkID, id, checkType, target, webhook string, interval
 }
 
 func applyResultForTest(runtime *Runtime, st *fakeResultStore, check checks.Check, result proto.CheckResult) error {
-	return ApplyResultBatch(runtime, st, []ObservedResult{
+	_, err := ApplyResultBatch(runtime, st, []ObservedResult{
 		{
 			Check:  check,
 			Result: result,
 		},
 	})
+	return err
 }
 
 func applyResultSequence(t *testing.T, runtime *Runtime, st *fakeResultStore, check checks.Check, results []proto.CheckResult) {
@@ -277,7 +280,7 @@ func TestApplyResultBatchPersistsMultipleWritesInSingleBatch(t *testing.T) {
 	runtime := NewRuntime([]string{checkID}, []string{"probe-a", "probe-b"})
 	at := time.Date(2026, time.April, 8, 12, 0, 0, 0, time.UTC)
 
-	err := ApplyResultBatch(runtime, st, []ObservedResult{
+	_, err := ApplyResultBatch(runtime, st, []ObservedResult{
 		{
 			Check:  check,
 			Result: proto.CheckResult{CheckID: checkID, CheckName: "check-a", ProbeID: "probe-a", Up: true, Timestamp: at},
@@ -306,6 +309,251 @@ func TestApplyResultBatchPersistsMultipleWritesInSingleBatch(t *testing.T) {
 	}
 }
 
+func TestApplyResultRecordsProbeAttempts(t *testing.T) {
+	st := &fakeResultStore{}
+	check := testObservedCheck("00000000-0000-0000-0000-000000000108", "check-a", "http", "https://example.com", "", 30)
+	runtime := NewRuntime([]string{check.ID}, []string{"probe-a"})
+	at := time.Date(2026, time.April, 8, 12, 0, 0, 0, time.UTC)
+
+	if err := applyResultForTest(runtime, st, check, proto.CheckResult{
+		CheckID: check.ID, ProbeID: "probe-a", Up: false, Error: "timeout", Timestamp: at, Attempts: 3,
+	}); err != nil {
+		t.Fatalf("apply result: %v", err)
+	}
+
+	state, err := runtime.CheckSnapshot(check.ID, "probe-a")
+	if err != nil {
+		t.Fatalf("CheckSnapshot() error = %v", err)
+	}
+	if state.LastAttempts != 3 {
+		t.Fatalf("LastAttempts = %d, want 3", state.LastAttempts)
+	}
+	if got := st.persistedWrites[0].CheckStateWrites[0].LastAttempts; got != 3 {
+		t.Fatalf("persisted LastAttempts = %d, want 3", got)
+	}
+}
+
+func TestApplyResultRecordsHTTPTimings(t *testing.T) {
+	st := &fakeResultStore{}
+	check := testObservedCheck("00000000-0000-0000-0000-000000000109", "check-a", "http", "https://example.com", "", 30)
+	runtime := NewRuntime([]string{check.ID}, []string{"probe-a"})
+	at := time.Date(2026, time.April, 8, 12, 0, 0, 0, time.UTC)
+	timings := proto.HTTPTimings{DNS: 40 * time.Millisecond, Connect: 10 * time.Millisecond, TTFB: 200 * time.Millisecond}
+
+	if err := applyResultForTest(runtime, st, check, proto.CheckResult{
+		CheckID: check.ID, ProbeID: "probe-a", Up: true, Timestamp: at, Timings: &timings,
+	}); err != nil {
+		t.Fatalf("apply result: %v", err)
+	}
+
+	state, err := runtime.CheckSnapshot(check.ID, "probe-a")
+	if err != nil {
+		t.Fatalf("CheckSnapshot() error = %v", err)
+	}
+	if state.LastTimings != timings {
+		t.Fatalf("LastTimings = %+v, want %+v", state.LastTimings, timings)
+	}
+	if got := st.persistedWrites[0].CheckStateWrites[0].LastTimings; got != timings {
+		t.Fatalf("persisted LastTimings = %+v, want %+v", got, timings)
+	}
+
+	// A later result without phases must not keep showing the old ones.
+	if err := applyResultForTest(runtime, st, check, proto.CheckResult{
+		CheckID: check.ID, ProbeID: "probe-a", Up: true, Timestamp: at.Add(30 * time.Second),
+	}); err != nil {
+		t.Fatalf("apply result: %v", err)
+	}
+	state, err = runtime.CheckSnapshot(check.ID, "probe-a")
+	if err != nil {
+		t.Fatalf("CheckSnapshot() error = %v", err)
+	}
+	if !state.LastTimings.IsZero() {
+		t.Fatalf("LastTimings = %+v, want zero", state.LastTimings)
+	}
+}
+
+func TestApplyResultReportsProbableCauseInIncidentPayload(t *testing.T) {
+	st := &fakeResultStore{}
+	check := testObservedCheck("00000000-0000-0000-0000-000000000110", "check-a", "http", "https://example.com", "https://hooks.example.com/wacht", 30)
+	checkID := check.ID
+	runtime := NewRuntime([]string{checkID}, []string{"probe-a", "probe-b", "probe-c"})
+	at := time.Date(2026, time.April, 8, 12, 0, 0, 0, time.UTC)
+
+	var results []proto.CheckResult
+	for i, probeID := range []string{"probe-a", "probe-b", "probe-c", "probe-a", "probe-b", "probe-c"} {
+		results = append(results, proto.CheckResult{CheckID: checkID, ProbeID: probeID, Up: true, Timestamp: at.Add(time.Duration(i) * time.Second)})
+	}
+	down := map[string]proto.ErrorKind{"probe-a": proto.ErrorKindDNS, "probe-b": proto.ErrorKindDNS, "probe-c": proto.ErrorKindTimeout}
+	for i, probeID := range []string{"probe-a", "probe-b", "probe-c", "probe-a", "probe-b", "probe-c", "probe-a"} {
+		results = append(results, proto.CheckResult{
+			CheckID: checkID, ProbeID: probeID, Up: false, Error: "failed", ErrorKind: down[probeID], Timestamp: at.Add(time.Duration(10+i) * time.Second),
+		})
+	}
+	applyResultSequence(t, runtime, st, check, results)
+
+	quorum, err := runtime.QuorumSnapshot(checkID)
+	if err != nil {
+		t.Fatalf("QuorumSnapshot() error = %v", err)
+	}
+	if !quorum.IncidentOpen || quorum.ProbableCause != proto.ErrorKindDNS {
+		t.Fatalf("quorum = %+v, want open incident with dns cause", quorum)
+	}
+
+	var payload alert.AlertPayload
+	for _, write := range st.persistedWrites {
+		if write.IncidentNotification != nil && !write.ResolveIncident {
+			if err := json.Unmarshal(write.IncidentNotification.Payload, &payload); err != nil {
+				t.Fatalf("decode payload: %v", err)
+			}
+			if write.ProbableCauseCheckID != checkID || write.ProbableCause != string(proto.ErrorKindDNS) {
+				t.Fatalf("opening write cause = %q for %q, want dns for the incident", write.ProbableCause, write.ProbableCauseCheckID)
+			}
+		}
+	}
+	if payload.Status != "down" || payload.ProbableCause != string(proto.ErrorKindDNS) {
+		t.Fatalf("payload = %+v, want down with probable_cause dns", payload)
+	}
+	if got := st.persistedWrites[len(st.persistedWrites)-1].CheckStateWrites[0].LastErrorKind; got != string(proto.ErrorKindDNS) {
+		t.Fatalf("persisted LastErrorKind = %q, want dns", got)
+	}
+
+	// The stored cause follows the quorum while the incident stays open.
+	st.persistedWrites = nil
+	applyResultSequence(t, runtime, st, check, []proto.CheckResult{
+		{CheckID: checkID, ProbeID: "probe-b", Up: false, Error: "failed", ErrorKind: proto.ErrorKindTimeout, Timestamp: at.Add(30 * time.Second)},
+	})
+	last := st.persistedWrites[len(st.persistedWrites)-1]
+	if last.ProbableCauseCheckID != checkID || last.ProbableCause != string(proto.ErrorKindTimeout) {
+		t.Fatalf("cause write = %q for %q, want timeout for the open incident", last.ProbableCause, last.ProbableCauseCheckID)
+	}
+}
+
+func TestApplyResultAttachesEvidenceToFailedResults(t *testing.T) {
+	st := &fakeResultStore{}
+	check := testObservedCheck("00000000-0000-0000-0000-000000000111", "check-a", "http", "https://example.com", "", 30)
+	runtime := NewRuntime([]string{check.ID}, []string{"probe-a"})
+	at := time.Date(2026, time.April, 8, 12, 0, 0, 0, time.UTC)
+	evidence := proto.HTTPEvidence{Status: "HTTP/1.1 502 Bad Gateway", Body: "upstream down", RemoteAddr: "203.0.113.7:443"}
+
+	applyResultSequence(t, runtime, st, check, []proto.CheckResult{
+		{CheckID: check.ID, ProbeID: "probe-a", Up: false, Error: "unexpected status code: 502", Timestamp: at, Evidence: &evidence},
+		{CheckID: check.ID, ProbeID: "probe-a", Up: false, Error: "timeout", Timestamp: at.Add(30 * time.Second)},
+	})
+
+	writes := st.persistedWrites[0].EvidenceWrites
+	if len(writes) != 1 {
+		t.Fatalf("evidence writes = %d, want 1", len(writes))
+	}
+	if writes[0].CheckID != check.ID || writes[0].ProbeID != "probe-a" || !writes[0].CapturedAt.Equal(at) || writes[0].Evidence.Status != evidence.Status {
+		t.Fatalf("evidence write = %+v, want probe-a 502 snapshot at %s", writes[0], at)
+	}
+	if got := len(st.persistedWrites[1].EvidenceWrites); got != 0 {
+		t.Fatalf("evidence writes without evidence = %d, want 0", got)
+	}
+}
+
+func TestApplyResultAttachesEarlierPathsWhenIncidentOpens(t *testing.T) {
+	st := &fakeResultStore{}
+	check := testObservedCheck("00000000-0000-0000-0000-000000000112", "check-a", "tcp", "example.com:443", "", 30)
+	checkID := check.ID
+	runtime := NewRuntime([]string{checkID}, []string{"probe-a", "probe-b"})
+	at := time.Date(2026, time.April, 8, 12, 0, 0, 0, time.UTC)
+	pathA := &proto.NetworkPath{Target: "203.0.113.7:443", Hops: []proto.PathHop{{TTL: 1, Addr: "192.0.2.1"}, {TTL: 2}}}
+	pathB := &proto.NetworkPath{Target: "203.0.113.7:443", Hops: []proto.PathHop{{TTL: 1, Addr: "198.51.100.1"}}}
+
+	applyResultSequence(t, runtime, st, check, []proto.CheckResult{
+		{CheckID: checkID, ProbeID: "probe-a", Up: true, Timestamp: at},
+		{CheckID: checkID, ProbeID: "probe-b", Up: true, Timestamp: at.Add(time.Second)},
+		{CheckID: checkID, ProbeID: "probe-a", Up: true, Timestamp: at.Add(2 * time.Second)},
+		{CheckID: checkID, ProbeID: "probe-b", Up: true, Timestamp: at.Add(3 * time.Second)},
+		{CheckID: checkID, ProbeID: "probe-a", Up: false, Error: "timeout", Timestamp: at.Add(4 * time.Second), Path: pathA},
+		{CheckID: checkID, ProbeID: "probe-b", Up: false, Error: "timeout", Timestamp: at.Add(5 * time.Second), Path: pathB},
+		{CheckID: checkID, ProbeID: "probe-a", Up: false, Error: "timeout", Timestamp: at.Add(6 * time.Second)},
+		{CheckID: checkID, ProbeID: "probe-b", Up: false, Error: "timeout", Timestamp: at.Add(7 * time.Second)},
+		{CheckID: checkID, ProbeID: "probe-a", Up: false, Error: "timeout", Timestamp: at.Add(8 * time.Second)},
+	})
+
+	traced := st.persistedWrites[4].EvidenceWrites
+	if len(traced) != 1 || traced[0].Path != pathA || traced[0].Evidence.Status != "" {
+		t.Fatalf("traced result evidence = %+v, want probe-a path only", traced)
+	}
+	openWrite := st.persistedWrites[len(st.persistedWrites)-1]
+	if openWrite.IncidentCheckID != checkID || openWrite.ResolveIncident {
+		t.Fatalf("last write = %+v, want incident opened", openWrite)
+	}
+	// Both paths were traced before the incident existed, so both are
+	// attached when it opens.
+	if len(openWrite.EvidenceWrites) != 2 {
+		t.Fatalf("opening evidence writes = %+v, want both probes' paths", openWrite.EvidenceWrites)
+	}
+	if got := openWrite.EvidenceWrites[0]; got.ProbeID != "probe-a" || got.Path != pathA || !got.CapturedAt.Equal(at.Add(4*time.Second)) {
+		t.Fatalf("opening evidence write = %+v, want probe-a path captured at %s", got, at.Add(4*time.Second))
+	}
+	if got := openWrite.EvidenceWrites[1]; got.ProbeID != "probe-b" || got.Path != pathB || !got.CapturedAt.Equal(at.Add(5*time.Second)) {
+		t.Fatalf("opening evidence write = %+v, want probe-b path captured at %s", got, at.Add(5*time.Second))
+	}
+
+	applyResultSequence(t, runtime, st, check, []proto.CheckResult{
+		{CheckID: checkID, ProbeID: "probe-b", Up: true, Timestamp: at.Add(9 * time.Second)},
+	})
+	state, err := runtime.CheckSnapshot(checkID, "probe-b")
+	if err != nil {
+		t.Fatalf("CheckSnapshot() error = %v", err)
+	}
+	if state.LastPath != nil {
+		t.Fatalf("LastPath after up = %+v, want nil", state.LastPath)
+	}
+}
+
+func TestApplyResultAttachesEarlierResponsesWhenIncidentOpens(t *testing.T) {
+	st := &fakeResultStore{}
+	check := testObservedCheck("00000000-0000-0000-0000-000000000113", "check-a", "http", "https://example.com", "", 30)
+	checkID := check.ID
+	runtime := NewRuntime([]string{checkID}, []string{"probe-a", "probe-b"})
+	at := time.Date(2026, time.April, 8, 12, 0, 0, 0, time.UTC)
+	evidenceA := &proto.HTTPEvidence{Status: "HTTP/1.1 502 Bad Gateway", Body: "upstream down"}
+	evidenceB := &proto.HTTPEvidence{Status: "HTTP/1.1 503 Service Unavailable", Body: "maintenance"}
+
+	applyResultSequence(t, runtime, st, check, []proto.CheckResult{
+		{CheckID: checkID, ProbeID: "probe-a", Up: true, Timestamp: at},
+		{CheckID: checkID, ProbeID: "probe-b", Up: true, Timestamp: at.Add(time.Second)},
+		{CheckID: checkID, ProbeID: "probe-a", Up: true, Timestamp: at.Add(2 * time.Second)},
+		{CheckID: checkID, ProbeID: "probe-b", Up: true, Timestamp: at.Add(3 * time.Second)},
+		{CheckID: checkID, ProbeID: "probe-a", Up: false, Error: "unexpected status code: 502", Timestamp: at.Add(4 * time.Second), Evidence: evidenceA},
+		{CheckID: checkID, ProbeID: "probe-b", Up: false, Error: "unexpected status code: 503", Timestamp: at.Add(5 * time.Second), Evidence: evidenceB},
+		{CheckID: checkID, ProbeID: "probe-a", Up: false, Error: "timeout", Timestamp: at.Add(6 * time.Second)},
+		{CheckID: checkID, ProbeID: "probe-b", Up: false, Error: "unexpected status code: 503", Timestamp: at.Add(7 * time.Second), Evidence: evidenceB},
+		{CheckID: checkID, ProbeID: "probe-a", Up: false, Error: "unexpected status code: 502", Timestamp: at.Add(8 * time.Second), Evidence: evidenceA},
+	})
+
+	openWrite := st.persistedWrites[len(st.persistedWrites)-1]
+	if openWrite.IncidentCheckID != checkID || openWrite.ResolveIncident {
+		t.Fatalf("last write = %+v, want incident opened", openWrite)
+	}
+	// probe-a's response from the opening result is in the write once;
+	// probe-b's latest came before the incident and is attached with it.
+	if len(openWrite.EvidenceWrites) != 2 {
+		t.Fatalf("opening evidence writes = %+v, want the opening result and probe-b's earlier response", openWrite.EvidenceWrites)
+	}
+	if got := openWrite.EvidenceWrites[0]; got.ProbeID != "probe-a" || !got.CapturedAt.Equal(at.Add(8*time.Second)) {
+		t.Fatalf("opening evidence write = %+v, want probe-a's opening result", got)
+	}
+	if got := openWrite.EvidenceWrites[1]; got.ProbeID != "probe-b" || got.Evidence.Status != evidenceB.Status || !got.CapturedAt.Equal(at.Add(7*time.Second)) {
+		t.Fatalf("opening evidence write = %+v, want probe-b's 503 captured at %s", got, at.Add(7*time.Second))
+	}
+
+	applyResultSequence(t, runtime, st, check, []proto.CheckResult{
+		{CheckID: checkID, ProbeID: "probe-a", Up: true, Timestamp: at.Add(9 * time.Second)},
+	})
+	state, err := runtime.CheckSnapshot(checkID, "probe-a")
+	if err != nil {
+		t.Fatalf("CheckSnapshot() error = %v", err)
+	}
+	if state.LastEvidence != nil {
+		t.Fatalf("LastEvidence after up = %+v, want nil", state.LastEvidence)
+	}
+}
+
 func TestApplyResultBatchRollsBackRuntimeWhenBatchPersistFails(t *testing.T) {
 	persistErr := errors.New("batch persist failed")
 	st := &fakeResultStore{
@@ -318,7 +566,7 @@ func TestApplyResultBatchRollsBackRuntimeWhenBatchPersistFails(t *testing.T) {
 	runtime := NewRuntime([]string{checkID}, []string{"probe-a", "probe-b"})
 	at := time.Date(2026, time.April, 8, 12, 0, 0, 0, time.UTC)
 
-	err := ApplyResultBatch(runtime, st, []ObservedResult{
+	_, err := ApplyResultBatch(runtime, st, []ObservedResult{
 		{
 			Check:  check,
 			Result: proto.CheckResult{CheckID: checkID, CheckName: "check-a", ProbeID: "probe-a", Up: false, Error: "timeout", Timestamp: at},
@@ -344,3 +592,86 @@ func TestApplyResultBatchRollsBackRuntimeWhenBatchPersistFails(t *testing.T) {
 		t.Fatalf("quorum state = %q, want %q", quorum.State, QuorumStatePending)
 	}
 }
+
+func TestApplyResultCountsDegradedProbeFailuresAsErrors(t *testing.T) {
+	st := &fakeResultStore{}
+	check := testObservedCheck("00000000-0000-0000-0000-000000000108", "check-a", "http", "https://example.com", "https://hooks.example.com/wacht", 30)
+	checkID := check.ID
+	runtime := NewRuntime([]string{checkID}, []string{"probe-a", "probe-b"})
+	at := time.Date(2026, time.April, 8, 12, 0, 0, 0, time.UTC)
+
+	results := []proto.CheckResult{
+		{CheckID: checkID, CheckName: "check-a", ProbeID: "probe-a", Up: true, Timestamp: at},
+		{CheckID: checkID, CheckName: "check-a", ProbeID: "probe-b", Up: true, Timestamp: at.Add(time.Second)},
+		{CheckID: checkID, CheckName: "check-a", ProbeID: "probe-a", Up: true, Timestamp: at.Add(2 * time.Second)},
+		{CheckID: checkID, CheckName: "check-a", ProbeID: "probe-b", Up: true, Timestamp: at.Add(3 * time.Second)},
+		{CheckID: checkID, CheckName: "check-a", ProbeID: "probe-a", Up: false, Error: "timeout", ProbeDegraded: true, Timestamp: at.Add(4 * time.Second)},
+		{CheckID: checkID, CheckName: "check-a", ProbeID: "probe-b", Up: false, Error: "timeout", ProbeDegraded: true, Timestamp: at.Add(5 * time.Second)},
+		{CheckID: checkID, CheckName: "check-a", ProbeID: "probe-a", Up: false, Error: "timeout", ProbeDegraded: true, Timestamp: at.Add(6 * time.Second)},
+		{CheckID: checkID, CheckName: "check-a", ProbeID: "probe-b", Up: false, Error: "timeout", ProbeDegraded: true, Timestamp: at.Add(7 * time.Second)},
+	}
+	applyResultSequence(t, runtime, st, check, results)
+
+	quorum, err := runtime.QuorumSnapshot(checkID)
+	if err != nil {
+		t.Fatalf("QuorumSnapshot() error = %v", err)
+	}
+	if quorum.State == QuorumStateDown || quorum.IncidentOpen {
+		t.Fatalf("quorum = %+v, want no down verdict from degraded probes", quorum)
+	}
+	for _, write := range st.persistedWrites {
+		if write.IncidentCheckID != "" {
+			t.Fatalf("incident write = %+v, want none", write)
+		}
+	}
+
+	state, err := runtime.CheckSnapshot(checkID, "probe-a")
+	if err != nil {
+		t.Fatalf("CheckSnapshot() error = %v", err)
+	}
+	if state.State != CheckStateError {
+		t.Fatalf("check state = %q, want %q", state.State, CheckStateError)
+	}
+	if state.LastError != "timeout" {
+		t.Fatalf("LastError = %q, want timeout", state.LastError)
+	}
+	if !state.LastResultAt.Equal(at.Add(6 * time.Second)) {
+		t.Fatalf("LastResultAt = %s, want %s", state.LastResultAt, at.Add(6*time.Second))
+	}
+}
+
+func TestApplyResultCountsFailuresFromErroredProbeAsErrors(t *testing.T) {
+	st := &fakeResultStore{}
+	check := testObservedCheck("00000000-0000-0000-0000-000000000109", "check-a", "http", "https://example.com", "", 30)
+	checkID := check.ID
+	runtime := NewRuntime([]string{checkID}, []string{"probe-a"})
+	at := time.Date(2026, time.April, 8, 12, 0, 0, 0, time.UTC)
+
+	if err := ApplyHeartbeat(runtime, &fakeHeartbeatStore{}, "probe-a", at, "all 1 canaries failed"); err != nil {
+		t.Fatalf("ApplyHeartbeat() error = %v", err)
+	}
+	applyResultSequence(t, runtime, st, check, []proto.CheckResult{
+		{CheckID: checkID, CheckName: "check-a", ProbeID: "probe-a", Up: false, Error: "timeout", Timestamp: at.Add(time.Second)},
+	})
+
+	state, err := runtime.CheckSnapshot(checkID, "probe-a")
+	if err != nil {
+		t.Fatalf("CheckSnapshot() error = %v", err)
+	}
+	if state.State != CheckStateError {
+		t.Fatalf("check state = %q, want %q", state.State, CheckStateError)
+	}
+
+	// Successes still count while the probe is degraded.
+	applyResultSequence(t, runtime, st, check, []proto.CheckResult{
+		{CheckID: checkID, CheckName: "check-a", ProbeID: "probe-a", Up: true, Timestamp: at.Add(2 * time.Second)},
+		{CheckID: checkID, CheckName: "check-a", ProbeID: "probe-a", Up: true, Timestamp: at.Add(3 * time.Second)},
+	})
+	state, err = runtime.CheckSnapshot(checkID, "probe-a")
+	if err != nil {
+		t.Fatalf("CheckSnapshot() error = %v", err)
+	}
+	if state.State != CheckStateUp {
+		t.Fatalf("check state = %q, want %q", state.State, CheckStateUp)
+	}
+}
@@ -19,9 +19,21 @@ var (
 
 // Runtime owns current monitoring truth in memory.
 type Runtime struct {
-	mu      sync.RWMutex
-	probes  map[string]*ProbeMachine
-	quorums map[string]*QuorumMachine
+	mu            sync.RWMutex
+	probes        map[string]*ProbeMachine
+	quorums       map[string]*QuorumMachine
+	notifications NotificationSettings
+	fleet         fleetState
+}
+
+// NotificationSettings carries server-wide context rendered into webhook
+// payloads.
+type NotificationSettings struct {
+	// ServerURL is the public base URL of this Wacht server, included in v2
+	// payloads so receivers can link back to the dashboard.
+	ServerURL string
+	// AdminWebhook receives probe fleet health alerts. Empty disables them.
+	AdminWebhook string
 }
 
 // NewRuntime creates runtime state for the active checks and known probes.
@@ -48,6 +60,14 @@ func NewRuntime(checkIDs, probeIDs []string) *Runtime {
 	return r
 }
 
+// SetNotificationSettings replaces the context used when rendering webhook
+// payloads for future transitions.
+func (r *Runtime) SetNotificationSettings(settings NotificationSettings) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifications = settings
+}
+
 // ProbeSnapshot returns the current runtime state of one probe.
 func (r *Runtime) ProbeSnapshot(probeID string) (ProbeRuntimeState, error) {
 	r.mu.RLock()
@@ -78,6 +98,29 @@ func (r *Runtime) CheckSnapshot(checkID, probeID string) (CheckExecState, error)
 	return check, nil
 }
 
+// CheckSnapshots returns the runtime state of every probe assigned to one
+// check, ordered by probe ID. Unknown checks have no assignments.
+func (r *Runtime) CheckSnapshots(checkID string) []CheckExecState {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	quorum, ok := r.quorums[checkID]
+	if !ok {
+		return nil
+	}
+	probeIDs := make([]string, 0, len(quorum.checks))
+	for probeID := range quorum.checks {
+		probeIDs = append(probeIDs, probeID)
+	}
+	sort.Strings(probeIDs)
+
+	out := make([]CheckExecState, 0, len(probeIDs))
+	for _, probeID := range probeIDs {
+		out = append(out, quorum.checks[probeID].Snapshot())
+	}
+	return out
+}
+
 // QuorumSnapshot returns the current aggregate runtime state of one check.
 func (r *Runtime) QuorumSnapshot(checkID string) (CheckQuorumState, error) {
 	r.mu.RLock()
@@ -109,6 +152,20 @@ func (r *Runtime) AddProbe(probeID string) ProbeRuntimeState {
 	return r.addProbeLocked(probeID)
 }
 
+// AddOwnedProbe is AddProbe for a user's private probe, recording its owner.
+func (r *Runtime) AddOwnedProbe(probeID string, ownerUserID int64) ProbeRuntimeState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.addProbeLocked(probeID)
+	probe, ok := r.probes[probeID]
+	if !ok {
+		return ProbeRuntimeState{}
+	}
+	probe.state.OwnerUserID = ownerUserID
+	return probe.Snapshot()
+}
+
 func (r *Runtime) addProbeLocked(probeID string) ProbeRuntimeState {
 	if probeID == "" {
 		return ProbeRuntimeState{}
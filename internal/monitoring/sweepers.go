@@ -24,7 +24,8 @@ type probeSweepRollback struct {
 
 // SweepProbes expires probe heartbeats that are older than offlineAfter and
 // clears their in-memory votes. Probe liveness recovery comes from the bounded
-// current-state snapshot in the store, so no append-only log write is needed.
+// current-state snapshot in the store, so no append-only log write is needed;
+// only admin fleet health notifications, when configured, are persisted.
 func SweepProbes(runtime *Runtime, st sweeperStore, now time.Time, offlineAfter time.Duration) (int, error) {
 	if runtime == nil {
 		return 0, fmt.Errorf("monitoring: runtime is required")
@@ -74,6 +75,21 @@ func SweepProbes(runtime *Runtime, st sweeperStore, now time.Time, offlineAfter
 			return expired, err
 		}
 
+		notifications, previousFleet, err := runtime.fleetNotificationsLocked(probeID, false, sweptAt)
+		if err != nil {
+			runtime.restoreProbeSweepRollbackLocked(probeID, rollback)
+			runtime.mu.Unlock()
+			return expired, err
+		}
+		if len(notifications) > 0 {
+			if _, err := st.PersistMonitoringWrite(store.MonitoringWrite{FleetNotifications: notifications}); err != nil {
+				runtime.fleet = previousFleet
+				runtime.restoreProbeSweepRollbackLocked(probeID, rollback)
+				runtime.mu.Unlock()
+				return expired, err
+			}
+		}
+
 		runtime.mu.Unlock()
 		expired++
 	}
@@ -155,14 +171,17 @@ func SweepChecks(runtime *Runtime, st sweeperStore, now time.Time) (int, error)
 		write := store.MonitoringWrite{
 			CheckStateWrites: []store.CheckStateWrite{
 				{
-					CheckID:      assignment.CheckID,
-					ProbeID:      assignment.ProbeID,
-					LastResultAt: check.state.LastResultAt,
-					LastOutcome:  string(check.state.LastOutcome),
-					StreakLen:    check.state.StreakLen,
-					ExpiresAt:    check.state.ExpiresAt,
-					State:        string(check.state.State),
-					LastError:    check.state.LastError,
+					CheckID:       assignment.CheckID,
+					ProbeID:       assignment.ProbeID,
+					LastResultAt:  check.state.LastResultAt,
+					LastOutcome:   string(check.state.LastOutcome),
+					StreakLen:     check.state.StreakLen,
+					ExpiresAt:     check.state.ExpiresAt,
+					State:         string(check.state.State),
+					LastError:     check.state.LastError,
+					LastErrorKind: string(check.state.LastErrorKind),
+					LastAttempts:  check.state.LastAttempts,
+					LastTimings:   check.state.LastTimings,
 				},
 			},
 		}
@@ -176,7 +195,7 @@ func SweepChecks(runtime *Runtime, st sweeperStore, now time.Time) (int, error)
 				return expired, err
 			}
 			if checkDef != nil {
-				write, err = monitoringWriteForCheckEvent(*checkDef, quorum, previousQuorum, update.Quorum, write)
+				write, err = monitoringWriteForCheckEvent(*checkDef, quorum, previousQuorum, update.Quorum, runtime.notifications, write)
 				if err != nil {
 					check.state = previousCheck
 					quorum.state = previousQuorum
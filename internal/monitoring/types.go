@@ -1,6 +1,10 @@
 package monitoring
 
-import "time"
+import (
+	"time"
+
+	"github.com/tmater/wacht/internal/proto"
+)
 
 // ProbeState describes whether a probe is currently usable for monitoring.
 type ProbeState string
@@ -37,6 +41,10 @@ type ProbeRuntimeState struct {
 	State           ProbeState
 	LastHeartbeatAt *time.Time
 	LastError       string
+	LastResultSeq   int64
+	// OwnerUserID is non-zero for a user's private probe, which is left out
+	// of the admin fleet health alerts.
+	OwnerUserID int64
 }
 
 // CheckExecState stores the current runtime facts for one (check, probe) pair.
@@ -49,6 +57,25 @@ type CheckExecState struct {
 	ExpiresAt    time.Time
 	State        CheckState
 	LastError    string
+	// LastErrorKind classifies LastError, or is empty when the probe did not
+	// classify it.
+	LastErrorKind proto.ErrorKind
+	// LastAttempts is how many runs the probe needed for its last result,
+	// or zero when the probe does not report attempts.
+	LastAttempts int
+	// LastTimings holds the HTTP phase breakdown of the probe's last result,
+	// or the zero value when the result carried none.
+	LastTimings proto.HTTPTimings
+	// LastPath is the network path the probe traced when its current failing
+	// streak began, kept in memory so it can be attached to an incident that
+	// opens later in the streak. It is nil while the check is up.
+	LastPath   *proto.NetworkPath
+	LastPathAt time.Time
+	// LastEvidence is the response the probe captured on its latest failure
+	// that carried one, kept like LastPath so it reaches an incident that
+	// opens later in the streak. It is nil while the check is up.
+	LastEvidence   *proto.HTTPEvidence
+	LastEvidenceAt time.Time
 }
 
 // CheckQuorumState is the aggregate runtime state of one check.
@@ -57,6 +84,9 @@ type CheckQuorumState struct {
 	State           QuorumState
 	LastStableState QuorumState
 	IncidentOpen    bool
+	// ProbableCause is the most common error kind among the probes voting
+	// down, or empty when no probe votes down with a classified error.
+	ProbableCause proto.ErrorKind
 }
 
 // clone returns a detached copy of the probe runtime state.
@@ -9,20 +9,30 @@ import (
 	"strings"
 )
 
-// ValidateCheckTarget checks target syntax and rejects disallowed destinations.
-func ValidateCheckTarget(ctx context.Context, checkType, target string, policy Policy) error {
-	switch NormalizeCheckType(checkType) {
+// ValidateCheckTarget checks target syntax and the tcp-expect exchange, and
+// rejects disallowed destinations. exchange must be zero for other types.
+func ValidateCheckTarget(ctx context.Context, checkType, target string, exchange TCPExchange, policy Policy) error {
+	checkType = NormalizeCheckType(checkType)
+	if checkType != "tcp-expect" && !exchange.IsZero() {
+		return fmt.Errorf("tls, send, and expect are only supported for tcp-expect checks")
+	}
+	switch checkType {
 	case "http":
 		u, err := ParseHTTPURLTarget(target)
 		if err != nil {
 			return err
 		}
 		return policy.ValidateHost(ctx, u.Hostname())
-	case "tcp":
+	case "tcp", "tcp-expect":
 		host, _, err := ParseTCPAddressTarget(target)
 		if err != nil {
 			return err
 		}
+		if checkType == "tcp-expect" {
+			if err := exchange.Validate(); err != nil {
+				return err
+			}
+		}
 		return policy.ValidateHost(ctx, host)
 	case "dns":
 		host, err := ParseDNSHostnameTarget(target)
@@ -15,6 +15,20 @@ type Policy struct {
 	AllowPrivateTargets bool
 }
 
+// PolicyError reports a destination the policy does not allow, as opposed to
+// one that could not be reached.
+type PolicyError struct {
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return e.Reason
+}
+
+func policyErrorf(format string, args ...any) error {
+	return &PolicyError{Reason: fmt.Sprintf(format, args...)}
+}
+
 // ValidateLiteralHost checks host-level restrictions without doing DNS lookups.
 func (p Policy) ValidateLiteralHost(host string) error {
 	host = strings.TrimSpace(host)
@@ -22,7 +36,7 @@ func (p Policy) ValidateLiteralHost(host string) error {
 		return fmt.Errorf("host is required")
 	}
 	if strings.EqualFold(host, "localhost") && !p.AllowPrivateTargets {
-		return fmt.Errorf("localhost is not allowed")
+		return policyErrorf("localhost is not allowed")
 	}
 	if ip := net.ParseIP(host); ip != nil {
 		return p.ValidateIP(ip)
@@ -33,10 +47,10 @@ func (p Policy) ValidateLiteralHost(host string) error {
 // ValidateIP reports whether ip is allowed by policy.
 func (p Policy) ValidateIP(ip net.IP) error {
 	if ip == nil {
-		return fmt.Errorf("destination is not allowed")
+		return policyErrorf("destination is not allowed")
 	}
 	if ip.IsUnspecified() || ip.IsMulticast() {
-		return fmt.Errorf("destination %s is not allowed", ip.String())
+		return policyErrorf("destination %s is not allowed", ip.String())
 	}
 	if p.AllowPrivateTargets {
 		return nil
@@ -45,7 +59,7 @@ func (p Policy) ValidateIP(ip net.IP) error {
 		ip.IsPrivate() ||
 		ip.IsLinkLocalUnicast() ||
 		ip.IsLinkLocalMulticast() {
-		return fmt.Errorf("destination %s is not allowed", ip.String())
+		return policyErrorf("destination %s is not allowed", ip.String())
 	}
 	return nil
 }
@@ -69,7 +83,7 @@ func (p Policy) ResolveHost(ctx context.Context, host string) ([]net.IPAddr, err
 	}
 	for _, ip := range ips {
 		if err := p.ValidateIP(ip.IP); err != nil {
-			return nil, fmt.Errorf("destination %q resolved to disallowed address %s", host, ip.IP.String())
+			return nil, policyErrorf("destination %q resolved to disallowed address %s", host, ip.IP.String())
 		}
 	}
 	return ips, nil
@@ -2,6 +2,7 @@ package network
 
 import (
 	"context"
+	"errors"
 	"testing"
 )
 
@@ -14,9 +15,14 @@ func TestPolicyValidateLiteralHost_RejectsLocalhost(t *testing.T) {
 
 func TestPolicyValidateLiteralHost_RejectsPrivateIP(t *testing.T) {
 	policy := Policy{}
-	if err := policy.ValidateLiteralHost("127.0.0.1"); err == nil {
+	err := policy.ValidateLiteralHost("127.0.0.1")
+	if err == nil {
 		t.Fatal("expected private IP literal to be rejected")
 	}
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("error = %T, want *PolicyError", err)
+	}
 }
 
 func TestPolicyValidateLiteralHost_AllowsPrivateIPWhenConfigured(t *testing.T) {
@@ -0,0 +1,90 @@
+package network
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Expect modes for TCPExchange.ExpectMode.
+const (
+	ExpectContains = "contains" // the response contains Expect as text
+	ExpectRegex    = "regex"    // the response matches Expect as a Go regexp
+	ExpectBytes    = "bytes"    // the response contains the hex-encoded bytes in Expect
+)
+
+const (
+	// MaxTCPPayloadBytes caps TCPExchange.Send and TCPExchange.Expect.
+	MaxTCPPayloadBytes = 4 << 10
+	// MaxTCPReadTimeout caps TCPExchange.ReadTimeout.
+	MaxTCPReadTimeout = 30 * time.Second
+)
+
+// TCPExchange is what a tcp-expect check does once connected: wrap the
+// connection in TLS, send a payload, and wait for a response matching Expect.
+// Each step is optional, but at least one is required.
+type TCPExchange struct {
+	TLS        bool
+	Send       string
+	Expect     string
+	ExpectMode string // ExpectContains when empty
+	// ReadTimeout bounds the wait for the expected response. Zero leaves it
+	// to the check timeout.
+	ReadTimeout time.Duration
+}
+
+// IsZero reports whether e asks for nothing beyond a connect.
+func (e TCPExchange) IsZero() bool {
+	return e == TCPExchange{}
+}
+
+// Validate rejects exchanges a probe could not run.
+func (e TCPExchange) Validate() error {
+	if !e.TLS && e.Send == "" && e.Expect == "" {
+		return fmt.Errorf("tcp-expect check requires tls, send, or expect")
+	}
+	if len(e.Send) > MaxTCPPayloadBytes {
+		return fmt.Errorf("send must be at most %d bytes", MaxTCPPayloadBytes)
+	}
+	if len(e.Expect) > MaxTCPPayloadBytes {
+		return fmt.Errorf("expect must be at most %d bytes", MaxTCPPayloadBytes)
+	}
+	if e.Expect == "" && (e.ExpectMode != "" || e.ReadTimeout != 0) {
+		return fmt.Errorf("expect_mode and read_timeout_ms require expect")
+	}
+	if e.ReadTimeout < 0 || e.ReadTimeout > MaxTCPReadTimeout {
+		return fmt.Errorf("read_timeout_ms must be between 0 and %d", MaxTCPReadTimeout.Milliseconds())
+	}
+	_, err := e.Matcher()
+	return err
+}
+
+// Matcher returns a function reporting whether the response read so far
+// satisfies Expect, or nil when the exchange expects no response.
+func (e TCPExchange) Matcher() (func([]byte) bool, error) {
+	if e.Expect == "" {
+		return nil, nil
+	}
+	switch e.ExpectMode {
+	case "", ExpectContains:
+		want := []byte(e.Expect)
+		return func(got []byte) bool { return bytes.Contains(got, want) }, nil
+	case ExpectRegex:
+		re, err := regexp.Compile(e.Expect)
+		if err != nil {
+			return nil, fmt.Errorf("expect: invalid regex: %w", err)
+		}
+		return re.Match, nil
+	case ExpectBytes:
+		want, err := hex.DecodeString(strings.Join(strings.Fields(e.Expect), ""))
+		if err != nil || len(want) == 0 {
+			return nil, fmt.Errorf("expect: bytes must be hex, such as \"2b504f4e47\"")
+		}
+		return func(got []byte) bool { return bytes.Contains(got, want) }, nil
+	default:
+		return nil, fmt.Errorf("expect_mode must be %q, %q, or %q", ExpectContains, ExpectRegex, ExpectBytes)
+	}
+}
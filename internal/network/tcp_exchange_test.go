@@ -0,0 +1,39 @@
+package network
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTCPExchangeValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		exchange TCPExchange
+		wantErr  string
+	}{
+		{name: "tls only", exchange: TCPExchange{TLS: true}},
+		{name: "send and regex", exchange: TCPExchange{Send: "stats\r\n", Expect: `STAT pid \d+`, ExpectMode: ExpectRegex}},
+		{name: "empty", exchange: TCPExchange{}, wantErr: "requires tls, send, or expect"},
+		{name: "bad regex", exchange: TCPExchange{Expect: "(", ExpectMode: ExpectRegex}, wantErr: "invalid regex"},
+		{name: "bad hex", exchange: TCPExchange{Expect: "zz", ExpectMode: ExpectBytes}, wantErr: "must be hex"},
+		{name: "unknown mode", exchange: TCPExchange{Expect: "ok", ExpectMode: "glob"}, wantErr: "expect_mode must be"},
+		{name: "mode without expect", exchange: TCPExchange{Send: "PING\r\n", ExpectMode: ExpectRegex}, wantErr: "require expect"},
+		{name: "read timeout too long", exchange: TCPExchange{Expect: "ok", ReadTimeout: time.Minute}, wantErr: "read_timeout_ms"},
+		{name: "payload too large", exchange: TCPExchange{Send: strings.Repeat("x", MaxTCPPayloadBytes+1)}, wantErr: "send must be at most"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.exchange.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+// Package probeauth derives probe signing keys and signs and verifies probe
+// requests. It sits below both the probe API client and the store, so the
+// server can store a verify key without depending on the API package.
+package probeauth
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// signatureVersion prefixes signatures so the canonical form can evolve.
+const signatureVersion = "v1="
+
+// signingKeyLabel domain-separates the signing key seed from every other value
+// derived from the probe secret, such as the stored secret hash.
+const signingKeyLabel = "wacht-probe-signing-v1"
+
+// SigningKey derives the Ed25519 key a probe signs requests with. The seed is
+// an HMAC of a fixed label keyed by the secret, so nothing the server stores
+// can be turned back into it.
+func SigningKey(secret string) ed25519.PrivateKey {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signingKeyLabel))
+	return ed25519.NewKeyFromSeed(mac.Sum(nil))
+}
+
+// VerifyKey returns the hex public half of the secret's signing key. The server
+// stores it to check signatures; it cannot produce them.
+func VerifyKey(secret string) string {
+	return hex.EncodeToString(SigningKey(secret).Public().(ed25519.PublicKey))
+}
+
+// SignedRequest is the part of a probe request a signature covers.
+type SignedRequest struct {
+	Method string
+	// RequestURI is the path and query.
+	RequestURI string
+	Timestamp  string
+	// Nonce is unique per request, so identical requests made in the same
+	// second still carry distinct signatures.
+	Nonce       string
+	IfNoneMatch string
+	Body        []byte
+}
+
+// Sign returns the signature header value for one request: an Ed25519 signature
+// over the fields of req, with the body reduced to its SHA-256.
+func Sign(key ed25519.PrivateKey, req SignedRequest) string {
+	return signatureVersion + hex.EncodeToString(ed25519.Sign(key, req.message()))
+}
+
+// VerifySignature reports whether signature was made over req by the private
+// half of verifyKey, a hex key as returned by VerifyKey.
+func VerifySignature(verifyKey string, req SignedRequest, signature string) bool {
+	public, err := hex.DecodeString(verifyKey)
+	if err != nil || len(public) != ed25519.PublicKeySize {
+		return false
+	}
+	encoded, ok := strings.CutPrefix(signature, signatureVersion)
+	if !ok {
+		return false
+	}
+	sig, err := hex.DecodeString(encoded)
+	if err != nil {
+		return false
+	}
+	return ed25519.Verify(public, req.message(), sig)
+}
+
+func (req SignedRequest) message() []byte {
+	bodySum := sha256.Sum256(req.Body)
+	return []byte(strings.Join([]string{req.Method, req.RequestURI, req.Timestamp, req.Nonce, req.IfNoneMatch, hex.EncodeToString(bodySum[:])}, "\n"))
+}
@@ -8,4 +8,14 @@ type ProbeCheck struct {
 	Type     string `json:"type"`
 	Target   string `json:"target"`
 	Interval int    `json:"interval"`
+	// Retries is how many times the probe re-runs a failed check before
+	// reporting the failure.
+	Retries int `json:"retries,omitempty"`
+	// TLS, Send, Expect, ExpectMode, and ReadTimeoutMS are what a tcp-expect
+	// check does once connected.
+	TLS           bool   `json:"tls,omitempty"`
+	Send          string `json:"send,omitempty"`
+	Expect        string `json:"expect,omitempty"`
+	ExpectMode    string `json:"expect_mode,omitempty"`
+	ReadTimeoutMS int    `json:"read_timeout_ms,omitempty"`
 }
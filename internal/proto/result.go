@@ -1,6 +1,10 @@
 package proto
 
-import "time"
+import (
+	"sort"
+	"strings"
+	"time"
+)
 
 // CheckResult is what a probe sends to the server after running a check.
 type CheckResult struct {
@@ -13,4 +17,159 @@ type CheckResult struct {
 	Latency   time.Duration `json:"latency_ms"` // in milliseconds
 	Error     string        `json:"error,omitempty"`
 	Timestamp time.Time     `json:"timestamp"`
+	// ErrorKind classifies Error for the server. It is empty for up results
+	// and for probes that do not classify failures.
+	ErrorKind ErrorKind `json:"error_kind,omitempty"`
+	// Seq is a per-probe number that increases with every result the probe
+	// produces. The server drops results at or below the last one it accepted,
+	// so retried uploads cannot be counted twice. Zero disables the check.
+	Seq int64 `json:"seq,omitempty"`
+	// Attempts is how many times the probe ran the check for this result,
+	// including confirmation retries after a failure. AttemptErrors holds
+	// the errors of the failed attempts before the reported one. Zero means
+	// the probe does not report attempts.
+	Attempts      int      `json:"attempts,omitempty"`
+	AttemptErrors []string `json:"attempt_errors,omitempty"`
+	// ProbeDegraded reports that the probe's own canaries were failing when
+	// it produced the result, so a failure says nothing about the target.
+	ProbeDegraded bool `json:"probe_degraded,omitempty"`
+	// Timings breaks an HTTP check down into request phases. It is nil for
+	// other check types and for probes that do not report phases.
+	Timings *HTTPTimings `json:"timings,omitempty"`
+	// Evidence is what the target answered when an HTTP check failed on its
+	// status or body. It is nil for up results and for failures that got no
+	// response.
+	Evidence *HTTPEvidence `json:"evidence,omitempty"`
+	// Path is the network path to the target, traced when a TCP or HTTP
+	// check starts failing on a probe that has traceroute enabled.
+	Path *NetworkPath `json:"path,omitempty"`
+}
+
+// ErrorKind is a machine-readable class of check failure.
+type ErrorKind string
+
+const (
+	ErrorKindDNS               ErrorKind = "dns"
+	ErrorKindConnectionRefused ErrorKind = "connection_refused"
+	ErrorKindTimeout           ErrorKind = "timeout"
+	ErrorKindTLS               ErrorKind = "tls"
+	// ErrorKindAssertion means the target answered, but not as the check
+	// expects: a bad status code, missing body text, or missing address.
+	ErrorKindAssertion ErrorKind = "assertion"
+	// ErrorKindBlocked means the probe's network policy refused the
+	// destination, so the target was never contacted.
+	ErrorKindBlocked ErrorKind = "blocked"
+	ErrorKindOther   ErrorKind = "other"
+)
+
+// Known reports whether k is one of the defined error kinds.
+func (k ErrorKind) Known() bool {
+	switch k {
+	case ErrorKindDNS, ErrorKindConnectionRefused, ErrorKindTimeout, ErrorKindTLS, ErrorKindAssertion, ErrorKindBlocked, ErrorKindOther:
+		return true
+	}
+	return false
+}
+
+// HTTPTimings is the per-phase duration of one HTTP check. Phases the request
+// never reached, such as TLS for plain HTTP or DNS for an IP literal, are
+// zero. Redirect hops add to the phases they repeat.
+type HTTPTimings struct {
+	DNS      time.Duration `json:"dns_ns,omitempty"`
+	Connect  time.Duration `json:"connect_ns,omitempty"`
+	TLS      time.Duration `json:"tls_ns,omitempty"`
+	TTFB     time.Duration `json:"ttfb_ns,omitempty"` // request written to first response byte
+	Transfer time.Duration `json:"transfer_ns,omitempty"`
+}
+
+// IsZero reports whether no phase was measured.
+func (t HTTPTimings) IsZero() bool {
+	return t == HTTPTimings{}
+}
+
+// Limits that keep HTTPEvidence small enough to ship with every failed result
+// and to store with an incident.
+const (
+	MaxEvidenceBodyBytes   = 4 << 10
+	MaxEvidenceHeaders     = 16
+	MaxEvidenceHeaderBytes = 256
+)
+
+// HTTPEvidence is a bounded snapshot of the response a failed HTTP check got.
+type HTTPEvidence struct {
+	Status        string            `json:"status"` // e.g. "HTTP/1.1 503 Service Unavailable"
+	Headers       map[string]string `json:"headers,omitempty"`
+	Body          string            `json:"body,omitempty"`
+	BodyTruncated bool              `json:"body_truncated,omitempty"`
+	RemoteAddr    string            `json:"remote_addr,omitempty"` // address the probe connected to
+}
+
+// Bounded returns a copy of e cut to the evidence limits, with text that is
+// valid UTF-8 and free of NUL bytes so it can be stored as-is.
+func (e HTTPEvidence) Bounded() HTTPEvidence {
+	out := HTTPEvidence{
+		Status:        evidenceText(e.Status, MaxEvidenceHeaderBytes),
+		Body:          evidenceText(e.Body, MaxEvidenceBodyBytes),
+		BodyTruncated: e.BodyTruncated || len(e.Body) > MaxEvidenceBodyBytes,
+		RemoteAddr:    evidenceText(e.RemoteAddr, MaxEvidenceHeaderBytes),
+	}
+	if len(e.Headers) > 0 {
+		names := make([]string, 0, len(e.Headers))
+		for name := range e.Headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) > MaxEvidenceHeaders {
+			names = names[:MaxEvidenceHeaders]
+		}
+		out.Headers = make(map[string]string, len(names))
+		for _, name := range names {
+			out.Headers[evidenceText(name, MaxEvidenceHeaderBytes)] = evidenceText(e.Headers[name], MaxEvidenceHeaderBytes)
+		}
+	}
+	return out
+}
+
+func evidenceText(s string, limit int) string {
+	if len(s) > limit {
+		s = s[:limit]
+	}
+	return strings.ReplaceAll(strings.ToValidUTF8(s, "\uFFFD"), "\x00", "")
+}
+
+// MaxPathHops caps how many hops a NetworkPath may hold.
+const MaxPathHops = 32
+
+// NetworkPath is a TCP traceroute from a probe toward a check target.
+type NetworkPath struct {
+	Target  string    `json:"target"`            // ip:port the path was traced to
+	Hops    []PathHop `json:"hops,omitempty"`    // in TTL order
+	Reached bool      `json:"reached,omitempty"` // the target itself answered
+	Error   string    `json:"error,omitempty"`   // why the trace stopped early
+}
+
+// PathHop is one TTL step of a NetworkPath. Addr is empty when nothing
+// answered within the hop timeout.
+type PathHop struct {
+	TTL  int           `json:"ttl"`
+	Addr string        `json:"addr,omitempty"`
+	RTT  time.Duration `json:"rtt_ns,omitempty"`
+}
+
+// Bounded returns a copy of p with at most MaxPathHops hops and cleaned text.
+func (p NetworkPath) Bounded() NetworkPath {
+	out := NetworkPath{
+		Target:  evidenceText(p.Target, MaxEvidenceHeaderBytes),
+		Reached: p.Reached,
+		Error:   evidenceText(p.Error, MaxEvidenceHeaderBytes),
+	}
+	hops := p.Hops
+	if len(hops) > MaxPathHops {
+		hops = hops[:MaxPathHops]
+	}
+	for _, hop := range hops {
+		hop.Addr = evidenceText(hop.Addr, MaxEvidenceHeaderBytes)
+		out.Hops = append(out.Hops, hop)
+	}
+	return out
 }
@@ -0,0 +1,37 @@
+package proto
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestHTTPEvidenceBoundedCutsAndCleansText(t *testing.T) {
+	headers := make(map[string]string)
+	for i := 0; i < MaxEvidenceHeaders+4; i++ {
+		headers[fmt.Sprintf("X-Header-%02d", i)] = "v"
+	}
+	headers["X-Header-00"] = strings.Repeat("h", MaxEvidenceHeaderBytes+10)
+
+	got := HTTPEvidence{
+		Status:  "HTTP/1.1 500 Internal Server Error",
+		Headers: headers,
+		Body:    "bad\x00\xffpage" + strings.Repeat("x", MaxEvidenceBodyBytes),
+	}.Bounded()
+
+	if len(got.Headers) != MaxEvidenceHeaders {
+		t.Fatalf("headers = %d, want %d", len(got.Headers), MaxEvidenceHeaders)
+	}
+	if len(got.Headers["X-Header-00"]) != MaxEvidenceHeaderBytes {
+		t.Fatalf("header value length = %d, want %d", len(got.Headers["X-Header-00"]), MaxEvidenceHeaderBytes)
+	}
+	if !got.BodyTruncated {
+		t.Fatal("BodyTruncated = false, want true")
+	}
+	if !strings.HasPrefix(got.Body, "bad�page") || strings.Contains(got.Body, "\x00") {
+		t.Fatalf("body prefix = %q, want NUL removed and invalid UTF-8 replaced", got.Body[:12])
+	}
+	if got.Status != "HTTP/1.1 500 Internal Server Error" {
+		t.Fatalf("status = %q", got.Status)
+	}
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tmater/wacht/internal/monitoring"
+	"github.com/tmater/wacht/internal/store"
+)
+
+const (
+	// defaultProbeSecretGrace is how long a rotated-out probe secret keeps
+	// working when the rotate request does not choose a grace period.
+	defaultProbeSecretGrace = 24 * time.Hour
+	// maxProbeSecretGrace bounds how long a rotated-out secret may stay valid.
+	maxProbeSecretGrace = 30 * 24 * time.Hour
+)
+
+// adminProbeDTO is the admin API response shape for one probe credential and
+// its current runtime state.
+type adminProbeDTO struct {
+	ProbeID                  string            `json:"probe_id"`
+	Version                  string            `json:"version,omitempty"`
+	ProtocolVersion          int               `json:"protocol_version"`
+	CheckTypes               []string          `json:"check_types"`
+	Outdated                 bool              `json:"outdated"`
+	Labels                   map[string]string `json:"labels"`
+	OwnerUserID              int64             `json:"owner_user_id,omitempty"`
+	ProvisionedBy            string            `json:"provisioned_by"`
+	Status                   string            `json:"status"`
+	RegisteredAt             *string           `json:"registered_at,omitempty"`
+	LastSeenAt               *string           `json:"last_seen_at,omitempty"`
+	RevokedAt                *string           `json:"revoked_at,omitempty"`
+	PreviousSecretValidUntil *string           `json:"previous_secret_valid_until,omitempty"`
+}
+
+type rotateProbeSecretRequest struct {
+	GracePeriod string `json:"grace_period"`
+}
+
+// handleListAdminProbes returns every probe credential, including revoked
+// ones, with its version, registration, and liveness. Protected by
+// requireAdmin.
+func (h *Handler) handleListAdminProbes(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	probes, err := h.probeCredentials.ListAllProbes()
+	if err != nil {
+		logger.Error("list probes failed", "component", "admin", "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]adminProbeDTO, 0, len(probes))
+	for _, probe := range probes {
+		item := adminProbeDTO{
+			ProbeID:                  probe.ProbeID,
+			Version:                  probe.Version,
+			ProtocolVersion:          probe.ProtocolVersion,
+			CheckTypes:               probe.CheckTypes,
+			Outdated:                 probeOutdated(probe, h.minProbeVersion()),
+			Labels:                   probe.Labels,
+			OwnerUserID:              probe.OwnerUserID,
+			ProvisionedBy:            probe.ProvisionedBy,
+			Status:                   string(monitoring.ProbeStateOffline),
+			RegisteredAt:             formatOptionalTimestamp(probe.RegisteredAt),
+			LastSeenAt:               formatOptionalTimestamp(probe.LastSeenAt),
+			RevokedAt:                formatOptionalTimestamp(probe.RevokedAt),
+			PreviousSecretValidUntil: formatOptionalTimestamp(probe.PreviousSecretValidUntil),
+		}
+		if item.CheckTypes == nil {
+			item.CheckTypes = []string{}
+		}
+		if probe.RevokedAt != nil {
+			item.Status = "revoked"
+		} else if h.monitoring != nil {
+			if state, err := h.monitoring.ProbeSnapshot(probe.ProbeID); err == nil {
+				item.Status = string(state.State)
+			}
+		}
+		items = append(items, item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(items); err != nil {
+		logger.Warn("encode probes failed", "component", "admin", "err", err)
+	}
+}
+
+// handleRevokeProbe permanently disables a probe credential and removes the
+// probe from the monitoring runtime. Protected by requireAdmin.
+func (h *Handler) handleRevokeProbe(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	probeID := r.PathValue("id")
+
+	probe, err := h.probeProcessor.Revoke(probeID)
+	if err != nil {
+		if writeProcessorError(w, err) {
+			return
+		}
+		logger.Error("revoke probe failed", "component", "admin", "probe_id", probeID, "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if probe == nil {
+		http.Error(w, "probe not found", http.StatusNotFound)
+		return
+	}
+
+	h.checkSets.Notify()
+	logger.Info("probe revoked", "component", "admin", "probe_id", probeID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleRotateProbeSecret issues a new secret for a probe. The old secret
+// stays valid for the requested grace period so the probe can be
+// reconfigured without missing results. Protected by requireAdmin.
+func (h *Handler) handleRotateProbeSecret(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	probeID := r.PathValue("id")
+	var req rotateProbeSecretRequest
+	if err := decodeJSONBody(w, r, &req, maxJSONRequestBodyBytes, true); err != nil {
+		if writeProcessorError(w, err) {
+			return
+		}
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	grace, err := parseProbeSecretGrace(req.GracePeriod)
+	if err != nil {
+		writeProcessorError(w, err)
+		return
+	}
+
+	rotation, err := h.probeCredentials.RotateProbeSecret(probeID, grace)
+	if err != nil {
+		if errors.Is(err, store.ErrProbeConfigManaged) {
+			err = &conflictError{message: "probe is provisioned by server config; change its secret in the config file instead"}
+		}
+		if writeProcessorError(w, err) {
+			return
+		}
+		logger.Error("rotate probe secret failed", "component", "admin", "probe_id", probeID, "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if rotation == nil {
+		http.Error(w, "probe not found", http.StatusNotFound)
+		return
+	}
+
+	logger.Info("probe secret rotated", "component", "admin", "probe_id", probeID, "grace_period", grace)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]string{
+		"probe_id":             rotation.ProbeID,
+		"secret":               rotation.Secret,
+		"previous_valid_until": rotation.PreviousValidUntil.UTC().Format(time.RFC3339),
+	}); err != nil {
+		logger.Warn("encode rotated probe secret failed", "component", "admin", "probe_id", probeID, "err", err)
+	}
+}
+
+// parseProbeSecretGrace parses a rotate request's grace period. Blank selects
+// the default; "0s" invalidates the old secret immediately.
+func parseProbeSecretGrace(raw string) (time.Duration, error) {
+	if raw == "" {
+		return defaultProbeSecretGrace, nil
+	}
+	grace, err := time.ParseDuration(raw)
+	if err != nil || grace < 0 {
+		return 0, &badRequestError{message: "grace_period must be a non-negative duration such as 24h"}
+	}
+	if grace > maxProbeSecretGrace {
+		return 0, &badRequestError{message: fmt.Sprintf("grace_period must be at most %s", maxProbeSecretGrace)}
+	}
+	return grace, nil
+}
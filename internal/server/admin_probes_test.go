@@ -0,0 +1,149 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tmater/wacht/internal/monitoring"
+	"github.com/tmater/wacht/internal/store"
+)
+
+func TestHandleListAdminProbesIncludesRuntimeAndRevokedProbes(t *testing.T) {
+	runtime := monitoring.NewRuntime(nil, []string{"probe-1"})
+	if _, err := runtime.ReceiveHeartbeat("probe-1", time.Now()); err != nil {
+		t.Fatalf("ReceiveHeartbeat: %v", err)
+	}
+	registered := time.Date(2026, time.October, 1, 12, 0, 0, 0, time.UTC)
+	h := &Handler{
+		monitoring: runtime,
+		probeCredentials: fakeProbeCredentialStore{
+			listAllFn: func() ([]store.Probe, error) {
+				return []store.Probe{
+					{ProbeID: "probe-1", Version: "v1.2.0", ProtocolVersion: 1, ProvisionedBy: "api", RegisteredAt: &registered},
+					{ProbeID: "probe-2", ProvisionedBy: "api", RevokedAt: &registered},
+				}, nil
+			},
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	h.handleListAdminProbes(rec, httptest.NewRequest(http.MethodGet, "/api/admin/probes", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var body []adminProbeDTO
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if len(body) != 2 {
+		t.Fatalf("body = %#v, want two probes", body)
+	}
+	if body[0].Status != string(monitoring.ProbeStateOnline) || body[0].Version != "v1.2.0" || body[0].RegisteredAt == nil {
+		t.Fatalf("probe-1 = %#v, want online registered v1.2.0", body[0])
+	}
+	if body[1].Status != "revoked" || body[1].RevokedAt == nil {
+		t.Fatalf("probe-2 = %#v, want revoked", body[1])
+	}
+}
+
+func TestHandleRevokeProbeMapsResults(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		result *store.Probe
+		err    error
+		want   int
+	}{
+		{name: "revoked", result: &store.Probe{ProbeID: "probe-1"}, want: http.StatusNoContent},
+		{name: "missing", want: http.StatusNotFound},
+		{name: "config", err: &conflictError{message: "probe is provisioned by server config"}, want: http.StatusConflict},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &Handler{
+				probeProcessor: fakeProbeProcessor{
+					revokeFn: func(string) (*store.Probe, error) { return tc.result, tc.err },
+				},
+			}
+			req := httptest.NewRequest(http.MethodPost, "/api/admin/probes/probe-1/revoke", nil)
+			req.SetPathValue("id", "probe-1")
+			rec := httptest.NewRecorder()
+
+			h.handleRevokeProbe(rec, req)
+
+			if rec.Code != tc.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tc.want)
+			}
+		})
+	}
+}
+
+func TestHandleRotateProbeSecretReturnsNewSecret(t *testing.T) {
+	validUntil := time.Date(2026, time.October, 2, 12, 0, 0, 0, time.UTC)
+	h := &Handler{
+		probeCredentials: fakeProbeCredentialStore{
+			rotateFn: func(probeID string, grace time.Duration) (*store.ProbeSecretRotation, error) {
+				if probeID != "probe-1" || grace != time.Hour {
+					t.Fatalf("RotateProbeSecret(%q, %s), want probe-1 1h", probeID, grace)
+				}
+				return &store.ProbeSecretRotation{ProbeID: probeID, Secret: "new-secret", PreviousValidUntil: validUntil}, nil
+			},
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/admin/probes/probe-1/rotate", bytes.NewBufferString(`{"grace_period":"1h"}`))
+	req.SetPathValue("id", "probe-1")
+	rec := httptest.NewRecorder()
+
+	h.handleRotateProbeSecret(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var body map[string]string
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if body["secret"] != "new-secret" || body["previous_valid_until"] != "2026-10-02T12:00:00Z" {
+		t.Fatalf("body = %v, want new secret and grace end", body)
+	}
+}
+
+func TestHandleRotateProbeSecretMapsErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		body string
+		err  error
+		want int
+	}{
+		{name: "missing", body: ``, want: http.StatusNotFound},
+		{name: "config", body: `{}`, err: store.ErrProbeConfigManaged, want: http.StatusConflict},
+		{name: "bad grace", body: `{"grace_period":"soon"}`, want: http.StatusBadRequest},
+		{name: "long grace", body: `{"grace_period":"8760h"}`, want: http.StatusBadRequest},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := &Handler{
+				probeCredentials: fakeProbeCredentialStore{
+					rotateFn: func(_ string, grace time.Duration) (*store.ProbeSecretRotation, error) {
+						if grace != defaultProbeSecretGrace {
+							t.Fatalf("grace = %s, want default", grace)
+						}
+						return nil, tc.err
+					},
+				},
+			}
+			req := httptest.NewRequest(http.MethodPost, "/api/admin/probes/probe-1/rotate", bytes.NewBufferString(tc.body))
+			req.SetPathValue("id", "probe-1")
+			rec := httptest.NewRecorder()
+
+			h.handleRotateProbeSecret(rec, req)
+
+			if rec.Code != tc.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tc.want)
+			}
+		})
+	}
+}
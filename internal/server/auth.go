@@ -27,13 +27,20 @@ const (
 )
 
 type probeCredentialStore interface {
-	CreateProbeCredential(probeID string) (store.ProbeCredential, error)
+	CreateProbeCredential(probeID string, ownerUserID int64) (store.ProbeCredential, error)
+	ListOwnedProbes(userID int64) ([]store.Probe, error)
+	ListAllProbes() ([]store.Probe, error)
+	RotateProbeSecret(probeID string, grace time.Duration) (*store.ProbeSecretRotation, error)
 }
 
 type createProbeCredentialRequest struct {
 	ProbeID string `json:"probe_id"`
 }
 
+type setProbeLabelsRequest struct {
+	Labels map[string]string `json:"labels"`
+}
+
 // requireProbeAuth authenticates an individual probe using its provisioned
 // probe_id + secret and injects that probe into the request context.
 func (h *Handler) requireProbeAuth(next http.Handler) http.Handler {
@@ -41,12 +48,29 @@ func (h *Handler) requireProbeAuth(next http.Handler) http.Handler {
 		logger := requestLogger(r)
 		probeID := strings.TrimSpace(r.Header.Get(probeapi.HeaderProbeID))
 		secret := strings.TrimSpace(r.Header.Get(probeapi.HeaderProbeSecret))
-		if probeID == "" || secret == "" {
+		signed := r.Header.Get(probeapi.HeaderSignature) != ""
+		if probeID == "" || (secret == "" && !signed) {
 			http.Error(w, "unauthorized", http.StatusUnauthorized)
 			return
 		}
-		probe, err := h.store.AuthenticateProbe(probeID, secret)
+		if !signed && h.requireSignedProbeAuth() {
+			http.Error(w, "signed probe requests required", http.StatusUnauthorized)
+			return
+		}
+
+		var (
+			probe *store.Probe
+			err   error
+		)
+		if signed {
+			probe, err = h.authenticateSignedProbe(w, r, probeID)
+		} else {
+			probe, err = h.probeAuth.AuthenticateProbe(probeID, secret)
+		}
 		if err != nil {
+			if writeProcessorError(w, err) {
+				return
+			}
 			logger.Error("probe lookup failed", "component", "auth", "probe_id", probeID, "err", err)
 			http.Error(w, "internal error", http.StatusInternalServerError)
 			return
@@ -448,9 +472,15 @@ func (h *Handler) handleRejectSignupRequest(w http.ResponseWriter, r *http.Reque
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// handleCreateProbeCredential creates one reusable probe credential and returns
-// the raw secret. Protected by requireAdmin.
+// handleCreateProbeCredential creates one reusable shared probe credential and
+// returns the raw secret. Protected by requireAdmin.
 func (h *Handler) handleCreateProbeCredential(w http.ResponseWriter, r *http.Request) {
+	h.createProbeCredential(w, r, 0, "admin")
+}
+
+// createProbeCredential decodes a probe credential request, provisions the
+// probe for ownerUserID (zero for a shared probe), and writes the raw secret.
+func (h *Handler) createProbeCredential(w http.ResponseWriter, r *http.Request, ownerUserID int64, component string) {
 	logger := requestLogger(r)
 	var req createProbeCredentialRequest
 	if err := decodeJSONBody(w, r, &req, maxJSONRequestBodyBytes, true); err != nil {
@@ -461,33 +491,75 @@ func (h *Handler) handleCreateProbeCredential(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	credential, err := h.probeCredentials.CreateProbeCredential(req.ProbeID)
+	credential, err := h.probeCredentials.CreateProbeCredential(req.ProbeID, ownerUserID)
 	if err != nil {
 		switch {
 		case errors.Is(err, store.ErrInvalidProbeID):
 			err = &badRequestError{message: "probe_id must be 1-64 letters, numbers, dots, underscores, or hyphens and start with a letter or number"}
 		case errors.Is(err, store.ErrProbeAlreadyExists):
 			err = &badRequestError{message: "probe_id already exists"}
+		case errors.Is(err, store.ErrOwnedProbeLimit):
+			err = &conflictError{message: fmt.Sprintf("at most %d private probes per user", store.MaxOwnedProbes)}
 		default:
 			err = fmt.Errorf("create probe credential: %w", err)
 		}
 		if writeProcessorError(w, err) {
 			return
 		}
-		logger.Error("create probe credential failed", "component", "admin", "probe_id", req.ProbeID, "err", err)
+		logger.Error("create probe credential failed", "component", component, "probe_id", req.ProbeID, "err", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 
-	h.monitoring.AddProbe(credential.ProbeID)
+	h.monitoring.AddOwnedProbe(credential.ProbeID, ownerUserID)
 
-	logger.Info("probe credential created", "component", "admin", "probe_id", credential.ProbeID)
+	logger.Info("probe credential created", "component", component, "probe_id", credential.ProbeID)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	if err := json.NewEncoder(w).Encode(map[string]string{
 		"probe_id": credential.ProbeID,
 		"secret":   credential.Secret,
 	}); err != nil {
-		logger.Warn("encode created probe credential failed", "component", "admin", "probe_id", credential.ProbeID, "err", err)
+		logger.Warn("encode created probe credential failed", "component", component, "probe_id", credential.ProbeID, "err", err)
+	}
+}
+
+// handleSetProbeLabels replaces the admin-set labels of a probe. Admin labels
+// override labels the probe declares at registration. Protected by
+// requireAdmin.
+func (h *Handler) handleSetProbeLabels(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	probeID := r.PathValue("id")
+	var req setProbeLabelsRequest
+	if err := decodeJSONBody(w, r, &req, maxJSONRequestBodyBytes, false); err != nil {
+		if writeProcessorError(w, err) {
+			return
+		}
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	probe, err := h.probeProcessor.SetLabels(probeID, req.Labels)
+	if err != nil {
+		if writeProcessorError(w, err) {
+			return
+		}
+		logger.Error("set probe labels failed", "component", "admin", "probe_id", probeID, "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if probe == nil {
+		http.Error(w, "probe not found", http.StatusNotFound)
+		return
+	}
+
+	h.checkSets.Notify()
+	logger.Info("probe labels updated", "component", "admin", "probe_id", probeID, "labels", probe.Labels)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"probe_id": probe.ProbeID,
+		"labels":   probe.Labels,
+	}); err != nil {
+		logger.Warn("encode probe labels failed", "component", "admin", "probe_id", probeID, "err", err)
 	}
 }
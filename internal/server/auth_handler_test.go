@@ -55,11 +55,26 @@ func (f fakeAuthProcessor) SetupPassword(req SetupPasswordRequest) (SetupPasswor
 }
 
 type fakeProbeCredentialStore struct {
-	createFn func(probeID string) (store.ProbeCredential, error)
+	createFn    func(probeID string, ownerUserID int64) (store.ProbeCredential, error)
+	listOwnedFn func(userID int64) ([]store.Probe, error)
+	listAllFn   func() ([]store.Probe, error)
+	rotateFn    func(probeID string, grace time.Duration) (*store.ProbeSecretRotation, error)
 }
 
-func (f fakeProbeCredentialStore) CreateProbeCredential(probeID string) (store.ProbeCredential, error) {
-	return f.createFn(probeID)
+func (f fakeProbeCredentialStore) CreateProbeCredential(probeID string, ownerUserID int64) (store.ProbeCredential, error) {
+	return f.createFn(probeID, ownerUserID)
+}
+
+func (f fakeProbeCredentialStore) ListOwnedProbes(userID int64) ([]store.Probe, error) {
+	return f.listOwnedFn(userID)
+}
+
+func (f fakeProbeCredentialStore) ListAllProbes() ([]store.Probe, error) {
+	return f.listAllFn()
+}
+
+func (f fakeProbeCredentialStore) RotateProbeSecret(probeID string, grace time.Duration) (*store.ProbeSecretRotation, error) {
+	return f.rotateFn(probeID, grace)
 }
 
 func TestHandleLoginMapsUnauthorizedError(t *testing.T) {
@@ -505,7 +520,7 @@ func TestHandleCreateProbeCredentialReturnsSecretAndUpdatesRuntime(t *testing.T)
 	h := &Handler{
 		monitoring: runtime,
 		probeCredentials: fakeProbeCredentialStore{
-			createFn: func(probeID string) (store.ProbeCredential, error) {
+			createFn: func(probeID string, ownerUserID int64) (store.ProbeCredential, error) {
 				if probeID != "probe-api-1" {
 					t.Fatalf("probeID = %q, want probe-api-1", probeID)
 				}
@@ -541,7 +556,7 @@ func TestHandleCreateProbeCredentialMapsBadRequestError(t *testing.T) {
 	h := &Handler{
 		monitoring: monitoring.NewRuntime(nil, nil),
 		probeCredentials: fakeProbeCredentialStore{
-			createFn: func(probeID string) (store.ProbeCredential, error) {
+			createFn: func(probeID string, ownerUserID int64) (store.ProbeCredential, error) {
 				return store.ProbeCredential{}, store.ErrProbeAlreadyExists
 			},
 		},
@@ -564,7 +579,7 @@ func TestHandleCreateProbeCredentialMapsInternalError(t *testing.T) {
 	h := &Handler{
 		monitoring: monitoring.NewRuntime(nil, nil),
 		probeCredentials: fakeProbeCredentialStore{
-			createFn: func(probeID string) (store.ProbeCredential, error) {
+			createFn: func(probeID string, ownerUserID int64) (store.ProbeCredential, error) {
 				return store.ProbeCredential{}, errors.New("boom")
 			},
 		},
@@ -586,7 +601,7 @@ func TestHandleCreateProbeCredentialMapsInternalError(t *testing.T) {
 func TestHandleCreateProbeCredentialRejectsTooLargeBody(t *testing.T) {
 	h := &Handler{
 		probeCredentials: fakeProbeCredentialStore{
-			createFn: func(probeID string) (store.ProbeCredential, error) {
+			createFn: func(probeID string, ownerUserID int64) (store.ProbeCredential, error) {
 				t.Fatal("CreateProbeCredential should not be called for an oversized body")
 				return store.ProbeCredential{}, nil
 			},
@@ -636,3 +651,142 @@ func TestHandleLoginRejectsTooLargeBody(t *testing.T) {
 		t.Fatalf("body = %q, want request body too large", got)
 	}
 }
+
+func TestHandleSetProbeLabelsReturnsEffectiveLabels(t *testing.T) {
+	h := &Handler{
+		probeProcessor: fakeProbeProcessor{
+			setLabelsFn: func(probeID string, labels map[string]string) (*store.Probe, error) {
+				if probeID != "probe-1" || labels["region"] != "eu-west" {
+					t.Fatalf("SetLabels(%q, %v), want probe-1 region eu-west", probeID, labels)
+				}
+				return &store.Probe{ProbeID: probeID, Labels: map[string]string{"region": "eu-west", "provider": "aws"}}, nil
+			},
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/api/admin/probes/probe-1/labels", bytes.NewBufferString(`{"labels":{"region":"eu-west"}}`))
+	req.SetPathValue("id", "probe-1")
+	rec := httptest.NewRecorder()
+
+	h.handleSetProbeLabels(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var body struct {
+		ProbeID string            `json:"probe_id"`
+		Labels  map[string]string `json:"labels"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if body.ProbeID != "probe-1" || body.Labels["provider"] != "aws" {
+		t.Fatalf("body = %+v, want effective labels for probe-1", body)
+	}
+}
+
+func TestHandleSetProbeLabelsMapsMissingProbeToNotFound(t *testing.T) {
+	h := &Handler{
+		probeProcessor: fakeProbeProcessor{
+			setLabelsFn: func(string, map[string]string) (*store.Probe, error) { return nil, nil },
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/api/admin/probes/missing/labels", bytes.NewBufferString(`{"labels":{}}`))
+	req.SetPathValue("id", "missing")
+	rec := httptest.NewRecorder()
+
+	h.handleSetProbeLabels(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", rec.Code)
+	}
+}
+
+func TestHandleCreatePrivateProbeOwnsCredentialBySessionUser(t *testing.T) {
+	runtime := monitoring.NewRuntime(nil, nil)
+	h := &Handler{
+		monitoring: runtime,
+		probeCredentials: fakeProbeCredentialStore{
+			createFn: func(probeID string, ownerUserID int64) (store.ProbeCredential, error) {
+				if ownerUserID != 7 {
+					t.Fatalf("ownerUserID = %d, want 7", ownerUserID)
+				}
+				return store.ProbeCredential{ProbeID: "office-probe", Secret: "secret-1"}, nil
+			},
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/private-probes", bytes.NewBufferString(`{"probe_id":"office-probe"}`))
+	req = req.WithContext(context.WithValue(req.Context(), contextKeyUser, &store.User{ID: 7}))
+	rec := httptest.NewRecorder()
+
+	h.handleCreatePrivateProbe(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201", rec.Code)
+	}
+	state, err := runtime.ProbeSnapshot("office-probe")
+	if err != nil {
+		t.Fatalf("runtime missing created probe: %v", err)
+	}
+	if state.OwnerUserID != 7 {
+		t.Fatalf("runtime owner = %d, want 7", state.OwnerUserID)
+	}
+}
+
+func TestHandleCreatePrivateProbeMapsLimitToConflict(t *testing.T) {
+	h := &Handler{
+		monitoring: monitoring.NewRuntime(nil, nil),
+		probeCredentials: fakeProbeCredentialStore{
+			createFn: func(probeID string, ownerUserID int64) (store.ProbeCredential, error) {
+				return store.ProbeCredential{}, store.ErrOwnedProbeLimit
+			},
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/private-probes", bytes.NewBufferString(`{}`))
+	req = req.WithContext(context.WithValue(req.Context(), contextKeyUser, &store.User{ID: 7}))
+	rec := httptest.NewRecorder()
+
+	h.handleCreatePrivateProbe(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409", rec.Code)
+	}
+}
+
+func TestHandleListPrivateProbesReturnsOwnedProbes(t *testing.T) {
+	runtime := monitoring.NewRuntime(nil, []string{"office-probe"})
+	if _, err := runtime.ReceiveHeartbeat("office-probe", time.Now()); err != nil {
+		t.Fatalf("ReceiveHeartbeat: %v", err)
+	}
+	h := &Handler{
+		monitoring: runtime,
+		probeCredentials: fakeProbeCredentialStore{
+			listOwnedFn: func(userID int64) ([]store.Probe, error) {
+				if userID != 7 {
+					t.Fatalf("userID = %d, want 7", userID)
+				}
+				return []store.Probe{{ProbeID: "office-probe", OwnerUserID: 7, Labels: map[string]string{"network": "office"}}}, nil
+			},
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/private-probes", nil)
+	req = req.WithContext(context.WithValue(req.Context(), contextKeyUser, &store.User{ID: 7}))
+	rec := httptest.NewRecorder()
+
+	h.handleListPrivateProbes(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var body []privateProbeDTO
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if len(body) != 1 || body[0].ProbeID != "office-probe" || !body[0].Online || body[0].Labels["network"] != "office" {
+		t.Fatalf("body = %#v, want online office-probe", body)
+	}
+}
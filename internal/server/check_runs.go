@@ -0,0 +1,423 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	probeapi "github.com/tmater/wacht/internal/api/probe"
+	"github.com/tmater/wacht/internal/checks"
+	"github.com/tmater/wacht/internal/monitoring"
+	"github.com/tmater/wacht/internal/proto"
+	"github.com/tmater/wacht/internal/store"
+)
+
+const (
+	// defaultCheckRunTimeout and maxCheckRunTimeout bound how long a run-now
+	// request waits for probe results.
+	defaultCheckRunTimeout = 15 * time.Second
+	maxCheckRunTimeout     = 60 * time.Second
+	// queryCheckRunTimeout overrides defaultCheckRunTimeout, such as "30s".
+	queryCheckRunTimeout = "timeout"
+	// maxPendingRunsPerProbe caps how many on-demand runs one probe may have
+	// queued or in flight, so repeated run-now requests cannot pile checks
+	// onto a target.
+	maxPendingRunsPerProbe = 4
+)
+
+// checkRunStore is the persistence surface needed to start on-demand runs.
+type checkRunStore interface {
+	GetCheckByName(name string, userID int64) (*checks.Check, error)
+	ListProbes() ([]store.Probe, error)
+}
+
+// checkRun is one on-demand execution of a check across its probes.
+type checkRun struct {
+	id      string
+	check   proto.ProbeCheck
+	probes  []string
+	results map[string]proto.CheckResult
+	done    chan struct{}
+}
+
+// checkRunDispatcher queues on-demand runs for long-polling probes and
+// collects their results. Runs live only in memory: a server restart drops
+// them, and callers see the missing probes as pending.
+type checkRunDispatcher struct {
+	mu      sync.Mutex
+	changed chan struct{}
+	pending map[string][]probeapi.RunRequest
+	runs    map[string]*checkRun
+}
+
+func newCheckRunDispatcher() *checkRunDispatcher {
+	return &checkRunDispatcher{
+		changed: make(chan struct{}),
+		pending: make(map[string][]probeapi.RunRequest),
+		runs:    make(map[string]*checkRun),
+	}
+}
+
+// Start queues check for every probe in probeIDs and wakes waiting probes. It
+// refuses the run when a probe already has maxPendingRunsPerProbe runs it has
+// not answered.
+func (d *checkRunDispatcher) Start(check proto.ProbeCheck, probeIDs []string) (*checkRun, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, fmt.Errorf("generate run id: %w", err)
+	}
+	run := &checkRun{
+		id:      hex.EncodeToString(b[:]),
+		check:   check,
+		probes:  append([]string(nil), probeIDs...),
+		results: make(map[string]proto.CheckResult, len(probeIDs)),
+		done:    make(chan struct{}),
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, probeID := range probeIDs {
+		if d.pendingRunsLocked(probeID) >= maxPendingRunsPerProbe {
+			return nil, &tooManyRequestsError{message: fmt.Sprintf("probe %s already has %d runs pending", probeID, maxPendingRunsPerProbe)}
+		}
+	}
+	d.runs[run.id] = run
+	for _, probeID := range probeIDs {
+		d.pending[probeID] = append(d.pending[probeID], probeapi.RunRequest{RunID: run.id, Check: check})
+	}
+	close(d.changed)
+	d.changed = make(chan struct{})
+	return run, nil
+}
+
+// pendingRunsLocked counts the unfinished runs probeID has not answered yet.
+func (d *checkRunDispatcher) pendingRunsLocked(probeID string) int {
+	pending := 0
+	for _, run := range d.runs {
+		if _, answered := run.results[probeID]; !answered && slices.Contains(run.probes, probeID) {
+			pending++
+		}
+	}
+	return pending
+}
+
+// Changed returns a channel that is closed when the next run is queued.
+func (d *checkRunDispatcher) Changed() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.changed
+}
+
+// Take removes and returns the runs queued for probeID.
+func (d *checkRunDispatcher) Take(probeID string) []probeapi.RunRequest {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	requests := d.pending[probeID]
+	delete(d.pending, probeID)
+	return requests
+}
+
+// Complete records probeID's result for a run. It reports false when the run
+// is unknown, already finished, or was not queued for the probe.
+func (d *checkRunDispatcher) Complete(probeID string, runID string, result proto.CheckResult) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	run, ok := d.runs[runID]
+	if !ok || !slices.Contains(run.probes, probeID) {
+		return false
+	}
+	if _, seen := run.results[probeID]; seen {
+		return true
+	}
+	result.CheckID = run.check.ID
+	result.CheckName = run.check.Name
+	result.Type = run.check.Type
+	result.Target = run.check.Target
+	run.results[probeID] = result
+	if len(run.results) == len(run.probes) {
+		close(run.done)
+	}
+	return true
+}
+
+// Finish forgets run, drops its requests no probe has picked up yet, and
+// returns the results collected so far.
+func (d *checkRunDispatcher) Finish(run *checkRun) map[string]proto.CheckResult {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	delete(d.runs, run.id)
+	for _, probeID := range run.probes {
+		queued := d.pending[probeID][:0]
+		for _, request := range d.pending[probeID] {
+			if request.RunID != run.id {
+				queued = append(queued, request)
+			}
+		}
+		if len(queued) == 0 {
+			delete(d.pending, probeID)
+			continue
+		}
+		d.pending[probeID] = queued
+	}
+
+	results := make(map[string]proto.CheckResult, len(run.results))
+	for probeID, result := range run.results {
+		results[probeID] = result
+	}
+	return results
+}
+
+// checkRunResponse reports one on-demand run. Its results are ad hoc: they
+// are returned to the caller only and never count toward check quorum or
+// incidents.
+type checkRunResponse struct {
+	RunID    string             `json:"run_id"`
+	AdHoc    bool               `json:"ad_hoc"`
+	Complete bool               `json:"complete"`
+	Results  []checkRunProbeDTO `json:"results"`
+}
+
+type checkRunProbeDTO struct {
+	ProbeID   string  `json:"probe_id"`
+	Status    string  `json:"status"` // up, down, or pending
+	LatencyMS *int64  `json:"latency_ms,omitempty"`
+	Error     string  `json:"error,omitempty"`
+	ErrorKind string  `json:"error_kind,omitempty"`
+	CheckedAt *string `json:"checked_at,omitempty"`
+}
+
+// handleRunCheck runs a saved check owned by the authenticated user on every
+// online probe assigned to it and returns the per-probe results.
+func (h *Handler) handleRunCheck(w http.ResponseWriter, r *http.Request) {
+	user := sessionUser(r)
+	name := r.PathValue("name")
+	logger := requestLogger(r)
+	timeout, err := parseCheckRunTimeout(r)
+	if err != nil {
+		writeProcessorError(w, err)
+		return
+	}
+	check, err := h.checkRunStore.GetCheckByName(name, user.ID)
+	if err != nil {
+		logger.Error("get check failed", "component", "checks", "check_name", name, "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if check == nil {
+		http.Error(w, "check not found", http.StatusNotFound)
+		return
+	}
+	h.runCheck(w, r, *check, timeout)
+}
+
+// handleRunAdHocCheck runs an unsaved check definition so it can be validated
+// before it is created.
+func (h *Handler) handleRunAdHocCheck(w http.ResponseWriter, r *http.Request) {
+	user := sessionUser(r)
+	timeout, err := parseCheckRunTimeout(r)
+	if err != nil {
+		writeProcessorError(w, err)
+		return
+	}
+	var check checks.Check
+	if err := decodeJSONBody(w, r, &check, maxJSONRequestBodyBytes, false); err != nil {
+		if writeProcessorError(w, err) {
+			return
+		}
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	check, err = check.NormalizeAndValidate(ctx, h.targetPolicy(), false)
+	if err != nil {
+		writeProcessorError(w, &badRequestError{message: err.Error()})
+		return
+	}
+	check.ID = ""
+	check.OwnerID = user.ID
+	h.runCheck(w, r, check, timeout)
+}
+
+// runCheck dispatches check to its online probes and writes whatever results
+// arrive within timeout.
+func (h *Handler) runCheck(w http.ResponseWriter, r *http.Request, check checks.Check, timeout time.Duration) {
+	logger := requestLogger(r)
+	probeIDs, err := h.checkRunProbes(check)
+	if err != nil {
+		logger.Error("list run probes failed", "component", "checks", "check_name", check.Name, "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if len(probeIDs) == 0 {
+		writeProcessorError(w, &conflictError{message: "no online probe can run this check"})
+		return
+	}
+
+	run, err := h.checkRuns.Start(toProbeCheck(check), probeIDs)
+	if writeProcessorError(w, err) {
+		return
+	}
+	if err != nil {
+		logger.Error("start check run failed", "component", "checks", "check_name", check.Name, "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + 10*time.Second))
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	select {
+	case <-run.done:
+	case <-deadline.C:
+	case <-r.Context().Done():
+		h.checkRuns.Finish(run)
+		return
+	}
+	results := h.checkRuns.Finish(run)
+
+	response := checkRunResponse{
+		RunID:    run.id,
+		AdHoc:    true,
+		Complete: len(results) == len(probeIDs),
+		Results:  make([]checkRunProbeDTO, 0, len(probeIDs)),
+	}
+	for _, probeID := range probeIDs {
+		result, ok := results[probeID]
+		if !ok {
+			response.Results = append(response.Results, checkRunProbeDTO{ProbeID: probeID, Status: "pending"})
+			continue
+		}
+		item := checkRunProbeDTO{
+			ProbeID:   probeID,
+			Status:    "down",
+			Error:     result.Error,
+			CheckedAt: formatOptionalTimestamp(&result.Timestamp),
+		}
+		switch {
+		case result.Up:
+			item.Status = "up"
+		case result.ErrorKind.Known():
+			item.ErrorKind = string(result.ErrorKind)
+		}
+		latency := result.Latency.Milliseconds()
+		item.LatencyMS = &latency
+		response.Results = append(response.Results, item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		logger.Warn("encode check run failed", "component", "checks", "err", err)
+	}
+}
+
+// checkRunProbes returns, in order, the live probes that would run check and
+// speak a protocol that polls for on-demand runs.
+func (h *Handler) checkRunProbes(check checks.Check) ([]string, error) {
+	probes, err := h.checkRunStore.ListProbes()
+	if err != nil {
+		return nil, err
+	}
+	probeIDs := make([]string, 0, len(probes))
+	for _, probe := range probes {
+		if probe.ProtocolVersion < probeapi.ProtocolVersionRuns || !probeRunsCheck(probe, check) {
+			continue
+		}
+		if h.monitoring != nil {
+			state, err := h.monitoring.ProbeSnapshot(probe.ProbeID)
+			if err != nil || state.State == monitoring.ProbeStateOffline {
+				continue
+			}
+		}
+		probeIDs = append(probeIDs, probe.ProbeID)
+	}
+	sort.Strings(probeIDs)
+	return probeIDs, nil
+}
+
+// parseCheckRunTimeout reads the optional run-now wait, capped at
+// maxCheckRunTimeout.
+func parseCheckRunTimeout(r *http.Request) (time.Duration, error) {
+	raw := r.URL.Query().Get(queryCheckRunTimeout)
+	if raw == "" {
+		return defaultCheckRunTimeout, nil
+	}
+	timeout, err := time.ParseDuration(raw)
+	if err != nil || timeout <= 0 {
+		return 0, &badRequestError{message: fmt.Sprintf("invalid %s duration", queryCheckRunTimeout)}
+	}
+	return min(timeout, maxCheckRunTimeout), nil
+}
+
+// handleProbeRuns long-polls for on-demand runs queued for the authenticated
+// probe.
+func (h *Handler) handleProbeRuns(w http.ResponseWriter, r *http.Request) {
+	probe := authenticatedProbe(r)
+	logger := requestLogger(r)
+	wait, err := parseCheckWatchWait(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if wait > 0 {
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + 10*time.Second))
+	}
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+
+	for {
+		changed := h.checkRuns.Changed()
+		if requests := h.checkRuns.Take(probe.ProbeID); len(requests) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(requests); err != nil {
+				logger.Warn("write probe runs failed", "component", "probe", "err", err)
+			}
+			return
+		}
+		if wait <= 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-deadline.C:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// handleProbeRunResult accepts the authenticated probe's result for one
+// on-demand run. Results for runs the caller stopped waiting for are refused
+// with 404.
+func (h *Handler) handleProbeRunResult(w http.ResponseWriter, r *http.Request) {
+	probe := authenticatedProbe(r)
+	var req probeapi.RunResult
+	if err := decodeJSONBody(w, r, &req, maxProbeJSONRequestBodyBytes, false); err != nil {
+		if writeProcessorError(w, err) {
+			return
+		}
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	result := req.Result
+	result.ProbeID = probe.ProbeID
+	result.Timestamp = time.Now().UTC()
+	if !h.checkRuns.Complete(probe.ProbeID, req.RunID, result) {
+		http.Error(w, "run not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	probeapi "github.com/tmater/wacht/internal/api/probe"
+	"github.com/tmater/wacht/internal/checks"
+	"github.com/tmater/wacht/internal/monitoring"
+	"github.com/tmater/wacht/internal/proto"
+	"github.com/tmater/wacht/internal/store"
+)
+
+type fakeCheckRunStore struct {
+	check  *checks.Check
+	probes []store.Probe
+}
+
+func (f fakeCheckRunStore) GetCheckByName(name string, userID int64) (*checks.Check, error) {
+	if f.check == nil || f.check.Name != name || f.check.OwnerID != userID {
+		return nil, nil
+	}
+	return f.check, nil
+}
+
+func (f fakeCheckRunStore) ListProbes() ([]store.Probe, error) {
+	return f.probes, nil
+}
+
+func TestCheckRunDispatcherCollectsResults(t *testing.T) {
+	d := newCheckRunDispatcher()
+	changed := d.Changed()
+	run, err := d.Start(proto.ProbeCheck{ID: "check-1", Type: "http", Target: "https://example.com"}, []string{"probe-a", "probe-b"})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	select {
+	case <-changed:
+	default:
+		t.Fatal("Start() did not wake waiting probes")
+	}
+
+	requests := d.Take("probe-a")
+	if len(requests) != 1 || requests[0].RunID != run.id || requests[0].Check.ID != "check-1" {
+		t.Fatalf("Take(probe-a) = %+v, want the queued run", requests)
+	}
+	if again := d.Take("probe-a"); len(again) != 0 {
+		t.Fatalf("second Take(probe-a) = %+v, want empty", again)
+	}
+	if d.Complete("probe-c", run.id, proto.CheckResult{Up: true}) {
+		t.Fatal("Complete() accepted a probe the run was not queued for")
+	}
+	if !d.Complete("probe-a", run.id, proto.CheckResult{Up: true, Target: "spoofed"}) {
+		t.Fatal("Complete(probe-a) = false, want true")
+	}
+	select {
+	case <-run.done:
+		t.Fatal("run finished before every probe answered")
+	default:
+	}
+
+	results := d.Finish(run)
+	if len(results) != 1 || results["probe-a"].Target != "https://example.com" {
+		t.Fatalf("Finish() = %+v, want probe-a result stamped with the run target", results)
+	}
+	if pending := d.Take("probe-b"); len(pending) != 0 {
+		t.Fatalf("Take(probe-b) after Finish = %+v, want dropped request", pending)
+	}
+	if d.Complete("probe-b", run.id, proto.CheckResult{}) {
+		t.Fatal("Complete() accepted a result for a finished run")
+	}
+}
+
+func TestCheckRunDispatcherCapsPendingRunsPerProbe(t *testing.T) {
+	d := newCheckRunDispatcher()
+	check := proto.ProbeCheck{ID: "check-1", Type: "http", Target: "https://example.com"}
+	var runs []*checkRun
+	for i := 0; i < maxPendingRunsPerProbe; i++ {
+		run, err := d.Start(check, []string{"probe-a"})
+		if err != nil {
+			t.Fatalf("Start() #%d error = %v", i+1, err)
+		}
+		runs = append(runs, run)
+	}
+
+	_, err := d.Start(check, []string{"probe-b", "probe-a"})
+	var tooMany *tooManyRequestsError
+	if !errors.As(err, &tooMany) {
+		t.Fatalf("Start() over the cap error = %v, want too many requests", err)
+	}
+	if pending := d.Take("probe-b"); len(pending) != 0 {
+		t.Fatalf("Take(probe-b) = %+v, want the refused run not queued", pending)
+	}
+
+	if !d.Complete("probe-a", runs[0].id, proto.CheckResult{Up: true}) {
+		t.Fatal("Complete() = false, want true")
+	}
+	if _, err := d.Start(check, []string{"probe-a"}); err != nil {
+		t.Fatalf("Start() after a run was answered error = %v", err)
+	}
+}
+
+func TestHandleRunCheckReturnsProbeResults(t *testing.T) {
+	runtime := monitoring.NewRuntime(nil, []string{"probe-a", "probe-b", "probe-old"})
+	for _, probeID := range []string{"probe-a", "probe-b", "probe-old"} {
+		if _, err := runtime.ReceiveHeartbeat(probeID, time.Now()); err != nil {
+			t.Fatalf("ReceiveHeartbeat: %v", err)
+		}
+	}
+	h := &Handler{
+		monitoring: runtime,
+		checkRuns:  newCheckRunDispatcher(),
+		checkRunStore: fakeCheckRunStore{
+			check: &checks.Check{ID: "check-1", Name: "api", Type: checks.CheckHTTP, Target: "https://example.com", Retries: 2, OwnerID: 7},
+			probes: []store.Probe{
+				{ProbeID: "probe-a", ProtocolVersion: probeapi.ProtocolVersion},
+				{ProbeID: "probe-b", ProtocolVersion: probeapi.ProtocolVersion},
+				{ProbeID: "probe-old", ProtocolVersion: 1},
+			},
+		},
+	}
+
+	// probe-a answers if the run carries the check's retries; probe-b never
+	// polls and stays pending.
+	go func() {
+		req := httptest.NewRequest(http.MethodGet, probeapi.PathRuns+"?wait=5s", nil)
+		req = req.WithContext(context.WithValue(req.Context(), contextKeyProbe, &store.Probe{ProbeID: "probe-a"}))
+		rec := httptest.NewRecorder()
+		h.handleProbeRuns(rec, req)
+		var requests []probeapi.RunRequest
+		if err := json.NewDecoder(rec.Body).Decode(&requests); err != nil || len(requests) != 1 || requests[0].Check.Retries != 2 {
+			return
+		}
+		body, _ := json.Marshal(probeapi.RunResult{RunID: requests[0].RunID, Result: proto.CheckResult{Up: true, Latency: 42 * time.Millisecond}})
+		req = httptest.NewRequest(http.MethodPost, probeapi.PathRunResults, bytes.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), contextKeyProbe, &store.Probe{ProbeID: "probe-a"}))
+		h.handleProbeRunResult(httptest.NewRecorder(), req)
+	}()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/checks/api/run?timeout=1s", nil)
+	req.SetPathValue("name", "api")
+	req = req.WithContext(context.WithValue(req.Context(), contextKeyUser, &store.User{ID: 7}))
+	rec := httptest.NewRecorder()
+	h.handleRunCheck(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	var body checkRunResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if !body.AdHoc || body.Complete || len(body.Results) != 2 {
+		t.Fatalf("body = %+v, want incomplete ad-hoc run on two probes", body)
+	}
+	if got := body.Results[0]; got.ProbeID != "probe-a" || got.Status != "up" || got.LatencyMS == nil || *got.LatencyMS != 42 {
+		t.Fatalf("probe-a = %+v, want up in 42ms", got)
+	}
+	if got := body.Results[1]; got.ProbeID != "probe-b" || got.Status != "pending" {
+		t.Fatalf("probe-b = %+v, want pending", got)
+	}
+}
+
+func TestHandleRunCheckRejectsChecksWithoutProbes(t *testing.T) {
+	h := &Handler{
+		monitoring: monitoring.NewRuntime(nil, []string{"probe-a"}),
+		checkRuns:  newCheckRunDispatcher(),
+		checkRunStore: fakeCheckRunStore{
+			check:  &checks.Check{ID: "check-1", Name: "api", Type: checks.CheckHTTP, Target: "https://example.com", OwnerID: 7},
+			probes: []store.Probe{{ProbeID: "probe-a", ProtocolVersion: probeapi.ProtocolVersion}},
+		},
+	}
+
+	for _, tc := range []struct {
+		name string
+		want int
+	}{
+		{name: "api", want: http.StatusConflict},
+		{name: "missing", want: http.StatusNotFound},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/checks/"+tc.name+"/run", nil)
+		req.SetPathValue("name", tc.name)
+		req = req.WithContext(context.WithValue(req.Context(), contextKeyUser, &store.User{ID: 7}))
+		rec := httptest.NewRecorder()
+		h.handleRunCheck(rec, req)
+		if rec.Code != tc.want {
+			t.Fatalf("%s: status = %d, want %d", tc.name, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestHandleProbeRunsReturnsNoContentWhenIdle(t *testing.T) {
+	h := &Handler{checkRuns: newCheckRunDispatcher()}
+	req := httptest.NewRequest(http.MethodGet, probeapi.PathRuns, nil)
+	req = req.WithContext(context.WithValue(req.Context(), contextKeyProbe, &store.Probe{ProbeID: "probe-a"}))
+	rec := httptest.NewRecorder()
+
+	h.handleProbeRuns(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204", rec.Code)
+	}
+}
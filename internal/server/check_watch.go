@@ -0,0 +1,57 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/tmater/wacht/internal/proto"
+)
+
+// maxCheckWatchWait caps how long a probe may hold a check-set long-poll open.
+const maxCheckWatchWait = 60 * time.Second
+
+// checkSetNotifier wakes long-polling probes when any probe's check set may
+// have changed. Waiters re-evaluate their own set, so spurious wakeups only
+// cost a recompute. A nil notifier never fires.
+type checkSetNotifier struct {
+	mu      sync.Mutex
+	changed chan struct{}
+}
+
+func newCheckSetNotifier() *checkSetNotifier {
+	return &checkSetNotifier{changed: make(chan struct{})}
+}
+
+// Changed returns a channel that is closed on the next Notify.
+func (n *checkSetNotifier) Changed() <-chan struct{} {
+	if n == nil {
+		return nil
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.changed
+}
+
+// Notify wakes every current waiter.
+func (n *checkSetNotifier) Notify() {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	close(n.changed)
+	n.changed = make(chan struct{})
+}
+
+// checkSetRevision returns the quoted ETag for one encoded probe check set.
+func checkSetRevision(payload []proto.ProbeCheck) (string, []byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", nil, err
+	}
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, body, nil
+}
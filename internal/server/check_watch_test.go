@@ -0,0 +1,114 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tmater/wacht/internal/checks"
+	"github.com/tmater/wacht/internal/proto"
+	"github.com/tmater/wacht/internal/store"
+)
+
+func TestCheckSetNotifierWakesCurrentWaiters(t *testing.T) {
+	n := newCheckSetNotifier()
+	before := n.Changed()
+	n.Notify()
+
+	select {
+	case <-before:
+	default:
+		t.Fatal("expected Notify to close the channel returned before it")
+	}
+	select {
+	case <-n.Changed():
+		t.Fatal("expected a fresh channel after Notify")
+	default:
+	}
+
+	var nilNotifier *checkSetNotifier
+	nilNotifier.Notify()
+	if nilNotifier.Changed() != nil {
+		t.Fatal("expected nil notifier to return a nil channel")
+	}
+}
+
+func TestCheckSetRevisionTracksContent(t *testing.T) {
+	set := []proto.ProbeCheck{{ID: "check-1", Name: "api", Type: "http", Target: "https://example.com", Interval: 30}}
+	first, _, err := checkSetRevision(set)
+	if err != nil {
+		t.Fatalf("checkSetRevision() error = %v", err)
+	}
+	again, _, err := checkSetRevision([]proto.ProbeCheck{set[0]})
+	if err != nil {
+		t.Fatalf("checkSetRevision() error = %v", err)
+	}
+	if first != again {
+		t.Fatalf("revision = %s then %s, want stable revision for identical sets", first, again)
+	}
+
+	set[0].Interval = 60
+	changed, _, err := checkSetRevision(set)
+	if err != nil {
+		t.Fatalf("checkSetRevision() error = %v", err)
+	}
+	if changed == first {
+		t.Fatal("expected revision to change with the check set")
+	}
+}
+
+func TestProbeChecksFiltersBySelector(t *testing.T) {
+	probe := store.Probe{ProbeID: "probe-1", Labels: map[string]string{"region": "eu"}}
+	all := []checks.Check{
+		{ID: "eu", Name: "eu", Type: checks.CheckHTTP, ProbeSelector: "region=eu"},
+		{ID: "us", Name: "us", Type: checks.CheckHTTP, ProbeSelector: "region=us"},
+	}
+
+	got := probeChecks(probe, all)
+	if len(got) != 1 || got[0].ID != "eu" {
+		t.Fatalf("probeChecks() = %#v, want only eu", got)
+	}
+}
+
+func TestProbeChecksSendsTCPExpectOnlyToProbesThatSupportIt(t *testing.T) {
+	all := []checks.Check{{
+		ID: "redis", Name: "redis", Type: checks.CheckTCPExpect, Target: "redis.example.com:6379",
+		Send: "PING\r\n", Expect: "+PONG", ExpectMode: "contains", ReadTimeoutMS: 500,
+	}}
+
+	legacy := store.Probe{ProbeID: "probe-1"}
+	if got := probeChecks(legacy, all); len(got) != 0 {
+		t.Fatalf("probeChecks(legacy) = %#v, want none", got)
+	}
+
+	current := store.Probe{ProbeID: "probe-2", CheckTypes: []string{"dns", "http", "tcp", "tcp-expect"}}
+	got := probeChecks(current, all)
+	if len(got) != 1 || got[0].Send != "PING\r\n" || got[0].Expect != "+PONG" || got[0].ExpectMode != "contains" || got[0].ReadTimeoutMS != 500 {
+		t.Fatalf("probeChecks(current) = %#v, want the redis exchange", got)
+	}
+}
+
+func TestParseCheckWatchWait(t *testing.T) {
+	for _, tc := range []struct {
+		query   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{query: "", want: 0},
+		{query: "?wait=25s", want: 25 * time.Second},
+		{query: "?wait=10m", want: maxCheckWatchWait},
+		{query: "?wait=soon", wantErr: true},
+		{query: "?wait=-1s", wantErr: true},
+	} {
+		got, err := parseCheckWatchWait(httptest.NewRequest("GET", "/api/probes/checks"+tc.query, nil))
+		if tc.wantErr {
+			if err == nil {
+				t.Fatalf("parseCheckWatchWait(%q) error = nil, want error", tc.query)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Fatalf("parseCheckWatchWait(%q) = %s, %v, want %s", tc.query, got, err, tc.want)
+		}
+	}
+}
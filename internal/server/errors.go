@@ -21,6 +21,34 @@ func (e *unauthorizedError) Error() string {
 	return e.message
 }
 
+// upgradeRequiredError reports a probe build older than the server accepts.
+type upgradeRequiredError struct {
+	message string
+}
+
+func (e *upgradeRequiredError) Error() string {
+	return e.message
+}
+
+// conflictError reports a request that conflicts with the resource's state.
+type conflictError struct {
+	message string
+}
+
+func (e *conflictError) Error() string {
+	return e.message
+}
+
+// tooManyRequestsError reports a request refused because too much of the same
+// work is already outstanding.
+type tooManyRequestsError struct {
+	message string
+}
+
+func (e *tooManyRequestsError) Error() string {
+	return e.message
+}
+
 type notFoundError struct {
 	message string
 }
@@ -54,5 +82,23 @@ func writeProcessorError(w http.ResponseWriter, err error) bool {
 		return true
 	}
 
+	var conflict *conflictError
+	if errors.As(err, &conflict) {
+		http.Error(w, conflict.Error(), http.StatusConflict)
+		return true
+	}
+
+	var tooMany *tooManyRequestsError
+	if errors.As(err, &tooMany) {
+		http.Error(w, tooMany.Error(), http.StatusTooManyRequests)
+		return true
+	}
+
+	var upgradeRequired *upgradeRequiredError
+	if errors.As(err, &upgradeRequired) {
+		http.Error(w, upgradeRequired.Error(), http.StatusUpgradeRequired)
+		return true
+	}
+
 	return false
 }
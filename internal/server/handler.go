@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/netip"
 	"time"
@@ -26,8 +27,17 @@ type Handler struct {
 	authProcessor    authProcessor
 	probeProcessor   probeProcessor
 	probeCredentials probeCredentialStore
+	probeEnrollment  probeEnrollmentStore
+	probeAuth        probeAuthStore
+	probeReplays     *signatureReplayCache
+	checkSets        *checkSetNotifier
+	checkRuns        *checkRunDispatcher
+	checkRunStore    checkRunStore
+	incidentEvidence incidentEvidenceStore
 	loginLimiter     *rateLimiter
 	signupLimiter    *rateLimiter
+	enrollLimiter    *rateLimiter
+	runLimiter       *rateLimiter
 	publicLimiter    *rateLimiter
 	trustedProxies   []netip.Prefix
 }
@@ -46,21 +56,43 @@ type notificationJSON struct {
 // New creates a new Handler.
 func New(store *store.Store, monitoringRuntime *monitoring.Runtime, cfg *config.ServerConfig) *Handler {
 	authRateLimit := cfg.AuthRateLimit
+	probeProcessor := NewProbeProcessor(store, monitoringRuntime)
+	probeProcessor.SetMinProbeVersion(cfg.MinProbeVersionParsed)
 	return &Handler{
 		store:            store,
 		monitoring:       monitoringRuntime,
 		config:           cfg,
-		webhooks:         alert.NewSender(store, network.Policy{AllowPrivateTargets: cfg.AllowPrivateTargets}),
+		webhooks:         alert.NewSender(store, network.Policy{AllowPrivateTargets: cfg.AllowPrivateTargets}, webhookOptions(cfg.Webhooks)),
 		authProcessor:    NewAuthProcessor(store),
-		probeProcessor:   NewProbeProcessor(store, monitoringRuntime),
+		probeProcessor:   probeProcessor,
 		probeCredentials: store,
+		probeEnrollment:  store,
+		probeAuth:        store,
+		probeReplays:     newSignatureReplayCache(probeSignatureWindow),
+		checkSets:        newCheckSetNotifier(),
+		checkRuns:        newCheckRunDispatcher(),
+		checkRunStore:    store,
+		incidentEvidence: store,
 		loginLimiter:     newRateLimiter(authRateLimit.Requests, authRateLimit.Window),
 		signupLimiter:    newRateLimiter(authRateLimit.Requests, authRateLimit.Window),
+		enrollLimiter:    newRateLimiter(authRateLimit.Requests, authRateLimit.Window),
+		runLimiter:       newRateLimiter(30, time.Minute),
 		publicLimiter:    newRateLimiter(60, time.Minute),
 		trustedProxies:   append([]netip.Prefix(nil), cfg.TrustedProxyCIDRs...),
 	}
 }
 
+func webhookOptions(cfg config.WebhookConfig) alert.Options {
+	return alert.Options{
+		GroupWindow:       cfg.GroupWindow,
+		HostConcurrency:   cfg.HostConcurrency,
+		HostRatePerMinute: cfg.HostRatePerMinute,
+		HostBurst:         cfg.HostBurst,
+		BreakerFailures:   cfg.BreakerFailures,
+		BreakerCooldown:   cfg.BreakerCooldown,
+	}
+}
+
 // Close stops background workers owned by the handler.
 func (h *Handler) Close() {
 	if h == nil {
@@ -81,10 +113,17 @@ func (h *Handler) Routes() http.Handler {
 	mux.HandleFunc("POST /api/auth/setup-password", h.rateLimited(h.signupLimiter, h.handleSetupPassword))
 	mux.HandleFunc("POST /api/auth/request-access", h.rateLimited(h.signupLimiter, h.handleRequestAccess))
 
+	// Probe enrollment — authenticated by a join token instead of a probe
+	// credential. The more specific pattern takes precedence over the
+	// authenticated /api/probes/ subtree.
+	mux.HandleFunc(http.MethodPost+" "+probeapi.PathEnroll, h.rateLimited(h.enrollLimiter, h.handleProbeEnroll))
+
 	// Probe routes — per-probe auth.
 	probe := http.NewServeMux()
 	probe.HandleFunc(http.MethodPost+" "+probeapi.PathRegister, h.handleProbeRegister)
 	probe.HandleFunc(http.MethodGet+" "+probeapi.PathChecks, h.handleProbeChecks)
+	probe.HandleFunc(http.MethodGet+" "+probeapi.PathRuns, h.handleProbeRuns)
+	probe.HandleFunc(http.MethodPost+" "+probeapi.PathRunResults, h.handleProbeRunResult)
 	probe.HandleFunc(http.MethodPost+" "+probeapi.PathHeartbeat, h.handleHeartbeat)
 	probe.HandleFunc(http.MethodPost+" "+probeapi.PathResults, h.handleResult)
 	mux.Handle("/api/probes/", h.requireProbeAuth(probe))
@@ -94,7 +133,13 @@ func (h *Handler) Routes() http.Handler {
 	mux.HandleFunc("GET /api/admin/signup-requests", h.requireAdmin(h.handleListSignupRequests))
 	mux.HandleFunc("POST /api/admin/signup-requests/{id}/approve", h.requireAdmin(h.handleApproveSignupRequest))
 	mux.HandleFunc("POST /api/admin/signup-requests/{id}/reject", h.requireAdmin(h.handleRejectSignupRequest))
+	mux.HandleFunc("GET /api/admin/probes", h.requireAdmin(h.handleListAdminProbes))
 	mux.HandleFunc("POST /api/admin/probes", h.requireAdmin(h.handleCreateProbeCredential))
+	mux.HandleFunc("POST /api/admin/probes/{id}/revoke", h.requireAdmin(h.handleRevokeProbe))
+	mux.HandleFunc("POST /api/admin/probes/{id}/rotate", h.requireAdmin(h.handleRotateProbeSecret))
+	mux.HandleFunc("PUT /api/admin/probes/{id}/labels", h.requireAdmin(h.handleSetProbeLabels))
+	mux.HandleFunc("POST /api/admin/probe-join-tokens", h.requireAdmin(h.handleCreateProbeJoinToken))
+	mux.HandleFunc("GET /api/admin/webhooks/destinations", h.requireAdmin(h.handleListWebhookDestinations))
 
 	// Dashboard routes — session auth.
 	mux.HandleFunc("GET /status", h.requireSession(h.handleStatus))
@@ -102,9 +147,14 @@ func (h *Handler) Routes() http.Handler {
 	mux.HandleFunc("POST /api/checks", h.requireSession(h.handleCreateCheck))
 	mux.HandleFunc("PUT /api/checks/{name}", h.requireSession(h.handleUpdateCheck))
 	mux.HandleFunc("DELETE /api/checks/{name}", h.requireSession(h.handleDeleteCheck))
+	mux.HandleFunc("POST /api/checks/run", h.rateLimited(h.runLimiter, h.requireSession(h.handleRunAdHocCheck)))
+	mux.HandleFunc("POST /api/checks/{name}/run", h.rateLimited(h.runLimiter, h.requireSession(h.handleRunCheck)))
 	mux.HandleFunc("GET /api/auth/me", h.requireSession(h.handleMe))
 	mux.HandleFunc("PUT /api/auth/change-password", h.requireSession(h.handleChangePassword))
 	mux.HandleFunc("GET /api/incidents", h.requireSession(h.handleListIncidents))
+	mux.HandleFunc("GET /api/incidents/{id}/evidence", h.requireSession(h.handleListIncidentEvidence))
+	mux.HandleFunc("GET /api/private-probes", h.requireSession(h.handleListPrivateProbes))
+	mux.HandleFunc("POST /api/private-probes", h.requireSession(h.handleCreatePrivateProbe))
 
 	return withRequestLog(withCORS(mux))
 }
@@ -114,7 +164,7 @@ func (h *Handler) Routes() http.Handler {
 func withCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+probeapi.HeaderProbeID+", "+probeapi.HeaderProbeSecret)
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, "+probeapi.HeaderProbeID+", "+probeapi.HeaderProbeSecret+", "+probeapi.HeaderTimestamp+", "+probeapi.HeaderNonce+", "+probeapi.HeaderSignature)
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
@@ -129,7 +179,7 @@ func (h *Handler) handleStatus(w http.ResponseWriter, r *http.Request) {
 	user := sessionUser(r)
 	logger := requestLogger(r)
 
-	checks, probes, err := buildAuthenticatedStatusResponse(h.monitoring, h.store, user.ID)
+	checks, probes, err := buildAuthenticatedStatusResponse(h.monitoring, h.store, user.ID, h.minProbeVersion())
 	if err != nil {
 		logger.Error("build status response failed", "component", "status", "err", err)
 		http.Error(w, "internal error", http.StatusInternalServerError)
@@ -174,33 +224,132 @@ func (h *Handler) handlePublicStatus(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleProbeChecks returns the probe-visible check set. This currently stays
-// global for all authenticated probes, but uses the stable check ID for probe
-// execution and keeps the tenant-scoped name as display metadata.
+// handleProbeChecks returns the checks the authenticated probe should run:
+// its owner's checks for a private probe, non-private checks for a shared one,
+// narrowed by each check's probe selector. It uses the stable check ID for
+// probe execution and keeps the tenant-scoped name as display metadata.
+//
+// The response carries the set's revision as an ETag. A request whose
+// If-None-Match matches the current revision gets 304 Not Modified; with a
+// wait query parameter the server first holds the request open until the set
+// changes or the wait elapses.
 func (h *Handler) handleProbeChecks(w http.ResponseWriter, r *http.Request) {
+	probe := authenticatedProbe(r)
 	logger := requestLogger(r)
-	checks, err := h.store.ListAllChecks()
+	wait, err := parseCheckWatchWait(r)
 	if err != nil {
-		logger.Error("list probe checks failed", "component", "probe", "err", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	payload := make([]proto.ProbeCheck, 0, len(checks))
-	for _, check := range checks {
-		payload = append(payload, proto.ProbeCheck{
-			ID:       check.ID,
-			Name:     check.Name,
-			Type:     string(check.Type),
-			Target:   check.Target,
-			Interval: check.Interval,
-		})
+	if wait > 0 {
+		// Long-polls outlive the server-wide write timeout.
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + 10*time.Second))
+	}
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+
+	for {
+		// Subscribe before reading so a change between the read and the wait
+		// still wakes this request.
+		changed := h.checkSets.Changed()
+		revision, body, err := h.probeCheckSet(*probe)
+		if err != nil {
+			logger.Error("list probe checks failed", "component", "probe", "err", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return
+		}
+		if revision != r.Header.Get("If-None-Match") {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("ETag", revision)
+			if _, err := w.Write(body); err != nil {
+				logger.Warn("write probe checks failed", "component", "probe", "err", err)
+			}
+			return
+		}
+		if wait <= 0 {
+			w.Header().Set("ETag", revision)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		select {
+		case <-changed:
+			// Labels or ownership may have changed while waiting.
+			reloaded, err := h.store.GetProbe(probe.ProbeID)
+			if err != nil {
+				logger.Error("reload probe failed", "component", "probe", "err", err)
+				http.Error(w, "internal error", http.StatusInternalServerError)
+				return
+			}
+			if reloaded == nil {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			probe = reloaded
+		case <-deadline.C:
+			w.Header().Set("ETag", revision)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// probeCheckSet returns the revision and encoded body of probe's check set.
+func (h *Handler) probeCheckSet(probe store.Probe) (string, []byte, error) {
+	all, err := h.store.ListAllChecks()
+	if err != nil {
+		return "", nil, err
 	}
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(payload); err != nil {
-		logger.Warn("encode probe checks failed", "component", "probe", "err", err)
+	return checkSetRevision(probeChecks(probe, all))
+}
+
+// probeChecks selects the checks probe runs from all and converts them to the
+// probe wire format.
+func probeChecks(probe store.Probe, all []checks.Check) []proto.ProbeCheck {
+	payload := make([]proto.ProbeCheck, 0, len(all))
+	for _, check := range all {
+		if !probeRunsCheck(probe, check) {
+			continue
+		}
+		payload = append(payload, toProbeCheck(check))
+	}
+	return payload
+}
+
+// toProbeCheck converts check to the probe wire format, for both scheduled
+// check sets and on-demand runs.
+func toProbeCheck(check checks.Check) proto.ProbeCheck {
+	return proto.ProbeCheck{
+		ID:            check.ID,
+		Name:          check.Name,
+		Type:          string(check.Type),
+		Target:        check.Target,
+		Interval:      check.Interval,
+		Retries:       check.Retries,
+		TLS:           check.TLS,
+		Send:          check.Send,
+		Expect:        check.Expect,
+		ExpectMode:    check.ExpectMode,
+		ReadTimeoutMS: check.ReadTimeoutMS,
 	}
 }
 
+// parseCheckWatchWait reads the optional long-poll wait, capped at
+// maxCheckWatchWait.
+func parseCheckWatchWait(r *http.Request) (time.Duration, error) {
+	raw := r.URL.Query().Get(probeapi.QueryWait)
+	if raw == "" {
+		return 0, nil
+	}
+	wait, err := time.ParseDuration(raw)
+	if err != nil || wait < 0 {
+		return 0, fmt.Errorf("invalid %s duration", probeapi.QueryWait)
+	}
+	return min(wait, maxCheckWatchWait), nil
+}
+
 // handleListChecks returns checks owned by the authenticated user.
 func (h *Handler) handleListChecks(w http.ResponseWriter, r *http.Request) {
 	user := sessionUser(r)
@@ -238,6 +387,7 @@ func (h *Handler) handleCreateCheck(w http.ResponseWriter, r *http.Request) {
 	if h.monitoring != nil {
 		h.monitoring.EnsureCheck(created.ID)
 	}
+	h.checkSets.Notify()
 	w.WriteHeader(http.StatusCreated)
 }
 
@@ -259,9 +409,40 @@ func (h *Handler) handleUpdateCheck(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	if err := h.applyCheckPlacement(name, user.ID); err != nil {
+		logger.Error("apply check placement failed", "component", "checks", "check_name", name, "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	h.checkSets.Notify()
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// applyCheckPlacement drops probes that no longer run the updated check from
+// its quorum.
+func (h *Handler) applyCheckPlacement(name string, userID int64) error {
+	if h.monitoring == nil {
+		return nil
+	}
+	check, err := h.store.GetCheckByName(name, userID)
+	if err != nil || check == nil {
+		return err
+	}
+	probes, err := h.store.ListProbes()
+	if err != nil {
+		return err
+	}
+	byID := make(map[string]store.Probe, len(probes))
+	for _, probe := range probes {
+		byID[probe.ProbeID] = probe
+	}
+	_, err = monitoring.ApplyCheckPlacement(h.monitoring, h.store, *check, func(probeID string) bool {
+		probe, ok := byID[probeID]
+		return ok && probeRunsCheck(probe, *check)
+	})
+	return err
+}
+
 func (h *Handler) decodeCheck(w http.ResponseWriter, r *http.Request, name string) (checks.Check, error) {
 	var check checks.Check
 	if err := decodeJSONBody(w, r, &check, maxJSONRequestBodyBytes, false); err != nil {
@@ -297,6 +478,9 @@ func (h *Handler) handleDeleteCheck(w http.ResponseWriter, r *http.Request) {
 	if deleted && h.monitoring != nil {
 		h.monitoring.RemoveCheck(checkID)
 	}
+	if deleted {
+		h.checkSets.Notify()
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -343,6 +527,9 @@ func (h *Handler) handleProbeRegister(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
+	// New capabilities or labels can change which checks the probe runs, so
+	// wake its pending long-poll rather than leaving it on a stale set.
+	h.checkSets.Notify()
 	logger.Info("probe registered", "component", "probe", "version", req.Version)
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -390,6 +577,7 @@ func (h *Handler) handleListIncidents(w http.ResponseWriter, r *http.Request) {
 		StartedAt        string            `json:"started_at"`
 		ResolvedAt       *string           `json:"resolved_at,omitempty"`
 		DurationMs       *int64            `json:"duration_ms,omitempty"`
+		ProbableCause    string            `json:"probable_cause,omitempty"`
 		DownNotification *notificationJSON `json:"down_notification,omitempty"`
 		UpNotification   *notificationJSON `json:"up_notification,omitempty"`
 	}
@@ -397,10 +585,11 @@ func (h *Handler) handleListIncidents(w http.ResponseWriter, r *http.Request) {
 	out := make([]incidentJSON, 0, len(incidents))
 	for _, inc := range incidents {
 		ij := incidentJSON{
-			ID:        inc.ID,
-			CheckID:   inc.CheckID,
-			CheckName: inc.CheckName,
-			StartedAt: inc.StartedAt.UTC().Format(time.RFC3339),
+			ID:            inc.ID,
+			CheckID:       inc.CheckID,
+			CheckName:     inc.CheckName,
+			StartedAt:     inc.StartedAt.UTC().Format(time.RFC3339),
+			ProbableCause: inc.ProbableCause,
 		}
 		if inc.ResolvedAt != nil {
 			s := inc.ResolvedAt.UTC().Format(time.RFC3339)
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tmater/wacht/internal/proto"
+	"github.com/tmater/wacht/internal/store"
+)
+
+// incidentEvidenceStore reads the failed-response snapshots kept with an
+// incident.
+type incidentEvidenceStore interface {
+	ListIncidentEvidence(userID, incidentID int64) ([]store.IncidentEvidence, bool, error)
+}
+
+type incidentEvidenceDTO struct {
+	ProbeID       string            `json:"probe_id"`
+	CapturedAt    string            `json:"captured_at"`
+	Status        string            `json:"status,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	Body          string            `json:"body,omitempty"`
+	BodyTruncated bool              `json:"body_truncated,omitempty"`
+	RemoteAddr    string            `json:"remote_addr,omitempty"`
+	Path          *incidentPathDTO  `json:"path,omitempty"`
+}
+
+type incidentPathDTO struct {
+	Target  string               `json:"target"`
+	Reached bool                 `json:"reached"`
+	Error   string               `json:"error,omitempty"`
+	Hops    []incidentPathHopDTO `json:"hops"`
+}
+
+// incidentPathHopDTO is one traceroute hop; Addr is empty when the hop did
+// not answer.
+type incidentPathHopDTO struct {
+	TTL   int    `json:"ttl"`
+	Addr  string `json:"addr,omitempty"`
+	RTTMS int64  `json:"rtt_ms"`
+}
+
+// handleListIncidentEvidence returns the responses probes received while one
+// of the authenticated user's incidents was open, oldest first.
+func (h *Handler) handleListIncidentEvidence(w http.ResponseWriter, r *http.Request) {
+	user := sessionUser(r)
+	logger := requestLogger(r)
+
+	incidentID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || incidentID <= 0 {
+		http.Error(w, "invalid incident id", http.StatusBadRequest)
+		return
+	}
+
+	evidence, found, err := h.incidentEvidence.ListIncidentEvidence(user.ID, incidentID)
+	if err != nil {
+		logger.Error("list incident evidence failed", "component", "incidents", "incident_id", incidentID, "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "incident not found", http.StatusNotFound)
+		return
+	}
+
+	out := make([]incidentEvidenceDTO, 0, len(evidence))
+	for _, item := range evidence {
+		out = append(out, incidentEvidenceDTO{
+			ProbeID:       item.ProbeID,
+			CapturedAt:    item.CapturedAt.UTC().Format(time.RFC3339),
+			Status:        item.Evidence.Status,
+			Headers:       item.Evidence.Headers,
+			Body:          item.Evidence.Body,
+			BodyTruncated: item.Evidence.BodyTruncated,
+			RemoteAddr:    item.Evidence.RemoteAddr,
+			Path:          incidentPath(item.Path),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		logger.Warn("encode incident evidence failed", "component", "incidents", "err", err)
+	}
+}
+
+func incidentPath(path *proto.NetworkPath) *incidentPathDTO {
+	if path == nil {
+		return nil
+	}
+	out := &incidentPathDTO{
+		Target:  path.Target,
+		Reached: path.Reached,
+		Error:   path.Error,
+		Hops:    make([]incidentPathHopDTO, 0, len(path.Hops)),
+	}
+	for _, hop := range path.Hops {
+		out.Hops = append(out.Hops, incidentPathHopDTO{TTL: hop.TTL, Addr: hop.Addr, RTTMS: hop.RTT.Milliseconds()})
+	}
+	return out
+}
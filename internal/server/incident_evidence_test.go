@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tmater/wacht/internal/proto"
+	"github.com/tmater/wacht/internal/store"
+)
+
+type fakeIncidentEvidenceStore struct {
+	listFn func(userID, incidentID int64) ([]store.IncidentEvidence, bool, error)
+}
+
+func (f *fakeIncidentEvidenceStore) ListIncidentEvidence(userID, incidentID int64) ([]store.IncidentEvidence, bool, error) {
+	return f.listFn(userID, incidentID)
+}
+
+func serveIncidentEvidence(h *Handler, id string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/incidents/"+id+"/evidence", nil)
+	req.SetPathValue("id", id)
+	req = req.WithContext(context.WithValue(req.Context(), contextKeyUser, &store.User{ID: 7}))
+	rec := httptest.NewRecorder()
+	h.handleListIncidentEvidence(rec, req)
+	return rec
+}
+
+func TestHandleListIncidentEvidenceReturnsSnapshots(t *testing.T) {
+	capturedAt := time.Date(2026, time.April, 8, 12, 0, 0, 0, time.UTC)
+	h := &Handler{incidentEvidence: &fakeIncidentEvidenceStore{
+		listFn: func(userID, incidentID int64) ([]store.IncidentEvidence, bool, error) {
+			if userID != 7 || incidentID != 42 {
+				t.Fatalf("ListIncidentEvidence(%d, %d), want (7, 42)", userID, incidentID)
+			}
+			return []store.IncidentEvidence{{
+				ID:         1,
+				ProbeID:    "probe-a",
+				CapturedAt: capturedAt,
+				Evidence: proto.HTTPEvidence{
+					Status:     "HTTP/1.1 503 Service Unavailable",
+					Headers:    map[string]string{"Server": "nginx"},
+					Body:       "maintenance",
+					RemoteAddr: "203.0.113.7:443",
+				},
+			}, {
+				ID:         2,
+				ProbeID:    "probe-b",
+				CapturedAt: capturedAt.Add(time.Second),
+				Path: &proto.NetworkPath{
+					Target: "203.0.113.7:443",
+					Hops:   []proto.PathHop{{TTL: 1, Addr: "192.0.2.1", RTT: 3 * time.Millisecond}, {TTL: 2}},
+					Error:  "no answer from the last 5 hops",
+				},
+			}}, true, nil
+		},
+	}}
+
+	rec := serveIncidentEvidence(h, "42")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body=%s", rec.Code, rec.Body.String())
+	}
+	var got []incidentEvidenceDTO
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("evidence = %d, want 2", len(got))
+	}
+	if got[0].ProbeID != "probe-a" || got[0].Status != "HTTP/1.1 503 Service Unavailable" || got[0].Headers["Server"] != "nginx" || got[0].RemoteAddr != "203.0.113.7:443" {
+		t.Fatalf("evidence = %+v", got[0])
+	}
+	if got[0].CapturedAt != capturedAt.Format(time.RFC3339) {
+		t.Fatalf("captured_at = %q, want %s", got[0].CapturedAt, capturedAt.Format(time.RFC3339))
+	}
+	if got[0].Path != nil {
+		t.Fatalf("response evidence path = %+v, want none", got[0].Path)
+	}
+	path := got[1].Path
+	if got[1].Status != "" || path == nil || path.Reached || len(path.Hops) != 2 {
+		t.Fatalf("path evidence = %+v, want an unreached two-hop path", got[1])
+	}
+	if path.Hops[0] != (incidentPathHopDTO{TTL: 1, Addr: "192.0.2.1", RTTMS: 3}) || path.Hops[1] != (incidentPathHopDTO{TTL: 2}) {
+		t.Fatalf("hops = %+v", path.Hops)
+	}
+}
+
+func TestHandleListIncidentEvidenceRejectsUnknownIncident(t *testing.T) {
+	h := &Handler{incidentEvidence: &fakeIncidentEvidenceStore{
+		listFn: func(userID, incidentID int64) ([]store.IncidentEvidence, bool, error) {
+			return nil, false, nil
+		},
+	}}
+
+	if rec := serveIncidentEvidence(h, "42"); rec.Code != http.StatusNotFound {
+		t.Fatalf("status = %d, want 404", rec.Code)
+	}
+	if rec := serveIncidentEvidence(h, "abc"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", rec.Code)
+	}
+}
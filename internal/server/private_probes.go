@@ -0,0 +1,74 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	probeapi "github.com/tmater/wacht/internal/api/probe"
+	"github.com/tmater/wacht/internal/monitoring"
+)
+
+// privateProbeDTO is the API response shape for one probe owned by the
+// requesting user.
+type privateProbeDTO struct {
+	ProbeID    string            `json:"probe_id"`
+	Version    string            `json:"version,omitempty"`
+	Outdated   bool              `json:"outdated"`
+	Labels     map[string]string `json:"labels"`
+	Status     string            `json:"status"`
+	Online     bool              `json:"online"`
+	LastSeenAt *string           `json:"last_seen_at,omitempty"`
+}
+
+// handleCreatePrivateProbe creates a probe credential owned by the
+// authenticated user. The probe only runs that user's checks, so it can be
+// deployed inside a private network.
+func (h *Handler) handleCreatePrivateProbe(w http.ResponseWriter, r *http.Request) {
+	h.createProbeCredential(w, r, sessionUser(r).ID, "private_probes")
+}
+
+// minProbeVersion returns the configured minimum probe build, or the zero
+// version when none is set.
+func (h *Handler) minProbeVersion() probeapi.Version {
+	if h.config == nil {
+		return probeapi.Version{}
+	}
+	return h.config.MinProbeVersionParsed
+}
+
+// handleListPrivateProbes returns the probes owned by the authenticated user
+// with their current runtime state.
+func (h *Handler) handleListPrivateProbes(w http.ResponseWriter, r *http.Request) {
+	user := sessionUser(r)
+	logger := requestLogger(r)
+	probes, err := h.probeCredentials.ListOwnedProbes(user.ID)
+	if err != nil {
+		logger.Error("list private probes failed", "component", "private_probes", "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]privateProbeDTO, 0, len(probes))
+	for _, probe := range probes {
+		item := privateProbeDTO{
+			ProbeID:    probe.ProbeID,
+			Version:    probe.Version,
+			Outdated:   probeOutdated(probe, h.minProbeVersion()),
+			Labels:     probe.Labels,
+			Status:     string(monitoring.ProbeStateOffline),
+			LastSeenAt: formatOptionalTimestamp(probe.LastSeenAt),
+		}
+		if h.monitoring != nil {
+			if state, err := h.monitoring.ProbeSnapshot(probe.ProbeID); err == nil {
+				item.Status = string(state.State)
+				item.Online = state.State == monitoring.ProbeStateOnline
+			}
+		}
+		items = append(items, item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(items); err != nil {
+		logger.Warn("encode private probes failed", "component", "private_probes", "err", err)
+	}
+}
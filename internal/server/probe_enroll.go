@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	probeapi "github.com/tmater/wacht/internal/api/probe"
+	"github.com/tmater/wacht/internal/labels"
+	"github.com/tmater/wacht/internal/store"
+)
+
+const (
+	// defaultJoinTokenTTL and maxJoinTokenTTL bound how long a join token can
+	// enroll probes.
+	defaultJoinTokenTTL = time.Hour
+	maxJoinTokenTTL     = 7 * 24 * time.Hour
+	// maxJoinTokenUses caps how many probes one join token may enroll.
+	maxJoinTokenUses = 1000
+	// maxEnrollmentIDLength bounds the client-generated enrollment ID.
+	maxEnrollmentIDLength = 128
+)
+
+// probeEnrollmentStore mints join tokens and exchanges them for probe
+// credentials.
+type probeEnrollmentStore interface {
+	CreateProbeJoinToken(labels map[string]string, maxUses int, ttl time.Duration) (store.ProbeJoinToken, error)
+	EnrollProbe(token, requestedProbeID, enrollmentID string) (store.ProbeCredential, error)
+}
+
+type createProbeJoinTokenRequest struct {
+	Labels  map[string]string `json:"labels"`
+	MaxUses int               `json:"max_uses"`
+	TTL     string            `json:"ttl"`
+}
+
+// handleCreateProbeJoinToken mints a short-lived, limited-use join token that
+// new probes exchange for their credential. Probes enrolled with the token
+// get its labels as admin-set labels. Protected by requireAdmin.
+func (h *Handler) handleCreateProbeJoinToken(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	var req createProbeJoinTokenRequest
+	if err := decodeJSONBody(w, r, &req, maxJSONRequestBodyBytes, true); err != nil {
+		if writeProcessorError(w, err) {
+			return
+		}
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	maxUses, ttl, err := validateJoinTokenRequest(req)
+	if err != nil {
+		writeProcessorError(w, err)
+		return
+	}
+
+	token, err := h.probeEnrollment.CreateProbeJoinToken(req.Labels, maxUses, ttl)
+	if err != nil {
+		logger.Error("create probe join token failed", "component", "admin", "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("probe join token created", "component", "admin", "max_uses", maxUses, "expires_at", token.ExpiresAt, "labels", req.Labels)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(map[string]any{
+		"token":      token.Token,
+		"max_uses":   token.MaxUses,
+		"expires_at": token.ExpiresAt.UTC().Format(time.RFC3339),
+	}); err != nil {
+		logger.Warn("encode probe join token failed", "component", "admin", "err", err)
+	}
+}
+
+// validateJoinTokenRequest applies defaults and limits to a join token
+// request, returning the use count and lifetime to mint it with.
+func validateJoinTokenRequest(req createProbeJoinTokenRequest) (int, time.Duration, error) {
+	if err := labels.Validate(req.Labels); err != nil {
+		return 0, 0, &badRequestError{message: err.Error()}
+	}
+	maxUses := req.MaxUses
+	switch {
+	case maxUses == 0:
+		maxUses = 1
+	case maxUses < 0 || maxUses > maxJoinTokenUses:
+		return 0, 0, &badRequestError{message: fmt.Sprintf("max_uses must be between 1 and %d", maxJoinTokenUses)}
+	}
+	ttl := defaultJoinTokenTTL
+	if req.TTL != "" {
+		parsed, err := time.ParseDuration(req.TTL)
+		if err != nil || parsed <= 0 || parsed > maxJoinTokenTTL {
+			return 0, 0, &badRequestError{message: fmt.Sprintf("ttl must be a positive duration of at most %s", maxJoinTokenTTL)}
+		}
+		ttl = parsed
+	}
+	return maxUses, ttl, nil
+}
+
+// handleProbeEnroll exchanges a join token for a long-lived probe credential.
+// The new probe then authenticates like any other through requireProbeAuth.
+func (h *Handler) handleProbeEnroll(w http.ResponseWriter, r *http.Request) {
+	logger := requestLogger(r)
+	var req probeapi.EnrollRequest
+	if err := decodeJSONBody(w, r, &req, maxJSONRequestBodyBytes, false); err != nil {
+		if writeProcessorError(w, err) {
+			return
+		}
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if req.Token == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.EnrollmentID) > maxEnrollmentIDLength {
+		http.Error(w, "enrollment_id is too long", http.StatusBadRequest)
+		return
+	}
+
+	credential, err := h.probeEnrollment.EnrollProbe(req.Token, req.ProbeID, req.EnrollmentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidJoinToken):
+			err = &unauthorizedError{message: "invalid join token"}
+		case errors.Is(err, store.ErrInvalidProbeID):
+			err = &badRequestError{message: "probe_id must be 1-64 letters, numbers, dots, underscores, or hyphens and start with a letter or number"}
+		case errors.Is(err, store.ErrProbeAlreadyExists):
+			err = &badRequestError{message: "probe_id already exists"}
+		default:
+			err = fmt.Errorf("enroll probe: %w", err)
+		}
+		if writeProcessorError(w, err) {
+			return
+		}
+		logger.Error("enroll probe failed", "component", "probe", "probe_id", req.ProbeID, "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	h.monitoring.AddProbe(credential.ProbeID)
+
+	logger.Info("probe enrolled", "component", "probe", "probe_id", credential.ProbeID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(probeapi.EnrollResponse{ProbeID: credential.ProbeID, Secret: credential.Secret}); err != nil {
+		logger.Warn("encode enrolled probe credential failed", "component", "probe", "probe_id", credential.ProbeID, "err", err)
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	probeapi "github.com/tmater/wacht/internal/api/probe"
+	"github.com/tmater/wacht/internal/config"
+	"github.com/tmater/wacht/internal/monitoring"
+	"github.com/tmater/wacht/internal/store"
+)
+
+type fakeProbeEnrollmentStore struct {
+	createFn func(labels map[string]string, maxUses int, ttl time.Duration) (store.ProbeJoinToken, error)
+	enrollFn func(token, requestedProbeID, enrollmentID string) (store.ProbeCredential, error)
+}
+
+func (f fakeProbeEnrollmentStore) CreateProbeJoinToken(labels map[string]string, maxUses int, ttl time.Duration) (store.ProbeJoinToken, error) {
+	return f.createFn(labels, maxUses, ttl)
+}
+
+func (f fakeProbeEnrollmentStore) EnrollProbe(token, requestedProbeID, enrollmentID string) (store.ProbeCredential, error) {
+	return f.enrollFn(token, requestedProbeID, enrollmentID)
+}
+
+func TestHandleCreateProbeJoinTokenAppliesDefaults(t *testing.T) {
+	h := &Handler{
+		probeEnrollment: fakeProbeEnrollmentStore{
+			createFn: func(labels map[string]string, maxUses int, ttl time.Duration) (store.ProbeJoinToken, error) {
+				if labels["region"] != "eu-west" || maxUses != 1 || ttl != defaultJoinTokenTTL {
+					t.Fatalf("CreateProbeJoinToken(%v, %d, %s), want region eu-west, 1 use, default ttl", labels, maxUses, ttl)
+				}
+				return store.ProbeJoinToken{Token: "join-1", MaxUses: maxUses, ExpiresAt: time.Date(2026, time.October, 1, 13, 0, 0, 0, time.UTC)}, nil
+			},
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	h.handleCreateProbeJoinToken(rec, httptest.NewRequest(http.MethodPost, "/api/admin/probe-join-tokens", bytes.NewBufferString(`{"labels":{"region":"eu-west"}}`)))
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201", rec.Code)
+	}
+	var body map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if body["token"] != "join-1" || body["expires_at"] != "2026-10-01T13:00:00Z" {
+		t.Fatalf("body = %v, want join-1 token", body)
+	}
+}
+
+func TestValidateJoinTokenRequestRejectsOutOfRangeValues(t *testing.T) {
+	for _, req := range []createProbeJoinTokenRequest{
+		{MaxUses: -1},
+		{MaxUses: maxJoinTokenUses + 1},
+		{TTL: "soon"},
+		{TTL: "0s"},
+		{TTL: "720h"},
+		{Labels: map[string]string{"": "eu"}},
+	} {
+		if _, _, err := validateJoinTokenRequest(req); err == nil {
+			t.Fatalf("validateJoinTokenRequest(%+v) error = nil, want bad request", req)
+		}
+	}
+	maxUses, ttl, err := validateJoinTokenRequest(createProbeJoinTokenRequest{MaxUses: 10, TTL: "24h"})
+	if err != nil || maxUses != 10 || ttl != 24*time.Hour {
+		t.Fatalf("validateJoinTokenRequest() = %d, %s, %v, want 10, 24h", maxUses, ttl, err)
+	}
+}
+
+func TestProbeEnrollRouteIssuesCredentialWithoutProbeAuth(t *testing.T) {
+	runtime := monitoring.NewRuntime(nil, nil)
+	h := &Handler{
+		monitoring: runtime,
+		config:     &config.ServerConfig{},
+		probeEnrollment: fakeProbeEnrollmentStore{
+			enrollFn: func(token, requestedProbeID, enrollmentID string) (store.ProbeCredential, error) {
+				if token != "join-1" || requestedProbeID != "edge-1" || enrollmentID != "enroll-1" {
+					t.Fatalf("EnrollProbe(%q, %q, %q), want join-1 for edge-1 with enroll-1", token, requestedProbeID, enrollmentID)
+				}
+				return store.ProbeCredential{ProbeID: "edge-1", Secret: "secret-1"}, nil
+			},
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, probeapi.PathEnroll, bytes.NewBufferString(`{"token":"join-1","probe_id":"edge-1","enrollment_id":"enroll-1"}`))
+	rec := httptest.NewRecorder()
+	h.Routes().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want 201: %s", rec.Code, rec.Body.String())
+	}
+	var body probeapi.EnrollResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if body != (probeapi.EnrollResponse{ProbeID: "edge-1", Secret: "secret-1"}) {
+		t.Fatalf("body = %+v, want edge-1 credential", body)
+	}
+	if _, err := runtime.ProbeSnapshot("edge-1"); err != nil {
+		t.Fatalf("runtime missing enrolled probe: %v", err)
+	}
+}
+
+func TestHandleProbeEnrollMapsInvalidToken(t *testing.T) {
+	h := &Handler{
+		probeEnrollment: fakeProbeEnrollmentStore{
+			enrollFn: func(string, string, string) (store.ProbeCredential, error) {
+				return store.ProbeCredential{}, store.ErrInvalidJoinToken
+			},
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	h.handleProbeEnroll(rec, httptest.NewRequest(http.MethodPost, probeapi.PathEnroll, bytes.NewBufferString(`{"token":"spent"}`)))
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", rec.Code)
+	}
+}
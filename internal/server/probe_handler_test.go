@@ -19,6 +19,8 @@ import (
 type fakeProbeProcessor struct {
 	heartbeatFn    func(probe *store.Probe, req probeapi.HeartbeatRequest) error
 	registerFn     func(probe *store.Probe, req probeapi.RegisterRequest) error
+	setLabelsFn    func(probeID string, labels map[string]string) (*store.Probe, error)
+	revokeFn       func(probeID string) (*store.Probe, error)
 	processBatchFn func(probe *store.Probe, incoming []proto.CheckResult) error
 }
 
@@ -30,6 +32,14 @@ func (f fakeProbeProcessor) Register(probe *store.Probe, req probeapi.RegisterRe
 	return f.registerFn(probe, req)
 }
 
+func (f fakeProbeProcessor) SetLabels(probeID string, labels map[string]string) (*store.Probe, error) {
+	return f.setLabelsFn(probeID, labels)
+}
+
+func (f fakeProbeProcessor) Revoke(probeID string) (*store.Probe, error) {
+	return f.revokeFn(probeID)
+}
+
 func (f fakeProbeProcessor) ProcessBatch(probe *store.Probe, incoming []proto.CheckResult) error {
 	return f.processBatchFn(probe, incoming)
 }
@@ -84,9 +94,34 @@ func TestHandleProbeRegisterMapsInternalError(t *testing.T) {
 	}
 }
 
+func TestHandleProbeRegisterWakesCheckSetWaiters(t *testing.T) {
+	h := &Handler{
+		checkSets: newCheckSetNotifier(),
+		probeProcessor: fakeProbeProcessor{
+			registerFn: func(probe *store.Probe, req probeapi.RegisterRequest) error { return nil },
+		},
+	}
+	changed := h.checkSets.Changed()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/probes/register", bytes.NewBufferString(`{"probe_id":"probe-1","version":"v1.0.0","check_types":["http"]}`))
+	req = req.WithContext(context.WithValue(req.Context(), contextKeyProbe, &store.Probe{ProbeID: "probe-1"}))
+	rec := httptest.NewRecorder()
+
+	h.handleProbeRegister(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want 204", rec.Code)
+	}
+	select {
+	case <-changed:
+	default:
+		t.Fatal("register did not wake check set waiters")
+	}
+}
+
 func TestHandleResultMapsBadRequestError(t *testing.T) {
 	h := &Handler{
-		webhooks: alert.NewSender(nil, network.Policy{}),
+		webhooks: alert.NewSender(nil, network.Policy{}, alert.Options{}),
 		probeProcessor: fakeProbeProcessor{
 			heartbeatFn: func(probe *store.Probe, req probeapi.HeartbeatRequest) error { return nil },
 			registerFn:  func(probe *store.Probe, req probeapi.RegisterRequest) error { return nil },
@@ -113,7 +148,7 @@ func TestHandleResultMapsBadRequestError(t *testing.T) {
 
 func TestHandleResultReturnsNoContentOnProcessorSuccess(t *testing.T) {
 	h := &Handler{
-		webhooks: alert.NewSender(nil, network.Policy{}),
+		webhooks: alert.NewSender(nil, network.Policy{}, alert.Options{}),
 		probeProcessor: fakeProbeProcessor{
 			heartbeatFn:    func(probe *store.Probe, req probeapi.HeartbeatRequest) error { return nil },
 			registerFn:     func(probe *store.Probe, req probeapi.RegisterRequest) error { return nil },
@@ -135,7 +170,7 @@ func TestHandleResultReturnsNoContentOnProcessorSuccess(t *testing.T) {
 
 func TestHandleResultRejectsEmptyBatch(t *testing.T) {
 	h := &Handler{
-		webhooks: alert.NewSender(nil, network.Policy{}),
+		webhooks: alert.NewSender(nil, network.Policy{}, alert.Options{}),
 		probeProcessor: fakeProbeProcessor{
 			heartbeatFn: func(probe *store.Probe, req probeapi.HeartbeatRequest) error { return nil },
 			registerFn:  func(probe *store.Probe, req probeapi.RegisterRequest) error { return nil },
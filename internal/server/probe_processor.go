@@ -4,18 +4,28 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
 	"time"
 
 	probeapi "github.com/tmater/wacht/internal/api/probe"
 	"github.com/tmater/wacht/internal/checks"
+	"github.com/tmater/wacht/internal/labels"
 	"github.com/tmater/wacht/internal/monitoring"
 	"github.com/tmater/wacht/internal/proto"
 	"github.com/tmater/wacht/internal/store"
 )
 
+// maxDegradedReasonLength bounds the self-test failure reason kept from a
+// probe heartbeat.
+const maxDegradedReasonLength = 512
+
 type probeStore interface {
-	RegisterProbe(probeID, version string) error
+	RegisterProbe(probeID string, reg store.ProbeRegistration) (*store.Probe, error)
+	SetProbeAdminLabels(probeID string, labels map[string]string) (*store.Probe, error)
+	RevokeProbe(probeID string) (*store.Probe, error)
 	GetCheckByID(checkID string) (*checks.Check, error)
+	ListAllChecks() ([]checks.Check, error)
 	PersistMonitoringWrite(write store.MonitoringWrite) (store.MonitoringWrite, error)
 	PersistMonitoringBatch(writes []store.MonitoringWrite) ([]store.MonitoringWrite, error)
 }
@@ -23,12 +33,15 @@ type probeStore interface {
 type probeProcessor interface {
 	Heartbeat(probe *store.Probe, req probeapi.HeartbeatRequest) error
 	Register(probe *store.Probe, req probeapi.RegisterRequest) error
+	SetLabels(probeID string, labels map[string]string) (*store.Probe, error)
+	Revoke(probeID string) (*store.Probe, error)
 	ProcessBatch(probe *store.Probe, incoming []proto.CheckResult) error
 }
 
 type ProbeProcessor struct {
-	store   probeStore
-	runtime *monitoring.Runtime
+	store      probeStore
+	runtime    *monitoring.Runtime
+	minVersion probeapi.Version
 }
 
 // NewProbeProcessor builds the probe ingress adapter around store and runtime
@@ -37,6 +50,12 @@ func NewProbeProcessor(store probeStore, runtime *monitoring.Runtime) *ProbeProc
 	return &ProbeProcessor{store: store, runtime: runtime}
 }
 
+// SetMinProbeVersion makes Register refuse probes built before minimum. The
+// zero version accepts any build.
+func (p *ProbeProcessor) SetMinProbeVersion(minimum probeapi.Version) {
+	p.minVersion = minimum
+}
+
 // Heartbeat validates the authenticated probe heartbeat request and delegates
 // the liveness update to the monitoring runtime.
 func (p *ProbeProcessor) Heartbeat(probe *store.Probe, req probeapi.HeartbeatRequest) error {
@@ -46,14 +65,22 @@ func (p *ProbeProcessor) Heartbeat(probe *store.Probe, req probeapi.HeartbeatReq
 	if req.ProbeID != "" && req.ProbeID != probe.ProbeID {
 		return &badRequestError{message: "probe_id does not match authenticated probe"}
 	}
-	p.runtime.AddProbe(probe.ProbeID)
-	if err := monitoring.ApplyHeartbeat(p.runtime, p.store, probe.ProbeID, time.Now().UTC()); err != nil {
+	degraded := strings.TrimSpace(req.Degraded)
+	if len(degraded) > maxDegradedReasonLength {
+		// Truncate rather than reject: refusing the heartbeat would turn a
+		// degraded probe into an offline one.
+		degraded = strings.ToValidUTF8(degraded[:maxDegradedReasonLength], "")
+	}
+	p.runtime.AddOwnedProbe(probe.ProbeID, probe.OwnerUserID)
+	if err := monitoring.ApplyHeartbeat(p.runtime, p.store, probe.ProbeID, time.Now().UTC(), degraded); err != nil {
 		return fmt.Errorf("apply heartbeat: %w", err)
 	}
 	return nil
 }
 
-// Register records authenticated probe startup metadata.
+// Register records authenticated probe startup metadata, including the check
+// types it can run and the labels it declares about itself. Probes built
+// before the configured minimum version are refused.
 func (p *ProbeProcessor) Register(probe *store.Probe, req probeapi.RegisterRequest) error {
 	if probe == nil {
 		return fmt.Errorf("probe is required")
@@ -61,13 +88,135 @@ func (p *ProbeProcessor) Register(probe *store.Probe, req probeapi.RegisterReque
 	if req.ProbeID != "" && req.ProbeID != probe.ProbeID {
 		return &badRequestError{message: "probe_id does not match authenticated probe"}
 	}
-	if err := p.store.RegisterProbe(probe.ProbeID, req.Version); err != nil {
+	if err := labels.Validate(req.Labels); err != nil {
+		return &badRequestError{message: err.Error()}
+	}
+	checkTypes, err := checks.NormalizeTypes(req.CheckTypes)
+	if err != nil {
+		return &badRequestError{message: err.Error()}
+	}
+	if probeVersionOutdated(req.Version, p.minVersion) {
+		return &upgradeRequiredError{message: fmt.Sprintf("probe version %q is below the minimum %s", req.Version, p.minVersion)}
+	}
+	registered, err := p.store.RegisterProbe(probe.ProbeID, store.ProbeRegistration{
+		Version:         req.Version,
+		ProtocolVersion: req.ProtocolVersion,
+		CheckTypes:      checkTypes,
+		Labels:          req.Labels,
+	})
+	if err != nil {
 		return err
 	}
-	p.runtime.AddProbe(probe.ProbeID)
+	p.runtime.AddOwnedProbe(probe.ProbeID, probe.OwnerUserID)
+	if registered == nil {
+		return nil
+	}
+	return p.placeProbe(*registered)
+}
+
+// SetLabels replaces the admin-set labels of a probe and returns the updated
+// probe, or nil when the probe does not exist.
+func (p *ProbeProcessor) SetLabels(probeID string, set map[string]string) (*store.Probe, error) {
+	if err := labels.Validate(set); err != nil {
+		return nil, &badRequestError{message: err.Error()}
+	}
+	updated, err := p.store.SetProbeAdminLabels(probeID, set)
+	if err != nil || updated == nil {
+		return updated, err
+	}
+	return updated, p.placeProbe(*updated)
+}
+
+// Revoke disables a probe's credential and drops the probe from the
+// monitoring runtime, so it stops voting in quorums and counting toward fleet
+// health at once. Revoking an already revoked probe repeats the runtime
+// cleanup, so a retry after a failed cleanup succeeds. It returns nil when the
+// probe does not exist.
+func (p *ProbeProcessor) Revoke(probeID string) (*store.Probe, error) {
+	revoked, err := p.store.RevokeProbe(probeID)
+	if errors.Is(err, store.ErrProbeConfigManaged) {
+		return nil, &conflictError{message: "probe is provisioned by server config; remove it from the config file instead"}
+	}
+	if err != nil || revoked == nil {
+		return revoked, err
+	}
+	all, err := p.store.ListAllChecks()
+	if err != nil {
+		return nil, fmt.Errorf("list checks: %w", err)
+	}
+	if err := monitoring.RemoveProbe(p.runtime, p.store, probeID, all); err != nil {
+		return nil, fmt.Errorf("remove probe from runtime: %w", err)
+	}
+	return revoked, nil
+}
+
+// placeProbe drops probe from the quorum of every check it no longer runs.
+func (p *ProbeProcessor) placeProbe(probe store.Probe) error {
+	all, err := p.store.ListAllChecks()
+	if err != nil {
+		return fmt.Errorf("list checks: %w", err)
+	}
+	for _, check := range all {
+		if probeRunsCheck(probe, check) {
+			continue
+		}
+		if _, err := monitoring.ApplyCheckPlacement(p.runtime, p.store, check, func(id string) bool { return id != probe.ProbeID }); err != nil {
+			return fmt.Errorf("apply placement for check %q: %w", check.ID, err)
+		}
+	}
 	return nil
 }
 
+// legacyCheckTypes are the check types assumed for probes that registered
+// before advertising their capabilities; those builds ran exactly these.
+var legacyCheckTypes = []string{string(checks.CheckHTTP), string(checks.CheckTCP), string(checks.CheckDNS)}
+
+// probeRunsCheck reports whether probe should execute check and vote in its
+// quorum. A probe only runs check types it supports. Private probes only run
+// their owner's checks and shared probes never run private checks; within
+// that, the check's probe selector decides.
+func probeRunsCheck(probe store.Probe, check checks.Check) bool {
+	if !probeSupportsCheckType(probe, string(check.Type)) {
+		return false
+	}
+	if probe.OwnerUserID != 0 {
+		if check.OwnerID != probe.OwnerUserID {
+			return false
+		}
+	} else if check.Private {
+		return false
+	}
+	return check.SelectsProbe(probe.Labels)
+}
+
+func probeSupportsCheckType(probe store.Probe, checkType string) bool {
+	supported := probe.CheckTypes
+	if len(supported) == 0 {
+		supported = legacyCheckTypes
+	}
+	return slices.Contains(supported, checkType)
+}
+
+// probeVersionOutdated reports whether a probe build version is older than
+// minimum. Versions that do not parse, such as development builds, count as
+// outdated once a minimum is configured.
+func probeVersionOutdated(version string, minimum probeapi.Version) bool {
+	if minimum.IsZero() {
+		return false
+	}
+	v, err := probeapi.ParseVersion(version)
+	return err != nil || v.Less(minimum)
+}
+
+// probeOutdated reports whether a registered probe speaks an older probe
+// protocol or runs a build below minimum.
+func probeOutdated(probe store.Probe, minimum probeapi.Version) bool {
+	if probe.RegisteredAt == nil {
+		return false
+	}
+	return probe.ProtocolVersion < probeapi.ProtocolVersion || probeVersionOutdated(probe.Version, minimum)
+}
+
 // ProcessBatch validates and normalizes one flushed probe result batch before
 // handing the accepted results off to runtime-owned monitoring logic.
 func (p *ProbeProcessor) ProcessBatch(probe *store.Probe, incoming []proto.CheckResult) error {
@@ -86,9 +235,13 @@ func (p *ProbeProcessor) ProcessBatch(probe *store.Probe, incoming []proto.Check
 	for _, item := range normalized {
 		slog.Default().Debug("probe result received", "component", "probe", "check_id", item.Result.CheckID, "check_name", item.Result.CheckName, "probe_id", item.Result.ProbeID, "up", item.Result.Up)
 	}
-	if err := monitoring.ApplyResultBatch(p.runtime, p.store, normalized); err != nil {
+	stale, err := monitoring.ApplyResultBatch(p.runtime, p.store, normalized)
+	if err != nil {
 		return fmt.Errorf("apply result batch: %w", err)
 	}
+	if stale > 0 {
+		slog.Default().Info("dropping duplicate or out-of-order probe results", "component", "probe", "probe_id", probe.ProbeID, "count", stale)
+	}
 	return nil
 }
 
@@ -103,7 +256,7 @@ func (p *ProbeProcessor) normalizeBatch(probe *store.Probe, incoming []proto.Che
 			return nil, err
 		}
 		if skip {
-			slog.Default().Debug("dropping result for unknown or invalid check", "component", "probe", "check_id", result.CheckID, "probe_id", probe.ProbeID)
+			slog.Default().Debug("dropping result for unknown, invalid, or unselected check", "component", "probe", "check_id", result.CheckID, "probe_id", probe.ProbeID)
 			continue
 		}
 		out = append(out, monitoring.ObservedResult{Check: *check, Result: normalized})
@@ -134,6 +287,9 @@ func (p *ProbeProcessor) normalizeWithCache(probe *store.Probe, cache map[string
 		cache[incoming.CheckID] = loaded
 		check = loaded
 	}
+	if !probeRunsCheck(*probe, *check) {
+		return nil, incoming, true, nil
+	}
 
 	result := incoming
 	result.CheckID = check.ID
@@ -142,5 +298,33 @@ func (p *ProbeProcessor) normalizeWithCache(probe *store.Probe, cache map[string
 	result.Type = string(check.Type)
 	result.Target = check.Target
 	result.Timestamp = acceptedAt
+	if result.Attempts < 0 {
+		result.Attempts = 0
+	}
+	if result.Evidence != nil {
+		// Evidence is stored with incidents, so the server enforces the
+		// bounds instead of trusting the probe to.
+		if result.Up || strings.TrimSpace(result.Evidence.Status) == "" {
+			result.Evidence = nil
+		} else {
+			evidence := result.Evidence.Bounded()
+			result.Evidence = &evidence
+		}
+	}
+	if result.Path != nil {
+		if result.Up {
+			result.Path = nil
+		} else {
+			path := result.Path.Bounded()
+			result.Path = &path
+		}
+	}
+	switch {
+	case result.Up:
+		result.ErrorKind = ""
+	case result.ErrorKind != "" && !result.ErrorKind.Known():
+		// Newer probes may classify failures this server does not know yet.
+		result.ErrorKind = proto.ErrorKindOther
+	}
 	return check, result, false, nil
 }
@@ -1,9 +1,12 @@
 package server
 
 import (
+	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
 
+	"github.com/tmater/wacht/internal/alert"
 	probeapi "github.com/tmater/wacht/internal/api/probe"
 	"github.com/tmater/wacht/internal/checks"
 	"github.com/tmater/wacht/internal/monitoring"
@@ -12,24 +15,52 @@ import (
 )
 
 type fakeProbeStore struct {
-	registerProbeFn          func(probeID, version string) error
+	registerProbeFn          func(probeID string, reg store.ProbeRegistration) (*store.Probe, error)
+	setProbeAdminLabelsFn    func(probeID string, labels map[string]string) (*store.Probe, error)
+	revokeProbeFn            func(probeID string) (*store.Probe, error)
 	getCheckByIDFn           func(checkID string) (*checks.Check, error)
+	listAllChecksFn          func() ([]checks.Check, error)
 	persistMonitoringWriteFn func(write store.MonitoringWrite) (store.MonitoringWrite, error)
 	persistMonitoringBatchFn func(writes []store.MonitoringWrite) ([]store.MonitoringWrite, error)
 	registerProbeID          string
-	registerVersion          string
+	registration             store.ProbeRegistration
 	persistedWrites          []store.MonitoringWrite
 	persistedBatches         [][]store.MonitoringWrite
 }
 
 // RegisterProbe records register calls made by probe processor tests.
-func (f *fakeProbeStore) RegisterProbe(probeID, version string) error {
+func (f *fakeProbeStore) RegisterProbe(probeID string, reg store.ProbeRegistration) (*store.Probe, error) {
 	f.registerProbeID = probeID
-	f.registerVersion = version
+	f.registration = reg
 	if f.registerProbeFn != nil {
-		return f.registerProbeFn(probeID, version)
+		return f.registerProbeFn(probeID, reg)
 	}
-	return nil
+	return &store.Probe{ProbeID: probeID, Version: reg.Version, ProtocolVersion: reg.ProtocolVersion, CheckTypes: reg.CheckTypes, Labels: reg.Labels}, nil
+}
+
+// SetProbeAdminLabels returns the stubbed updated probe for probe processor
+// tests.
+func (f *fakeProbeStore) SetProbeAdminLabels(probeID string, labels map[string]string) (*store.Probe, error) {
+	if f.setProbeAdminLabelsFn != nil {
+		return f.setProbeAdminLabelsFn(probeID, labels)
+	}
+	return &store.Probe{ProbeID: probeID, Labels: labels}, nil
+}
+
+// RevokeProbe returns the stubbed revoked probe for probe processor tests.
+func (f *fakeProbeStore) RevokeProbe(probeID string) (*store.Probe, error) {
+	if f.revokeProbeFn != nil {
+		return f.revokeProbeFn(probeID)
+	}
+	return &store.Probe{ProbeID: probeID}, nil
+}
+
+// ListAllChecks returns stubbed check metadata for probe processor tests.
+func (f *fakeProbeStore) ListAllChecks() ([]checks.Check, error) {
+	if f.listAllChecksFn != nil {
+		return f.listAllChecksFn()
+	}
+	return nil, nil
 }
 
 // GetCheckByID returns stubbed check metadata for probe processor tests.
@@ -93,6 +124,29 @@ func testProbeCheck(checkID, name, checkType, target, webhook string, interval i
 	return check
 }
 
+// TestProbeProcessorHeartbeatMarksDegradedProbeError verifies that a heartbeat
+// carrying a failed self-test moves the probe into the error state with a
+// bounded reason.
+func TestProbeProcessorHeartbeatMarksDegradedProbeError(t *testing.T) {
+	p := NewProbeProcessor(&fakeProbeStore{}, monitoring.NewRuntime(nil, []string{"probe-1"}))
+
+	reason := strings.Repeat("x", maxDegradedReasonLength+10)
+	if err := p.Heartbeat(&store.Probe{ProbeID: "probe-1"}, probeapi.HeartbeatRequest{Degraded: reason}); err != nil {
+		t.Fatalf("Heartbeat() error = %v", err)
+	}
+
+	probeState, err := p.runtime.ProbeSnapshot("probe-1")
+	if err != nil {
+		t.Fatalf("ProbeSnapshot() error = %v", err)
+	}
+	if probeState.State != monitoring.ProbeStateError {
+		t.Fatalf("probe state = %q, want %q", probeState.State, monitoring.ProbeStateError)
+	}
+	if len(probeState.LastError) != maxDegradedReasonLength {
+		t.Fatalf("LastError length = %d, want %d", len(probeState.LastError), maxDegradedReasonLength)
+	}
+}
+
 // TestProbeProcessorHeartbeatUpdatesAuthenticatedProbe verifies that the HTTP
 // heartbeat adapter delegates to runtime-owned monitoring writes.
 func TestProbeProcessorHeartbeatUpdatesAuthenticatedProbe(t *testing.T) {
@@ -132,15 +186,311 @@ func TestProbeProcessorRegisterRecordsVersion(t *testing.T) {
 	s := &fakeProbeStore{}
 	p := NewProbeProcessor(s, monitoring.NewRuntime(nil, []string{"probe-1"}))
 
-	err := p.Register(&store.Probe{ProbeID: "probe-1"}, probeapi.RegisterRequest{Version: "v1.2.3"})
+	err := p.Register(&store.Probe{ProbeID: "probe-1"}, probeapi.RegisterRequest{Version: "v1.2.3", ProtocolVersion: 1, CheckTypes: []string{"http"}})
 	if err != nil {
 		t.Fatalf("Register() error = %v", err)
 	}
 	if s.registerProbeID != "probe-1" {
 		t.Fatalf("RegisterProbe probeID = %q, want probe-1", s.registerProbeID)
 	}
-	if s.registerVersion != "v1.2.3" {
-		t.Fatalf("RegisterProbe version = %q, want v1.2.3", s.registerVersion)
+	if s.registration.Version != "v1.2.3" || s.registration.ProtocolVersion != 1 || len(s.registration.CheckTypes) != 1 {
+		t.Fatalf("RegisterProbe registration = %#v, want v1.2.3 protocol 1 [http]", s.registration)
+	}
+}
+
+// TestProbeProcessorRegisterRefusesOutdatedProbe verifies that probes built
+// before the configured minimum, including development builds, are refused.
+func TestProbeProcessorRegisterRefusesOutdatedProbe(t *testing.T) {
+	for _, version := range []string{"v1.3.9", "dev"} {
+		s := &fakeProbeStore{}
+		p := NewProbeProcessor(s, monitoring.NewRuntime(nil, []string{"probe-1"}))
+		p.SetMinProbeVersion(probeapi.Version{Major: 1, Minor: 4})
+
+		err := p.Register(&store.Probe{ProbeID: "probe-1"}, probeapi.RegisterRequest{Version: version})
+		var upgradeRequired *upgradeRequiredError
+		if !errors.As(err, &upgradeRequired) {
+			t.Fatalf("Register(%q) error = %v, want upgradeRequiredError", version, err)
+		}
+		if s.registerProbeID != "" {
+			t.Fatalf("Register(%q) called RegisterProbe, want refusal", version)
+		}
+	}
+
+	s := &fakeProbeStore{}
+	p := NewProbeProcessor(s, monitoring.NewRuntime(nil, []string{"probe-1"}))
+	p.SetMinProbeVersion(probeapi.Version{Major: 1, Minor: 4})
+	if err := p.Register(&store.Probe{ProbeID: "probe-1"}, probeapi.RegisterRequest{Version: "v1.4.0"}); err != nil {
+		t.Fatalf("Register(v1.4.0) error = %v", err)
+	}
+}
+
+// TestProbeProcessorRegisterRejectsInvalidLabels verifies that malformed
+// declared labels fail registration as a bad request.
+func TestProbeProcessorRegisterRejectsInvalidLabels(t *testing.T) {
+	s := &fakeProbeStore{}
+	p := NewProbeProcessor(s, monitoring.NewRuntime(nil, []string{"probe-1"}))
+
+	err := p.Register(&store.Probe{ProbeID: "probe-1"}, probeapi.RegisterRequest{Labels: map[string]string{"region": "eu west"}})
+	var badRequest *badRequestError
+	if !errors.As(err, &badRequest) {
+		t.Fatalf("Register() error = %v, want badRequestError", err)
+	}
+	if s.registerProbeID != "" {
+		t.Fatal("expected RegisterProbe not to be called")
+	}
+}
+
+func TestProbeProcessorRegisterValidatesCheckTypes(t *testing.T) {
+	s := &fakeProbeStore{}
+	p := NewProbeProcessor(s, monitoring.NewRuntime(nil, []string{"probe-1"}))
+
+	err := p.Register(&store.Probe{ProbeID: "probe-1"}, probeapi.RegisterRequest{CheckTypes: []string{"http", "icmp"}})
+	var badRequest *badRequestError
+	if !errors.As(err, &badRequest) {
+		t.Fatalf("Register() unknown type error = %v, want badRequestError", err)
+	}
+	if s.registerProbeID != "" {
+		t.Fatal("expected RegisterProbe not to be called for an unknown type")
+	}
+
+	if err := p.Register(&store.Probe{ProbeID: "probe-1"}, probeapi.RegisterRequest{CheckTypes: []string{"http", "dns", "http"}}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if got := s.registration.CheckTypes; len(got) != 2 || got[0] != "http" || got[1] != "dns" {
+		t.Fatalf("RegisterProbe check types = %v, want [http dns]", got)
+	}
+}
+
+// TestProbeProcessorProcessDropsResultsForUnselectedChecks verifies that a
+// probe whose labels do not match a check's selector never joins its quorum.
+func TestProbeProcessorProcessDropsResultsForUnselectedChecks(t *testing.T) {
+	const checkID = "00000000-0000-0000-0000-000000000341"
+	s := &fakeProbeStore{
+		getCheckByIDFn: func(checkID string) (*checks.Check, error) {
+			check := testProbeCheck(checkID, "site", "http", "https://example.com", "", 0)
+			check.ProbeSelector = "region=eu-west"
+			return &check, nil
+		},
+	}
+	runtime := monitoring.NewRuntime([]string{checkID}, []string{"probe-1", "probe-2"})
+	p := NewProbeProcessor(s, runtime)
+
+	for _, probe := range []*store.Probe{
+		{ProbeID: "probe-1", Labels: map[string]string{"region": "eu-west"}},
+		{ProbeID: "probe-2", Labels: map[string]string{"region": "us-east"}},
+	} {
+		if err := p.ProcessBatch(probe, []proto.CheckResult{{CheckID: checkID, Up: true}}); err != nil {
+			t.Fatalf("ProcessBatch(%s) error = %v", probe.ProbeID, err)
+		}
+	}
+
+	if _, err := runtime.CheckSnapshot(checkID, "probe-1"); err != nil {
+		t.Fatalf("CheckSnapshot(probe-1) error = %v", err)
+	}
+	if _, err := runtime.CheckSnapshot(checkID, "probe-2"); !errors.Is(err, monitoring.ErrUnknownCheckAssignment) {
+		t.Fatalf("CheckSnapshot(probe-2) error = %v, want %v", err, monitoring.ErrUnknownCheckAssignment)
+	}
+}
+
+// TestProbeProcessorSetLabelsRemovesProbeFromUnselectedQuorums verifies that
+// relabeling a probe drops it from checks that no longer select it.
+func TestProbeProcessorSetLabelsRemovesProbeFromUnselectedQuorums(t *testing.T) {
+	const checkID = "00000000-0000-0000-0000-000000000342"
+	check := testProbeCheck(checkID, "site", "http", "https://example.com", "", 0)
+	check.ProbeSelector = "region=eu-west"
+	s := &fakeProbeStore{
+		getCheckByIDFn:  func(string) (*checks.Check, error) { return &check, nil },
+		listAllChecksFn: func() ([]checks.Check, error) { return []checks.Check{check}, nil },
+	}
+	runtime := monitoring.NewRuntime([]string{checkID}, []string{"probe-1", "probe-2"})
+	p := NewProbeProcessor(s, runtime)
+
+	for _, probeID := range []string{"probe-1", "probe-2"} {
+		probe := &store.Probe{ProbeID: probeID, Labels: map[string]string{"region": "eu-west"}}
+		if err := p.ProcessBatch(probe, []proto.CheckResult{{CheckID: checkID, Up: true}}); err != nil {
+			t.Fatalf("ProcessBatch(%s) error = %v", probeID, err)
+		}
+	}
+	s.persistedWrites = nil
+
+	updated, err := p.SetLabels("probe-2", map[string]string{"region": "us-east"})
+	if err != nil {
+		t.Fatalf("SetLabels() error = %v", err)
+	}
+	if updated.Labels["region"] != "us-east" {
+		t.Fatalf("SetLabels() labels = %v, want region us-east", updated.Labels)
+	}
+
+	if _, err := runtime.CheckSnapshot(checkID, "probe-2"); !errors.Is(err, monitoring.ErrUnknownCheckAssignment) {
+		t.Fatalf("CheckSnapshot(probe-2) error = %v, want %v", err, monitoring.ErrUnknownCheckAssignment)
+	}
+	if len(s.persistedWrites) != 1 {
+		t.Fatalf("persisted writes = %d, want 1", len(s.persistedWrites))
+	}
+	removed := s.persistedWrites[0].RemovedAssignments
+	if len(removed) != 1 || removed[0] != (store.CheckAssignment{CheckID: checkID, ProbeID: "probe-2"}) {
+		t.Fatalf("RemovedAssignments = %+v, want probe-2 only", removed)
+	}
+}
+
+func TestProbeProcessorRevokeRemovesProbeFromRuntime(t *testing.T) {
+	const checkID = "00000000-0000-0000-0000-000000000343"
+	check := testProbeCheck(checkID, "site", "http", "https://example.com", "", 0)
+	s := &fakeProbeStore{
+		getCheckByIDFn:  func(string) (*checks.Check, error) { return &check, nil },
+		listAllChecksFn: func() ([]checks.Check, error) { return []checks.Check{check}, nil },
+	}
+	runtime := monitoring.NewRuntime([]string{checkID}, []string{"probe-1", "probe-2"})
+	p := NewProbeProcessor(s, runtime)
+
+	for _, probeID := range []string{"probe-1", "probe-2"} {
+		if err := p.ProcessBatch(&store.Probe{ProbeID: probeID}, []proto.CheckResult{{CheckID: checkID, Up: true}}); err != nil {
+			t.Fatalf("ProcessBatch(%s) error = %v", probeID, err)
+		}
+	}
+
+	revoked, err := p.Revoke("probe-2")
+	if err != nil || revoked == nil {
+		t.Fatalf("Revoke() = %+v, %v, want revoked probe", revoked, err)
+	}
+	if _, err := runtime.CheckSnapshot(checkID, "probe-2"); !errors.Is(err, monitoring.ErrUnknownCheckAssignment) {
+		t.Fatalf("CheckSnapshot(probe-2) error = %v, want %v", err, monitoring.ErrUnknownCheckAssignment)
+	}
+	if _, err := runtime.ProbeSnapshot("probe-2"); err == nil {
+		t.Fatal("ProbeSnapshot(probe-2) error = nil, want revoked probe gone from runtime")
+	}
+	if _, err := runtime.CheckSnapshot(checkID, "probe-1"); err != nil {
+		t.Fatalf("CheckSnapshot(probe-1) error = %v, want untouched assignment", err)
+	}
+}
+
+func TestProbeProcessorRevokeRetryFinishesRuntimeCleanup(t *testing.T) {
+	const checkID = "00000000-0000-0000-0000-000000000344"
+	check := testProbeCheck(checkID, "site", "http", "https://example.com", "", 0)
+	listErr := errors.New("db unavailable")
+	s := &fakeProbeStore{
+		getCheckByIDFn:  func(string) (*checks.Check, error) { return &check, nil },
+		listAllChecksFn: func() ([]checks.Check, error) { return []checks.Check{check}, nil },
+	}
+	runtime := monitoring.NewRuntime([]string{checkID}, []string{"probe-1"})
+	p := NewProbeProcessor(s, runtime)
+	if err := p.ProcessBatch(&store.Probe{ProbeID: "probe-1"}, []proto.CheckResult{{CheckID: checkID, Up: true}}); err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+
+	s.listAllChecksFn = func() ([]checks.Check, error) { return nil, listErr }
+	if _, err := p.Revoke("probe-1"); !errors.Is(err, listErr) {
+		t.Fatalf("Revoke() error = %v, want %v", err, listErr)
+	}
+	if _, err := runtime.ProbeSnapshot("probe-1"); err != nil {
+		t.Fatalf("ProbeSnapshot(probe-1) error = %v, want probe still in runtime", err)
+	}
+
+	// The store reports the already revoked probe on retry.
+	s.listAllChecksFn = func() ([]checks.Check, error) { return []checks.Check{check}, nil }
+	revoked, err := p.Revoke("probe-1")
+	if err != nil || revoked == nil {
+		t.Fatalf("Revoke() retry = %+v, %v, want revoked probe", revoked, err)
+	}
+	if _, err := runtime.ProbeSnapshot("probe-1"); err == nil {
+		t.Fatal("ProbeSnapshot(probe-1) error = nil, want probe gone after retry")
+	}
+}
+
+func TestProbeProcessorRevokeRejectsConfigProbe(t *testing.T) {
+	s := &fakeProbeStore{
+		revokeProbeFn: func(string) (*store.Probe, error) { return nil, store.ErrProbeConfigManaged },
+	}
+	p := NewProbeProcessor(s, monitoring.NewRuntime(nil, []string{"probe-1"}))
+
+	_, err := p.Revoke("probe-1")
+	var conflict *conflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("Revoke() error = %v, want conflict", err)
+	}
+	if _, err := p.runtime.ProbeSnapshot("probe-1"); err != nil {
+		t.Fatalf("ProbeSnapshot(probe-1) error = %v, want probe kept", err)
+	}
+}
+
+// TestProbeRunsCheckSeparatesPrivateAndSharedProbes verifies the ownership
+// rules that decide which probes run and vote on a check.
+func TestProbeRunsCheckSeparatesPrivateAndSharedProbes(t *testing.T) {
+	shared := store.Probe{ProbeID: "shared"}
+	mine := store.Probe{ProbeID: "mine", OwnerUserID: 7}
+	publicCheck := checks.Check{ID: "public", Type: checks.CheckHTTP, OwnerID: 7}
+	privateCheck := checks.Check{ID: "private", Type: checks.CheckHTTP, OwnerID: 7, Private: true}
+	otherCheck := checks.Check{ID: "other", Type: checks.CheckHTTP, OwnerID: 8}
+
+	for _, tc := range []struct {
+		probe store.Probe
+		check checks.Check
+		want  bool
+	}{
+		{probe: shared, check: publicCheck, want: true},
+		{probe: shared, check: privateCheck, want: false},
+		{probe: shared, check: otherCheck, want: true},
+		{probe: mine, check: publicCheck, want: true},
+		{probe: mine, check: privateCheck, want: true},
+		{probe: mine, check: otherCheck, want: false},
+	} {
+		if got := probeRunsCheck(tc.probe, tc.check); got != tc.want {
+			t.Fatalf("probeRunsCheck(%s, %s) = %t, want %t", tc.probe.ProbeID, tc.check.ID, got, tc.want)
+		}
+	}
+}
+
+func TestProbeRunsCheckRequiresSupportedCheckType(t *testing.T) {
+	legacy := store.Probe{ProbeID: "legacy"}
+	httpOnly := store.Probe{ProbeID: "http-only", CheckTypes: []string{"http"}}
+	httpCheck := checks.Check{ID: "http", Type: checks.CheckHTTP}
+	dnsCheck := checks.Check{ID: "dns", Type: checks.CheckDNS}
+	futureCheck := checks.Check{ID: "future", Type: checks.Type("icmp")}
+
+	for _, tc := range []struct {
+		probe store.Probe
+		check checks.Check
+		want  bool
+	}{
+		{probe: legacy, check: httpCheck, want: true},
+		{probe: legacy, check: dnsCheck, want: true},
+		{probe: legacy, check: futureCheck, want: false},
+		{probe: httpOnly, check: httpCheck, want: true},
+		{probe: httpOnly, check: dnsCheck, want: false},
+	} {
+		if got := probeRunsCheck(tc.probe, tc.check); got != tc.want {
+			t.Fatalf("probeRunsCheck(%s, %s) = %t, want %t", tc.probe.ProbeID, tc.check.ID, got, tc.want)
+		}
+	}
+}
+
+// TestProbeProcessorProcessDropsPrivateCheckResultsFromSharedProbes verifies
+// that a shared probe cannot vote on a private check even if it submits a
+// result for it.
+func TestProbeProcessorProcessDropsPrivateCheckResultsFromSharedProbes(t *testing.T) {
+	const checkID = "00000000-0000-0000-0000-000000000351"
+	s := &fakeProbeStore{
+		getCheckByIDFn: func(checkID string) (*checks.Check, error) {
+			check := testProbeCheck(checkID, "intranet", "http", "http://10.0.0.5", "", 0)
+			check.Private = true
+			check.OwnerID = 7
+			return &check, nil
+		},
+	}
+	runtime := monitoring.NewRuntime([]string{checkID}, []string{"shared", "mine"})
+	p := NewProbeProcessor(s, runtime)
+
+	for _, probe := range []*store.Probe{{ProbeID: "shared"}, {ProbeID: "mine", OwnerUserID: 7}} {
+		if err := p.ProcessBatch(probe, []proto.CheckResult{{CheckID: checkID, Up: true}}); err != nil {
+			t.Fatalf("ProcessBatch(%s) error = %v", probe.ProbeID, err)
+		}
+	}
+
+	if _, err := runtime.CheckSnapshot(checkID, "mine"); err != nil {
+		t.Fatalf("CheckSnapshot(mine) error = %v", err)
+	}
+	if _, err := runtime.CheckSnapshot(checkID, "shared"); !errors.Is(err, monitoring.ErrUnknownCheckAssignment) {
+		t.Fatalf("CheckSnapshot(shared) error = %v, want %v", err, monitoring.ErrUnknownCheckAssignment)
 	}
 }
 
@@ -298,6 +648,72 @@ func TestProbeProcessorProcessOpensIncidentOnStableUpToDownTransition(t *testing
 	}
 }
 
+// TestProbeProcessorProcessRendersVersionedPayloadForOptedInCheck verifies
+// that v2 destinations get per-probe detail and ask the store for incident
+// correlation fields.
+func TestProbeProcessorProcessRendersVersionedPayloadForOptedInCheck(t *testing.T) {
+	const checkID = "00000000-0000-0000-0000-000000000306"
+	s := &fakeProbeStore{
+		getCheckByIDFn: func(checkID string) (*checks.Check, error) {
+			check := testProbeCheck(checkID, "site", "http", "https://example.com", "https://hooks.example.com/wacht", 0)
+			check.WebhookVersion = checks.WebhookPayloadV2
+			return &check, nil
+		},
+	}
+
+	runtime := monitoring.NewRuntime(nil, []string{"probe-1", "probe-2"})
+	runtime.SetNotificationSettings(monitoring.NotificationSettings{ServerURL: "https://wacht.example.com"})
+	p := NewProbeProcessor(s, runtime)
+
+	processSequence(t, p, checkID, []struct {
+		probeID string
+		up      bool
+	}{
+		{probeID: "probe-1", up: true},
+		{probeID: "probe-2", up: true},
+		{probeID: "probe-1", up: true},
+		{probeID: "probe-2", up: true},
+		{probeID: "probe-1", up: false},
+		{probeID: "probe-2", up: false},
+		{probeID: "probe-1", up: false},
+		{probeID: "probe-2", up: false},
+		{probeID: "probe-1", up: false},
+	})
+
+	write := s.persistedWrites[len(s.persistedWrites)-1]
+	if write.IncidentNotification == nil {
+		t.Fatal("expected durable down notification request")
+	}
+	if !write.IncidentNotification.IncludeIncident {
+		t.Fatal("IncludeIncident = false, want store to attach incident fields")
+	}
+
+	var payload alert.AlertPayloadV2
+	if err := json.Unmarshal(write.IncidentNotification.Payload, &payload); err != nil {
+		t.Fatalf("Unmarshal payload: %v", err)
+	}
+	if payload.SchemaVersion != alert.PayloadSchemaV2 || payload.Status != "down" || payload.ServerURL != "https://wacht.example.com" {
+		t.Fatalf("payload header = %+v", payload)
+	}
+	if payload.Check != (alert.AlertCheck{ID: checkID, Name: "site", Type: "http", Target: "https://example.com"}) {
+		t.Fatalf("payload check = %+v", payload.Check)
+	}
+	if payload.ProbesDown != 2 || payload.ProbesTotal != 2 || len(payload.Probes) != 2 {
+		t.Fatalf("payload probes = %d/%d %+v", payload.ProbesDown, payload.ProbesTotal, payload.Probes)
+	}
+	for i, probe := range payload.Probes {
+		if want := []string{"probe-1", "probe-2"}[i]; probe.ProbeID != want {
+			t.Fatalf("probes[%d].probe_id = %q, want %q", i, probe.ProbeID, want)
+		}
+		if probe.State != "down" || probe.LastError != "timeout" || probe.LastResultAt == nil {
+			t.Fatalf("probes[%d] = %+v, want down with last error", i, probe)
+		}
+	}
+	if payload.Incident != nil {
+		t.Fatalf("incident = %+v, want store to fill it", payload.Incident)
+	}
+}
+
 // TestProbeProcessorProcessResolvesIncidentOnStableDownToUpTransition
 // verifies durable incident resolution on a stable recovery transition.
 func TestProbeProcessorProcessResolvesIncidentOnStableDownToUpTransition(t *testing.T) {
@@ -460,3 +876,220 @@ func TestProbeProcessorProcessPropagatesPersistError(t *testing.T) {
 		t.Fatalf("QuorumSnapshot() error = %v, want %v", qErr, monitoring.ErrUnknownCheck)
 	}
 }
+
+// TestProbeProcessorProcessBatchDropsRetriedDuplicates verifies that a batch
+// re-sent after an upload timeout does not extend check streaks twice.
+func TestProbeProcessorProcessBatchDropsRetriedDuplicates(t *testing.T) {
+	const checkID = "00000000-0000-0000-0000-000000000307"
+	s := &fakeProbeStore{
+		getCheckByIDFn: func(checkID string) (*checks.Check, error) {
+			check := testProbeCheck(checkID, "site", "http", "https://example.com", "", 30)
+			return &check, nil
+		},
+	}
+	runtime := monitoring.NewRuntime(nil, []string{"probe-1"})
+	p := NewProbeProcessor(s, runtime)
+	probe := &store.Probe{ProbeID: "probe-1"}
+	batch := []proto.CheckResult{
+		{CheckID: checkID, Up: false, Error: "timeout", Seq: 11},
+		{CheckID: checkID, Up: false, Error: "timeout", Seq: 12},
+	}
+
+	if err := p.ProcessBatch(probe, batch); err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+	if err := p.ProcessBatch(probe, batch); err != nil {
+		t.Fatalf("ProcessBatch(retry) error = %v", err)
+	}
+
+	state, err := runtime.CheckSnapshot(checkID, "probe-1")
+	if err != nil {
+		t.Fatalf("CheckSnapshot() error = %v", err)
+	}
+	if state.StreakLen != 2 {
+		t.Fatalf("StreakLen = %d, want 2 after duplicate retry", state.StreakLen)
+	}
+	if len(s.persistedBatches) != 1 {
+		t.Fatalf("persisted batches = %d, want retry to persist nothing", len(s.persistedBatches))
+	}
+	last := s.persistedBatches[0][len(s.persistedBatches[0])-1]
+	if last.ResultSeqProbeID != "probe-1" || last.ResultSeq != 12 {
+		t.Fatalf("seq write = %q/%d, want probe-1/12", last.ResultSeqProbeID, last.ResultSeq)
+	}
+}
+
+// TestProbeProcessorProcessBatchDropsStaleResultsButKeepsNewerOnes verifies
+// that a partially overlapping or reordered batch only applies unseen results.
+func TestProbeProcessorProcessNormalizesErrorKind(t *testing.T) {
+	const checkID = "00000000-0000-0000-0000-000000000302"
+	s := &fakeProbeStore{
+		getCheckByIDFn: func(checkID string) (*checks.Check, error) {
+			check := testProbeCheck(checkID, "site", "http", "https://example.com", "", 0)
+			return &check, nil
+		},
+	}
+	runtime := monitoring.NewRuntime(nil, []string{"probe-1"})
+	p := NewProbeProcessor(s, runtime)
+
+	for _, tc := range []struct {
+		result proto.CheckResult
+		want   string
+	}{
+		{proto.CheckResult{CheckID: checkID, Up: false, Error: "boom", ErrorKind: "quantum"}, string(proto.ErrorKindOther)},
+		{proto.CheckResult{CheckID: checkID, Up: false, Error: "no such host", ErrorKind: proto.ErrorKindDNS}, string(proto.ErrorKindDNS)},
+		{proto.CheckResult{CheckID: checkID, Up: true, ErrorKind: proto.ErrorKindTimeout}, ""},
+	} {
+		if err := processOne(t, p, "probe-1", tc.result); err != nil {
+			t.Fatalf("Process() error = %v", err)
+		}
+		got := s.persistedWrites[len(s.persistedWrites)-1].CheckStateWrites[0].LastErrorKind
+		if got != tc.want {
+			t.Fatalf("LastErrorKind for %+v = %q, want %q", tc.result, got, tc.want)
+		}
+	}
+}
+
+func TestProbeProcessorProcessBoundsEvidence(t *testing.T) {
+	const checkID = "00000000-0000-0000-0000-000000000303"
+	s := &fakeProbeStore{
+		getCheckByIDFn: func(checkID string) (*checks.Check, error) {
+			check := testProbeCheck(checkID, "site", "http", "https://example.com", "", 0)
+			return &check, nil
+		},
+	}
+	runtime := monitoring.NewRuntime(nil, []string{"probe-1"})
+	p := NewProbeProcessor(s, runtime)
+
+	err := processOne(t, p, "probe-1", proto.CheckResult{
+		CheckID: checkID,
+		Up:      false,
+		Error:   "unexpected status code: 500",
+		Evidence: &proto.HTTPEvidence{
+			Status: "HTTP/1.1 500 Internal Server Error",
+			Body:   strings.Repeat("x", proto.MaxEvidenceBodyBytes*2),
+		},
+	})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	writes := s.persistedWrites[0].EvidenceWrites
+	if len(writes) != 1 {
+		t.Fatalf("evidence writes = %d, want 1", len(writes))
+	}
+	if got := writes[0].Evidence; len(got.Body) != proto.MaxEvidenceBodyBytes || !got.BodyTruncated {
+		t.Fatalf("evidence body = %d bytes truncated=%v, want %d bytes truncated", len(got.Body), got.BodyTruncated, proto.MaxEvidenceBodyBytes)
+	}
+
+	err = processOne(t, p, "probe-1", proto.CheckResult{
+		CheckID:  checkID,
+		Up:       true,
+		Evidence: &proto.HTTPEvidence{Status: "HTTP/1.1 200 OK"},
+	})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if got := len(s.persistedWrites[1].EvidenceWrites); got != 0 {
+		t.Fatalf("evidence writes for up result = %d, want 0", got)
+	}
+
+	hops := make([]proto.PathHop, proto.MaxPathHops+8)
+	for i := range hops {
+		hops[i] = proto.PathHop{TTL: i + 1}
+	}
+	err = processOne(t, p, "probe-1", proto.CheckResult{
+		CheckID:   checkID,
+		Up:        false,
+		Error:     "timeout",
+		ErrorKind: proto.ErrorKindTimeout,
+		Path:      &proto.NetworkPath{Target: "203.0.113.7:443", Hops: hops},
+	})
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	writes = s.persistedWrites[2].EvidenceWrites
+	if len(writes) != 1 || writes[0].Path == nil {
+		t.Fatalf("evidence writes = %+v, want one path", writes)
+	}
+	if got := len(writes[0].Path.Hops); got != proto.MaxPathHops {
+		t.Fatalf("path hops = %d, want %d", got, proto.MaxPathHops)
+	}
+}
+
+func TestProbeProcessorProcessBatchDropsStaleResultsButKeepsNewerOnes(t *testing.T) {
+	const checkID = "00000000-0000-0000-0000-000000000308"
+	s := &fakeProbeStore{
+		getCheckByIDFn: func(checkID string) (*checks.Check, error) {
+			check := testProbeCheck(checkID, "site", "http", "https://example.com", "", 30)
+			return &check, nil
+		},
+	}
+	runtime := monitoring.NewRuntime(nil, []string{"probe-1"})
+	p := NewProbeProcessor(s, runtime)
+	probe := &store.Probe{ProbeID: "probe-1"}
+
+	if err := p.ProcessBatch(probe, []proto.CheckResult{{CheckID: checkID, Up: true, Seq: 20}}); err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+	if err := p.ProcessBatch(probe, []proto.CheckResult{
+		{CheckID: checkID, Up: false, Error: "stale", Seq: 19},
+		{CheckID: checkID, Up: true, Seq: 20},
+		{CheckID: checkID, Up: true, Seq: 21},
+		{CheckID: checkID, Up: false, Error: "reordered", Seq: 21},
+	}); err != nil {
+		t.Fatalf("ProcessBatch() error = %v", err)
+	}
+
+	state, err := runtime.CheckSnapshot(checkID, "probe-1")
+	if err != nil {
+		t.Fatalf("CheckSnapshot() error = %v", err)
+	}
+	if state.LastOutcome != monitoring.CheckStateUp || state.StreakLen != 2 {
+		t.Fatalf("check state = %s/%d, want up with streak 2", state.LastOutcome, state.StreakLen)
+	}
+	probeState, err := runtime.ProbeSnapshot("probe-1")
+	if err != nil {
+		t.Fatalf("ProbeSnapshot() error = %v", err)
+	}
+	if probeState.LastResultSeq != 21 {
+		t.Fatalf("LastResultSeq = %d, want 21", probeState.LastResultSeq)
+	}
+}
+
+// TestProbeProcessorProcessBatchRestoresSeqWhenPersistFails verifies that a
+// failed commit does not make the probe's retry look like a duplicate.
+func TestProbeProcessorProcessBatchRestoresSeqWhenPersistFails(t *testing.T) {
+	const checkID = "00000000-0000-0000-0000-000000000309"
+	failing := true
+	s := &fakeProbeStore{
+		getCheckByIDFn: func(checkID string) (*checks.Check, error) {
+			check := testProbeCheck(checkID, "site", "http", "https://example.com", "", 30)
+			return &check, nil
+		},
+		persistMonitoringBatchFn: func(writes []store.MonitoringWrite) ([]store.MonitoringWrite, error) {
+			if failing {
+				return nil, errors.New("write failed")
+			}
+			return writes, nil
+		},
+	}
+	runtime := monitoring.NewRuntime(nil, []string{"probe-1"})
+	p := NewProbeProcessor(s, runtime)
+	probe := &store.Probe{ProbeID: "probe-1"}
+	batch := []proto.CheckResult{{CheckID: checkID, Up: true, Seq: 5}}
+
+	if err := p.ProcessBatch(probe, batch); err == nil {
+		t.Fatal("ProcessBatch() error = nil, want persist failure")
+	}
+	failing = false
+	if err := p.ProcessBatch(probe, batch); err != nil {
+		t.Fatalf("ProcessBatch(retry) error = %v", err)
+	}
+
+	state, err := runtime.CheckSnapshot(checkID, "probe-1")
+	if err != nil {
+		t.Fatalf("CheckSnapshot() error = %v", err)
+	}
+	if state.StreakLen != 1 {
+		t.Fatalf("StreakLen = %d, want 1 after retry of failed commit", state.StreakLen)
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	probeapi "github.com/tmater/wacht/internal/api/probe"
+	"github.com/tmater/wacht/internal/config"
+	"github.com/tmater/wacht/internal/probeauth"
+	"github.com/tmater/wacht/internal/store"
+)
+
+// probeSignatureWindow bounds how far a signed request's timestamp may drift
+// from the server clock. Accepted nonces are remembered while their request
+// could still pass the timestamp check, so each one is accepted only once.
+const probeSignatureWindow = 5 * time.Minute
+
+// maxProbeNonceLength bounds the nonce header so replay cache keys stay small.
+const maxProbeNonceLength = 64
+
+// probeAuthStore authenticates probes by secret header or request signature.
+type probeAuthStore interface {
+	AuthenticateProbe(probeID, secret string) (*store.Probe, error)
+	AuthenticateProbeSignature(probeID string, verify func(verifyKey string) bool) (*store.Probe, error)
+}
+
+// authenticateSignedProbe verifies a signed probe request. It reads and
+// restores the request body so handlers can decode it afterwards. A nil probe
+// with a nil error means the request is not authenticated.
+func (h *Handler) authenticateSignedProbe(w http.ResponseWriter, r *http.Request, probeID string) (*store.Probe, error) {
+	signature := r.Header.Get(probeapi.HeaderSignature)
+	signed := probeauth.SignedRequest{
+		Method:      r.Method,
+		RequestURI:  r.URL.RequestURI(),
+		Timestamp:   r.Header.Get(probeapi.HeaderTimestamp),
+		Nonce:       r.Header.Get(probeapi.HeaderNonce),
+		IfNoneMatch: r.Header.Get("If-None-Match"),
+	}
+	if signed.Nonce == "" || len(signed.Nonce) > maxProbeNonceLength {
+		return nil, nil
+	}
+	unix, err := strconv.ParseInt(signed.Timestamp, 10, 64)
+	if err != nil {
+		return nil, nil
+	}
+	now := time.Now()
+	if skew := now.Sub(time.Unix(unix, 0)); skew > probeSignatureWindow || skew < -probeSignatureWindow {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxProbeJSONRequestBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, &requestEntityTooLargeError{message: "request body too large"}
+		}
+		return nil, &badRequestError{message: "invalid request body"}
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	signed.Body = body
+
+	probe, err := h.probeAuth.AuthenticateProbeSignature(probeID, func(verifyKey string) bool {
+		return probeauth.VerifySignature(verifyKey, signed, signature)
+	})
+	if err != nil || probe == nil {
+		return nil, err
+	}
+	if !h.probeReplays.firstUse(probeID+" "+signed.Nonce, now) {
+		return nil, nil
+	}
+	return probe, nil
+}
+
+// signatureReplayCache remembers recently accepted request nonces so a
+// captured signed request cannot be replayed inside the signature window.
+type signatureReplayCache struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	window    time.Duration
+	lastPrune time.Time
+}
+
+func newSignatureReplayCache(window time.Duration) *signatureReplayCache {
+	return &signatureReplayCache{seen: make(map[string]time.Time), window: window}
+}
+
+// firstUse records key and reports whether it was not seen within the window.
+func (c *signatureReplayCache) firstUse(key string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Sub(c.lastPrune) > c.window {
+		for k, at := range c.seen {
+			// Keep entries for two windows: a request may be signed up to one
+			// window in the future and still replayable one window later.
+			if now.Sub(at) > 2*c.window {
+				delete(c.seen, k)
+			}
+		}
+		c.lastPrune = now
+	}
+	if _, ok := c.seen[key]; ok {
+		return false
+	}
+	c.seen[key] = now
+	return true
+}
+
+// requireSignedProbeAuth reports whether the server rejects the secret header
+// scheme.
+func (h *Handler) requireSignedProbeAuth() bool {
+	return h.config != nil && h.config.ProbeAuth == config.ProbeAuthSigned
+}
@@ -0,0 +1,166 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	probeapi "github.com/tmater/wacht/internal/api/probe"
+	"github.com/tmater/wacht/internal/config"
+	"github.com/tmater/wacht/internal/probeauth"
+	"github.com/tmater/wacht/internal/store"
+)
+
+type fakeProbeAuthStore struct {
+	secret string
+}
+
+func (f *fakeProbeAuthStore) AuthenticateProbe(probeID, secret string) (*store.Probe, error) {
+	if secret != f.secret {
+		return nil, nil
+	}
+	return &store.Probe{ProbeID: probeID}, nil
+}
+
+func (f *fakeProbeAuthStore) AuthenticateProbeSignature(probeID string, verify func(verifyKey string) bool) (*store.Probe, error) {
+	if !verify(probeauth.VerifyKey(f.secret)) {
+		return nil, nil
+	}
+	return &store.Probe{ProbeID: probeID}, nil
+}
+
+func newProbeAuthTestHandler(probeAuth string) http.Handler {
+	h := &Handler{
+		config:       &config.ServerConfig{ProbeAuth: probeAuth},
+		probeAuth:    &fakeProbeAuthStore{secret: "secret-1"},
+		probeReplays: newSignatureReplayCache(probeSignatureWindow),
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Probe", authenticatedProbe(r).ProbeID)
+		_, _ = w.Write(body)
+	})
+	return h.requireProbeAuth(next)
+}
+
+func signedProbeRequest(body string, at time.Time) *http.Request {
+	return signedProbeRequestWithNonce(http.MethodPost, probeapi.PathResults, "", body, at, "nonce-1")
+}
+
+func signedProbeRequestWithNonce(method, target, ifNoneMatch, body string, at time.Time, nonce string) *http.Request {
+	req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+	signed := probeauth.SignedRequest{
+		Method:      method,
+		RequestURI:  target,
+		Timestamp:   strconv.FormatInt(at.Unix(), 10),
+		Nonce:       nonce,
+		IfNoneMatch: ifNoneMatch,
+		Body:        []byte(body),
+	}
+	req.Header.Set(probeapi.HeaderProbeID, "probe-1")
+	req.Header.Set(probeapi.HeaderTimestamp, signed.Timestamp)
+	req.Header.Set(probeapi.HeaderNonce, signed.Nonce)
+	if ifNoneMatch != "" {
+		req.Header.Set("If-None-Match", ifNoneMatch)
+	}
+	req.Header.Set(probeapi.HeaderSignature, probeauth.Sign(probeauth.SigningKey("secret-1"), signed))
+	return req
+}
+
+func TestRequireProbeAuthAcceptsSignedRequestOnce(t *testing.T) {
+	handler := newProbeAuthTestHandler(config.ProbeAuthSigned)
+	signedAt := time.Now()
+	req := signedProbeRequest(`{"results":[]}`, signedAt)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	if rec.Header().Get("X-Probe") != "probe-1" || rec.Body.String() != `{"results":[]}` {
+		t.Fatalf("handler saw probe %q body %q, want probe-1 and the original body", rec.Header().Get("X-Probe"), rec.Body.String())
+	}
+
+	replay := signedProbeRequest(`{"results":[]}`, signedAt)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, replay)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("replay status = %d, want 401", rec.Code)
+	}
+}
+
+func TestRequireProbeAuthAcceptsIdenticalRequestsWithDistinctNonces(t *testing.T) {
+	handler := newProbeAuthTestHandler(config.ProbeAuthSigned)
+	signedAt := time.Now()
+	target := probeapi.PathChecks + "?wait=30s"
+
+	for _, nonce := range []string{"nonce-1", "nonce-2"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, signedProbeRequestWithNonce(http.MethodGet, target, `"rev-1"`, "", signedAt, nonce))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("nonce %s: status = %d, want 200", nonce, rec.Code)
+		}
+	}
+
+	for name, req := range map[string]*http.Request{
+		"missing nonce": signedProbeRequestWithNonce(http.MethodGet, target, "", "", signedAt, ""),
+		"reused nonce":  signedProbeRequestWithNonce(http.MethodGet, target, `"rev-1"`, "", signedAt, "nonce-1"),
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: status = %d, want 401", name, rec.Code)
+		}
+	}
+
+	swapped := signedProbeRequestWithNonce(http.MethodGet, target, `"rev-1"`, "", signedAt, "nonce-3")
+	swapped.Header.Set("If-None-Match", `"rev-2"`)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, swapped)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("swapped If-None-Match status = %d, want 401", rec.Code)
+	}
+}
+
+func TestRequireProbeAuthRejectsStaleOrTamperedSignatures(t *testing.T) {
+	handler := newProbeAuthTestHandler(config.ProbeAuthAny)
+
+	stale := signedProbeRequest(`{}`, time.Now().Add(-probeSignatureWindow-time.Minute))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, stale)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("stale status = %d, want 401", rec.Code)
+	}
+
+	tampered := signedProbeRequest(`{}`, time.Now())
+	tampered.Body = io.NopCloser(bytes.NewBufferString(`{"results":[{}]}`))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, tampered)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("tampered status = %d, want 401", rec.Code)
+	}
+}
+
+func TestRequireProbeAuthSecretHeaderDependsOnMode(t *testing.T) {
+	for _, tc := range []struct {
+		mode string
+		want int
+	}{
+		{mode: config.ProbeAuthAny, want: http.StatusOK},
+		{mode: config.ProbeAuthSigned, want: http.StatusUnauthorized},
+	} {
+		handler := newProbeAuthTestHandler(tc.mode)
+		req := httptest.NewRequest(http.MethodGet, probeapi.PathChecks, nil)
+		req.Header.Set(probeapi.HeaderProbeID, "probe-1")
+		req.Header.Set(probeapi.HeaderProbeSecret, "secret-1")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Fatalf("probe_auth %s: status = %d, want %d", tc.mode, rec.Code, tc.want)
+		}
+	}
+}
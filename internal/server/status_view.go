@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"time"
 
+	probeapi "github.com/tmater/wacht/internal/api/probe"
 	"github.com/tmater/wacht/internal/monitoring"
 	"github.com/tmater/wacht/internal/store"
 )
@@ -11,6 +12,7 @@ import (
 type statusViewStore interface {
 	StatusCheckViews(userID int64) ([]store.StatusCheckView, error)
 	PublicStatusCheckViews(slug string) ([]store.PublicStatusCheckView, bool, error)
+	ListProbes() ([]store.Probe, error)
 }
 
 type statusCheckDTO struct {
@@ -19,17 +21,48 @@ type statusCheckDTO struct {
 	Target        string  `json:"target,omitempty"`
 	Status        string  `json:"status"`
 	IncidentSince *string `json:"incident_since,omitempty"`
+	// ProbableCause is the error kind most down probes report, such as
+	// "dns" or "timeout".
+	ProbableCause string `json:"probable_cause,omitempty"`
+	// Probes is the per-probe view of the check. Only the authenticated
+	// status view fills it in.
+	Probes []statusCheckProbeDTO `json:"probes,omitempty"`
 }
 
+// statusCheckProbeDTO is one probe's latest evidence for a check.
+type statusCheckProbeDTO struct {
+	ProbeID      string            `json:"probe_id"`
+	Status       string            `json:"status"`
+	LastResultAt *string           `json:"last_result_at,omitempty"`
+	LastError    string            `json:"last_error,omitempty"`
+	ErrorKind    string            `json:"error_kind,omitempty"`
+	Timings      *statusTimingsDTO `json:"timings,omitempty"`
+}
+
+// statusTimingsDTO is the HTTP phase breakdown of a probe's last result, in
+// milliseconds.
+type statusTimingsDTO struct {
+	DNSMS      int64 `json:"dns_ms"`
+	ConnectMS  int64 `json:"connect_ms"`
+	TLSMS      int64 `json:"tls_ms"`
+	TTFBMS     int64 `json:"ttfb_ms"`
+	TransferMS int64 `json:"transfer_ms"`
+}
+
+// statusProbeDTO is one probe in the authenticated status view. Outdated
+// marks probes speaking an older probe protocol or running a build below the
+// configured minimum version.
 type statusProbeDTO struct {
 	ProbeID    string  `json:"probe_id"`
+	Version    string  `json:"version,omitempty"`
+	Outdated   bool    `json:"outdated"`
 	Status     string  `json:"status"`
 	Online     bool    `json:"online"`
 	LastSeenAt *string `json:"last_seen_at,omitempty"`
 	LastError  string  `json:"last_error,omitempty"`
 }
 
-func buildAuthenticatedStatusResponse(runtime *monitoring.Runtime, st statusViewStore, userID int64) ([]statusCheckDTO, []statusProbeDTO, error) {
+func buildAuthenticatedStatusResponse(runtime *monitoring.Runtime, st statusViewStore, userID int64, minProbeVersion probeapi.Version) ([]statusCheckDTO, []statusProbeDTO, error) {
 	if runtime == nil {
 		return nil, nil, fmt.Errorf("monitoring runtime is required")
 	}
@@ -52,6 +85,20 @@ func buildAuthenticatedStatusResponse(runtime *monitoring.Runtime, st statusView
 		quorumByCheckID[quorum.CheckID] = quorum
 	}
 
+	// Other users' private probes are not part of this user's fleet.
+	stored, err := st.ListProbes()
+	if err != nil {
+		return nil, nil, err
+	}
+	hidden := make(map[string]bool)
+	storedByID := make(map[string]store.Probe, len(stored))
+	for _, probe := range stored {
+		if probe.OwnerUserID != 0 && probe.OwnerUserID != userID {
+			hidden[probe.ProbeID] = true
+		}
+		storedByID[probe.ProbeID] = probe
+	}
+
 	checks := make([]statusCheckDTO, 0, len(views))
 	for _, view := range views {
 		quorum := quorumByCheckID[view.CheckID]
@@ -61,14 +108,22 @@ func buildAuthenticatedStatusResponse(runtime *monitoring.Runtime, st statusView
 			Target:        view.Target,
 			Status:        string(quorum.State),
 			IncidentSince: formatOptionalTimestamp(view.IncidentSince),
+			ProbableCause: string(quorum.ProbableCause),
+			Probes:        statusCheckProbes(runtime.CheckSnapshots(view.CheckID), hidden),
 		})
 	}
 
 	probes := runtime.ProbeSnapshots()
 	items := make([]statusProbeDTO, 0, len(probes))
 	for _, probe := range probes {
+		if hidden[probe.ProbeID] {
+			continue
+		}
+		record := storedByID[probe.ProbeID]
 		items = append(items, statusProbeDTO{
 			ProbeID:    probe.ProbeID,
+			Version:    record.Version,
+			Outdated:   probeOutdated(record, minProbeVersion),
 			Status:     string(probe.State),
 			Online:     probe.State == monitoring.ProbeStateOnline,
 			LastSeenAt: formatOptionalTimestamp(probe.LastHeartbeatAt),
@@ -78,6 +133,37 @@ func buildAuthenticatedStatusResponse(runtime *monitoring.Runtime, st statusView
 	return checks, items, nil
 }
 
+// statusCheckProbes converts one check's per-probe runtime states, skipping
+// probes the viewer cannot see.
+func statusCheckProbes(states []monitoring.CheckExecState, hidden map[string]bool) []statusCheckProbeDTO {
+	items := make([]statusCheckProbeDTO, 0, len(states))
+	for _, state := range states {
+		if hidden[state.ProbeID] {
+			continue
+		}
+		item := statusCheckProbeDTO{
+			ProbeID:   state.ProbeID,
+			Status:    string(state.State),
+			LastError: state.LastError,
+			ErrorKind: string(state.LastErrorKind),
+		}
+		if !state.LastResultAt.IsZero() {
+			item.LastResultAt = formatOptionalTimestamp(&state.LastResultAt)
+		}
+		if !state.LastTimings.IsZero() {
+			item.Timings = &statusTimingsDTO{
+				DNSMS:      state.LastTimings.DNS.Milliseconds(),
+				ConnectMS:  state.LastTimings.Connect.Milliseconds(),
+				TLSMS:      state.LastTimings.TLS.Milliseconds(),
+				TTFBMS:     state.LastTimings.TTFB.Milliseconds(),
+				TransferMS: state.LastTimings.Transfer.Milliseconds(),
+			}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
 func buildPublicStatusResponse(runtime *monitoring.Runtime, st statusViewStore, slug string) ([]statusCheckDTO, bool, error) {
 	if runtime == nil {
 		return nil, false, fmt.Errorf("monitoring runtime is required")
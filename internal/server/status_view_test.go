@@ -4,7 +4,9 @@ import (
 	"testing"
 	"time"
 
+	probeapi "github.com/tmater/wacht/internal/api/probe"
 	"github.com/tmater/wacht/internal/monitoring"
+	"github.com/tmater/wacht/internal/proto"
 	"github.com/tmater/wacht/internal/store"
 )
 
@@ -14,6 +16,7 @@ type fakeStatusViewStore struct {
 	publicViews    []store.PublicStatusCheckView
 	publicFound    bool
 	publicErr      error
+	probes         []store.Probe
 	lastStatusUser int64
 	lastPublicSlug string
 }
@@ -28,6 +31,10 @@ func (f *fakeStatusViewStore) PublicStatusCheckViews(slug string) ([]store.Publi
 	return append([]store.PublicStatusCheckView(nil), f.publicViews...), f.publicFound, f.publicErr
 }
 
+func (f *fakeStatusViewStore) ListProbes() ([]store.Probe, error) {
+	return append([]store.Probe(nil), f.probes...), nil
+}
+
 func TestBuildAuthenticatedStatusResponseUsesRuntimeState(t *testing.T) {
 	const (
 		pendingCheckID = "00000000-0000-0000-0000-000000000501"
@@ -93,7 +100,7 @@ func TestBuildAuthenticatedStatusResponseUsesRuntimeState(t *testing.T) {
 		},
 	}
 
-	checks, probes, err := buildAuthenticatedStatusResponse(runtime, st, 42)
+	checks, probes, err := buildAuthenticatedStatusResponse(runtime, st, 42, probeapi.Version{})
 	if err != nil {
 		t.Fatalf("buildAuthenticatedStatusResponse() error = %v", err)
 	}
@@ -116,6 +123,12 @@ func TestBuildAuthenticatedStatusResponseUsesRuntimeState(t *testing.T) {
 	if got := checks[2].Status; got != "error" {
 		t.Fatalf("error-check status = %q, want error", got)
 	}
+	if len(checks[0].Probes) != 0 {
+		t.Fatalf("pending-check probes = %#v, want none", checks[0].Probes)
+	}
+	if len(checks[1].Probes) != 3 || checks[1].Probes[0].ProbeID != "probe-a" || checks[1].Probes[0].Status != "down" || checks[1].Probes[0].LastError != "timeout" {
+		t.Fatalf("down-check probes = %#v, want three down probes starting with probe-a", checks[1].Probes)
+	}
 
 	if len(probes) != 5 {
 		t.Fatalf("len(probes) = %d, want 5", len(probes))
@@ -138,7 +151,7 @@ func TestBuildAuthenticatedStatusResponseIncludesProbesWithoutChecks(t *testing.
 	runtime := monitoring.NewRuntime(nil, []string{"probe-a"})
 	st := &fakeStatusViewStore{}
 
-	checks, probes, err := buildAuthenticatedStatusResponse(runtime, st, 7)
+	checks, probes, err := buildAuthenticatedStatusResponse(runtime, st, 7, probeapi.Version{})
 	if err != nil {
 		t.Fatalf("buildAuthenticatedStatusResponse() error = %v", err)
 	}
@@ -153,6 +166,49 @@ func TestBuildAuthenticatedStatusResponseIncludesProbesWithoutChecks(t *testing.
 	}
 }
 
+func TestBuildAuthenticatedStatusResponseHidesOtherUsersPrivateProbes(t *testing.T) {
+	runtime := monitoring.NewRuntime(nil, []string{"shared", "mine", "theirs"})
+	st := &fakeStatusViewStore{probes: []store.Probe{
+		{ProbeID: "shared"},
+		{ProbeID: "mine", OwnerUserID: 7},
+		{ProbeID: "theirs", OwnerUserID: 8},
+	}}
+
+	_, probes, err := buildAuthenticatedStatusResponse(runtime, st, 7, probeapi.Version{})
+	if err != nil {
+		t.Fatalf("buildAuthenticatedStatusResponse() error = %v", err)
+	}
+	if len(probes) != 2 || probes[0].ProbeID != "mine" || probes[1].ProbeID != "shared" {
+		t.Fatalf("probes = %#v, want mine and shared only", probes)
+	}
+}
+
+func TestBuildAuthenticatedStatusResponseFlagsOutdatedProbes(t *testing.T) {
+	registeredAt := time.Date(2026, time.April, 8, 12, 0, 0, 0, time.UTC)
+	runtime := monitoring.NewRuntime(nil, []string{"current", "old-protocol", "old-build", "unregistered"})
+	st := &fakeStatusViewStore{probes: []store.Probe{
+		{ProbeID: "current", Version: "v1.4.0", ProtocolVersion: probeapi.ProtocolVersion, RegisteredAt: &registeredAt},
+		{ProbeID: "old-protocol", Version: "v1.4.0", RegisteredAt: &registeredAt},
+		{ProbeID: "old-build", Version: "v1.3.0", ProtocolVersion: probeapi.ProtocolVersion, RegisteredAt: &registeredAt},
+		{ProbeID: "unregistered"},
+	}}
+
+	_, probes, err := buildAuthenticatedStatusResponse(runtime, st, 7, probeapi.Version{Major: 1, Minor: 4})
+	if err != nil {
+		t.Fatalf("buildAuthenticatedStatusResponse() error = %v", err)
+	}
+	outdated := make(map[string]bool, len(probes))
+	for _, probe := range probes {
+		outdated[probe.ProbeID] = probe.Outdated
+	}
+	want := map[string]bool{"current": false, "old-protocol": true, "old-build": true, "unregistered": false}
+	for probeID, wantOutdated := range want {
+		if outdated[probeID] != wantOutdated {
+			t.Fatalf("%s outdated = %v, want %v", probeID, outdated[probeID], wantOutdated)
+		}
+	}
+}
+
 func TestBuildPublicStatusResponseUsesRuntimeState(t *testing.T) {
 	const (
 		downCheckID    = "00000000-0000-0000-0000-000000000601"
@@ -228,3 +284,40 @@ func TestBuildPublicStatusResponsePropagatesMissingSlug(t *testing.T) {
 		t.Fatal("found = true, want false")
 	}
 }
+
+func TestStatusCheckProbesReportsTimingsAndHidesProbes(t *testing.T) {
+	at := time.Date(2026, time.April, 8, 12, 0, 0, 0, time.UTC)
+	items := statusCheckProbes([]monitoring.CheckExecState{
+		{
+			ProbeID:      "probe-a",
+			State:        monitoring.CheckStateUp,
+			LastResultAt: at,
+			LastTimings: proto.HTTPTimings{
+				DNS:      45 * time.Millisecond,
+				Connect:  12 * time.Millisecond,
+				TLS:      30 * time.Millisecond,
+				TTFB:     410 * time.Millisecond,
+				Transfer: 3 * time.Millisecond,
+			},
+		},
+		{ProbeID: "probe-b", State: monitoring.CheckStateMissing, LastError: "no such host", LastErrorKind: proto.ErrorKindDNS},
+		{ProbeID: "theirs", State: monitoring.CheckStateUp, LastResultAt: at},
+	}, map[string]bool{"theirs": true})
+
+	if len(items) != 2 {
+		t.Fatalf("len(items) = %d, want 2", len(items))
+	}
+	want := statusTimingsDTO{DNSMS: 45, ConnectMS: 12, TLSMS: 30, TTFBMS: 410, TransferMS: 3}
+	if items[0].Timings == nil || *items[0].Timings != want {
+		t.Fatalf("probe-a timings = %#v, want %#v", items[0].Timings, want)
+	}
+	if items[0].LastResultAt == nil || *items[0].LastResultAt != at.Format(time.RFC3339) {
+		t.Fatalf("probe-a last_result_at = %v, want %s", items[0].LastResultAt, at.Format(time.RFC3339))
+	}
+	if items[1].ErrorKind != "dns" {
+		t.Fatalf("probe-b error_kind = %q, want dns", items[1].ErrorKind)
+	}
+	if items[1].ProbeID != "probe-b" || items[1].Timings != nil || items[1].LastResultAt != nil {
+		t.Fatalf("probe-b = %#v, want no timings or last result", items[1])
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// webhookDestinationJSON is the admin API shape for one webhook host's
+// delivery guard.
+type webhookDestinationJSON struct {
+	Host                string  `json:"host"`
+	Breaker             string  `json:"breaker"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+	InFlight            int     `json:"in_flight"`
+	OpenUntil           *string `json:"open_until,omitempty"`
+	LastError           string  `json:"last_error,omitempty"`
+	LastFailureAt       *string `json:"last_failure_at,omitempty"`
+	LastSuccessAt       *string `json:"last_success_at,omitempty"`
+}
+
+// handleListWebhookDestinations reports circuit breaker and limiter state for
+// every webhook host the sender has talked to recently.
+func (h *Handler) handleListWebhookDestinations(w http.ResponseWriter, r *http.Request) {
+	destinations := h.webhooks.Destinations()
+	out := make([]webhookDestinationJSON, 0, len(destinations))
+	for _, d := range destinations {
+		out = append(out, webhookDestinationJSON{
+			Host:                d.Host,
+			Breaker:             d.Breaker,
+			ConsecutiveFailures: d.ConsecutiveFailures,
+			InFlight:            d.InFlight,
+			OpenUntil:           formatOptionalTimestamp(d.OpenUntil),
+			LastError:           d.LastError,
+			LastFailureAt:       formatOptionalTimestamp(d.LastFailureAt),
+			LastSuccessAt:       formatOptionalTimestamp(d.LastSuccessAt),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		requestLogger(r).Warn("encode webhook destinations failed", "component", "webhooks", "err", err)
+	}
+}
@@ -77,6 +77,8 @@ func TestCheckCRUD(t *testing.T) {
 	// Update
 	c.Target = "https://updated.com"
 	c.Webhook = "https://hooks.example.com"
+	c.ProbeSelector = "region=eu-west"
+	c.Private = true
 	if err := s.UpdateCheck(c, user.ID); err != nil {
 		t.Fatalf("UpdateCheck: %v", err)
 	}
@@ -84,6 +86,9 @@ func TestCheckCRUD(t *testing.T) {
 	if got.Target != "https://updated.com" || got.Webhook != "https://hooks.example.com" {
 		t.Errorf("UpdateCheck: unexpected values %+v", got)
 	}
+	if got.ProbeSelector != "region=eu-west" || !got.Private || got.OwnerID != user.ID {
+		t.Errorf("UpdateCheck: placement fields %+v, want selector, private, and owner", got)
+	}
 
 	// Delete
 	deleted, checkID, err := s.DeleteCheck("c1", user.ID)
@@ -199,6 +204,37 @@ func TestCheckCRUD_PersistsCanonicalDefinition(t *testing.T) {
 	}
 }
 
+func TestCheckCRUD_PersistsTCPExchange(t *testing.T) {
+	s := newTestStore(t)
+
+	user, err := s.CreateUser("exchange@example.com", "password", false)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	c := testCheck("redis", "tcp-expect", "redis.example.com:6379")
+	c.Send, c.Expect, c.ExpectMode, c.ReadTimeoutMS = "PING\r\n", "+PONG", "contains", 500
+	created, err := s.CreateCheck(c, user.ID)
+	if err != nil {
+		t.Fatalf("CreateCheck: %v", err)
+	}
+
+	c.ID = created.ID
+	c.OwnerID = user.ID
+	c.TLS, c.Expect, c.ExpectMode = true, `^\+PONG`, "regex"
+	if err := s.UpdateCheck(c, user.ID); err != nil {
+		t.Fatalf("UpdateCheck: %v", err)
+	}
+
+	got, err := s.GetCheckByName("redis", user.ID)
+	if err != nil || got == nil {
+		t.Fatalf("GetCheck = %v, %v", got, err)
+	}
+	if got.TCPExchange() != c.TCPExchange() {
+		t.Fatalf("exchange = %+v, want %+v", got.TCPExchange(), c.TCPExchange())
+	}
+}
+
 func TestDeleteCheck_PreservesHistoryWithoutLeakingStateOnIDReuse(t *testing.T) {
 	s := newTestStore(t)
 
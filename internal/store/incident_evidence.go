@@ -0,0 +1,127 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tmater/wacht/internal/proto"
+)
+
+// maxIncidentEvidencePerProbe bounds how many snapshots one probe adds to an
+// incident. The first failures show how the outage started; later ones from a
+// long outage would mostly repeat them.
+const maxIncidentEvidencePerProbe = 5
+
+// IncidentEvidenceWrite attaches one probe's failure snapshot to the check's
+// open incident: the response it got, the network path it traced, or both.
+// It is dropped when the check has no open incident.
+type IncidentEvidenceWrite struct {
+	CheckID    string
+	ProbeID    string
+	CapturedAt time.Time
+	Evidence   proto.HTTPEvidence // zero when the failure got no response
+	Path       *proto.NetworkPath
+}
+
+// IncidentEvidence is one stored failure snapshot of an incident.
+type IncidentEvidence struct {
+	ID         int64
+	ProbeID    string
+	CapturedAt time.Time
+	Evidence   proto.HTTPEvidence
+	Path       *proto.NetworkPath
+}
+
+func validIncidentEvidenceWrite(write IncidentEvidenceWrite) bool {
+	return strings.TrimSpace(write.CheckID) != "" && strings.TrimSpace(write.ProbeID) != "" &&
+		(strings.TrimSpace(write.Evidence.Status) != "" || write.Path != nil)
+}
+
+// insertIncidentEvidenceTx stores evidence against the check's open incident,
+// up to maxIncidentEvidencePerProbe snapshots per probe.
+func insertIncidentEvidenceTx(tx *sql.Tx, write IncidentEvidenceWrite) error {
+	checkID, err := normalizeCheckID(write.CheckID)
+	if err != nil {
+		return ErrInvalidMonitoringIncidentWrite
+	}
+	evidence := write.Evidence.Bounded()
+	headers := "{}"
+	if len(evidence.Headers) > 0 {
+		raw, err := json.Marshal(evidence.Headers)
+		if err != nil {
+			return fmt.Errorf("encode evidence headers: %w", err)
+		}
+		headers = string(raw)
+	}
+	var path *string
+	if write.Path != nil {
+		raw, err := json.Marshal(write.Path.Bounded())
+		if err != nil {
+			return fmt.Errorf("encode evidence path: %w", err)
+		}
+		encoded := string(raw)
+		path = &encoded
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO incident_evidence (incident_id, probe_id, captured_at, status, headers, body, body_truncated, remote_addr, path)
+		SELECT i.id, $2, $3, $4, $5::jsonb, $6, $7, $8, $9::jsonb
+		FROM incidents i
+		WHERE i.check_id = $1
+		  AND i.resolved_at IS NULL
+		  AND (SELECT COUNT(*) FROM incident_evidence e WHERE e.incident_id = i.id AND e.probe_id = $2) < $10
+	`, checkID, strings.TrimSpace(write.ProbeID), normalizeTime(write.CapturedAt), evidence.Status, headers, evidence.Body, evidence.BodyTruncated, evidence.RemoteAddr, path, maxIncidentEvidencePerProbe)
+	return err
+}
+
+// ListIncidentEvidence returns the evidence of one of userID's incidents in
+// capture order. found is false when the incident does not exist or belongs
+// to another user.
+func (s *Store) ListIncidentEvidence(userID, incidentID int64) (evidence []IncidentEvidence, found bool, err error) {
+	if err := s.db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM incidents WHERE id = $1 AND user_id = $2)
+	`, incidentID, userID).Scan(&found); err != nil || !found {
+		return nil, false, err
+	}
+
+	rows, err := s.db.Query(`
+		SELECT id, probe_id, captured_at, status, headers, body, body_truncated, remote_addr, path
+		FROM incident_evidence
+		WHERE incident_id = $1
+		ORDER BY captured_at, id
+	`, incidentID)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			item    IncidentEvidence
+			headers []byte
+			path    []byte
+		)
+		if err := rows.Scan(&item.ID, &item.ProbeID, &item.CapturedAt, &item.Evidence.Status, &headers, &item.Evidence.Body, &item.Evidence.BodyTruncated, &item.Evidence.RemoteAddr, &path); err != nil {
+			return nil, false, err
+		}
+		if len(headers) > 0 {
+			if err := json.Unmarshal(headers, &item.Evidence.Headers); err != nil {
+				return nil, false, fmt.Errorf("decode evidence headers: %w", err)
+			}
+		}
+		if len(item.Evidence.Headers) == 0 {
+			item.Evidence.Headers = nil
+		}
+		if len(path) > 0 {
+			item.Path = &proto.NetworkPath{}
+			if err := json.Unmarshal(path, item.Path); err != nil {
+				return nil, false, fmt.Errorf("decode evidence path: %w", err)
+			}
+		}
+		evidence = append(evidence, item)
+	}
+	return evidence, true, rows.Err()
+}
@@ -2,6 +2,8 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
+	"sort"
 	"time"
 )
 
@@ -16,10 +18,40 @@ const (
 	notificationStateSuperseded = "superseded"
 )
 
+// Fleet health events for admin notifications that are not tied to an
+// incident.
+const (
+	FleetEventProbeOffline   = "probe_offline"
+	FleetEventProbeOnline    = "probe_online"
+	FleetEventQuorumAtRisk   = "quorum_at_risk"
+	FleetEventQuorumRestored = "quorum_restored"
+)
+
+// FleetNotification is durable admin-facing webhook work about probe fleet
+// health. It shares the incident notification delivery pipeline.
+type FleetNotification struct {
+	Event      string
+	ProbeID    string
+	WebhookURL string
+	Payload    []byte
+}
+
 // NotificationRequest captures the durable work needed to deliver a webhook.
 type NotificationRequest struct {
 	WebhookURL string
 	Payload    []byte
+	// IncludeIncident merges an "incident" object into the JSON payload once
+	// the incident row is known, for schemas that correlate down and up events.
+	IncludeIncident bool
+}
+
+// NotificationIncident is the incident block merged into versioned webhook
+// payloads when the notification is queued.
+type NotificationIncident struct {
+	ID         int64   `json:"id"`
+	StartedAt  string  `json:"started_at"`
+	ResolvedAt *string `json:"resolved_at,omitempty"`
+	DurationMs *int64  `json:"duration_ms,omitempty"`
 }
 
 // IncidentNotification summarizes the delivery state for one incident transition.
@@ -33,30 +65,91 @@ type IncidentNotification struct {
 	DeliveredAt   *time.Time
 }
 
-// NotificationJob is a claimed webhook delivery ready for dispatch.
+// NotificationJob is a claimed webhook delivery ready for dispatch. Fleet
+// health jobs have no incident or check and may carry a probe ID instead.
 type NotificationJob struct {
 	ID         int64
 	IncidentID int64
 	CheckID    string
+	ProbeID    string
 	Event      string
 	WebhookURL string
 	Payload    []byte
 	Attempts   int
 }
 
-func insertIncidentNotification(tx *sql.Tx, incidentID int64, event string, request *NotificationRequest, now time.Time) error {
+func insertIncidentNotification(tx *sql.Tx, incidentID int64, startedAt time.Time, resolvedAt *time.Time, event string, request *NotificationRequest, now time.Time) error {
 	if request == nil || request.WebhookURL == "" || len(request.Payload) == 0 {
 		return nil
 	}
 
-	_, err := tx.Exec(`
+	payload := request.Payload
+	if request.IncludeIncident {
+		var err error
+		payload, err = withNotificationIncident(payload, incidentID, startedAt, resolvedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	res, err := tx.Exec(`
 		INSERT INTO incident_notifications (
 			incident_id, event, state, webhook_url, payload, attempts, next_attempt_at, created_at, updated_at
 		)
 		VALUES ($1, $2, $3, $4, $5::jsonb, 0, $6, $6, $6)
 		ON CONFLICT (incident_id, event) DO NOTHING
-	`, incidentID, event, notificationStatePending, request.WebhookURL, string(request.Payload), now)
-	return err
+	`, incidentID, event, notificationStatePending, request.WebhookURL, string(payload), now)
+	if err != nil {
+		return err
+	}
+	return notifyIncidentNotificationQueuedTx(tx, res)
+}
+
+func insertFleetNotificationTx(tx *sql.Tx, notification FleetNotification, now time.Time) error {
+	res, err := tx.Exec(`
+		INSERT INTO incident_notifications (
+			probe_id, event, state, webhook_url, payload, attempts, next_attempt_at, created_at, updated_at
+		)
+		VALUES (NULLIF($1, ''), $2, $3, $4, $5::jsonb, 0, $6, $6, $6)
+	`, notification.ProbeID, notification.Event, notificationStatePending, notification.WebhookURL, string(notification.Payload), now)
+	if err != nil {
+		return err
+	}
+	return notifyIncidentNotificationQueuedTx(tx, res)
+}
+
+func validFleetNotification(notification FleetNotification) bool {
+	switch notification.Event {
+	case FleetEventProbeOffline, FleetEventProbeOnline, FleetEventQuorumAtRisk, FleetEventQuorumRestored:
+	default:
+		return false
+	}
+	return notification.WebhookURL != "" && len(notification.Payload) > 0
+}
+
+// withNotificationIncident adds the incident block to a JSON object payload.
+func withNotificationIncident(payload []byte, incidentID int64, startedAt time.Time, resolvedAt *time.Time) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, err
+	}
+
+	incident := NotificationIncident{
+		ID:        incidentID,
+		StartedAt: startedAt.UTC().Format(time.RFC3339),
+	}
+	if resolvedAt != nil {
+		resolved := resolvedAt.UTC().Format(time.RFC3339)
+		durationMs := resolvedAt.Sub(startedAt).Milliseconds()
+		incident.ResolvedAt = &resolved
+		incident.DurationMs = &durationMs
+	}
+	encoded, err := json.Marshal(incident)
+	if err != nil {
+		return nil, err
+	}
+	fields["incident"] = encoded
+	return json.Marshal(fields)
 }
 
 // ClaimDueIncidentNotifications claims notifications that are ready for delivery.
@@ -70,11 +163,10 @@ func (s *Store) ClaimDueIncidentNotifications(now, staleBefore time.Time, limit
 		WITH due AS (
 			SELECT n.id
 			FROM incident_notifications n
-			JOIN incidents i ON i.id = n.incident_id
-			JOIN checks c ON c.id = i.check_id
+			LEFT JOIN incidents i ON i.id = n.incident_id
 			WHERE (
 				(n.state IN ($1, $2) AND n.next_attempt_at <= $3)
-				OR (n.state = $4 AND n.last_attempt_at <= $5)
+				OR (n.state = $4 AND n.claimed_at <= $5)
 			)
 			AND NOT (n.event = $6 AND i.resolved_at IS NOT NULL)
 			ORDER BY n.next_attempt_at ASC, n.id ASC
@@ -84,13 +176,13 @@ func (s *Store) ClaimDueIncidentNotifications(now, staleBefore time.Time, limit
 		UPDATE incident_notifications n
 		SET state = $4,
 		    attempts = n.attempts + 1,
-		    last_attempt_at = $3,
+		    claimed_at = $3,
 		    updated_at = $3
-		FROM due, incidents i, checks c
+		FROM due
 		WHERE n.id = due.id
-		  AND i.id = n.incident_id
-		  AND c.id = i.check_id
-		RETURNING n.id, n.incident_id, c.id::text, n.event, n.webhook_url, n.payload, n.attempts
+		RETURNING n.id, COALESCE(n.incident_id, 0),
+		          COALESCE((SELECT i.check_id::text FROM incidents i WHERE i.id = n.incident_id), ''),
+		          COALESCE(n.probe_id, ''), n.event, n.webhook_url, n.payload, n.attempts
 	`, notificationStatePending, notificationStateRetrying, now, notificationStateProcessing, staleBefore, notificationEventDown, limit)
 	if err != nil {
 		return nil, err
@@ -100,7 +192,7 @@ func (s *Store) ClaimDueIncidentNotifications(now, staleBefore time.Time, limit
 	jobs := make([]NotificationJob, 0, limit)
 	for rows.Next() {
 		var job NotificationJob
-		if err := rows.Scan(&job.ID, &job.IncidentID, &job.CheckID, &job.Event, &job.WebhookURL, &job.Payload, &job.Attempts); err != nil {
+		if err := rows.Scan(&job.ID, &job.IncidentID, &job.CheckID, &job.ProbeID, &job.Event, &job.WebhookURL, &job.Payload, &job.Attempts); err != nil {
 			return nil, err
 		}
 		jobs = append(jobs, job)
@@ -108,6 +200,77 @@ func (s *Store) ClaimDueIncidentNotifications(now, staleBefore time.Time, limit
 	return jobs, rows.Err()
 }
 
+// ClaimDueIncidentNotificationGroup claims due notifications that share one
+// webhook destination so the sender can deliver them as a single digest.
+//
+// A destination only becomes due once its oldest first-attempt notification
+// was created at or before groupBefore; everything else queued for the same
+// URL by then rides along. Retries and stale claims are not held back again.
+func (s *Store) ClaimDueIncidentNotificationGroup(now, staleBefore, groupBefore time.Time, limit int) ([]NotificationJob, error) {
+	if limit <= 0 {
+		limit = 1
+	}
+
+	rows, err := s.db.Query(`
+		WITH head AS (
+			SELECT n.webhook_url
+			FROM incident_notifications n
+			LEFT JOIN incidents i ON i.id = n.incident_id
+			WHERE (
+				(n.state IN ($1, $2) AND n.next_attempt_at <= $3)
+				OR (n.state = $4 AND n.claimed_at <= $5)
+			)
+			AND NOT (n.event = $6 AND i.resolved_at IS NOT NULL)
+			AND (n.attempts > 0 OR n.created_at <= $7)
+			ORDER BY n.next_attempt_at ASC, n.id ASC
+			LIMIT 1
+			FOR UPDATE OF n SKIP LOCKED
+		),
+		due AS (
+			SELECT n.id
+			FROM incident_notifications n
+			LEFT JOIN incidents i ON i.id = n.incident_id
+			JOIN head h ON h.webhook_url = n.webhook_url
+			WHERE (
+				(n.state IN ($1, $2) AND n.next_attempt_at <= $3)
+				OR (n.state = $4 AND n.claimed_at <= $5)
+			)
+			AND NOT (n.event = $6 AND i.resolved_at IS NOT NULL)
+			ORDER BY n.next_attempt_at ASC, n.id ASC
+			LIMIT $8
+			FOR UPDATE OF n SKIP LOCKED
+		)
+		UPDATE incident_notifications n
+		SET state = $4,
+		    attempts = n.attempts + 1,
+		    claimed_at = $3,
+		    updated_at = $3
+		FROM due
+		WHERE n.id = due.id
+		RETURNING n.id, COALESCE(n.incident_id, 0),
+		          COALESCE((SELECT i.check_id::text FROM incidents i WHERE i.id = n.incident_id), ''),
+		          COALESCE(n.probe_id, ''), n.event, n.webhook_url, n.payload, n.attempts
+	`, notificationStatePending, notificationStateRetrying, now, notificationStateProcessing, staleBefore, notificationEventDown, groupBefore, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make([]NotificationJob, 0, limit)
+	for rows.Next() {
+		var job NotificationJob
+		if err := rows.Scan(&job.ID, &job.IncidentID, &job.CheckID, &job.ProbeID, &job.Event, &job.WebhookURL, &job.Payload, &job.Attempts); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	return jobs, nil
+}
+
 // MarkIncidentNotificationDelivered records a successful delivery while
 // preserving rows that were already superseded during an in-flight send.
 func (s *Store) MarkIncidentNotificationDelivered(id int64, deliveredAt time.Time) error {
@@ -115,6 +278,8 @@ func (s *Store) MarkIncidentNotificationDelivered(id int64, deliveredAt time.Tim
 		UPDATE incident_notifications
 		SET state = $2,
 		    delivered_at = $1,
+		    last_attempt_at = $1,
+		    claimed_at = NULL,
 		    next_attempt_at = NULL,
 		    last_error = NULL,
 		    updated_at = $1
@@ -140,10 +305,13 @@ func (s *Store) MarkIncidentNotificationRetry(id int64, attemptedAt, nextAttempt
 				ELSE $5::timestamptz
 			END,
 		    last_error = $6,
+		    last_attempt_at = $1,
+		    claimed_at = NULL,
 		    updated_at = $1
-		FROM incidents i
+		FROM incident_notifications self
+		LEFT JOIN incidents i ON i.id = self.incident_id
 		WHERE n.id = $7
-		  AND i.id = n.incident_id
+		  AND self.id = n.id
 		  AND n.state <> $8
 	`, attemptedAt, notificationStateSuperseded, notificationEventDown, notificationStateRetrying, nextAttemptAt, truncateError(lastError), id, notificationStateDelivered)
 	if err != nil {
@@ -160,6 +328,24 @@ func (s *Store) MarkIncidentNotificationRetry(id int64, attemptedAt, nextAttempt
 	return nil
 }
 
+// ReleaseIncidentNotification hands a claimed notification back without
+// counting the claim as a delivery attempt, e.g. when the sender parks work for
+// a destination whose circuit breaker is open. last_attempt_at keeps the
+// previous real attempt, if any.
+func (s *Store) ReleaseIncidentNotification(id int64, releasedAt, nextAttemptAt time.Time) error {
+	_, err := s.db.Exec(`
+		UPDATE incident_notifications
+		SET state = CASE WHEN attempts <= 1 THEN $2 ELSE $3 END,
+		    attempts = GREATEST(attempts - 1, 0),
+		    claimed_at = NULL,
+		    next_attempt_at = $4,
+		    updated_at = $1
+		WHERE id = $5
+		  AND state = $6
+	`, releasedAt, notificationStatePending, notificationStateRetrying, nextAttemptAt, id, notificationStateProcessing)
+	return err
+}
+
 func truncateError(message string) string {
 	if len(message) <= 512 {
 		return message
@@ -221,21 +407,24 @@ func openIncidentWithNotificationByCheckIDTx(tx *sql.Tx, checkID string, request
 		return false, err
 	}
 
-	if err := insertIncidentNotification(tx, incidentID, notificationEventDown, request, now); err != nil {
+	if err := insertIncidentNotification(tx, incidentID, now, nil, notificationEventDown, request, now); err != nil {
 		return false, err
 	}
 	return false, nil
 }
 
 func resolveIncidentWithNotificationByCheckIDTx(tx *sql.Tx, checkID string, request *NotificationRequest, now time.Time) (bool, error) {
-	var incidentID int64
+	var (
+		incidentID int64
+		startedAt  time.Time
+	)
 	err := tx.QueryRow(`
 		UPDATE incidents
 		SET resolved_at = $1
 		WHERE check_id = $2
 		  AND resolved_at IS NULL
-		RETURNING id
-	`, now, checkID).Scan(&incidentID)
+		RETURNING id, started_at
+	`, now, checkID).Scan(&incidentID, &startedAt)
 	if err == sql.ErrNoRows {
 		return false, nil
 	}
@@ -255,7 +444,7 @@ func resolveIncidentWithNotificationByCheckIDTx(tx *sql.Tx, checkID string, requ
 		return false, err
 	}
 
-	if err := insertIncidentNotification(tx, incidentID, notificationEventUp, request, now); err != nil {
+	if err := insertIncidentNotification(tx, incidentID, startedAt, &now, notificationEventUp, request, now); err != nil {
 		return false, err
 	}
 	return true, nil
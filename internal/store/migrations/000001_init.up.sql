@@ -3,15 +3,42 @@ CREATE EXTENSION IF NOT EXISTS pgcrypto;
 CREATE TABLE probes (
     probe_id      TEXT PRIMARY KEY,
     secret_hash   TEXT NOT NULL,
+    verify_key    TEXT NOT NULL,
     provisioned_by TEXT NOT NULL DEFAULT 'config',
     version       TEXT NOT NULL DEFAULT '',
     created_at    TIMESTAMPTZ NOT NULL,
     registered_at TIMESTAMPTZ,
     last_seen_at  TIMESTAMPTZ,
     revoked_at    TIMESTAMPTZ,
+    last_result_seq BIGINT NOT NULL DEFAULT 0,
+    declared_labels JSONB NOT NULL DEFAULT '{}',
+    admin_labels    JSONB NOT NULL DEFAULT '{}',
+    owner_user_id   INTEGER,
+    protocol_version INTEGER NOT NULL DEFAULT 0,
+    check_types     JSONB NOT NULL DEFAULT '[]',
+    previous_secret_hash       TEXT,
+    previous_verify_key        TEXT,
+    previous_secret_expires_at TIMESTAMPTZ,
+    join_token_id      BIGINT,
+    enrollment_id_hash TEXT,
     CONSTRAINT probes_provisioned_by_check CHECK (provisioned_by IN ('config', 'api'))
 );
 
+CREATE TABLE probe_join_tokens (
+    id          BIGSERIAL PRIMARY KEY,
+    token_hash  TEXT NOT NULL UNIQUE,
+    labels      JSONB NOT NULL DEFAULT '{}',
+    max_uses    INTEGER NOT NULL,
+    uses        INTEGER NOT NULL DEFAULT 0,
+    created_at  TIMESTAMPTZ NOT NULL,
+    expires_at  TIMESTAMPTZ NOT NULL,
+    CONSTRAINT probe_join_tokens_uses_check CHECK (uses <= max_uses)
+);
+
+CREATE UNIQUE INDEX idx_probes_enrollment
+    ON probes (join_token_id, enrollment_id_hash)
+    WHERE enrollment_id_hash IS NOT NULL;
+
 CREATE TABLE users (
     id            BIGSERIAL PRIMARY KEY,
     email         TEXT NOT NULL UNIQUE,
@@ -39,7 +66,17 @@ CREATE TABLE checks (
     webhook          TEXT NOT NULL DEFAULT '',
     user_id          INTEGER,
     interval_seconds INTEGER NOT NULL DEFAULT 30,
-    deleted_at       TIMESTAMPTZ
+    webhook_version  SMALLINT NOT NULL DEFAULT 1,
+    probe_selector   TEXT NOT NULL DEFAULT '',
+    private          BOOLEAN NOT NULL DEFAULT false,
+    retries          SMALLINT NOT NULL DEFAULT 0,
+    tls              BOOLEAN NOT NULL DEFAULT false,
+    send             TEXT NOT NULL DEFAULT '',
+    expect           TEXT NOT NULL DEFAULT '',
+    expect_mode      TEXT NOT NULL DEFAULT '',
+    read_timeout_ms  INTEGER NOT NULL DEFAULT 0,
+    deleted_at       TIMESTAMPTZ,
+    CONSTRAINT checks_webhook_version_check CHECK (webhook_version IN (1, 2))
 );
 
 CREATE UNIQUE INDEX idx_checks_active_scope_name
@@ -47,14 +84,17 @@ CREATE UNIQUE INDEX idx_checks_active_scope_name
     WHERE deleted_at IS NULL;
 
 CREATE TABLE check_probe_state (
-    check_id       UUID NOT NULL REFERENCES checks(id),
-    probe_id       TEXT NOT NULL,
-    last_result_at TIMESTAMPTZ NOT NULL,
-    last_outcome   TEXT NOT NULL,
-    streak_len     INTEGER NOT NULL,
-    expires_at     TIMESTAMPTZ NOT NULL,
-    state          TEXT NOT NULL,
-    last_error     TEXT NOT NULL DEFAULT '',
+    check_id        UUID NOT NULL REFERENCES checks(id),
+    probe_id        TEXT NOT NULL,
+    last_result_at  TIMESTAMPTZ NOT NULL,
+    last_outcome    TEXT NOT NULL,
+    streak_len      INTEGER NOT NULL,
+    expires_at      TIMESTAMPTZ NOT NULL,
+    state           TEXT NOT NULL,
+    last_error      TEXT NOT NULL DEFAULT '',
+    last_error_kind TEXT NOT NULL DEFAULT '',
+    last_attempts   INTEGER NOT NULL DEFAULT 0,
+    last_timings    JSONB,
     PRIMARY KEY (check_id, probe_id),
     CONSTRAINT check_probe_state_last_outcome_check CHECK (last_outcome IN ('', 'up', 'down', 'error')),
     CONSTRAINT check_probe_state_state_check CHECK (state IN ('up', 'down', 'missing', 'error')),
@@ -66,15 +106,19 @@ CREATE TABLE incidents (
     check_id    UUID NOT NULL REFERENCES checks(id),
     user_id     INTEGER,
     started_at  TIMESTAMPTZ NOT NULL,
-    resolved_at TIMESTAMPTZ
+    resolved_at TIMESTAMPTZ,
+    probable_cause TEXT NOT NULL DEFAULT ''
 );
 
 CREATE INDEX idx_incidents_user_started_at ON incidents (user_id, started_at DESC);
 CREATE UNIQUE INDEX idx_incidents_open_check ON incidents (check_id) WHERE resolved_at IS NULL;
 
+-- Durable webhook work. Incident transitions carry incident_id; admin-facing
+-- probe fleet health alerts have no incident and may name the probe instead.
 CREATE TABLE incident_notifications (
     id              BIGSERIAL PRIMARY KEY,
-    incident_id     BIGINT NOT NULL REFERENCES incidents(id) ON DELETE CASCADE,
+    incident_id     BIGINT REFERENCES incidents(id) ON DELETE CASCADE,
+    probe_id        TEXT,
     event           TEXT NOT NULL,
     state           TEXT NOT NULL,
     webhook_url     TEXT NOT NULL,
@@ -82,11 +126,13 @@ CREATE TABLE incident_notifications (
     attempts        INTEGER NOT NULL DEFAULT 0,
     last_error      TEXT,
     last_attempt_at TIMESTAMPTZ,
+    claimed_at      TIMESTAMPTZ,
     next_attempt_at TIMESTAMPTZ,
     delivered_at    TIMESTAMPTZ,
     created_at      TIMESTAMPTZ NOT NULL,
     updated_at      TIMESTAMPTZ NOT NULL,
-    CONSTRAINT incident_notifications_event_check CHECK (event IN ('down', 'up')),
+    CONSTRAINT incident_notifications_event_check CHECK (event IN ('down', 'up', 'probe_offline', 'probe_online', 'quorum_at_risk', 'quorum_restored')),
+    CONSTRAINT incident_notifications_incident_event_check CHECK ((incident_id IS NOT NULL) = (event IN ('down', 'up'))),
     CONSTRAINT incident_notifications_state_check CHECK (state IN ('pending', 'processing', 'retrying', 'delivered', 'superseded'))
 );
 
@@ -96,6 +142,25 @@ CREATE UNIQUE INDEX idx_incident_notifications_incident_event
 CREATE INDEX idx_incident_notifications_dispatch
     ON incident_notifications (state, next_attempt_at, id);
 
+-- Bounded snapshots of the responses probes got and the network paths they
+-- traced while an incident was open, so responders can see the failure
+-- without reproducing it. status is empty for path-only rows.
+CREATE TABLE incident_evidence (
+    id             BIGSERIAL PRIMARY KEY,
+    incident_id    BIGINT NOT NULL REFERENCES incidents(id) ON DELETE CASCADE,
+    probe_id       TEXT NOT NULL,
+    captured_at    TIMESTAMPTZ NOT NULL,
+    status         TEXT NOT NULL DEFAULT '',
+    headers        JSONB NOT NULL DEFAULT '{}',
+    body           TEXT NOT NULL DEFAULT '',
+    body_truncated BOOLEAN NOT NULL DEFAULT false,
+    remote_addr    TEXT NOT NULL DEFAULT '',
+    path           JSONB
+);
+
+CREATE INDEX idx_incident_evidence_incident
+    ON incident_evidence (incident_id, probe_id, captured_at);
+
 CREATE TABLE signup_requests (
     id                     BIGSERIAL PRIMARY KEY,
     email                  TEXT NOT NULL UNIQUE,
@@ -3,9 +3,13 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"strings"
 	"time"
+
+	"github.com/tmater/wacht/internal/proto"
 )
 
 var (
@@ -13,6 +17,9 @@ var (
 	ErrInvalidMonitoringProbeWrite = errors.New("store: invalid monitoring probe write")
 	// ErrInvalidMonitoringIncidentWrite reports an incomplete incident write.
 	ErrInvalidMonitoringIncidentWrite = errors.New("store: invalid monitoring incident write")
+	// ErrInvalidMonitoringFleetWrite reports an incomplete fleet health
+	// notification.
+	ErrInvalidMonitoringFleetWrite = errors.New("store: invalid monitoring fleet write")
 	// ErrInvalidMonitoringCheckStateWrite reports an incomplete per-(check, probe)
 	// current-state write.
 	ErrInvalidMonitoringCheckStateWrite = errors.New("store: invalid monitoring check state write")
@@ -21,34 +28,48 @@ var (
 // CheckStateWrite is one bounded persisted current-state row for a
 // (check, probe) assignment.
 type CheckStateWrite struct {
-	CheckID      string
-	ProbeID      string
-	LastResultAt time.Time
-	LastOutcome  string
-	StreakLen    int
-	ExpiresAt    time.Time
-	State        string
-	LastError    string
+	CheckID       string
+	ProbeID       string
+	LastResultAt  time.Time
+	LastOutcome   string
+	StreakLen     int
+	ExpiresAt     time.Time
+	State         string
+	LastError     string
+	LastErrorKind string
+	LastAttempts  int
+	LastTimings   proto.HTTPTimings
+}
+
+// CheckAssignment identifies one (check, probe) pair.
+type CheckAssignment struct {
+	CheckID string
+	ProbeID string
 }
 
 // PersistedProbeState is the compact persisted probe liveness snapshot needed
 // for runtime recovery.
 type PersistedProbeState struct {
-	ProbeID    string
-	LastSeenAt *time.Time
+	ProbeID       string
+	LastSeenAt    *time.Time
+	LastResultSeq int64
+	OwnerUserID   int64
 }
 
 // PersistedCheckState is the compact persisted per-(check, probe) snapshot
 // needed for runtime recovery.
 type PersistedCheckState struct {
-	CheckID      string
-	ProbeID      string
-	LastResultAt time.Time
-	LastOutcome  string
-	StreakLen    int
-	ExpiresAt    time.Time
-	State        string
-	LastError    string
+	CheckID       string
+	ProbeID       string
+	LastResultAt  time.Time
+	LastOutcome   string
+	StreakLen     int
+	ExpiresAt     time.Time
+	State         string
+	LastError     string
+	LastErrorKind string
+	LastAttempts  int
+	LastTimings   proto.HTTPTimings
 }
 
 // MonitoringWrite groups current-state, probe heartbeat, and incident writes
@@ -60,13 +81,37 @@ type MonitoringWrite struct {
 	IncidentCheckID      string
 	ResolveIncident      bool
 	IncidentNotification *NotificationRequest
+	FleetNotifications   []FleetNotification
+	ResultSeqProbeID     string
+	ResultSeq            int64
+	RemovedAssignments   []CheckAssignment
+	EvidenceWrites       []IncidentEvidenceWrite
+
+	// ProbableCauseCheckID names the check whose open incident records
+	// ProbableCause. It is applied after any incident write, so a write that
+	// opens an incident can carry its cause.
+	ProbableCauseCheckID string
+	ProbableCause        string
+}
+
+// empty reports whether write has nothing to persist. Fields that only qualify
+// another one, such as ProbeHeartbeatAt or ResolveIncident, are left out.
+func (w MonitoringWrite) empty() bool {
+	return len(w.CheckStateWrites) == 0 &&
+		w.ProbeHeartbeatID == "" &&
+		w.IncidentCheckID == "" &&
+		len(w.FleetNotifications) == 0 &&
+		w.ResultSeqProbeID == "" &&
+		len(w.RemovedAssignments) == 0 &&
+		len(w.EvidenceWrites) == 0 &&
+		w.ProbableCauseCheckID == ""
 }
 
 // RecoverableProbeStates returns all non-revoked probes plus their last-seen
 // timestamps for runtime recovery.
 func (s *Store) RecoverableProbeStates() ([]PersistedProbeState, error) {
 	rows, err := s.db.Query(`
-		SELECT probe_id, last_seen_at
+		SELECT probe_id, last_seen_at, last_result_seq, COALESCE(owner_user_id, 0)
 		FROM probes
 		WHERE revoked_at IS NULL
 		ORDER BY probe_id
@@ -82,7 +127,7 @@ func (s *Store) RecoverableProbeStates() ([]PersistedProbeState, error) {
 			state      PersistedProbeState
 			lastSeenAt sql.NullTime
 		)
-		if err := rows.Scan(&state.ProbeID, &lastSeenAt); err != nil {
+		if err := rows.Scan(&state.ProbeID, &lastSeenAt, &state.LastResultSeq, &state.OwnerUserID); err != nil {
 			return nil, err
 		}
 		if lastSeenAt.Valid {
@@ -98,7 +143,7 @@ func (s *Store) RecoverableProbeStates() ([]PersistedProbeState, error) {
 // to rebuild runtime state after restart.
 func (s *Store) PersistedCheckStates() ([]PersistedCheckState, error) {
 	rows, err := s.db.Query(`
-		SELECT check_id::text, probe_id, last_result_at, last_outcome, streak_len, expires_at, state, last_error
+		SELECT check_id::text, probe_id, last_result_at, last_outcome, streak_len, expires_at, state, last_error, last_error_kind, last_attempts, last_timings
 		FROM check_probe_state
 		ORDER BY check_id, probe_id
 	`)
@@ -112,6 +157,7 @@ func (s *Store) PersistedCheckStates() ([]PersistedCheckState, error) {
 		var (
 			state     PersistedCheckState
 			streakLen int32
+			timings   []byte
 		)
 		if err := rows.Scan(
 			&state.CheckID,
@@ -122,10 +168,18 @@ func (s *Store) PersistedCheckStates() ([]PersistedCheckState, error) {
 			&state.ExpiresAt,
 			&state.State,
 			&state.LastError,
+			&state.LastErrorKind,
+			&state.LastAttempts,
+			&timings,
 		); err != nil {
 			return nil, err
 		}
 		state.StreakLen = int(streakLen)
+		if len(timings) > 0 {
+			if err := json.Unmarshal(timings, &state.LastTimings); err != nil {
+				return nil, fmt.Errorf("decode check state timings: %w", err)
+			}
+		}
 		states = append(states, state)
 	}
 	return states, rows.Err()
@@ -178,10 +232,10 @@ func (s *Store) PersistMonitoringWrite(write MonitoringWrite) (MonitoringWrite,
 // batched probe result ingestion.
 func (s *Store) PersistMonitoringBatch(writes []MonitoringWrite) ([]MonitoringWrite, error) {
 	for _, write := range writes {
-		if write.ProbeHeartbeatID == "" && !write.ProbeHeartbeatAt.IsZero() {
+		if (write.ProbeHeartbeatID == "" && !write.ProbeHeartbeatAt.IsZero()) || (write.ResultSeqProbeID == "" && write.ResultSeq != 0) {
 			return nil, ErrInvalidMonitoringProbeWrite
 		}
-		if write.IncidentCheckID == "" && (write.ResolveIncident || write.IncidentNotification != nil) {
+		if (write.IncidentCheckID == "" && (write.ResolveIncident || write.IncidentNotification != nil)) || (write.ProbableCauseCheckID == "" && write.ProbableCause != "") {
 			return nil, ErrInvalidMonitoringIncidentWrite
 		}
 		for _, state := range write.CheckStateWrites {
@@ -189,11 +243,26 @@ func (s *Store) PersistMonitoringBatch(writes []MonitoringWrite) ([]MonitoringWr
 				return nil, err
 			}
 		}
+		for _, assignment := range write.RemovedAssignments {
+			if !validCheckAssignment(assignment) {
+				return nil, ErrInvalidMonitoringCheckStateWrite
+			}
+		}
+		for _, notification := range write.FleetNotifications {
+			if !validFleetNotification(notification) {
+				return nil, ErrInvalidMonitoringFleetWrite
+			}
+		}
+		for _, evidence := range write.EvidenceWrites {
+			if !validIncidentEvidenceWrite(evidence) {
+				return nil, ErrInvalidMonitoringIncidentWrite
+			}
+		}
 	}
 
 	nonEmpty := false
 	for _, write := range writes {
-		if len(write.CheckStateWrites) > 0 || write.ProbeHeartbeatID != "" || write.IncidentCheckID != "" {
+		if !write.empty() {
 			nonEmpty = true
 			break
 		}
@@ -224,10 +293,10 @@ func (s *Store) PersistMonitoringBatch(writes []MonitoringWrite) ([]MonitoringWr
 }
 
 func persistMonitoringWriteTx(tx *sql.Tx, write MonitoringWrite) (MonitoringWrite, error) {
-	if write.ProbeHeartbeatID == "" && !write.ProbeHeartbeatAt.IsZero() {
+	if (write.ProbeHeartbeatID == "" && !write.ProbeHeartbeatAt.IsZero()) || (write.ResultSeqProbeID == "" && write.ResultSeq != 0) {
 		return MonitoringWrite{}, ErrInvalidMonitoringProbeWrite
 	}
-	if write.IncidentCheckID == "" && (write.ResolveIncident || write.IncidentNotification != nil) {
+	if (write.IncidentCheckID == "" && (write.ResolveIncident || write.IncidentNotification != nil)) || (write.ProbableCauseCheckID == "" && write.ProbableCause != "") {
 		return MonitoringWrite{}, ErrInvalidMonitoringIncidentWrite
 	}
 	for _, state := range write.CheckStateWrites {
@@ -235,8 +304,23 @@ func persistMonitoringWriteTx(tx *sql.Tx, write MonitoringWrite) (MonitoringWrit
 			return MonitoringWrite{}, err
 		}
 	}
+	for _, assignment := range write.RemovedAssignments {
+		if !validCheckAssignment(assignment) {
+			return MonitoringWrite{}, ErrInvalidMonitoringCheckStateWrite
+		}
+	}
+	for _, notification := range write.FleetNotifications {
+		if !validFleetNotification(notification) {
+			return MonitoringWrite{}, ErrInvalidMonitoringFleetWrite
+		}
+	}
+	for _, evidence := range write.EvidenceWrites {
+		if !validIncidentEvidenceWrite(evidence) {
+			return MonitoringWrite{}, ErrInvalidMonitoringIncidentWrite
+		}
+	}
 
-	if len(write.CheckStateWrites) == 0 && write.ProbeHeartbeatID == "" && write.IncidentCheckID == "" {
+	if write.empty() {
 		return MonitoringWrite{}, nil
 	}
 
@@ -251,6 +335,12 @@ func persistMonitoringWriteTx(tx *sql.Tx, write MonitoringWrite) (MonitoringWrit
 		persisted.CheckStateWrites = append(persisted.CheckStateWrites, saved)
 	}
 
+	for _, assignment := range write.RemovedAssignments {
+		if err := deleteCheckStateTx(tx, assignment); err != nil {
+			return MonitoringWrite{}, err
+		}
+	}
+
 	if write.ProbeHeartbeatID != "" {
 		heartbeatAt, err := updateProbeHeartbeatTx(tx, write.ProbeHeartbeatID, write.ProbeHeartbeatAt)
 		if err != nil {
@@ -259,6 +349,12 @@ func persistMonitoringWriteTx(tx *sql.Tx, write MonitoringWrite) (MonitoringWrit
 		persisted.ProbeHeartbeatAt = heartbeatAt
 	}
 
+	if write.ResultSeqProbeID != "" {
+		if err := updateProbeResultSeqTx(tx, write.ResultSeqProbeID, write.ResultSeq); err != nil {
+			return MonitoringWrite{}, err
+		}
+	}
+
 	if _, err := applyMonitoringIncidentTx(
 		tx,
 		write.IncidentCheckID,
@@ -267,6 +363,24 @@ func persistMonitoringWriteTx(tx *sql.Tx, write MonitoringWrite) (MonitoringWrit
 	); err != nil {
 		return MonitoringWrite{}, err
 	}
+	if err := updateIncidentProbableCauseTx(tx, write.ProbableCauseCheckID, write.ProbableCause); err != nil {
+		return MonitoringWrite{}, err
+	}
+
+	// Evidence goes in after the incident write so the result that opens an
+	// incident is the first one attached to it.
+	for _, evidence := range write.EvidenceWrites {
+		if err := insertIncidentEvidenceTx(tx, evidence); err != nil {
+			return MonitoringWrite{}, err
+		}
+	}
+
+	now := time.Now().UTC()
+	for _, notification := range write.FleetNotifications {
+		if err := insertFleetNotificationTx(tx, notification, now); err != nil {
+			return MonitoringWrite{}, err
+		}
+	}
 	return persisted, nil
 }
 
@@ -280,33 +394,73 @@ func upsertCheckStateTx(tx *sql.Tx, state CheckStateWrite) (CheckStateWrite, err
 		return CheckStateWrite{}, ErrInvalidMonitoringCheckStateWrite
 	}
 	state.CheckID = checkID
+	timings, err := encodeCheckStateTimings(state.LastTimings)
+	if err != nil {
+		return CheckStateWrite{}, err
+	}
 
 	_, err = tx.Exec(`
 		INSERT INTO check_probe_state (
-			check_id, probe_id, last_result_at, last_outcome, streak_len, expires_at, state, last_error
+			check_id, probe_id, last_result_at, last_outcome, streak_len, expires_at, state, last_error, last_error_kind, last_attempts, last_timings
 		)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11::jsonb)
 		ON CONFLICT (check_id, probe_id) DO UPDATE
 		SET last_result_at = excluded.last_result_at,
 		    last_outcome = excluded.last_outcome,
 		    streak_len = excluded.streak_len,
 		    expires_at = excluded.expires_at,
 		    state = excluded.state,
-		    last_error = excluded.last_error
-	`, checkID, state.ProbeID, state.LastResultAt, state.LastOutcome, state.StreakLen, state.ExpiresAt, state.State, state.LastError)
+		    last_error = excluded.last_error,
+		    last_error_kind = excluded.last_error_kind,
+		    last_attempts = excluded.last_attempts,
+		    last_timings = excluded.last_timings
+	`, checkID, state.ProbeID, state.LastResultAt, state.LastOutcome, state.StreakLen, state.ExpiresAt, state.State, state.LastError, state.LastErrorKind, state.LastAttempts, timings)
 	if err != nil {
 		return CheckStateWrite{}, err
 	}
 	return state, nil
 }
 
+// encodeCheckStateTimings returns the JSON for the last_timings column, or nil
+// so the column stays NULL when the last result carried no phases.
+func encodeCheckStateTimings(timings proto.HTTPTimings) (*string, error) {
+	if timings.IsZero() {
+		return nil, nil
+	}
+	raw, err := json.Marshal(timings)
+	if err != nil {
+		return nil, fmt.Errorf("encode check state timings: %w", err)
+	}
+	encoded := string(raw)
+	return &encoded, nil
+}
+
+// deleteCheckStateTx drops the persisted current state of one assignment so
+// recovery does not re-add a probe the check no longer selects.
+func deleteCheckStateTx(tx *sql.Tx, assignment CheckAssignment) error {
+	checkID, err := normalizeCheckID(assignment.CheckID)
+	if err != nil {
+		return ErrInvalidMonitoringCheckStateWrite
+	}
+	_, err = tx.Exec(`
+		DELETE FROM check_probe_state
+		WHERE check_id = $1 AND probe_id = $2
+	`, checkID, strings.TrimSpace(assignment.ProbeID))
+	return err
+}
+
+func validCheckAssignment(assignment CheckAssignment) bool {
+	return strings.TrimSpace(assignment.CheckID) != "" && strings.TrimSpace(assignment.ProbeID) != ""
+}
+
 func normalizeCheckStateWrite(state CheckStateWrite) (CheckStateWrite, error) {
 	state.CheckID = strings.TrimSpace(state.CheckID)
 	state.ProbeID = strings.TrimSpace(state.ProbeID)
 	state.LastOutcome = strings.TrimSpace(state.LastOutcome)
 	state.State = strings.TrimSpace(state.State)
 	state.LastError = strings.TrimSpace(state.LastError)
-	if state.CheckID == "" || state.ProbeID == "" || state.State == "" || state.StreakLen < 0 {
+	state.LastErrorKind = strings.TrimSpace(state.LastErrorKind)
+	if state.CheckID == "" || state.ProbeID == "" || state.State == "" || state.StreakLen < 0 || state.LastAttempts < 0 {
 		return CheckStateWrite{}, ErrInvalidMonitoringCheckStateWrite
 	}
 	if state.LastOutcome == "" && state.State != "missing" {
@@ -344,6 +498,25 @@ func applyMonitoringIncidentTx(tx *sql.Tx, checkID string, resolve bool, request
 	return !alreadyOpen, nil
 }
 
+// updateIncidentProbableCauseTx records cause on the open incident of checkID,
+// if there is one.
+func updateIncidentProbableCauseTx(tx *sql.Tx, checkID, cause string) error {
+	if checkID == "" {
+		return nil
+	}
+	checkID, err := normalizeCheckID(checkID)
+	if err != nil {
+		return ErrInvalidMonitoringIncidentWrite
+	}
+	_, err = tx.Exec(`
+		UPDATE incidents
+		SET probable_cause = $1
+		WHERE check_id = $2
+		  AND resolved_at IS NULL
+	`, cause, checkID)
+	return err
+}
+
 // normalizeTime coerces zero or local times into a UTC timestamp suitable for
 // durable monitoring records.
 func normalizeTime(t time.Time) time.Time {
@@ -2,8 +2,11 @@ package store
 
 import (
 	"errors"
+	"reflect"
 	"testing"
 	"time"
+
+	"github.com/tmater/wacht/internal/proto"
 )
 
 func TestPersistMonitoringWriteUpsertsCheckStateAndListsRecoverySnapshots(t *testing.T) {
@@ -38,6 +41,7 @@ func TestPersistMonitoringWriteUpsertsCheckStateAndListsRecoverySnapshots(t *tes
 				StreakLen:    2,
 				ExpiresAt:    secondAt.Add(30 * time.Second),
 				State:        "up",
+				LastTimings:  proto.HTTPTimings{DNS: 12 * time.Millisecond, TTFB: 80 * time.Millisecond},
 			},
 			{
 				CheckID:      checkID,
@@ -56,14 +60,15 @@ func TestPersistMonitoringWriteUpsertsCheckStateAndListsRecoverySnapshots(t *tes
 
 	if _, err := s.PersistMonitoringWrite(MonitoringWrite{
 		CheckStateWrites: []CheckStateWrite{{
-			CheckID:      checkID,
-			ProbeID:      "probe-a",
-			LastResultAt: secondAt,
-			LastOutcome:  "down",
-			StreakLen:    2,
-			ExpiresAt:    secondAt.Add(30 * time.Second),
-			State:        "down",
-			LastError:    "timeout",
+			CheckID:       checkID,
+			ProbeID:       "probe-a",
+			LastResultAt:  secondAt,
+			LastOutcome:   "down",
+			StreakLen:     2,
+			ExpiresAt:     secondAt.Add(30 * time.Second),
+			State:         "down",
+			LastError:     "timeout",
+			LastErrorKind: "timeout",
 		}},
 	}); err != nil {
 		t.Fatalf("PersistMonitoringWrite second: %v", err)
@@ -90,12 +95,21 @@ func TestPersistMonitoringWriteUpsertsCheckStateAndListsRecoverySnapshots(t *tes
 	if states[0].ProbeID != "probe-a" || states[0].State != "down" || states[0].StreakLen != 2 {
 		t.Fatalf("states[0] = %#v, want probe-a/down/streak 2", states[0])
 	}
+	if states[0].LastErrorKind != "timeout" {
+		t.Fatalf("states[0].LastErrorKind = %q, want timeout", states[0].LastErrorKind)
+	}
 	if !states[0].LastResultAt.Equal(secondAt) {
 		t.Fatalf("states[0].LastResultAt = %s, want %s", states[0].LastResultAt, secondAt)
 	}
 	if states[1].ProbeID != "probe-b" || states[1].State != "up" {
 		t.Fatalf("states[1] = %#v, want probe-b/up", states[1])
 	}
+	if want := (proto.HTTPTimings{DNS: 12 * time.Millisecond, TTFB: 80 * time.Millisecond}); states[1].LastTimings != want {
+		t.Fatalf("states[1].LastTimings = %+v, want %+v", states[1].LastTimings, want)
+	}
+	if !states[0].LastTimings.IsZero() {
+		t.Fatalf("states[0].LastTimings = %+v, want zero", states[0].LastTimings)
+	}
 }
 
 // TestPersistMonitoringWriteCommitsCurrentStateAndIncidentAtomically verifies
@@ -172,6 +186,87 @@ func TestPersistMonitoringWriteCommitsCurrentStateAndIncidentAtomically(t *testi
 	}
 }
 
+// TestPersistMonitoringWriteAttachesEvidenceToOpenIncident verifies that
+// failed-response evidence lands on the check's open incident, is capped per
+// probe, and is dropped while no incident is open.
+func TestPersistMonitoringWriteAttachesEvidenceToOpenIncident(t *testing.T) {
+	s := newTestStore(t)
+
+	user, err := s.CreateUser("evidence@example.com", "pass", false)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	check, err := s.CreateCheck(testCheck("check-1", "http", "https://example.com"), user.ID)
+	if err != nil {
+		t.Fatalf("CreateCheck: %v", err)
+	}
+	at := time.Date(2026, time.January, 2, 3, 4, 5, 0, time.UTC)
+	evidenceWrite := func(offset time.Duration) IncidentEvidenceWrite {
+		return IncidentEvidenceWrite{
+			CheckID:    check.ID,
+			ProbeID:    "probe-a",
+			CapturedAt: at.Add(offset),
+			Evidence: proto.HTTPEvidence{
+				Status:     "HTTP/1.1 503 Service Unavailable",
+				Headers:    map[string]string{"Server": "nginx"},
+				Body:       "maintenance",
+				RemoteAddr: "203.0.113.7:443",
+			},
+		}
+	}
+
+	// No incident yet: the snapshot has nothing to attach to.
+	if _, err := s.PersistMonitoringWrite(MonitoringWrite{EvidenceWrites: []IncidentEvidenceWrite{evidenceWrite(0)}}); err != nil {
+		t.Fatalf("PersistMonitoringWrite without incident: %v", err)
+	}
+	if _, err := s.PersistMonitoringWrite(MonitoringWrite{
+		IncidentCheckID:      check.ID,
+		EvidenceWrites:       []IncidentEvidenceWrite{evidenceWrite(time.Second)},
+		ProbableCauseCheckID: check.ID,
+		ProbableCause:        string(proto.ErrorKindDNS),
+	}); err != nil {
+		t.Fatalf("PersistMonitoringWrite opening incident: %v", err)
+	}
+	path := &proto.NetworkPath{Target: "203.0.113.7:443", Hops: []proto.PathHop{{TTL: 1, Addr: "192.0.2.1", RTT: time.Millisecond}}}
+	if _, err := s.PersistMonitoringWrite(MonitoringWrite{EvidenceWrites: []IncidentEvidenceWrite{{
+		CheckID: check.ID, ProbeID: "probe-b", CapturedAt: at.Add(time.Second), Path: path,
+	}}}); err != nil {
+		t.Fatalf("PersistMonitoringWrite path: %v", err)
+	}
+	for i := 2; i < maxIncidentEvidencePerProbe+4; i++ {
+		if _, err := s.PersistMonitoringWrite(MonitoringWrite{EvidenceWrites: []IncidentEvidenceWrite{evidenceWrite(time.Duration(i) * time.Second)}}); err != nil {
+			t.Fatalf("PersistMonitoringWrite evidence %d: %v", i, err)
+		}
+	}
+
+	incidents, err := s.ListIncidents(user.ID, 10)
+	if err != nil || len(incidents) != 1 {
+		t.Fatalf("ListIncidents = %v, %v; want one incident", incidents, err)
+	}
+	if incidents[0].ProbableCause != string(proto.ErrorKindDNS) {
+		t.Fatalf("ProbableCause = %q, want dns from the opening write", incidents[0].ProbableCause)
+	}
+	evidence, found, err := s.ListIncidentEvidence(user.ID, incidents[0].ID)
+	if err != nil || !found {
+		t.Fatalf("ListIncidentEvidence = found %v, err %v", found, err)
+	}
+	if len(evidence) != maxIncidentEvidencePerProbe+1 {
+		t.Fatalf("evidence rows = %d, want %d", len(evidence), maxIncidentEvidencePerProbe+1)
+	}
+	traced := evidence[1]
+	if traced.ProbeID != "probe-b" || traced.Evidence.Status != "" || traced.Path == nil || len(traced.Path.Hops) != 1 || traced.Path.Hops[0] != path.Hops[0] {
+		t.Fatalf("path evidence = %+v, want probe-b's traced path", traced)
+	}
+	first := evidence[0]
+	if !first.CapturedAt.Equal(at.Add(time.Second)) || first.ProbeID != "probe-a" || first.Evidence.Headers["Server"] != "nginx" || first.Evidence.Body != "maintenance" {
+		t.Fatalf("first evidence = %+v, want the snapshot from the opening write", first)
+	}
+
+	if _, found, err := s.ListIncidentEvidence(user.ID+1, incidents[0].ID); err != nil || found {
+		t.Fatalf("ListIncidentEvidence other user = found %v, err %v; want not found", found, err)
+	}
+}
+
 // TestPersistMonitoringWriteUpdatesProbeHeartbeatAtomically verifies that the
 // heartbeat write and persisted probe metadata update commit together.
 func TestPersistMonitoringWriteUpdatesProbeHeartbeatAtomically(t *testing.T) {
@@ -462,3 +557,117 @@ func TestPersistMonitoringBatchRollsBackAllWritesOnError(t *testing.T) {
 		t.Fatalf("expected rollback to leave 0 check state rows, got %d", stateCount)
 	}
 }
+
+// TestPersistMonitoringBatchKeepsHighestResultSeq verifies that the accepted
+// result sequence survives restarts and never moves backwards.
+func TestPersistMonitoringBatchKeepsHighestResultSeq(t *testing.T) {
+	s := newTestStore(t)
+
+	if err := s.SeedProbes([]ProbeSeed{{ProbeID: "probe-a", Secret: "secret-a"}}); err != nil {
+		t.Fatalf("SeedProbes: %v", err)
+	}
+	for _, seq := range []int64{42, 17} {
+		if _, err := s.PersistMonitoringBatch([]MonitoringWrite{{ResultSeqProbeID: "probe-a", ResultSeq: seq}}); err != nil {
+			t.Fatalf("PersistMonitoringBatch(%d): %v", seq, err)
+		}
+	}
+
+	probes, err := s.RecoverableProbeStates()
+	if err != nil {
+		t.Fatalf("RecoverableProbeStates: %v", err)
+	}
+	if len(probes) != 1 || probes[0].LastResultSeq != 42 {
+		t.Fatalf("probes = %#v, want probe-a with last_result_seq 42", probes)
+	}
+
+	if _, err := s.PersistMonitoringBatch([]MonitoringWrite{{ResultSeq: 5}}); !errors.Is(err, ErrInvalidMonitoringProbeWrite) {
+		t.Fatalf("PersistMonitoringBatch without probe = %v, want %v", err, ErrInvalidMonitoringProbeWrite)
+	}
+}
+
+// TestPersistMonitoringWriteDeletesRemovedAssignments verifies that dropping a
+// probe from a check's quorum also drops its recoverable current state.
+func TestPersistMonitoringWriteDeletesRemovedAssignments(t *testing.T) {
+	s := newTestStore(t)
+
+	user, err := s.CreateUser("monitoring-placement@example.com", "pass", false)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	check, err := s.CreateCheck(testCheckWithWebhook("check-1", "http", "https://example.com", "", 30), user.ID)
+	if err != nil {
+		t.Fatalf("CreateCheck: %v", err)
+	}
+
+	at := time.Date(2026, time.January, 2, 3, 4, 5, 0, time.UTC)
+	var states []CheckStateWrite
+	for _, probeID := range []string{"probe-a", "probe-b"} {
+		states = append(states, CheckStateWrite{
+			CheckID:      check.ID,
+			ProbeID:      probeID,
+			LastResultAt: at,
+			LastOutcome:  "up",
+			StreakLen:    1,
+			ExpiresAt:    at.Add(time.Minute),
+			State:        "up",
+		})
+	}
+	if _, err := s.PersistMonitoringWrite(MonitoringWrite{CheckStateWrites: states}); err != nil {
+		t.Fatalf("PersistMonitoringWrite states: %v", err)
+	}
+
+	if _, err := s.PersistMonitoringWrite(MonitoringWrite{
+		RemovedAssignments: []CheckAssignment{{CheckID: check.ID, ProbeID: "probe-b"}},
+	}); err != nil {
+		t.Fatalf("PersistMonitoringWrite removal: %v", err)
+	}
+
+	persisted, err := s.PersistedCheckStates()
+	if err != nil {
+		t.Fatalf("PersistedCheckStates: %v", err)
+	}
+	if len(persisted) != 1 || persisted[0].ProbeID != "probe-a" {
+		t.Fatalf("PersistedCheckStates = %+v, want only probe-a", persisted)
+	}
+}
+
+func TestMonitoringWriteEmptyCoversEveryField(t *testing.T) {
+	// These fields only qualify another field, so on their own they leave
+	// nothing to persist.
+	qualifiers := map[string]bool{
+		"ProbeHeartbeatAt":     true,
+		"ResolveIncident":      true,
+		"IncidentNotification": true,
+		"ResultSeq":            true,
+		"ProbableCause":        true,
+	}
+
+	if !(MonitoringWrite{}).empty() {
+		t.Fatal("zero MonitoringWrite is not empty")
+	}
+	typ := reflect.TypeOf(MonitoringWrite{})
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+		var write MonitoringWrite
+		value := reflect.ValueOf(&write).Elem().Field(i)
+		switch value.Kind() {
+		case reflect.Slice:
+			value.Set(reflect.MakeSlice(field.Type, 1, 1))
+		case reflect.Pointer:
+			value.Set(reflect.New(field.Type.Elem()))
+		case reflect.String:
+			value.SetString("x")
+		case reflect.Bool:
+			value.SetBool(true)
+		case reflect.Int64:
+			value.SetInt(1)
+		case reflect.Struct:
+			value.Set(reflect.ValueOf(time.Unix(1, 0)))
+		default:
+			t.Fatalf("field %s has unhandled kind %s", field.Name, value.Kind())
+		}
+		if got, want := write.empty(), qualifiers[field.Name]; got != want {
+			t.Errorf("empty() with only %s set = %v, want %v", field.Name, got, want)
+		}
+	}
+}
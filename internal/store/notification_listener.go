@@ -0,0 +1,53 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// incidentNotificationChannel is the Postgres NOTIFY channel signalled when
+// new webhook work is queued.
+const incidentNotificationChannel = "wacht_incident_notifications"
+
+// notifyIncidentNotificationQueuedTx signals listeners once the surrounding
+// transaction commits. Postgres folds repeated notifications in one
+// transaction, so a batch wakes the sender once.
+func notifyIncidentNotificationQueuedTx(tx *sql.Tx, res sql.Result) error {
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return nil
+	}
+	_, err = tx.Exec(`SELECT pg_notify($1, '')`, incidentNotificationChannel)
+	return err
+}
+
+// ListenIncidentNotifications holds a dedicated connection outside the pool
+// and calls wake each time new webhook work is queued. It returns when ctx is
+// cancelled or the connection fails; callers are expected to reconnect and to
+// keep polling as a fallback for retries and stale claims.
+func (s *Store) ListenIncidentNotifications(ctx context.Context, wake func()) error {
+	conn, err := pgx.Connect(ctx, s.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+incidentNotificationChannel); err != nil {
+		return err
+	}
+	// Anything queued before LISTEN took effect would otherwise wait for the
+	// next poll.
+	wake()
+
+	for {
+		if _, err := conn.WaitForNotification(ctx); err != nil {
+			return err
+		}
+		wake()
+	}
+}
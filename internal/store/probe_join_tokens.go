@@ -0,0 +1,178 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/tmater/wacht/internal/probeauth"
+)
+
+// ErrInvalidJoinToken reports a probe join token that does not exist, has
+// expired, or has no uses left.
+var ErrInvalidJoinToken = errors.New("store: invalid join token")
+
+// ProbeJoinToken is a newly minted join token. Token is returned to the
+// caller at creation time; only its hash is stored.
+type ProbeJoinToken struct {
+	Token     string
+	Labels    map[string]string
+	MaxUses   int
+	ExpiresAt time.Time
+}
+
+func hashJoinToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateProbeJoinToken mints a join token that enrolls up to maxUses probes
+// within ttl. Enrolled probes get labels as admin-set labels.
+func (s *Store) CreateProbeJoinToken(labels map[string]string, maxUses int, ttl time.Duration) (ProbeJoinToken, error) {
+	encoded, err := encodeProbeLabels(labels)
+	if err != nil {
+		return ProbeJoinToken{}, err
+	}
+	token, err := randomHexToken(32)
+	if err != nil {
+		return ProbeJoinToken{}, err
+	}
+	now := time.Now().UTC()
+	expiresAt := now.Add(ttl)
+	if _, err := s.db.Exec(`
+		INSERT INTO probe_join_tokens (token_hash, labels, max_uses, uses, created_at, expires_at)
+		VALUES ($1, $2::jsonb, $3, 0, $4, $5)
+	`, hashJoinToken(token), encoded, maxUses, now, expiresAt); err != nil {
+		return ProbeJoinToken{}, err
+	}
+	return ProbeJoinToken{Token: token, Labels: labels, MaxUses: maxUses, ExpiresAt: expiresAt}, nil
+}
+
+// EnrollProbe spends one use of a join token and provisions a shared probe
+// credential carrying the token's labels. A blank requestedProbeID gets a
+// generated ID. It returns ErrInvalidJoinToken when the token cannot be used;
+// a failed enrollment does not spend a use.
+//
+// enrollmentID is a client-generated key that makes retries safe: repeating
+// an enrollment with the same token and enrollmentID returns the probe it
+// created, with a freshly issued secret since only secret hashes are stored,
+// and spends no further use, even once the token is used up or expired. This
+// holds only until the probe first registers, so the key cannot take over a
+// credential already in use.
+func (s *Store) EnrollProbe(token, requestedProbeID, enrollmentID string) (ProbeCredential, error) {
+	tx, err := s.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return ProbeCredential{}, err
+	}
+	defer tx.Rollback()
+
+	var (
+		id     int64
+		labels []byte
+		usable bool
+	)
+	err = tx.QueryRow(`
+		SELECT id, labels, expires_at > $2 AND uses < max_uses
+		FROM probe_join_tokens
+		WHERE token_hash = $1
+		FOR UPDATE
+	`, hashJoinToken(token), time.Now().UTC()).Scan(&id, &labels, &usable)
+	if err == sql.ErrNoRows {
+		return ProbeCredential{}, ErrInvalidJoinToken
+	}
+	if err != nil {
+		return ProbeCredential{}, err
+	}
+
+	if enrollmentID != "" {
+		credential, found, err := reissueEnrolledProbeTx(tx, id, enrollmentID)
+		if err != nil {
+			return ProbeCredential{}, err
+		}
+		if found {
+			if err := tx.Commit(); err != nil {
+				return ProbeCredential{}, err
+			}
+			return credential, nil
+		}
+	}
+	if !usable {
+		return ProbeCredential{}, ErrInvalidJoinToken
+	}
+
+	decoded, err := decodeProbeLabels(labels)
+	if err != nil {
+		return ProbeCredential{}, err
+	}
+	credential, err := createProbeCredential(tx, requestedProbeID, 0, decoded)
+	if err != nil {
+		return ProbeCredential{}, err
+	}
+	if _, err := tx.Exec(`
+		UPDATE probes
+		SET join_token_id = $1,
+		    enrollment_id_hash = NULLIF($2, '')
+		WHERE probe_id = $3
+	`, id, enrollmentIDHash(enrollmentID), credential.ProbeID); err != nil {
+		return ProbeCredential{}, err
+	}
+	if _, err := tx.Exec(`UPDATE probe_join_tokens SET uses = uses + 1 WHERE id = $1`, id); err != nil {
+		return ProbeCredential{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return ProbeCredential{}, err
+	}
+	return credential, nil
+}
+
+// reissueEnrolledProbeTx finds the probe an earlier attempt of the same
+// enrollment created and replaces its secret. found is false when there is no
+// such probe; an enrolled probe that already registered is rejected with
+// ErrInvalidJoinToken.
+func reissueEnrolledProbeTx(tx *sql.Tx, tokenID int64, enrollmentID string) (credential ProbeCredential, found bool, err error) {
+	var (
+		probeID    string
+		registered bool
+	)
+	err = tx.QueryRow(`
+		SELECT probe_id, registered_at IS NOT NULL
+		FROM probes
+		WHERE join_token_id = $1 AND enrollment_id_hash = $2 AND revoked_at IS NULL
+		FOR UPDATE
+	`, tokenID, enrollmentIDHash(enrollmentID)).Scan(&probeID, &registered)
+	if err == sql.ErrNoRows {
+		return ProbeCredential{}, false, nil
+	}
+	if err != nil {
+		return ProbeCredential{}, false, err
+	}
+	if registered {
+		return ProbeCredential{}, false, ErrInvalidJoinToken
+	}
+
+	secret, err := randomHexToken(32)
+	if err != nil {
+		return ProbeCredential{}, false, err
+	}
+	if _, err := tx.Exec(`
+		UPDATE probes
+		SET secret_hash = $1,
+		    verify_key = $2
+		WHERE probe_id = $3
+	`, hashProbeSecret(secret), probeauth.VerifyKey(secret), probeID); err != nil {
+		return ProbeCredential{}, false, err
+	}
+	return ProbeCredential{ProbeID: probeID, Secret: secret}, true, nil
+}
+
+// enrollmentIDHash returns the stored form of a client enrollment ID, or ""
+// for none. The ID is hashed like a token since it can re-issue a secret.
+func enrollmentIDHash(enrollmentID string) string {
+	if enrollmentID == "" {
+		return ""
+	}
+	return hashJoinToken(enrollmentID)
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEnrollProbe_SpendsJoinTokenAndAppliesLabels(t *testing.T) {
+	s := newTestStore(t)
+
+	token, err := s.CreateProbeJoinToken(map[string]string{"region": "eu-west"}, 1, time.Hour)
+	if err != nil {
+		t.Fatalf("CreateProbeJoinToken: %v", err)
+	}
+
+	credential, err := s.EnrollProbe(token.Token, "edge-1", "")
+	if err != nil {
+		t.Fatalf("EnrollProbe: %v", err)
+	}
+	probe, err := s.AuthenticateProbe("edge-1", credential.Secret)
+	if err != nil {
+		t.Fatalf("AuthenticateProbe: %v", err)
+	}
+	if probe == nil || probe.Labels["region"] != "eu-west" || probe.ProvisionedBy != "api" {
+		t.Fatalf("probe = %+v, want enrolled probe with token labels", probe)
+	}
+
+	if _, err := s.EnrollProbe(token.Token, "edge-2", ""); !errors.Is(err, ErrInvalidJoinToken) {
+		t.Fatalf("EnrollProbe spent token error = %v, want %v", err, ErrInvalidJoinToken)
+	}
+	if _, err := s.EnrollProbe("unknown", "", ""); !errors.Is(err, ErrInvalidJoinToken) {
+		t.Fatalf("EnrollProbe unknown token error = %v, want %v", err, ErrInvalidJoinToken)
+	}
+}
+
+func TestEnrollProbe_RetryWithEnrollmentIDReturnsSameProbe(t *testing.T) {
+	s := newTestStore(t)
+
+	token, err := s.CreateProbeJoinToken(nil, 1, time.Hour)
+	if err != nil {
+		t.Fatalf("CreateProbeJoinToken: %v", err)
+	}
+	first, err := s.EnrollProbe(token.Token, "", "enroll-1")
+	if err != nil {
+		t.Fatalf("EnrollProbe: %v", err)
+	}
+
+	// The token is used up, but a retry of the same enrollment still gets
+	// its probe back with a working secret.
+	retry, err := s.EnrollProbe(token.Token, "", "enroll-1")
+	if err != nil {
+		t.Fatalf("EnrollProbe retry: %v", err)
+	}
+	if retry.ProbeID != first.ProbeID || retry.Secret == first.Secret {
+		t.Fatalf("retry = %+v, want probe %s with a reissued secret", retry, first.ProbeID)
+	}
+	if probe, err := s.AuthenticateProbe(retry.ProbeID, retry.Secret); err != nil || probe == nil {
+		t.Fatalf("AuthenticateProbe retry = %+v, %v, want probe", probe, err)
+	}
+	if _, err := s.EnrollProbe(token.Token, "", "enroll-2"); !errors.Is(err, ErrInvalidJoinToken) {
+		t.Fatalf("EnrollProbe other enrollment error = %v, want %v", err, ErrInvalidJoinToken)
+	}
+
+	if _, err := s.RegisterProbe(retry.ProbeID, ProbeRegistration{}); err != nil {
+		t.Fatalf("RegisterProbe: %v", err)
+	}
+	if _, err := s.EnrollProbe(token.Token, "", "enroll-1"); !errors.Is(err, ErrInvalidJoinToken) {
+		t.Fatalf("EnrollProbe after register error = %v, want %v", err, ErrInvalidJoinToken)
+	}
+}
+
+func TestEnrollProbe_FailedEnrollmentKeepsUse(t *testing.T) {
+	s := newTestStore(t)
+
+	if _, err := s.CreateProbeCredential("taken", 0); err != nil {
+		t.Fatalf("CreateProbeCredential: %v", err)
+	}
+	token, err := s.CreateProbeJoinToken(nil, 1, time.Hour)
+	if err != nil {
+		t.Fatalf("CreateProbeJoinToken: %v", err)
+	}
+
+	if _, err := s.EnrollProbe(token.Token, "taken", ""); !errors.Is(err, ErrProbeAlreadyExists) {
+		t.Fatalf("EnrollProbe taken error = %v, want %v", err, ErrProbeAlreadyExists)
+	}
+	credential, err := s.EnrollProbe(token.Token, "", "")
+	if err != nil {
+		t.Fatalf("EnrollProbe generated: %v", err)
+	}
+	if credential.ProbeID == "" || credential.Secret == "" {
+		t.Fatalf("credential = %+v, want generated probe", credential)
+	}
+}
+
+func TestEnrollProbe_RejectsExpiredToken(t *testing.T) {
+	s := newTestStore(t)
+
+	token, err := s.CreateProbeJoinToken(nil, 5, -time.Minute)
+	if err != nil {
+		t.Fatalf("CreateProbeJoinToken: %v", err)
+	}
+	if _, err := s.EnrollProbe(token.Token, "", ""); !errors.Is(err, ErrInvalidJoinToken) {
+		t.Fatalf("EnrollProbe expired error = %v, want %v", err, ErrInvalidJoinToken)
+	}
+}
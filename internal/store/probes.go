@@ -1,15 +1,20 @@
 package store
 
 import (
+	"context"
 	"crypto/sha256"
 	"crypto/subtle"
 	"database/sql"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/tmater/wacht/internal/checks"
+	"github.com/tmater/wacht/internal/probeauth"
 )
 
 var (
@@ -18,6 +23,16 @@ var (
 	ErrInvalidProbeID = errors.New("store: invalid probe id")
 	// ErrProbeAlreadyExists reports that a requested probe ID is already taken.
 	ErrProbeAlreadyExists = errors.New("store: probe id already exists")
+	// ErrProbeConfigManaged reports a lifecycle change to a probe whose
+	// credential comes from the server config file, which would undo it on
+	// the next restart.
+	ErrProbeConfigManaged = errors.New("store: probe is provisioned by config")
+	// ErrOwnedProbeLimit reports that a user already owns MaxOwnedProbes
+	// active private probes.
+	ErrOwnedProbeLimit = errors.New("store: private probe limit reached")
+	// ErrInvalidProbeCheckTypes reports a registration advertising unknown
+	// or too many check types.
+	ErrInvalidProbeCheckTypes = errors.New("store: invalid probe check types")
 
 	probeIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
 )
@@ -35,12 +50,42 @@ type ProbeCredential struct {
 	Secret  string
 }
 
-// Probe is an authenticated or stored probe record.
+// ProbeSecretRotation is a replacement probe secret. The previous secret keeps
+// authenticating until PreviousValidUntil so the probe can be reconfigured
+// without downtime.
+type ProbeSecretRotation struct {
+	ProbeID            string
+	Secret             string
+	PreviousValidUntil time.Time
+}
+
+// Probe is an authenticated or stored probe record. Labels holds the
+// effective labels: those the probe declared at registration, overlaid with
+// any an admin set. OwnerUserID is zero for shared probes and the owning
+// user for private probes. ProtocolVersion and CheckTypes are empty for
+// probes that registered before advertising their capabilities.
+// PreviousSecretValidUntil is set while a rotated-out secret is still
+// accepted.
 type Probe struct {
-	ProbeID      string
-	Version      string
-	RegisteredAt *time.Time
-	LastSeenAt   *time.Time
+	ProbeID                  string
+	Version                  string
+	ProtocolVersion          int
+	CheckTypes               []string
+	RegisteredAt             *time.Time
+	LastSeenAt               *time.Time
+	Labels                   map[string]string
+	OwnerUserID              int64
+	ProvisionedBy            string
+	RevokedAt                *time.Time
+	PreviousSecretValidUntil *time.Time
+}
+
+// ProbeRegistration is the startup metadata a probe reports about itself.
+type ProbeRegistration struct {
+	Version         string
+	ProtocolVersion int
+	CheckTypes      []string
+	Labels          map[string]string
 }
 
 // hashProbeSecret derives the stored secret hash for probe authentication.
@@ -61,13 +106,14 @@ func (s *Store) SeedProbes(probes []ProbeSeed) error {
 		keep[probe.ProbeID] = struct{}{}
 		now := time.Now().UTC()
 		_, err := s.db.Exec(`
-			INSERT INTO probes (probe_id, secret_hash, provisioned_by, version, created_at, registered_at, last_seen_at, revoked_at)
-			VALUES ($1, $2, 'config', '', $3, NULL, NULL, NULL)
+			INSERT INTO probes (probe_id, secret_hash, verify_key, provisioned_by, version, created_at, registered_at, last_seen_at, revoked_at)
+			VALUES ($1, $2, $3, 'config', '', $4, NULL, NULL, NULL)
 			ON CONFLICT (probe_id) DO UPDATE
 			SET secret_hash = excluded.secret_hash,
+			    verify_key = excluded.verify_key,
 			    provisioned_by = 'config',
 			    revoked_at = NULL
-		`, probe.ProbeID, hashProbeSecret(probe.Secret), now)
+		`, probe.ProbeID, hashProbeSecret(probe.Secret), probeauth.VerifyKey(probe.Secret), now)
 		if err != nil {
 			return err
 		}
@@ -97,12 +143,55 @@ func (s *Store) SeedProbes(probes []ProbeSeed) error {
 	return nil
 }
 
+// MaxOwnedProbes caps the active private probes one user may own.
+const MaxOwnedProbes = 10
+
 // CreateProbeCredential provisions one API-managed probe credential. If
-// requestedProbeID is blank, a unique probe ID is generated.
-func (s *Store) CreateProbeCredential(requestedProbeID string) (ProbeCredential, error) {
+// requestedProbeID is blank, a unique probe ID is generated. A non-zero
+// ownerUserID creates a private probe that only runs that user's checks; it
+// fails with ErrOwnedProbeLimit once the user owns MaxOwnedProbes.
+func (s *Store) CreateProbeCredential(requestedProbeID string, ownerUserID int64) (ProbeCredential, error) {
+	if ownerUserID == 0 {
+		return createProbeCredential(s.db, requestedProbeID, 0, nil)
+	}
+
+	tx, err := s.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return ProbeCredential{}, err
+	}
+	defer tx.Rollback()
+
+	// Lock the owner so concurrent creates cannot both pass the count.
+	var owned int
+	err = tx.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM probes WHERE owner_user_id = u.id AND revoked_at IS NULL)
+		FROM users u
+		WHERE u.id = $1
+		FOR UPDATE
+	`, ownerUserID).Scan(&owned)
+	if err != nil {
+		return ProbeCredential{}, err
+	}
+	if owned >= MaxOwnedProbes {
+		return ProbeCredential{}, ErrOwnedProbeLimit
+	}
+
+	credential, err := createProbeCredential(tx, requestedProbeID, ownerUserID, nil)
+	if err != nil {
+		return ProbeCredential{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return ProbeCredential{}, err
+	}
+	return credential, nil
+}
+
+// createProbeCredential provisions a probe credential with adminLabels,
+// generating a unique probe ID when requestedProbeID is blank.
+func createProbeCredential(q sqlQuerier, requestedProbeID string, ownerUserID int64, adminLabels map[string]string) (ProbeCredential, error) {
 	probeID := strings.TrimSpace(requestedProbeID)
 	if probeID != "" {
-		return s.insertProbeCredential(probeID)
+		return insertProbeCredential(q, probeID, ownerUserID, adminLabels)
 	}
 
 	for i := 0; i < 8; i++ {
@@ -110,7 +199,7 @@ func (s *Store) CreateProbeCredential(requestedProbeID string) (ProbeCredential,
 		if err != nil {
 			return ProbeCredential{}, err
 		}
-		credential, err := s.insertProbeCredential(generated)
+		credential, err := insertProbeCredential(q, generated, ownerUserID, adminLabels)
 		if errors.Is(err, ErrProbeAlreadyExists) {
 			continue
 		}
@@ -120,11 +209,15 @@ func (s *Store) CreateProbeCredential(requestedProbeID string) (ProbeCredential,
 	return ProbeCredential{}, fmt.Errorf("%w: generated id collision", ErrProbeAlreadyExists)
 }
 
-func (s *Store) insertProbeCredential(probeID string) (ProbeCredential, error) {
+func insertProbeCredential(q sqlQuerier, probeID string, ownerUserID int64, adminLabels map[string]string) (ProbeCredential, error) {
 	probeID = strings.TrimSpace(probeID)
 	if !probeIDPattern.MatchString(probeID) {
 		return ProbeCredential{}, fmt.Errorf("%w: %q", ErrInvalidProbeID, probeID)
 	}
+	admin, err := encodeProbeLabels(adminLabels)
+	if err != nil {
+		return ProbeCredential{}, err
+	}
 
 	secret, err := randomHexToken(32)
 	if err != nil {
@@ -133,12 +226,12 @@ func (s *Store) insertProbeCredential(probeID string) (ProbeCredential, error) {
 	now := time.Now().UTC()
 
 	var insertedProbeID string
-	err = s.db.QueryRow(`
-		INSERT INTO probes (probe_id, secret_hash, provisioned_by, version, created_at, registered_at, last_seen_at, revoked_at)
-		VALUES ($1, $2, 'api', '', $3, NULL, NULL, NULL)
+	err = q.QueryRow(`
+		INSERT INTO probes (probe_id, secret_hash, verify_key, provisioned_by, version, created_at, registered_at, last_seen_at, revoked_at, owner_user_id, admin_labels)
+		VALUES ($1, $2, $3, 'api', '', $4, NULL, NULL, NULL, NULLIF($5, 0), $6::jsonb)
 		ON CONFLICT (probe_id) DO NOTHING
 		RETURNING probe_id
-	`, probeID, hashProbeSecret(secret), now).Scan(&insertedProbeID)
+	`, probeID, hashProbeSecret(secret), probeauth.VerifyKey(secret), now, ownerUserID, admin).Scan(&insertedProbeID)
 	if err == sql.ErrNoRows {
 		return ProbeCredential{}, ErrProbeAlreadyExists
 	}
@@ -158,34 +251,310 @@ func randomProbeID() (string, error) {
 }
 
 // AuthenticateProbe returns the active probe record for the given probe_id and
-// secret. Returns nil if the credentials are invalid.
+// secret. A rotated-out secret is accepted until its grace period ends.
+// Returns nil if the credentials are invalid.
 func (s *Store) AuthenticateProbe(probeID, secret string) (*Probe, error) {
-	var (
-		probe        Probe
-		secretHash   string
-		registeredAt sql.NullTime
-		lastSeen     sql.NullTime
-	)
-	err := s.db.QueryRow(`
-		SELECT probe_id, version, registered_at, last_seen_at, secret_hash
+	probe, hashes, _, err := s.probeCredentials(probeID)
+	if err != nil || probe == nil {
+		return nil, err
+	}
+	given := []byte(hashProbeSecret(secret))
+	for _, hash := range hashes {
+		if subtle.ConstantTimeCompare([]byte(hash), given) == 1 {
+			return probe, nil
+		}
+	}
+	return nil, nil
+}
+
+// AuthenticateProbeSignature returns the active probe record for probeID when
+// verify accepts one of the probe's verify keys: the current one, or a
+// rotated-out one still inside its grace period. Returns nil if the probe
+// does not exist or the signature is invalid.
+func (s *Store) AuthenticateProbeSignature(probeID string, verify func(verifyKey string) bool) (*Probe, error) {
+	probe, _, keys, err := s.probeCredentials(probeID)
+	if err != nil || probe == nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		if verify(key) {
+			return probe, nil
+		}
+	}
+	return nil, nil
+}
+
+// probeCredentials returns an active probe with the secret hashes and verify
+// keys it may currently authenticate with, newest first. It returns a nil
+// probe when probeID is not active.
+func (s *Store) probeCredentials(probeID string) (*Probe, []string, []string, error) {
+	var secretHash, verifyKey, previousHash, previousKey string
+	probe, err := scanProbe(s.db.QueryRow(`
+		SELECT `+probeColumns+`, secret_hash, verify_key,
+		       CASE WHEN previous_secret_expires_at > now() THEN COALESCE(previous_secret_hash, '') ELSE '' END,
+		       CASE WHEN previous_secret_expires_at > now() THEN COALESCE(previous_verify_key, '') ELSE '' END
 		FROM probes
 		WHERE probe_id = $1 AND revoked_at IS NULL
-	`, probeID).Scan(
-		&probe.ProbeID,
-		&probe.Version,
-		&registeredAt,
-		&lastSeen,
-		&secretHash,
-	)
+	`, probeID), &secretHash, &verifyKey, &previousHash, &previousKey)
 	if err == sql.ErrNoRows {
-		return nil, nil
+		return nil, nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	hashes, keys := []string{secretHash}, []string{verifyKey}
+	if previousHash != "" {
+		hashes = append(hashes, previousHash)
+	}
+	if previousKey != "" {
+		keys = append(keys, previousKey)
+	}
+	return &probe, hashes, keys, nil
+}
+
+// RevokeProbe permanently disables an API-provisioned probe's credential and
+// returns the revoked probe. Revoking an already revoked probe returns it
+// unchanged, so a retried revoke can finish the runtime cleanup. It returns
+// nil when no API-provisioned probe has probeID and ErrProbeConfigManaged for
+// probes seeded from config.
+func (s *Store) RevokeProbe(probeID string) (*Probe, error) {
+	tx, err := s.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	ok, err := lockManagedProbeTx(tx, probeID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		probe, err := scanProbe(tx.QueryRow(`
+			SELECT `+probeColumns+`
+			FROM probes
+			WHERE probe_id = $1 AND revoked_at IS NOT NULL AND provisioned_by = 'api'
+		`, probeID))
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &probe, nil
+	}
+	probe, err := scanProbe(tx.QueryRow(`
+		UPDATE probes
+		SET revoked_at = $1,
+		    previous_secret_hash = NULL,
+		    previous_verify_key = NULL,
+		    previous_secret_expires_at = NULL
+		WHERE probe_id = $2
+		RETURNING `+probeColumns, time.Now().UTC(), probeID))
+	if err != nil {
+		return nil, err
 	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &probe, nil
+}
+
+// RotateProbeSecret replaces an API-provisioned probe's secret. The current
+// secret stays valid for grace, replacing any earlier rotated-out secret; a
+// zero grace invalidates it immediately. It returns nil when no active probe
+// has probeID and ErrProbeConfigManaged for probes seeded from config.
+func (s *Store) RotateProbeSecret(probeID string, grace time.Duration) (*ProbeSecretRotation, error) {
+	secret, err := randomHexToken(32)
 	if err != nil {
 		return nil, err
 	}
-	if subtle.ConstantTimeCompare([]byte(secretHash), []byte(hashProbeSecret(secret))) != 1 {
+
+	tx, err := s.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if ok, err := lockManagedProbeTx(tx, probeID); err != nil || !ok {
+		return nil, err
+	}
+	validUntil := time.Now().UTC().Add(grace)
+	if _, err := tx.Exec(`
+		UPDATE probes
+		SET previous_secret_hash = secret_hash,
+		    previous_verify_key = verify_key,
+		    previous_secret_expires_at = $1,
+		    secret_hash = $2,
+		    verify_key = $3
+		WHERE probe_id = $4
+	`, validUntil, hashProbeSecret(secret), probeauth.VerifyKey(secret), probeID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &ProbeSecretRotation{ProbeID: probeID, Secret: secret, PreviousValidUntil: validUntil}, nil
+}
+
+// lockManagedProbeTx locks the active probe row for a credential lifecycle
+// change. It reports false when no active probe has probeID and returns
+// ErrProbeConfigManaged when the credential comes from config.
+func lockManagedProbeTx(tx *sql.Tx, probeID string) (bool, error) {
+	var provisionedBy string
+	err := tx.QueryRow(`
+		SELECT provisioned_by
+		FROM probes
+		WHERE probe_id = $1 AND revoked_at IS NULL
+		FOR UPDATE
+	`, probeID).Scan(&provisionedBy)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if provisionedBy == "config" {
+		return false, ErrProbeConfigManaged
+	}
+	return true, nil
+}
+
+// RegisterProbe records a successful authenticated startup for a probe and
+// replaces its version, capabilities, and the labels it declares about
+// itself. Admin-set labels are kept. It returns the updated probe, or nil when
+// the probe is not active.
+func (s *Store) RegisterProbe(probeID string, reg ProbeRegistration) (*Probe, error) {
+	declared, err := encodeProbeLabels(reg.Labels)
+	if err != nil {
+		return nil, err
+	}
+	normalized, err := checks.NormalizeTypes(reg.CheckTypes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProbeCheckTypes, err)
+	}
+	checkTypes, err := encodeProbeCheckTypes(normalized)
+	if err != nil {
+		return nil, err
+	}
+	return s.queryProbe(`
+		UPDATE probes
+		SET version = $1,
+		    protocol_version = $2,
+		    check_types = $3::jsonb,
+		    registered_at = COALESCE(registered_at, $4),
+		    last_seen_at = $4,
+		    declared_labels = $5::jsonb
+		WHERE probe_id = $6 AND revoked_at IS NULL
+		RETURNING `+probeColumns, reg.Version, reg.ProtocolVersion, checkTypes, time.Now().UTC(), declared, probeID)
+}
+
+// SetProbeAdminLabels replaces the admin-set labels of an active probe and
+// returns the updated probe, or nil when the probe does not exist.
+func (s *Store) SetProbeAdminLabels(probeID string, labels map[string]string) (*Probe, error) {
+	admin, err := encodeProbeLabels(labels)
+	if err != nil {
+		return nil, err
+	}
+	return s.queryProbe(`
+		UPDATE probes
+		SET admin_labels = $1::jsonb
+		WHERE probe_id = $2 AND revoked_at IS NULL
+		RETURNING `+probeColumns, admin, probeID)
+}
+
+// queryProbe returns the single probe selected by query, or nil when no row
+// matches.
+func (s *Store) queryProbe(query string, args ...any) (*Probe, error) {
+	probe, err := scanProbe(s.db.QueryRow(query, args...))
+	if err == sql.ErrNoRows {
 		return nil, nil
 	}
+	if err != nil {
+		return nil, err
+	}
+	return &probe, nil
+}
+
+// GetProbe returns the active probe with probeID, or nil when none exists.
+func (s *Store) GetProbe(probeID string) (*Probe, error) {
+	return s.queryProbe(`
+		SELECT `+probeColumns+`
+		FROM probes
+		WHERE probe_id = $1 AND revoked_at IS NULL
+	`, probeID)
+}
+
+// ListProbes returns every active probe ordered by probe ID.
+func (s *Store) ListProbes() ([]Probe, error) {
+	return s.queryProbes(`
+		SELECT ` + probeColumns + `
+		FROM probes
+		WHERE revoked_at IS NULL
+		ORDER BY probe_id
+	`)
+}
+
+// ListAllProbes returns every probe, including revoked ones, ordered by probe
+// ID.
+func (s *Store) ListAllProbes() ([]Probe, error) {
+	return s.queryProbes(`
+		SELECT ` + probeColumns + `
+		FROM probes
+		ORDER BY probe_id
+	`)
+}
+
+// ListOwnedProbes returns the active private probes owned by userID.
+func (s *Store) ListOwnedProbes(userID int64) ([]Probe, error) {
+	return s.queryProbes(`
+		SELECT `+probeColumns+`
+		FROM probes
+		WHERE owner_user_id = $1
+		  AND revoked_at IS NULL
+		ORDER BY probe_id
+	`, userID)
+}
+
+const probeColumns = `probe_id, version, protocol_version, check_types, registered_at, last_seen_at, declared_labels || admin_labels, COALESCE(owner_user_id, 0),
+	provisioned_by, revoked_at, CASE WHEN previous_secret_expires_at > now() THEN previous_secret_expires_at END`
+
+func (s *Store) queryProbes(query string, args ...any) ([]Probe, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var probes []Probe
+	for rows.Next() {
+		probe, err := scanProbe(rows)
+		if err != nil {
+			return nil, err
+		}
+		probes = append(probes, probe)
+	}
+	return probes, rows.Err()
+}
+
+// scanProbe reads one row selected with probeColumns, followed by any extra
+// columns scanned into extra.
+func scanProbe(scanner rowScanner, extra ...any) (Probe, error) {
+	var (
+		probe        Probe
+		checkTypes   []byte
+		registeredAt sql.NullTime
+		lastSeen     sql.NullTime
+		labels       []byte
+		revokedAt    sql.NullTime
+		previousTill sql.NullTime
+	)
+	dest := append([]any{
+		&probe.ProbeID, &probe.Version, &probe.ProtocolVersion, &checkTypes, &registeredAt, &lastSeen, &labels, &probe.OwnerUserID,
+		&probe.ProvisionedBy, &revokedAt, &previousTill,
+	}, extra...)
+	if err := scanner.Scan(dest...); err != nil {
+		return Probe{}, err
+	}
 	if registeredAt.Valid {
 		t := registeredAt.Time
 		probe.RegisteredAt = &t
@@ -194,19 +563,67 @@ func (s *Store) AuthenticateProbe(probeID, secret string) (*Probe, error) {
 		t := lastSeen.Time
 		probe.LastSeenAt = &t
 	}
-	return &probe, nil
+	if revokedAt.Valid {
+		t := revokedAt.Time
+		probe.RevokedAt = &t
+	}
+	if previousTill.Valid {
+		t := previousTill.Time
+		probe.PreviousSecretValidUntil = &t
+	}
+	var err error
+	if probe.Labels, err = decodeProbeLabels(labels); err != nil {
+		return Probe{}, err
+	}
+	if len(checkTypes) > 0 {
+		if err := json.Unmarshal(checkTypes, &probe.CheckTypes); err != nil {
+			return Probe{}, fmt.Errorf("decode probe check types: %w", err)
+		}
+	}
+	return probe, nil
 }
 
-// RegisterProbe records a successful authenticated startup for a probe.
-func (s *Store) RegisterProbe(probeID, version string) error {
-	now := time.Now().UTC()
-	_, err := s.db.Exec(`
+func encodeProbeLabels(labels map[string]string) (string, error) {
+	if len(labels) == 0 {
+		return "{}", nil
+	}
+	raw, err := json.Marshal(labels)
+	if err != nil {
+		return "", fmt.Errorf("encode probe labels: %w", err)
+	}
+	return string(raw), nil
+}
+
+func encodeProbeCheckTypes(checkTypes []string) (string, error) {
+	if len(checkTypes) == 0 {
+		return "[]", nil
+	}
+	raw, err := json.Marshal(checkTypes)
+	if err != nil {
+		return "", fmt.Errorf("encode probe check types: %w", err)
+	}
+	return string(raw), nil
+}
+
+func decodeProbeLabels(raw []byte) (map[string]string, error) {
+	labels := map[string]string{}
+	if len(raw) == 0 {
+		return labels, nil
+	}
+	if err := json.Unmarshal(raw, &labels); err != nil {
+		return nil, fmt.Errorf("decode probe labels: %w", err)
+	}
+	return labels, nil
+}
+
+// updateProbeResultSeqTx records the highest result sequence accepted from a
+// probe. GREATEST keeps the value monotonic even if writes race.
+func updateProbeResultSeqTx(tx *sql.Tx, probeID string, seq int64) error {
+	_, err := tx.Exec(`
 		UPDATE probes
-		SET version = $1,
-		    registered_at = COALESCE(registered_at, $2),
-		    last_seen_at = $2
-		WHERE probe_id = $3 AND revoked_at IS NULL
-	`, version, now, probeID)
+		SET last_result_seq = GREATEST(last_result_seq, $1)
+		WHERE probe_id = $2 AND revoked_at IS NULL
+	`, seq, probeID)
 	return err
 }
 
@@ -2,7 +2,11 @@ package store
 
 import (
 	"errors"
+	"fmt"
 	"testing"
+	"time"
+
+	"github.com/tmater/wacht/internal/probeauth"
 )
 
 func TestSeedProbes_AuthenticateProbe(t *testing.T) {
@@ -43,6 +47,35 @@ func TestAuthenticateProbe_WrongSecret(t *testing.T) {
 	}
 }
 
+func TestAuthenticateProbeSignature_VerifiesWithVerifyKey(t *testing.T) {
+	s := newTestStore(t)
+
+	if err := s.SeedProbes([]ProbeSeed{{ProbeID: "probe-1", Secret: "secret-1"}}); err != nil {
+		t.Fatalf("SeedProbes: %v", err)
+	}
+
+	probe, err := s.AuthenticateProbeSignature("probe-1", func(key string) bool {
+		if key == hashProbeSecret("secret-1") {
+			t.Fatal("verify key must not be the stored secret hash")
+		}
+		return key == probeauth.VerifyKey("secret-1")
+	})
+	if err != nil {
+		t.Fatalf("AuthenticateProbeSignature: %v", err)
+	}
+	if probe == nil || probe.ProbeID != "probe-1" {
+		t.Fatalf("probe = %+v, want probe-1", probe)
+	}
+
+	rejected, err := s.AuthenticateProbeSignature("probe-1", func(string) bool { return false })
+	if err != nil {
+		t.Fatalf("AuthenticateProbeSignature rejected: %v", err)
+	}
+	if rejected != nil {
+		t.Fatal("expected nil for a signature that does not verify")
+	}
+}
+
 func TestRegisterProbe_UpdatesVersionAndLastSeen(t *testing.T) {
 	s := newTestStore(t)
 
@@ -50,7 +83,7 @@ func TestRegisterProbe_UpdatesVersionAndLastSeen(t *testing.T) {
 		t.Fatalf("SeedProbes: %v", err)
 	}
 
-	if err := s.RegisterProbe("probe-1", "v1.2.3"); err != nil {
+	if _, err := s.RegisterProbe("probe-1", ProbeRegistration{Version: "v1.2.3", ProtocolVersion: 1, CheckTypes: []string{"dns", "http"}}); err != nil {
 		t.Fatalf("RegisterProbe: %v", err)
 	}
 
@@ -67,6 +100,127 @@ func TestRegisterProbe_UpdatesVersionAndLastSeen(t *testing.T) {
 	if probe.LastSeenAt == nil {
 		t.Fatal("expected RegisterProbe to set LastSeenAt")
 	}
+	stored, err := s.GetProbe("probe-1")
+	if err != nil {
+		t.Fatalf("GetProbe: %v", err)
+	}
+	if stored == nil || stored.Version != "v1.2.3" {
+		t.Fatalf("GetProbe = %+v, want probe-1 at v1.2.3", stored)
+	}
+	if probe.ProtocolVersion != 1 || len(probe.CheckTypes) != 2 || probe.CheckTypes[0] != "dns" || probe.CheckTypes[1] != "http" {
+		t.Fatalf("capabilities = protocol %d types %v, want protocol 1 [dns http]", probe.ProtocolVersion, probe.CheckTypes)
+	}
+}
+
+func TestProbeLabels_AdminLabelsOverrideDeclared(t *testing.T) {
+	s := newTestStore(t)
+
+	if err := s.SeedProbes([]ProbeSeed{{ProbeID: "probe-1", Secret: "secret-1"}}); err != nil {
+		t.Fatalf("SeedProbes: %v", err)
+	}
+
+	registered, err := s.RegisterProbe("probe-1", ProbeRegistration{Version: "v1", Labels: map[string]string{"region": "eu-west", "provider": "aws"}})
+	if err != nil {
+		t.Fatalf("RegisterProbe: %v", err)
+	}
+	if registered.Labels["region"] != "eu-west" || registered.Labels["provider"] != "aws" {
+		t.Fatalf("RegisterProbe labels = %v, want declared labels", registered.Labels)
+	}
+
+	updated, err := s.SetProbeAdminLabels("probe-1", map[string]string{"region": "eu-central"})
+	if err != nil {
+		t.Fatalf("SetProbeAdminLabels: %v", err)
+	}
+	if updated.Labels["region"] != "eu-central" || updated.Labels["provider"] != "aws" {
+		t.Fatalf("SetProbeAdminLabels labels = %v, want admin override", updated.Labels)
+	}
+
+	// Re-registering replaces declared labels but keeps the admin override.
+	if _, err := s.RegisterProbe("probe-1", ProbeRegistration{Version: "v2", Labels: map[string]string{"region": "us-east"}}); err != nil {
+		t.Fatalf("RegisterProbe again: %v", err)
+	}
+	probe, err := s.AuthenticateProbe("probe-1", "secret-1")
+	if err != nil {
+		t.Fatalf("AuthenticateProbe: %v", err)
+	}
+	if len(probe.Labels) != 1 || probe.Labels["region"] != "eu-central" {
+		t.Fatalf("Labels = %v, want only admin region", probe.Labels)
+	}
+
+	all, err := s.ListProbes()
+	if err != nil {
+		t.Fatalf("ListProbes: %v", err)
+	}
+	if len(all) != 1 || all[0].Labels["region"] != "eu-central" {
+		t.Fatalf("ListProbes = %+v, want probe-1 region eu-central", all)
+	}
+
+	missing, err := s.SetProbeAdminLabels("missing", map[string]string{"region": "eu"})
+	if err != nil {
+		t.Fatalf("SetProbeAdminLabels missing: %v", err)
+	}
+	if missing != nil {
+		t.Fatalf("SetProbeAdminLabels missing = %v, want nil", missing)
+	}
+}
+
+func TestCreateProbeCredential_PrivateProbeHasOwner(t *testing.T) {
+	s := newTestStore(t)
+
+	user, err := s.CreateUser("private-probe@example.com", "pass", false)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	credential, err := s.CreateProbeCredential("office-probe", user.ID)
+	if err != nil {
+		t.Fatalf("CreateProbeCredential: %v", err)
+	}
+	if _, err := s.CreateProbeCredential("shared-probe", 0); err != nil {
+		t.Fatalf("CreateProbeCredential shared: %v", err)
+	}
+
+	probe, err := s.AuthenticateProbe("office-probe", credential.Secret)
+	if err != nil {
+		t.Fatalf("AuthenticateProbe: %v", err)
+	}
+	if probe == nil || probe.OwnerUserID != user.ID {
+		t.Fatalf("probe = %+v, want owner %d", probe, user.ID)
+	}
+
+	owned, err := s.ListOwnedProbes(user.ID)
+	if err != nil {
+		t.Fatalf("ListOwnedProbes: %v", err)
+	}
+	if len(owned) != 1 || owned[0].ProbeID != "office-probe" {
+		t.Fatalf("ListOwnedProbes = %+v, want office-probe only", owned)
+	}
+}
+
+func TestCreateProbeCredential_CapsPrivateProbesPerUser(t *testing.T) {
+	s := newTestStore(t)
+
+	user, err := s.CreateUser("private-cap@example.com", "pass", false)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	for i := range MaxOwnedProbes {
+		if _, err := s.CreateProbeCredential(fmt.Sprintf("office-%d", i), user.ID); err != nil {
+			t.Fatalf("CreateProbeCredential %d: %v", i, err)
+		}
+	}
+	if _, err := s.CreateProbeCredential("office-extra", user.ID); !errors.Is(err, ErrOwnedProbeLimit) {
+		t.Fatalf("CreateProbeCredential over cap err = %v, want ErrOwnedProbeLimit", err)
+	}
+	if _, err := s.CreateProbeCredential("shared-extra", 0); err != nil {
+		t.Fatalf("CreateProbeCredential shared: %v", err)
+	}
+
+	if _, err := s.RevokeProbe("office-0"); err != nil {
+		t.Fatalf("RevokeProbe: %v", err)
+	}
+	if _, err := s.CreateProbeCredential("office-extra", user.ID); err != nil {
+		t.Fatalf("CreateProbeCredential after revoke: %v", err)
+	}
 }
 
 func TestSeedProbes_RevokesMissingProbe(t *testing.T) {
@@ -95,7 +249,7 @@ func TestSeedProbes_RevokesMissingProbe(t *testing.T) {
 func TestCreateProbeCredential_AuthenticateProbe(t *testing.T) {
 	s := newTestStore(t)
 
-	credential, err := s.CreateProbeCredential("probe-api-1")
+	credential, err := s.CreateProbeCredential("probe-api-1", 0)
 	if err != nil {
 		t.Fatalf("CreateProbeCredential: %v", err)
 	}
@@ -118,7 +272,7 @@ func TestCreateProbeCredential_AuthenticateProbe(t *testing.T) {
 func TestCreateProbeCredential_GeneratesProbeID(t *testing.T) {
 	s := newTestStore(t)
 
-	credential, err := s.CreateProbeCredential("")
+	credential, err := s.CreateProbeCredential("", 0)
 	if err != nil {
 		t.Fatalf("CreateProbeCredential: %v", err)
 	}
@@ -133,10 +287,10 @@ func TestCreateProbeCredential_GeneratesProbeID(t *testing.T) {
 func TestCreateProbeCredential_RejectsDuplicateProbeID(t *testing.T) {
 	s := newTestStore(t)
 
-	if _, err := s.CreateProbeCredential("probe-api-1"); err != nil {
+	if _, err := s.CreateProbeCredential("probe-api-1", 0); err != nil {
 		t.Fatalf("CreateProbeCredential first: %v", err)
 	}
-	if _, err := s.CreateProbeCredential("probe-api-1"); !errors.Is(err, ErrProbeAlreadyExists) {
+	if _, err := s.CreateProbeCredential("probe-api-1", 0); !errors.Is(err, ErrProbeAlreadyExists) {
 		t.Fatalf("CreateProbeCredential duplicate error = %v, want ErrProbeAlreadyExists", err)
 	}
 }
@@ -144,7 +298,7 @@ func TestCreateProbeCredential_RejectsDuplicateProbeID(t *testing.T) {
 func TestCreateProbeCredential_RejectsInvalidProbeID(t *testing.T) {
 	s := newTestStore(t)
 
-	if _, err := s.CreateProbeCredential("bad probe"); !errors.Is(err, ErrInvalidProbeID) {
+	if _, err := s.CreateProbeCredential("bad probe", 0); !errors.Is(err, ErrInvalidProbeID) {
 		t.Fatalf("CreateProbeCredential error = %v, want ErrInvalidProbeID", err)
 	}
 }
@@ -152,7 +306,7 @@ func TestCreateProbeCredential_RejectsInvalidProbeID(t *testing.T) {
 func TestSeedProbes_DoesNotRevokeAPICreatedProbe(t *testing.T) {
 	s := newTestStore(t)
 
-	credential, err := s.CreateProbeCredential("probe-api-1")
+	credential, err := s.CreateProbeCredential("probe-api-1", 0)
 	if err != nil {
 		t.Fatalf("CreateProbeCredential: %v", err)
 	}
@@ -168,3 +322,100 @@ func TestSeedProbes_DoesNotRevokeAPICreatedProbe(t *testing.T) {
 		t.Fatal("expected API-created probe to remain active after config seeding")
 	}
 }
+
+func TestRotateProbeSecret_PreviousSecretValidDuringGrace(t *testing.T) {
+	s := newTestStore(t)
+
+	credential, err := s.CreateProbeCredential("probe-1", 0)
+	if err != nil {
+		t.Fatalf("CreateProbeCredential: %v", err)
+	}
+	rotation, err := s.RotateProbeSecret("probe-1", time.Hour)
+	if err != nil {
+		t.Fatalf("RotateProbeSecret: %v", err)
+	}
+	if rotation == nil || rotation.Secret == "" || rotation.Secret == credential.Secret {
+		t.Fatalf("rotation = %+v, want a new secret", rotation)
+	}
+
+	for _, secret := range []string{credential.Secret, rotation.Secret} {
+		probe, err := s.AuthenticateProbe("probe-1", secret)
+		if err != nil {
+			t.Fatalf("AuthenticateProbe: %v", err)
+		}
+		if probe == nil || probe.PreviousSecretValidUntil == nil {
+			t.Fatalf("AuthenticateProbe = %+v, want probe inside rotation grace", probe)
+		}
+	}
+	signed, err := s.AuthenticateProbeSignature("probe-1", func(key string) bool {
+		return key == probeauth.VerifyKey(credential.Secret)
+	})
+	if err != nil || signed == nil {
+		t.Fatalf("AuthenticateProbeSignature previous = %+v, %v, want probe", signed, err)
+	}
+
+	if _, err := s.RotateProbeSecret("probe-1", 0); err != nil {
+		t.Fatalf("RotateProbeSecret without grace: %v", err)
+	}
+	for _, secret := range []string{credential.Secret, rotation.Secret} {
+		probe, err := s.AuthenticateProbe("probe-1", secret)
+		if err != nil {
+			t.Fatalf("AuthenticateProbe: %v", err)
+		}
+		if probe != nil {
+			t.Fatal("expected rotated-out secrets to be rejected after a rotation without grace")
+		}
+	}
+
+	missing, err := s.RotateProbeSecret("missing", time.Hour)
+	if err != nil || missing != nil {
+		t.Fatalf("RotateProbeSecret missing = %+v, %v, want nil", missing, err)
+	}
+}
+
+func TestRevokeProbe_DisablesApiProbeOnly(t *testing.T) {
+	s := newTestStore(t)
+
+	if err := s.SeedProbes([]ProbeSeed{{ProbeID: "seeded", Secret: "secret-1"}}); err != nil {
+		t.Fatalf("SeedProbes: %v", err)
+	}
+	credential, err := s.CreateProbeCredential("probe-1", 0)
+	if err != nil {
+		t.Fatalf("CreateProbeCredential: %v", err)
+	}
+
+	if _, err := s.RevokeProbe("seeded"); !errors.Is(err, ErrProbeConfigManaged) {
+		t.Fatalf("RevokeProbe seeded error = %v, want %v", err, ErrProbeConfigManaged)
+	}
+	if _, err := s.RotateProbeSecret("seeded", time.Hour); !errors.Is(err, ErrProbeConfigManaged) {
+		t.Fatalf("RotateProbeSecret seeded error = %v, want %v", err, ErrProbeConfigManaged)
+	}
+
+	revoked, err := s.RevokeProbe("probe-1")
+	if err != nil {
+		t.Fatalf("RevokeProbe: %v", err)
+	}
+	if revoked == nil || revoked.RevokedAt == nil {
+		t.Fatalf("RevokeProbe = %+v, want revoked probe", revoked)
+	}
+	probe, err := s.AuthenticateProbe("probe-1", credential.Secret)
+	if err != nil || probe != nil {
+		t.Fatalf("AuthenticateProbe revoked = %+v, %v, want nil", probe, err)
+	}
+	again, err := s.RevokeProbe("probe-1")
+	if err != nil || again == nil || again.RevokedAt == nil || !again.RevokedAt.Equal(*revoked.RevokedAt) {
+		t.Fatalf("RevokeProbe again = %+v, %v, want the already revoked probe", again, err)
+	}
+	missing, err := s.RevokeProbe("missing")
+	if err != nil || missing != nil {
+		t.Fatalf("RevokeProbe missing = %+v, %v, want nil", missing, err)
+	}
+
+	all, err := s.ListAllProbes()
+	if err != nil {
+		t.Fatalf("ListAllProbes: %v", err)
+	}
+	if len(all) != 2 || all[0].ProbeID != "probe-1" || all[0].RevokedAt == nil || all[1].ProvisionedBy != "config" {
+		t.Fatalf("ListAllProbes = %+v, want revoked probe-1 and seeded", all)
+	}
+}
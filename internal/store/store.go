@@ -19,7 +19,8 @@ var migrationsFS embed.FS
 
 // Store handles persistence for metadata, incidents, and monitoring recovery.
 type Store struct {
-	db *sql.DB
+	db  *sql.DB
+	dsn string
 }
 
 // New opens the Postgres database and runs any pending migrations.
@@ -34,7 +35,7 @@ func New(dsn string) (*Store, error) {
 	}
 
 	log.Printf("store: database ready")
-	return &Store{db: db}, nil
+	return &Store{db: db, dsn: dsn}, nil
 }
 
 func runMigrations(db *sql.DB) error {
@@ -158,10 +159,10 @@ func (s *Store) PublicStatusCheckViews(slug string) ([]PublicStatusCheckView, bo
 func (s *Store) SeedChecks(checks []checks.Check, userID int64) error {
 	for _, c := range checks {
 		_, err := s.db.Exec(`
-			INSERT INTO checks (name, type, target, webhook, user_id, interval_seconds)
-			VALUES ($1, $2, $3, $4, NULLIF($5, 0), $6)
+			INSERT INTO checks (name, type, target, webhook, user_id, interval_seconds, webhook_version, probe_selector, private, retries, tls, send, expect, expect_mode, read_timeout_ms)
+			VALUES ($1, $2, $3, $4, NULLIF($5, 0), $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
 			ON CONFLICT DO NOTHING
-		`, c.Name, string(c.Type), c.Target, c.Webhook, userID, c.Interval)
+		`, c.Name, string(c.Type), c.Target, c.Webhook, userID, c.Interval, webhookVersion(c), c.ProbeSelector, c.Private, c.Retries, c.TLS, c.Send, c.Expect, c.ExpectMode, c.ReadTimeoutMS)
 		if err != nil {
 			return err
 		}
@@ -172,7 +173,7 @@ func (s *Store) SeedChecks(checks []checks.Check, userID int64) error {
 // ListChecks returns all checks owned by userID.
 func (s *Store) ListChecks(userID int64) ([]checks.Check, error) {
 	rows, err := s.db.Query(`
-		SELECT id::text, name, type, target, webhook, interval_seconds
+		SELECT `+checkColumns+`
 		FROM checks
 		WHERE user_id = $1
 		  AND deleted_at IS NULL
@@ -197,7 +198,7 @@ func (s *Store) ListChecks(userID int64) ([]checks.Check, error) {
 // ListAllChecks returns all checks regardless of owner. Used by probes.
 func (s *Store) ListAllChecks() ([]checks.Check, error) {
 	rows, err := s.db.Query(`
-		SELECT id::text, name, type, target, webhook, interval_seconds
+		SELECT ` + checkColumns + `
 		FROM checks
 		WHERE deleted_at IS NULL
 		ORDER BY name, id
@@ -222,7 +223,7 @@ func (s *Store) ListAllChecks() ([]checks.Check, error) {
 // human-facing name, or (nil, nil) if not found.
 func (s *Store) GetCheckByName(name string, userID int64) (*checks.Check, error) {
 	c, err := scanCheck(s.db.QueryRow(`
-		SELECT id::text, name, type, target, webhook, interval_seconds
+		SELECT `+checkColumns+`
 		FROM checks
 		WHERE name = $1
 		  AND user_id = $2
@@ -246,7 +247,7 @@ func (s *Store) GetCheckByID(id string) (*checks.Check, error) {
 	}
 
 	c, err := scanCheck(s.db.QueryRow(`
-		SELECT id::text, name, type, target, webhook, interval_seconds
+		SELECT `+checkColumns+`
 		FROM checks
 		WHERE id = $1
 		  AND deleted_at IS NULL
@@ -264,29 +265,42 @@ func (s *Store) GetCheckByID(id string) (*checks.Check, error) {
 // stable ID populated.
 func (s *Store) CreateCheck(c checks.Check, userID int64) (checks.Check, error) {
 	err := s.db.QueryRow(`
-		INSERT INTO checks (name, type, target, webhook, user_id, interval_seconds)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO checks (name, type, target, webhook, user_id, interval_seconds, webhook_version, probe_selector, private, retries, tls, send, expect, expect_mode, read_timeout_ms)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
 		RETURNING id::text
-	`, c.Name, string(c.Type), c.Target, c.Webhook, userID, c.Interval).Scan(&c.ID)
+	`, c.Name, string(c.Type), c.Target, c.Webhook, userID, c.Interval, webhookVersion(c), c.ProbeSelector, c.Private, c.Retries, c.TLS, c.Send, c.Expect, c.ExpectMode, c.ReadTimeoutMS).Scan(&c.ID)
 	if err != nil {
 		return checks.Check{}, err
 	}
+	c.OwnerID = userID
 	return c, nil
 }
 
-// UpdateCheck replaces type, target, webhook, and interval_seconds for a check owned by userID.
+// UpdateCheck replaces type, target, webhook, interval_seconds,
+// webhook_version, probe_selector, private, retries, and the tcp-expect
+// exchange for a check owned by userID.
 func (s *Store) UpdateCheck(c checks.Check, userID int64) error {
 	_, err := s.db.Exec(`
 		UPDATE checks
-		SET type = $1, target = $2, webhook = $3, interval_seconds = $4
-		WHERE name = $5
-		  AND user_id = $6
+		SET type = $1, target = $2, webhook = $3, interval_seconds = $4, webhook_version = $5, probe_selector = $6, private = $7, retries = $8,
+		    tls = $9, send = $10, expect = $11, expect_mode = $12, read_timeout_ms = $13
+		WHERE name = $14
+		  AND user_id = $15
 		  AND deleted_at IS NULL
 	`,
-		string(c.Type), c.Target, c.Webhook, c.Interval, c.Name, userID)
+		string(c.Type), c.Target, c.Webhook, c.Interval, webhookVersion(c), c.ProbeSelector, c.Private, c.Retries,
+		c.TLS, c.Send, c.Expect, c.ExpectMode, c.ReadTimeoutMS, c.Name, userID)
 	return err
 }
 
+// webhookVersion maps an unset payload version to the legacy v1 schema.
+func webhookVersion(c checks.Check) int {
+	if c.WebhookVersion == 0 {
+		return checks.WebhookPayloadV1
+	}
+	return c.WebhookVersion
+}
+
 // DeleteCheck removes a check owned by userID. It returns whether an active
 // owned check was deleted plus the deleted check's stable ID so callers can
 // evict matching in-memory state. Unauthorized, missing, or already-deleted
@@ -366,6 +380,7 @@ type Incident struct {
 	CheckName        string
 	StartedAt        time.Time
 	ResolvedAt       *time.Time
+	ProbableCause    string
 	DownNotification *IncidentNotification
 	UpNotification   *IncidentNotification
 }
@@ -380,6 +395,7 @@ func (s *Store) ListIncidents(userID int64, limit int) ([]Incident, error) {
 			c.name,
 			i.started_at,
 			i.resolved_at,
+			i.probable_cause,
 			down_n.id,
 			down_n.state,
 			down_n.attempts,
@@ -427,6 +443,7 @@ func (s *Store) ListIncidents(userID int64, limit int) ([]Incident, error) {
 			&inc.CheckName,
 			&inc.StartedAt,
 			&inc.ResolvedAt,
+			&inc.ProbableCause,
 			&downID,
 			&downState,
 			&downAttempts,
@@ -456,6 +473,9 @@ func (s *Store) Close() error {
 	return s.db.Close()
 }
 
+// checkColumns is the column list scanCheck expects, in order.
+const checkColumns = `id::text, name, type, target, webhook, interval_seconds, webhook_version, probe_selector, private, retries, tls, send, expect, expect_mode, read_timeout_ms, COALESCE(user_id, 0)`
+
 type rowScanner interface {
 	Scan(dest ...any) error
 }
@@ -464,7 +484,7 @@ type rowScanner interface {
 func scanCheck(scanner rowScanner) (checks.Check, error) {
 	var c checks.Check
 	var checkType string
-	if err := scanner.Scan(&c.ID, &c.Name, &checkType, &c.Target, &c.Webhook, &c.Interval); err != nil {
+	if err := scanner.Scan(&c.ID, &c.Name, &checkType, &c.Target, &c.Webhook, &c.Interval, &c.WebhookVersion, &c.ProbeSelector, &c.Private, &c.Retries, &c.TLS, &c.Send, &c.Expect, &c.ExpectMode, &c.ReadTimeoutMS, &c.OwnerID); err != nil {
 		return checks.Check{}, err
 	}
 	c.Type = checks.Type(checkType)
@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"os"
 	"sync"
 	"testing"
@@ -58,7 +59,7 @@ func newTestStore(t *testing.T) *Store {
 
 	// Wipe all tables so tests don't interfere with each other.
 	_, err = s.db.Exec(`
-		TRUNCATE check_probe_state, incident_notifications, signup_requests, incidents, sessions, checks, users, probes RESTART IDENTITY CASCADE
+		TRUNCATE check_probe_state, incident_evidence, incident_notifications, signup_requests, incidents, sessions, checks, users, probe_join_tokens, probes RESTART IDENTITY CASCADE
 	`)
 	if err != nil {
 		t.Fatalf("truncate tables: %v", err)
@@ -330,6 +331,175 @@ func TestOpenIncidentWithNotification_CreatesDurableDownNotification(t *testing.
 	}
 }
 
+func TestClaimDueIncidentNotificationGroup_WaitsForWindowAndGroupsByDestination(t *testing.T) {
+	s := newTestStore(t)
+
+	user, err := s.CreateUser("notify-group@example.com", "pass", false)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	for _, check := range []checks.Check{
+		testCheckWithWebhook("check-1", "http", "https://one.example.com", "https://hooks.example.com/shared", 30),
+		testCheckWithWebhook("check-2", "http", "https://two.example.com", "https://hooks.example.com/shared", 30),
+		testCheckWithWebhook("check-3", "http", "https://three.example.com", "https://hooks.example.com/other", 30),
+	} {
+		if _, err := s.CreateCheck(check, user.ID); err != nil {
+			t.Fatalf("CreateCheck(%s): %v", check.Name, err)
+		}
+		if _, err := openIncidentWithNotificationForTest(s, check.Name, &NotificationRequest{
+			WebhookURL: check.Webhook,
+			Payload:    []byte(`{"status":"down"}`),
+		}); err != nil {
+			t.Fatalf("OpenIncidentWithNotification(%s): %v", check.Name, err)
+		}
+	}
+
+	now := time.Now().UTC()
+	jobs, err := s.ClaimDueIncidentNotificationGroup(now, now.Add(-time.Minute), now.Add(-30*time.Second), 10)
+	if err != nil {
+		t.Fatalf("ClaimDueIncidentNotificationGroup inside window: %v", err)
+	}
+	if len(jobs) != 0 {
+		t.Fatalf("claimed %d jobs inside grouping window, want 0", len(jobs))
+	}
+
+	later := now.Add(time.Minute)
+	jobs, err = s.ClaimDueIncidentNotificationGroup(later, later.Add(-time.Minute), later.Add(-30*time.Second), 10)
+	if err != nil {
+		t.Fatalf("ClaimDueIncidentNotificationGroup: %v", err)
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("claimed %d jobs, want 2 for the first destination", len(jobs))
+	}
+	for _, job := range jobs {
+		if job.WebhookURL != "https://hooks.example.com/shared" {
+			t.Fatalf("job webhook = %q, want shared destination", job.WebhookURL)
+		}
+		if job.Attempts != 1 {
+			t.Fatalf("job attempts = %d, want 1", job.Attempts)
+		}
+	}
+
+	jobs, err = s.ClaimDueIncidentNotificationGroup(later, later.Add(-time.Minute), later.Add(-30*time.Second), 10)
+	if err != nil {
+		t.Fatalf("ClaimDueIncidentNotificationGroup second destination: %v", err)
+	}
+	if len(jobs) != 1 || jobs[0].WebhookURL != "https://hooks.example.com/other" {
+		t.Fatalf("jobs = %+v, want the other destination on its own", jobs)
+	}
+}
+
+func TestListenIncidentNotifications_WakesOnQueuedNotification(t *testing.T) {
+	s := newTestStore(t)
+
+	user, err := s.CreateUser("notify-listen@example.com", "pass", false)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, err := s.CreateCheck(testCheckWithWebhook("check-1", "http", "https://example.com", "https://hooks.example.com/wacht", 30), user.ID); err != nil {
+		t.Fatalf("CreateCheck: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	wakes := make(chan struct{}, 4)
+	done := make(chan error, 1)
+	go func() {
+		done <- s.ListenIncidentNotifications(ctx, func() { wakes <- struct{}{} })
+	}()
+
+	select {
+	case <-wakes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener did not report LISTEN readiness")
+	}
+
+	if _, err := openIncidentWithNotificationForTest(s, "check-1", &NotificationRequest{
+		WebhookURL: "https://hooks.example.com/wacht",
+		Payload:    []byte(`{"status":"down"}`),
+	}); err != nil {
+		t.Fatalf("OpenIncidentWithNotification: %v", err)
+	}
+
+	select {
+	case <-wakes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener was not woken by queued notification")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener did not stop after cancel")
+	}
+}
+
+func TestIncidentNotification_IncludeIncidentAddsCorrelationFields(t *testing.T) {
+	s := newTestStore(t)
+
+	user, err := s.CreateUser("notify-v2@example.com", "pass", false)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	check := testCheckWithWebhook("check-1", "http", "https://example.com", "https://hooks.example.com/wacht", 30)
+	check.WebhookVersion = checks.WebhookPayloadV2
+	if _, err := s.CreateCheck(check, user.ID); err != nil {
+		t.Fatalf("CreateCheck: %v", err)
+	}
+
+	request := func(status string) *NotificationRequest {
+		return &NotificationRequest{
+			WebhookURL:      "https://hooks.example.com/wacht",
+			Payload:         []byte(`{"schema_version":2,"status":"` + status + `"}`),
+			IncludeIncident: true,
+		}
+	}
+	if _, err := openIncidentWithNotificationForTest(s, "check-1", request("down")); err != nil {
+		t.Fatalf("OpenIncidentWithNotification: %v", err)
+	}
+	if _, err := resolveIncidentWithNotificationForTest(s, "check-1", request("up")); err != nil {
+		t.Fatalf("ResolveIncidentWithNotification: %v", err)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT event, payload::text
+		FROM incident_notifications
+		ORDER BY id
+	`)
+	if err != nil {
+		t.Fatalf("Query incident_notifications: %v", err)
+	}
+	defer rows.Close()
+
+	payloads := map[string]struct {
+		SchemaVersion int                  `json:"schema_version"`
+		Incident      NotificationIncident `json:"incident"`
+	}{}
+	for rows.Next() {
+		var event, raw string
+		if err := rows.Scan(&event, &raw); err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		payload := payloads[event]
+		if err := json.Unmarshal([]byte(raw), &payload); err != nil {
+			t.Fatalf("Unmarshal %s payload: %v", event, err)
+		}
+		payloads[event] = payload
+	}
+
+	down, up := payloads[notificationEventDown], payloads[notificationEventUp]
+	if down.SchemaVersion != 2 || down.Incident.ID == 0 || down.Incident.StartedAt == "" || down.Incident.ResolvedAt != nil {
+		t.Fatalf("down payload = %+v, want open incident block", down)
+	}
+	if up.Incident.ID != down.Incident.ID || up.Incident.StartedAt != down.Incident.StartedAt {
+		t.Fatalf("up incident = %+v, want same incident as down %+v", up.Incident, down.Incident)
+	}
+	if up.Incident.ResolvedAt == nil || up.Incident.DurationMs == nil || *up.Incident.DurationMs < 0 {
+		t.Fatalf("up incident = %+v, want resolved time and duration", up.Incident)
+	}
+}
+
 func TestResolveIncidentWithNotification_SupersedesPendingDownNotification(t *testing.T) {
 	s := newTestStore(t)
 
@@ -427,6 +597,65 @@ func TestMarkIncidentNotificationRetry_SupersedesDownAfterResolve(t *testing.T)
 	}
 }
 
+func TestReleaseIncidentNotification_KeepsPreviousAttemptTime(t *testing.T) {
+	s := newTestStore(t)
+
+	user, err := s.CreateUser("notify-release@example.com", "pass", false)
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if _, err := s.CreateCheck(testCheckWithWebhook("check-1", "http", "https://example.com", "https://hooks.example.com/wacht", 30), user.ID); err != nil {
+		t.Fatalf("CreateCheck: %v", err)
+	}
+	if _, err := openIncidentWithNotificationForTest(s, "check-1", &NotificationRequest{
+		WebhookURL: "https://hooks.example.com/wacht",
+		Payload:    []byte(`{"status":"down"}`),
+	}); err != nil {
+		t.Fatalf("OpenIncidentWithNotification: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	jobs, err := s.ClaimDueIncidentNotifications(now, now.Add(-time.Minute), 1)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("ClaimDueIncidentNotifications = %d jobs, %v; want 1", len(jobs), err)
+	}
+	if err := s.MarkIncidentNotificationRetry(jobs[0].ID, now, now, "boom"); err != nil {
+		t.Fatalf("MarkIncidentNotificationRetry: %v", err)
+	}
+
+	claimedAt := now.Add(time.Minute)
+	jobs, err = s.ClaimDueIncidentNotifications(claimedAt, claimedAt.Add(-time.Minute), 1)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("second ClaimDueIncidentNotifications = %d jobs, %v; want 1", len(jobs), err)
+	}
+	if err := s.ReleaseIncidentNotification(jobs[0].ID, claimedAt, claimedAt.Add(time.Minute)); err != nil {
+		t.Fatalf("ReleaseIncidentNotification: %v", err)
+	}
+
+	var (
+		state         string
+		attempts      int
+		lastAttemptAt time.Time
+		claimed       sql.NullTime
+	)
+	if err := s.db.QueryRow(`
+		SELECT state, attempts, last_attempt_at, claimed_at
+		FROM incident_notifications
+		WHERE id = $1
+	`, jobs[0].ID).Scan(&state, &attempts, &lastAttemptAt, &claimed); err != nil {
+		t.Fatalf("query notification: %v", err)
+	}
+	if state != notificationStateRetrying || attempts != 1 {
+		t.Fatalf("state = %q attempts = %d, want retrying after 1 attempt", state, attempts)
+	}
+	if !lastAttemptAt.Equal(now) {
+		t.Fatalf("last_attempt_at = %v, want the real attempt at %v", lastAttemptAt, now)
+	}
+	if claimed.Valid {
+		t.Fatalf("claimed_at = %v, want NULL after release", claimed.Time)
+	}
+}
+
 func TestMarkIncidentNotificationDelivered_DoesNotOverrideSupersededDownNotification(t *testing.T) {
 	s := newTestStore(t)
 
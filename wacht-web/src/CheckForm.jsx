@@ -9,15 +9,49 @@ export default function CheckForm({ initial, onSave, onCancel, onDelete }) {
   const [target, setTarget] = useState(initial?.target ?? '')
   const [webhook, setWebhook] = useState(initial?.webhook ?? '')
   const [interval, setInterval] = useState(initial?.interval ?? 30)
+  const [webhookVersion, setWebhookVersion] = useState(initial?.webhook_version ?? 1)
   const [saving, setSaving] = useState(false)
+  const [running, setRunning] = useState(false)
+  const [run, setRun] = useState(null)
   const [err, setErr] = useState(null)
 
+  function checkBody() {
+    return JSON.stringify({
+      name,
+      type,
+      target,
+      webhook,
+      interval: parseInt(interval, 10),
+      webhook_version: parseInt(webhookVersion, 10),
+    })
+  }
+
+  // Runs the form's current definition on every online probe without saving
+  // it. Results are ad hoc and do not affect the check's status.
+  async function handleRun() {
+    setErr(null)
+    setRun(null)
+    setRunning(true)
+    try {
+      const res = await fetch(`${API_URL}/api/checks/run`, { method: 'POST', headers: authHeaders(), body: checkBody() })
+      if (!res.ok) {
+        const text = await res.text()
+        throw new Error(text.trim() || `HTTP ${res.status}`)
+      }
+      setRun(await res.json())
+    } catch (e) {
+      setErr(e.message)
+    } finally {
+      setRunning(false)
+    }
+  }
+
   async function handleSubmit(e) {
     e.preventDefault()
     setErr(null)
     setSaving(true)
     try {
-      const body = JSON.stringify({ name, type, target, webhook, interval: parseInt(interval, 10) })
+      const body = checkBody()
       const res = isNew
         ? await fetch(`${API_URL}/api/checks`, { method: 'POST', headers: authHeaders(), body })
         : await fetch(`${API_URL}/api/checks/${encodeURIComponent(initial.name)}`, { method: 'PUT', headers: authHeaders(), body })
@@ -72,6 +106,13 @@ export default function CheckForm({ initial, onSave, onCancel, onDelete }) {
             className={ui.inputSm}
           />
         </div>
+        <div>
+          <label className={ui.label}>Webhook payload</label>
+          <select value={webhookVersion} onChange={e => setWebhookVersion(e.target.value)} className={ui.select}>
+            <option value={1}>v1 (legacy)</option>
+            <option value={2}>v2 (incident, probes, timestamps)</option>
+          </select>
+        </div>
         <div>
           <label className={ui.label}>Interval <span className="text-gray-600">(seconds)</span></label>
           <input
@@ -85,10 +126,25 @@ export default function CheckForm({ initial, onSave, onCancel, onDelete }) {
         </div>
       </div>
       {err && <p className={`mt-2 ${ui.errorText}`}>{err}</p>}
+      {run && (
+        <ul className="mt-2 space-y-0.5">
+          {run.results.map(r => (
+            <li key={r.probe_id} className="font-mono text-xs text-gray-400">
+              {r.probe_id}{' '}
+              <span className={r.status === 'up' ? ui.successText : r.status === 'down' ? ui.errorText : 'text-gray-500'}>{r.status}</span>
+              {r.latency_ms != null && ` ${r.latency_ms}ms`}
+              {r.error && ` ${r.error}`}
+            </li>
+          ))}
+        </ul>
+      )}
       <div className="mt-3 flex items-center gap-2">
         <button type="submit" disabled={saving} className={ui.btn.primary}>
           {saving ? 'Saving…' : isNew ? 'Add check' : 'Save'}
         </button>
+        <button type="button" onClick={handleRun} disabled={running || !target} className={ui.btn.secondary}>
+          {running ? 'Running…' : 'Run now'}
+        </button>
         <button type="button" onClick={onCancel} className={ui.btn.secondary}>
           Cancel
         </button>